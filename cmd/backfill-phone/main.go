@@ -0,0 +1,113 @@
+// Command backfill-phone adds a generated E.164 column next to every raw phone
+// column of the tenant tables (contacts.phone_number, chats.phone_number,
+// messages.from_phone / to_phone) and indexes it. Postgres fills existing rows
+// while adding the column and keeps new rows in sync, so it only needs to run
+// once per tenant, or again with -rebuild after changing a tenant's phone region.
+//
+// Usage:
+//
+//	go run ./cmd/backfill-phone [-companies=a,b] [-rebuild] [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/config"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/logger"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/phone"
+	"go.uber.org/zap"
+)
+
+func main() {
+	companies := flag.String("companies", "", "comma-separated company IDs (default: every tenant schema)")
+	rebuild := flag.Bool("rebuild", false, "drop and recreate existing normalized columns (after a region change)")
+	dryRun := flag.Bool("dry-run", false, "print the statements without executing them")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	log := logger.NewLogger()
+	defer log.Sync()
+
+	phone.Configure(cfg.PhoneDefaultRegion, cfg.PhoneTenantRegions)
+
+	if err := database.ConnectGORM(cfg.PgDsn, log); err != nil {
+		log.Fatal("Cannot initialize database", zap.Error(err))
+	}
+
+	ctx := context.Background()
+
+	tenants, err := database.ListTenants(ctx)
+	if err != nil {
+		log.Fatal("Cannot list tenants", zap.Error(err))
+	}
+	if *companies != "" {
+		tenants = strings.Split(*companies, ",")
+	}
+
+	failed := 0
+	for _, companyId := range tenants {
+		companyId = strings.TrimSpace(companyId)
+		if companyId == "" {
+			continue
+		}
+		if err := backfillTenant(ctx, companyId, *rebuild, *dryRun); err != nil {
+			failed++
+			log.Error("Backfill failed", zap.String("company_id", companyId), zap.Error(err))
+			continue
+		}
+		log.Info("Backfill done", zap.String("company_id", companyId), zap.String("region", phone.RegionFor(companyId)))
+	}
+
+	if failed > 0 {
+		log.Fatal("Backfill finished with errors", zap.Int("failed_tenants", failed))
+	}
+}
+
+// backfillTenant adds the normalized columns to one tenant's tables.
+func backfillTenant(ctx context.Context, companyId string, rebuild, dryRun bool) error {
+	schema := database.TenantSchema(companyId)
+	region := phone.RegionFor(companyId)
+
+	for table, phoneColumns := range repository.PhoneColumns {
+		var exists int64
+		if err := database.DB.WithContext(ctx).
+			Raw(`SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = ?`, schema, table).
+			Scan(&exists).Error; err != nil {
+			return err
+		}
+		if exists == 0 {
+			continue
+		}
+
+		qualified := fmt.Sprintf(`"%s"."%s"`, schema, table)
+		for _, column := range phoneColumns {
+			normalized := repository.NormalizedPhoneColumn(column)
+
+			var stmts []string
+			if rebuild {
+				stmts = append(stmts, fmt.Sprintf(`ALTER TABLE %s DROP COLUMN IF EXISTS %s`, qualified, normalized))
+			}
+			stmts = append(stmts,
+				fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s TEXT GENERATED ALWAYS AS (%s) STORED`,
+					qualified, normalized, phone.SQLExpr(column, region)),
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_%s_idx ON %s (%s)`, table, normalized, qualified, normalized),
+			)
+
+			for _, stmt := range stmts {
+				if dryRun {
+					fmt.Println(stmt + ";")
+					continue
+				}
+				if err := database.DB.WithContext(ctx).Exec(stmt).Error; err != nil {
+					return fmt.Errorf("%s.%s: %w", table, normalized, err)
+				}
+			}
+		}
+	}
+	return nil
+}
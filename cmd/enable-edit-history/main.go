@@ -0,0 +1,96 @@
+// Command enable-edit-history creates the message_edits table of every tenant and
+// the trigger on its messages table that records each edit. Creating the trigger
+// locks the messages table, so this runs once per tenant from a deploy step against
+// the primary, not from the API replicas. It is idempotent: run it again for new tenants.
+//
+// Usage:
+//
+//	go run ./cmd/enable-edit-history [-companies=a,b] [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/config"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func main() {
+	companies := flag.String("companies", "", "comma-separated company IDs (default: every tenant schema)")
+	dryRun := flag.Bool("dry-run", false, "print the statements without executing them")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	log := logger.NewLogger()
+	defer log.Sync()
+
+	if err := database.ConnectGORM(cfg.PgDsn, log); err != nil {
+		log.Fatal("Cannot initialize database", zap.Error(err))
+	}
+
+	ctx := context.Background()
+
+	tenants, err := database.ListTenants(ctx)
+	if err != nil {
+		log.Fatal("Cannot list tenants", zap.Error(err))
+	}
+	if *companies != "" {
+		tenants = strings.Split(*companies, ",")
+	}
+
+	failed := 0
+	for _, companyId := range tenants {
+		companyId = strings.TrimSpace(companyId)
+		if companyId == "" {
+			continue
+		}
+		if err := enableTenant(ctx, companyId, *dryRun); err != nil {
+			failed++
+			log.Error("Enabling edit history failed", zap.String("company_id", companyId), zap.Error(err))
+			continue
+		}
+		log.Info("Edit history enabled", zap.String("company_id", companyId))
+	}
+
+	if failed > 0 {
+		log.Fatal("Finished with errors", zap.Int("failed_tenants", failed))
+	}
+}
+
+// enableTenant runs the edit history statements for one tenant in a transaction,
+// skipping tenants without a messages table.
+func enableTenant(ctx context.Context, companyId string, dryRun bool) error {
+	var exists int64
+	if err := database.DB.WithContext(ctx).
+		Raw(`SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'messages'`,
+			database.TenantSchema(companyId)).
+		Scan(&exists).Error; err != nil {
+		return err
+	}
+	if exists == 0 {
+		return nil
+	}
+
+	stmts := repository.EditHistoryDDL(companyId)
+	if dryRun {
+		for _, stmt := range stmts {
+			fmt.Println(stmt + ";")
+		}
+		return nil
+	}
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range stmts {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,90 @@
+// Command index-message-threads adds to every tenant's messages table the partial
+// expression indexes on reaction and reply targets that the reactions of normalized
+// message lists and GET /messages/:message_id/replies rely on. Building them scans
+// the table, so this runs once per tenant from a deploy step, not from the API. It is
+// idempotent: run it again for new tenants.
+//
+// Usage:
+//
+//	go run ./cmd/index-message-threads [-companies=a,b] [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/config"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/logger"
+	"go.uber.org/zap"
+)
+
+func main() {
+	companies := flag.String("companies", "", "comma-separated company IDs (default: every tenant schema)")
+	dryRun := flag.Bool("dry-run", false, "print the statements without executing them")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	log := logger.NewLogger()
+	defer log.Sync()
+
+	if err := database.ConnectGORM(cfg.PgDsn, log); err != nil {
+		log.Fatal("Cannot initialize database", zap.Error(err))
+	}
+
+	ctx := context.Background()
+
+	tenants, err := database.ListTenants(ctx)
+	if err != nil {
+		log.Fatal("Cannot list tenants", zap.Error(err))
+	}
+	if *companies != "" {
+		tenants = strings.Split(*companies, ",")
+	}
+
+	failed := 0
+	for _, companyId := range tenants {
+		companyId = strings.TrimSpace(companyId)
+		if companyId == "" {
+			continue
+		}
+		if err := indexTenant(ctx, companyId, *dryRun); err != nil {
+			failed++
+			log.Error("Indexing message threads failed", zap.String("company_id", companyId), zap.Error(err))
+			continue
+		}
+		log.Info("Message threads indexed", zap.String("company_id", companyId))
+	}
+
+	if failed > 0 {
+		log.Fatal("Finished with errors", zap.Int("failed_tenants", failed))
+	}
+}
+
+// indexTenant creates the indexes of one tenant, skipping tenants without a messages table.
+func indexTenant(ctx context.Context, companyId string, dryRun bool) error {
+	var exists int64
+	if err := database.DB.WithContext(ctx).
+		Raw(`SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'messages'`,
+			database.TenantSchema(companyId)).
+		Scan(&exists).Error; err != nil {
+		return err
+	}
+	if exists == 0 {
+		return nil
+	}
+
+	for _, stmt := range repository.MessageThreadIndexDDL(companyId) {
+		if dryRun {
+			fmt.Println(stmt + ";")
+			continue
+		}
+		if err := database.DB.WithContext(ctx).Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,19 +2,26 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/config"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/handler"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/media"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/middleware"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/ratelimit"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/routes"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/storage"
 	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/logger"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/phone"
 	"go.uber.org/zap"
 )
 
@@ -26,26 +33,103 @@ func main() {
 	log := logger.NewLogger()
 	defer log.Sync()
 
+	// Regions used to normalize phone numbers to E.164
+	phone.Configure(cfg.PhoneDefaultRegion, cfg.PhoneTenantRegions)
+
 	// Connect to Postgres using the full DSN from env (POSTGRES_DSN)
 	if err := database.ConnectGORM(cfg.PgDsn, log); err != nil {
 		log.Fatal("Cannot initialize database", zap.Error(err))
 	}
 
+	// Response cache, shared by the replicas when kept in Redis
+	cacheStore, err := newCacheStore(cfg)
+	if err != nil {
+		log.Fatal("Cannot initialize cache", zap.Error(err))
+	}
+	defer cacheStore.Close()
+	cache.Configure(cacheStore, cfg.CacheTTL, func(err error) {
+		log.Warn("Response cache unavailable", zap.Error(err))
+	})
+
 	// Repo + Service Registration
 	agentRepo := repository.NewAgentRepository()
 	chatRepo := repository.NewChatRepository()
 	messageRepo := repository.NewMessageRepository()
 	contactRepo := repository.NewContactRepository()
+	auditRepo := repository.NewAuditRepository()
+	analyticsRepo := repository.NewAnalyticsRepository()
+	exportRepo := repository.NewExportRepository()
+	retentionRepo := repository.NewRetentionRepository()
+	privacyRepo := repository.NewPrivacyRepository()
+	archiveRepo := repository.NewArchiveRepository()
+	// Idempotency-Keys, shared by the replicas through Postgres or Redis
+	idempotencyRepo, err := newIdempotencyRepository(cfg)
+	if err != nil {
+		log.Fatal("Cannot initialize idempotency store", zap.Error(err))
+	}
+	defer idempotencyRepo.Close()
+	rateLimitRepo := repository.NewRateLimitRepository()
+
+	// Request counters of the rate limiter, shared by the replicas when kept in Redis
+	rateLimitStore, err := newRateLimitStore(cfg)
+	if err != nil {
+		log.Fatal("Cannot initialize rate limiter", zap.Error(err))
+	}
+	defer rateLimitStore.Close()
+
+	// Blob storage for media (local filesystem under STORAGE_DIR)
+	store, err := storage.NewLocalStore(cfg.StorageDir)
+	if err != nil {
+		log.Fatal("Cannot initialize storage", zap.Error(err))
+	}
+	// Message archives may live on a separate, cheaper volume (ARCHIVE_DIR)
+	archiveStore, err := storage.NewLocalStore(cfg.ArchiveDir)
+	if err != nil {
+		log.Fatal("Cannot initialize archive storage", zap.Error(err))
+	}
+
+	// Media URLs get their own secret, so leaking one never exposes the other
+	if cfg.MediaURLSecret == cfg.SecretKey {
+		log.Fatal("MEDIA_URL_SECRET must differ from SECRET_KEY")
+	}
+	signer, err := media.NewSigner(cfg.MediaURLSecret, cfg.MediaURLTTL, cfg.MediaBaseURL)
+	if err != nil {
+		log.Fatal("Cannot initialize media signer", zap.Error(err))
+	}
+	if cfg.PrivacyHashSecret == "" || cfg.PrivacyHashSecret == cfg.SecretKey {
+		log.Fatal("PRIVACY_HASH_SECRET is required and must differ from SECRET_KEY")
+	}
 
-	agentSvc := service.NewAgentService(agentRepo)
+	agentSvc := service.NewAgentService(agentRepo, cfg.AgentStaleAfter, cfg.AgentQRTTL)
 	chatSvc := service.NewChatService(chatRepo)
-	messageSvc := service.NewMessageService(messageRepo)
+	mediaSvc := service.NewMediaService(messageRepo, store, signer)
+	archiveSvc := service.NewArchiveService(archiveRepo, archiveStore)
+	messageSvc := service.NewMessageService(messageRepo, mediaSvc, archiveSvc)
 	contactSvc := service.NewContactService(contactRepo)
+	transcriptSvc := service.NewTranscriptService(chatRepo, messageRepo, agentRepo, archiveSvc)
+	exportSvc := service.NewExportService(exportRepo, store, cfg.ExportWorkers)
+	retentionSvc := service.NewRetentionService(retentionRepo, archiveSvc)
+	privacySvc := service.NewPrivacyService(privacyRepo, store, archiveSvc, cfg.PrivacyHashSecret)
+	auditSvc := service.NewAuditService(auditRepo)
+	idempotencySvc := service.NewIdempotencyService(idempotencyRepo, cfg.IdempotencyTTL, cfg.IdempotencyLockTimeout)
+	rateLimitSvc := service.NewRateLimitService(rateLimitRepo, rateLimitStore, defaultRateLimit(cfg))
+	analyticsSvc := service.NewAnalyticsService(analyticsRepo,
+		cfg.StatsCacheTTL, cfg.StatsViewsRefreshInterval > 0, cfg.SLAResponseThreshold)
 
+	handler.RegisterLogger(log)
 	handler.RegisterAgentService(agentSvc)
 	handler.RegisterChatService(chatSvc)
 	handler.RegisterMessageService(messageSvc)
+	handler.RegisterMediaService(mediaSvc)
 	handler.RegisterContactService(contactSvc)
+	handler.RegisterTranscriptService(transcriptSvc)
+	handler.RegisterExportService(exportSvc)
+	handler.RegisterRetentionService(retentionSvc)
+	handler.RegisterArchiveService(archiveSvc)
+	handler.RegisterPrivacyService(privacySvc)
+	handler.RegisterAuditService(auditSvc)
+	handler.RegisterAnalyticsService(analyticsSvc)
+	handler.RegisterRateLimitService(rateLimitSvc)
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
@@ -53,11 +137,10 @@ func main() {
 	})
 
 	// Global middleware
-	app.Use(middleware.Recover())     // panic recovery
-	app.Use(middleware.RequestID())   // inject X-Request-ID
-	app.Use(middleware.Helmet())      // security headers
-	app.Use(middleware.CORS())        // CORS support
-	app.Use(middleware.Idempotency()) // idempotent POST/PUT/DELETE
+	app.Use(middleware.Recover())   // panic recovery
+	app.Use(middleware.RequestID()) // inject X-Request-ID
+	app.Use(middleware.Helmet())    // security headers
+	app.Use(middleware.CORS())      // CORS support
 
 	// Health endpoints
 	app.Get("/healthz", func(c *fiber.Ctx) error {
@@ -78,8 +161,45 @@ func main() {
 		return c.SendStatus(fiber.StatusOK)
 	})
 
+	// Signed media URLs (authorized by signature, not bearer token)
+	routes.MediaRoutes(app)
+
 	// Register all /api/v1 routes
-	routes.RegisterV1Routes(app)
+	routes.RegisterV1Routes(app,
+		middleware.RateLimit(rateLimitSvc, log),     // per-company rate limits and monthly quota
+		middleware.Idempotency(idempotencySvc, log), // retry-safe POST/PUT/PATCH/DELETE; replays skip the audit
+		middleware.Audit(auditSvc, log),             // audit trail of POST/PATCH/DELETE
+	)
+
+	// Background jobs stop when the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	// Run agent purges, picking up those left pending or abandoned by any replica
+	agentSvc.Start(jobsCtx)
+	go resumeAgentPurges(jobsCtx, agentSvc, cfg.AgentPurgeResumeInterval, log)
+
+	// Process export jobs, picking up those left unfinished by a previous run
+	exportSvc.Start(jobsCtx)
+	go resumeExports(jobsCtx, exportSvc, cfg.ExportResumeInterval, log)
+
+	// Enforce data retention policies
+	go enforceRetention(jobsCtx, retentionSvc, cfg.RetentionInterval, log)
+
+	// Move old message partitions to archive storage
+	go archivePartitions(jobsCtx, archiveSvc, cfg.ArchiveAfterMonths, cfg.ArchiveInterval, log)
+
+	// Mark agents stale once they stop sending heartbeats
+	go sweepStaleAgents(jobsCtx, agentSvc, cfg.AgentSweepInterval, log)
+
+	// Refresh the materialized statistics views (when enabled)
+	go refreshStatsViews(jobsCtx, analyticsSvc, cfg.StatsViewsRefreshInterval, log)
+
+	// Delete expired Idempotency-Keys
+	go cleanIdempotencyKeys(jobsCtx, idempotencySvc, cfg.IdempotencyCleanupInterval, log)
+
+	// Store the counted usage; the last counts are flushed after shutdown
+	go flushUsage(jobsCtx, rateLimitSvc, cfg.UsageFlushInterval, log)
 
 	// Start server in goroutine
 	go func() {
@@ -95,6 +215,7 @@ func main() {
 	<-quit
 
 	log.Info("Shutting down server...")
+	stopJobs()
 
 	// Give active requests up to 5s to complete
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -104,4 +225,331 @@ func main() {
 	if err := app.ShutdownWithContext(ctx); err != nil {
 		log.Error("Error during shutdown", zap.Error(err))
 	}
+
+	// Running purges stop after their current batch and return their jobs to pending
+	agentSvc.Wait()
+
+	// Store the usage counted since the last flush
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := rateLimitSvc.Flush(flushCtx); err != nil {
+		log.Error("Failed to store usage", zap.Error(err))
+	}
+}
+
+// newCacheStore returns the response cache store selected by CACHE_STORE
+func newCacheStore(cfg *config.Config) (cache.Store, error) {
+	switch cfg.CacheStore {
+	case "", "memory":
+		return cache.NewMemoryStore(), nil
+	case "redis":
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return cache.NewRedisStore(ctx, cfg.RedisURL)
+	default:
+		return nil, fmt.Errorf("unknown cache store %q", cfg.CacheStore)
+	}
+}
+
+// newIdempotencyRepository returns the idempotency key store selected by IDEMPOTENCY_STORE
+func newIdempotencyRepository(cfg *config.Config) (repository.IdempotencyRepository, error) {
+	switch cfg.IdempotencyStore {
+	case "", "postgres":
+		return repository.NewIdempotencyRepository(), nil
+	case "redis":
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return repository.NewIdempotencyRedisRepository(ctx, cfg.RedisURL)
+	default:
+		return nil, fmt.Errorf("unknown idempotency store %q", cfg.IdempotencyStore)
+	}
+}
+
+// newRateLimitStore returns the request counter store selected by RATE_LIMIT_STORE
+func newRateLimitStore(cfg *config.Config) (ratelimit.Store, error) {
+	switch cfg.RateLimitStore {
+	case "", "memory":
+		return ratelimit.NewMemoryStore(), nil
+	case "redis":
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return ratelimit.NewRedisStore(ctx, cfg.RedisURL)
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.RateLimitStore)
+	}
+}
+
+// defaultRateLimit is the limit of tenants without rows in their rate_limits table
+func defaultRateLimit(cfg *config.Config) model.RateLimit {
+	limit := model.RateLimit{
+		Requests:      cfg.RateLimitRequests,
+		WindowSeconds: int(cfg.RateLimitWindow / time.Second),
+	}
+	if cfg.RateLimitKeyRequests > 0 {
+		limit.KeyRequests = &cfg.RateLimitKeyRequests
+	}
+	if cfg.MonthlyRequestQuota > 0 {
+		limit.MonthlyQuota = &cfg.MonthlyRequestQuota
+	}
+	return limit
+}
+
+// sweepStaleAgents periodically marks, in every tenant, the agents whose last
+// heartbeat is older than the configured threshold.
+func sweepStaleAgents(ctx context.Context, svc service.AgentService, interval time.Duration, log *zap.Logger) {
+	if interval <= 0 {
+		log.Info("Stale agent sweeper disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		tenants, err := database.ListTenants(ctx)
+		if err != nil {
+			log.Error("Failed to list tenants for stale agent sweep", zap.Error(err))
+			continue
+		}
+		for _, companyId := range tenants {
+			marked, err := svc.MarkStale(ctx, companyId)
+			if err != nil {
+				log.Error("Failed to mark stale agents", zap.String("company_id", companyId), zap.Error(err))
+				continue
+			}
+			if len(marked) > 0 {
+				log.Info("Marked agents stale", zap.String("company_id", companyId), zap.Strings("agent_ids", marked))
+			}
+		}
+	}
+}
+
+// resumeAgentPurges starts, in every tenant, the agent purge jobs that are pending
+// or whose worker stopped, right away and then at each interval.
+func resumeAgentPurges(ctx context.Context, svc service.AgentService, interval time.Duration, log *zap.Logger) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		tenants, err := database.ListTenants(ctx)
+		if err != nil {
+			log.Error("Failed to list tenants for agent purge resume", zap.Error(err))
+		}
+		for _, companyId := range tenants {
+			resumed, err := svc.ResumePurges(ctx, companyId)
+			if err != nil {
+				log.Error("Failed to resume agent purges", zap.String("company_id", companyId), zap.Error(err))
+				continue
+			}
+			if resumed > 0 {
+				log.Info("Resumed agent purges", zap.String("company_id", companyId), zap.Int("jobs", resumed))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resumeExports queues, in every tenant, the export jobs that are pending or whose
+// worker stopped, right away and then at each interval.
+func resumeExports(ctx context.Context, svc service.ExportService, interval time.Duration, log *zap.Logger) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		tenants, err := database.ListTenants(ctx)
+		if err != nil {
+			log.Error("Failed to list tenants for export resume", zap.Error(err))
+		}
+		for _, companyId := range tenants {
+			queued, err := svc.Resume(ctx, companyId)
+			if err != nil {
+				log.Error("Failed to resume exports", zap.String("company_id", companyId), zap.Error(err))
+				continue
+			}
+			if queued > 0 {
+				log.Info("Queued unfinished exports", zap.String("company_id", companyId), zap.Int("jobs", queued))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// enforceRetention removes the data expired by each tenant's retention policies,
+// right away and then at each interval.
+func enforceRetention(ctx context.Context, svc service.RetentionService, interval time.Duration, log *zap.Logger) {
+	if interval <= 0 {
+		log.Info("Retention enforcement disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		tenants, err := database.ListTenants(ctx)
+		if err != nil {
+			log.Error("Failed to list tenants for retention", zap.Error(err))
+		}
+		for _, companyId := range tenants {
+			run, err := svc.Enforce(ctx, companyId)
+			if err != nil {
+				log.Error("Failed to enforce retention", zap.String("company_id", companyId), zap.Error(err))
+				continue
+			}
+			if run != nil && (run.Partitions != "" || run.DeletedMessages > 0 || run.DeletedContacts > 0 || run.DeletedArchives > 0) {
+				log.Info("Enforced retention",
+					zap.String("company_id", companyId),
+					zap.String("partitions", run.Partitions),
+					zap.Int64("archives", run.DeletedArchives),
+					zap.Int64("messages", run.DeletedMessages),
+					zap.Int64("contacts", run.DeletedContacts))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// archivePartitions archives, in every tenant, the message partitions older than months.
+func archivePartitions(ctx context.Context, svc service.ArchiveService, months int, interval time.Duration, log *zap.Logger) {
+	if months <= 0 || interval <= 0 {
+		log.Info("Scheduled message archiving disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		tenants, err := database.ListTenants(ctx)
+		if err != nil {
+			log.Error("Failed to list tenants for archiving", zap.Error(err))
+		}
+		for _, companyId := range tenants {
+			n, err := svc.ArchiveOlderThan(ctx, companyId, months)
+			if err != nil {
+				log.Error("Failed to archive message partitions", zap.String("company_id", companyId), zap.Error(err))
+			}
+			if n > 0 {
+				log.Info("Archived message partitions", zap.String("company_id", companyId), zap.Int("partitions", n))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshStatsViews refreshes every tenant's statistics views right away and then
+// at each interval. Until a tenant's first refresh, its statistics are computed live.
+func refreshStatsViews(ctx context.Context, svc service.AnalyticsService, interval time.Duration, log *zap.Logger) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		tenants, err := database.ListTenants(ctx)
+		if err != nil {
+			log.Error("Failed to list tenants for statistics refresh", zap.Error(err))
+		}
+		for _, companyId := range tenants {
+			if err := svc.RefreshStatsViews(ctx, companyId); err != nil {
+				log.Error("Failed to refresh statistics views", zap.String("company_id", companyId), zap.Error(err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanIdempotencyKeys deletes, in every tenant, the Idempotency-Keys past their
+// lifetime, right away and then at each interval.
+func cleanIdempotencyKeys(ctx context.Context, svc service.IdempotencyService, interval time.Duration, log *zap.Logger) {
+	if interval <= 0 {
+		log.Info("Idempotency key cleanup disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		tenants, err := database.ListTenants(ctx)
+		if err != nil {
+			log.Error("Failed to list tenants for idempotency key cleanup", zap.Error(err))
+		}
+		for _, companyId := range tenants {
+			deleted, err := svc.Cleanup(ctx, companyId)
+			if err != nil {
+				log.Error("Failed to delete expired idempotency keys", zap.String("company_id", companyId), zap.Error(err))
+				continue
+			}
+			if deleted > 0 {
+				log.Info("Deleted expired idempotency keys", zap.String("company_id", companyId), zap.Int64("keys", deleted))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// flushUsage writes the usage counted by the rate limiter to the database at each interval.
+func flushUsage(ctx context.Context, svc service.RateLimitService, interval time.Duration, log *zap.Logger) {
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := svc.Flush(ctx); err != nil {
+			log.Error("Failed to store usage", zap.Error(err))
+		}
+	}
 }
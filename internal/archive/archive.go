@@ -0,0 +1,87 @@
+// Package archive reads and writes message archives: gzip-compressed JSON lines,
+// one message per line, ordered by chat.
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+)
+
+// Format and ContentType describe archive files
+const (
+	Format      = "jsonl.gz"
+	ContentType = "application/gzip"
+)
+
+// maxLineSize bounds one archived message (payloads included)
+const maxLineSize = 16 << 20
+
+// row is an archived message. The row id, hidden from API responses, is kept so
+// archived messages stay ordered like hot ones.
+type row struct {
+	RowID int64 `json:"row_id"`
+	*model.Message
+}
+
+// Writer compresses messages into an archive.
+type Writer struct {
+	gz   *gzip.Writer
+	enc  *json.Encoder
+	rows int64
+}
+
+// NewWriter returns a Writer on w. Close must be called to complete the archive.
+func NewWriter(w io.Writer) *Writer {
+	gz := gzip.NewWriter(w)
+	return &Writer{gz: gz, enc: json.NewEncoder(gz)}
+}
+
+// Write appends a message.
+func (w *Writer) Write(m *model.Message) error {
+	if err := w.enc.Encode(row{RowID: m.ID, Message: m}); err != nil {
+		return err
+	}
+	w.rows++
+	return nil
+}
+
+// Rows returns the number of messages written.
+func (w *Writer) Rows() int64 {
+	return w.rows
+}
+
+// Close flushes the compressed stream; it does not close the underlying writer.
+func (w *Writer) Close() error {
+	return w.gz.Close()
+}
+
+// Read decodes the archive in r, calling fn for each message until fn returns
+// false. Returns the number of messages read.
+func Read(r io.Reader, fn func(*model.Message) (bool, error)) (int64, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+	var n int64
+	for scanner.Scan() {
+		decoded := row{Message: &model.Message{}}
+		if err := json.Unmarshal(scanner.Bytes(), &decoded); err != nil {
+			return n, err
+		}
+		decoded.Message.ID = decoded.RowID
+		n++
+		more, err := fn(decoded.Message)
+		if err != nil || !more {
+			return n, err
+		}
+	}
+	return n, scanner.Err()
+}
@@ -0,0 +1,108 @@
+// Package audit carries the row-level details of a mutating request from the
+// repositories that perform the write to the middleware that records it.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+)
+
+// LocalsKey is the request-local key under which the Audit middleware stores
+// the pending *Change. Fiber locals are visible through c.Context() as
+// context values, so repositories can reach it from their ctx argument.
+const LocalsKey = "audit"
+
+// ignoredFields never count as a change on their own.
+var ignoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// Change describes the entity touched by a request and how it changed.
+type Change struct {
+	EntityType string
+	EntityID   string
+	Before     map[string]interface{}
+	After      map[string]interface{}
+	// Skip drops the entry, for high-frequency calls that change nothing of interest
+	Skip bool
+}
+
+// Track records the entity affected by the current request.
+// before is nil for creations and after is nil for deletions; for updates only
+// the fields that differ are kept. It is a no-op outside an audited request.
+func Track(ctx context.Context, entityType, entityID string, before, after interface{}) {
+	if ctx == nil {
+		return
+	}
+	change, ok := ctx.Value(LocalsKey).(*Change)
+	if !ok || change == nil {
+		return
+	}
+
+	change.Skip = false
+	change.EntityType = entityType
+	change.EntityID = entityID
+	change.Before, change.After = Diff(toMap(before), toMap(after))
+}
+
+// Skip marks the current request as not worth auditing, unless a repository
+// tracks a change afterwards. It is a no-op outside an audited request.
+func Skip(ctx context.Context) {
+	if ctx == nil {
+		return
+	}
+	if change, ok := ctx.Value(LocalsKey).(*Change); ok && change != nil {
+		change.Skip = true
+	}
+}
+
+// Diff strips the fields that are identical in before and after.
+// When one side is nil the other is returned unchanged.
+func Diff(before, after map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	if before == nil || after == nil {
+		return before, after
+	}
+
+	b := make(map[string]interface{})
+	a := make(map[string]interface{})
+	for key, newVal := range after {
+		if ignoredFields[key] {
+			continue
+		}
+		oldVal, existed := before[key]
+		if existed && reflect.DeepEqual(oldVal, newVal) {
+			continue
+		}
+		if existed {
+			b[key] = oldVal
+		}
+		a[key] = newVal
+	}
+	for key, oldVal := range before {
+		if _, stillThere := after[key]; !stillThere && !ignoredFields[key] {
+			b[key] = oldVal
+		}
+	}
+	return b, a
+}
+
+// toMap converts a struct or map into its JSON field representation.
+func toMap(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil
+	}
+	return m
+}
@@ -0,0 +1,153 @@
+// Package cache is the response cache shared by the API replicas. Entries are
+// tagged with the resources they were built from; writes invalidate those tags so
+// readers never wait for an entry to expire, and each invalidation moves the tags to
+// a new generation so a value built meanwhile is not stored. Keys and tags are
+// scoped per tenant.
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store keeps cached values. Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns the value under key, or nil when there is none
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Generation returns the current invalidation generation of tags, as an opaque token
+	Generation(ctx context.Context, tags []string) (string, error)
+	// Set stores the value for ttl and attaches it to tags, unless one of the tags
+	// was invalidated since generation was read from Generation(tags)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string, generation string) error
+	// Invalidate removes every value attached to one of the tags and moves the tags
+	// to a new generation
+	Invalidate(ctx context.Context, tags ...string) error
+	// Close releases the store's resources
+	Close() error
+}
+
+// Tags of the cached resources. Every entry also carries TagAll.
+const (
+	TagAgents   = "agents"
+	TagChats    = "chats"
+	TagMessages = "messages"
+	TagContacts = "contacts"
+	// TagAnalytics and TagRateLimits tag computed results rather than responses
+	TagAnalytics  = "analytics"
+	TagRateLimits = "rate-limits"
+	// TagAll is carried by every entry, so a tenant's whole cache can be dropped
+	TagAll = "all"
+)
+
+// AgentTag tags the entries built from one agent
+func AgentTag(agentId string) string {
+	return "agent:" + agentId
+}
+
+// ContactTag tags the entries built from one contact
+func ContactTag(id string) string {
+	return "contact:" + id
+}
+
+var (
+	mu      sync.RWMutex
+	store   Store = NewMemoryStore()
+	ttl           = time.Minute
+	onError       = func(error) {}
+)
+
+// Configure sets the store, how long response entries live (0 disables response
+// caching) and the function told about store failures. Call once at startup before serving requests.
+func Configure(s Store, entryTTL time.Duration, errorHandler func(error)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	store, ttl = s, entryTTL
+	if errorHandler != nil {
+		onError = errorHandler
+	}
+}
+
+func current() (Store, time.Duration, func(error)) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return store, ttl, onError
+}
+
+func tenantKey(companyId, key string) string {
+	return "cache:" + companyId + ":" + key
+}
+
+func tenantTags(companyId string, tags []string) []string {
+	scoped := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		scoped = append(scoped, tenantKey(companyId, "tag:"+tag))
+	}
+	return scoped
+}
+
+// Enabled tells whether responses are cached
+func Enabled() bool {
+	_, entryTTL, _ := current()
+	return entryTTL > 0
+}
+
+// Get returns the tenant's value under key. A failing store counts as a miss.
+func Get(ctx context.Context, companyId, key string) ([]byte, bool) {
+	s, _, fail := current()
+	value, err := s.Get(ctx, tenantKey(companyId, key))
+	if err != nil {
+		fail(err)
+		return nil, false
+	}
+	return value, value != nil
+}
+
+// Generation reads the generation of the tenant's tags. Read it before building a
+// value from the tagged resources and pass it to Set, so a value built while one
+// of them was invalidated is not stored. ok is false when the store fails.
+func Generation(ctx context.Context, companyId string, tags ...string) (string, bool) {
+	s, _, fail := current()
+	generation, err := s.Generation(ctx, tenantTags(companyId, withAll(tags)))
+	if err != nil {
+		fail(err)
+		return "", false
+	}
+	return generation, true
+}
+
+// Set stores the tenant's response under key for the configured lifetime, attached
+// to tags and TagAll. generation comes from Generation with the same tags.
+func Set(ctx context.Context, companyId, key string, value []byte, generation string, tags ...string) {
+	_, entryTTL, _ := current()
+	SetFor(ctx, companyId, key, value, entryTTL, generation, tags...)
+}
+
+// SetFor is Set with its own lifetime; ttl <= 0 stores nothing
+func SetFor(ctx context.Context, companyId, key string, value []byte, ttl time.Duration, generation string, tags ...string) {
+	s, _, fail := current()
+	if ttl <= 0 {
+		return
+	}
+	err := s.Set(ctx, tenantKey(companyId, key), value, ttl, tenantTags(companyId, withAll(tags)), generation)
+	if err != nil {
+		fail(err)
+	}
+}
+
+// Invalidate removes the tenant's entries attached to one of the tags. Writes call
+// it once committed; a failure is reported and leaves entries to expire.
+func Invalidate(ctx context.Context, companyId string, tags ...string) {
+	s, _, fail := current()
+	if len(tags) == 0 {
+		return
+	}
+	if err := s.Invalidate(context.WithoutCancel(ctx), tenantTags(companyId, tags)...); err != nil {
+		fail(err)
+	}
+}
+
+func withAll(tags []string) []string {
+	return append(tags[:len(tags):len(tags)], TagAll)
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxMemoryEntries bounds the entries of a store: inserting into a full store evicts
+// the least recently used entry. It also triggers a sweep of expired generations.
+const maxMemoryEntries = 10000
+
+// generationTTL is how long a tag's generation outlives its last invalidation. A
+// value built over a longer time may be stored although one of its tags changed.
+const generationTTL = time.Hour
+
+// MemoryStore keeps entries in the process, at most maxMemoryEntries of them. Each
+// replica has its own copy, so it only suits single-replica deployments. Expired
+// entries are dropped when read or once they become least recently used.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order lists the entries, most recently used first
+	order *list.List
+	tags  map[string]map[string]struct{}
+	// generations holds the invalidated tags; clock numbers the invalidations
+	generations map[string]memoryGeneration
+	clock       uint64
+}
+
+type memoryEntry struct {
+	key       string
+	value     []byte
+	tags      []string
+	expiresAt time.Time
+}
+
+type memoryGeneration struct {
+	n         uint64
+	expiresAt time.Time
+}
+
+// NewMemoryStore returns an empty in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+		tags:        make(map[string]map[string]struct{}),
+		generations: make(map[string]memoryGeneration),
+	}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	entry := elem.Value.(*memoryEntry)
+	if time.Now().After(entry.expiresAt) {
+		s.remove(key)
+		return nil, nil
+	}
+	s.order.MoveToFront(elem)
+	return entry.value, nil
+}
+
+func (s *MemoryStore) Generation(_ context.Context, tags []string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.generation(tags), nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration, tags []string, generation string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.generation(tags) != generation {
+		return nil
+	}
+
+	now := time.Now()
+	if len(s.generations) >= maxMemoryEntries {
+		for tag, gen := range s.generations {
+			if now.After(gen.expiresAt) {
+				delete(s.generations, tag)
+			}
+		}
+	}
+
+	s.remove(key)
+	for len(s.entries) >= maxMemoryEntries {
+		s.remove(s.order.Back().Value.(*memoryEntry).key)
+	}
+	s.entries[key] = s.order.PushFront(&memoryEntry{key: key, value: value, tags: tags, expiresAt: now.Add(ttl)})
+	for _, tag := range tags {
+		keys, ok := s.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			s.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Invalidate(_ context.Context, tags ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt := time.Now().Add(generationTTL)
+	for _, tag := range tags {
+		for key := range s.tags[tag] {
+			s.remove(key)
+		}
+		delete(s.tags, tag)
+		s.clock++
+		s.generations[tag] = memoryGeneration{n: s.clock, expiresAt: expiresAt}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// generation joins the generations of tags, 0 for a tag never invalidated; the
+// caller holds mu
+func (s *MemoryStore) generation(tags []string) string {
+	var b strings.Builder
+	for i, tag := range tags {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatUint(s.generations[tag].n, 10))
+	}
+	return b.String()
+}
+
+// remove deletes an entry and its tag memberships; the caller holds mu
+func (s *MemoryStore) remove(key string) {
+	elem, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	entry := s.order.Remove(elem).(*memoryEntry)
+	delete(s.entries, key)
+	for _, tag := range entry.tags {
+		if keys, ok := s.tags[tag]; ok {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(s.tags, tag)
+			}
+		}
+	}
+}
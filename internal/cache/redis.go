@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps entries in Redis, shared by every replica. A tag is a Redis
+// set holding the keys of its entries; its generation is a counter under
+// "<tag>:gen", kept for generationTTL after the last invalidation.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// invalidateScript deletes the members of each tag set and the sets themselves and
+// increments the tags' generations, atomically, so an entry stored meanwhile cannot
+// escape its tag. ARGV[1] is the generation lifetime in milliseconds.
+var invalidateScript = redis.NewScript(`
+for _, tag in ipairs(KEYS) do
+	local keys = redis.call('SMEMBERS', tag)
+	for i = 1, #keys, 500 do
+		redis.call('UNLINK', unpack(keys, i, math.min(i + 499, #keys)))
+	end
+	redis.call('UNLINK', tag)
+	redis.call('INCR', tag .. ':gen')
+	redis.call('PEXPIRE', tag .. ':gen', ARGV[1])
+end
+return 0
+`)
+
+// setScript stores KEYS[1] and adds it to the tag sets KEYS[2..] unless the tags'
+// generation differs from ARGV[3]. ARGV[1] is the value and ARGV[2] its lifetime
+// in milliseconds; a tag set lives as long as its longest-lived entry.
+var setScript = redis.NewScript(`
+local gens = {}
+for i = 2, #KEYS do
+	gens[#gens + 1] = redis.call('GET', KEYS[i] .. ':gen') or '0'
+end
+if table.concat(gens, ',') ~= ARGV[3] then
+	return 0
+end
+local ttl = tonumber(ARGV[2])
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ttl)
+for i = 2, #KEYS do
+	redis.call('SADD', KEYS[i], KEYS[1])
+	if redis.call('PTTL', KEYS[i]) < ttl then
+		redis.call('PEXPIRE', KEYS[i], ttl)
+	end
+end
+return 1
+`)
+
+// NewRedisStore connects to the Redis server at url ("redis://[:password@]host:port/db")
+func NewRedisStore(ctx context.Context, url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &RedisStore{client: client}, nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (s *RedisStore) Generation(ctx context.Context, tags []string) (string, error) {
+	if len(tags) == 0 {
+		return "", nil
+	}
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys = append(keys, tag+":gen")
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return "", err
+	}
+	gens := make([]string, 0, len(values))
+	for _, value := range values {
+		gen, ok := value.(string)
+		if !ok {
+			gen = "0"
+		}
+		gens = append(gens, gen)
+	}
+	return strings.Join(gens, ","), nil
+}
+
+// Set stores the entry and adds it to its tags. Keys of expired entries left in a
+// tag set are harmless.
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string, generation string) error {
+	keys := append([]string{key}, tags...)
+	return setScript.Run(ctx, s.client, keys, value, ttl.Milliseconds(), generation).Err()
+}
+
+func (s *RedisStore) Invalidate(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	return invalidateScript.Run(ctx, s.client, tags, generationTTL.Milliseconds()).Err()
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
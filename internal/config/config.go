@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -12,6 +13,75 @@ type Config struct {
 	Port      string
 	PgDsn     string
 	SecretKey string
+	// PhoneDefaultRegion is the region national phone numbers are interpreted in (e.g. "ID").
+	PhoneDefaultRegion string
+	// PhoneTenantRegions overrides the region per company (companyId → region).
+	PhoneTenantRegions map[string]string
+	// AgentStaleAfter is how long an agent may stay silent before it is marked stale.
+	AgentStaleAfter time.Duration
+	// AgentSweepInterval is how often agents are checked for missed heartbeats.
+	AgentSweepInterval time.Duration
+	// AgentPurgeResumeInterval is how often pending or abandoned agent purges are picked up.
+	AgentPurgeResumeInterval time.Duration
+	// AgentQRTTL is how long a QR code set through PATCH /agents stays valid.
+	AgentQRTTL time.Duration
+	// StatsCacheTTL is how long computed statistics are reused per tenant (0 disables caching).
+	StatsCacheTTL time.Duration
+	// StatsViewsRefreshInterval enables materialized statistics views refreshed at this interval (0 disables them).
+	StatsViewsRefreshInterval time.Duration
+	// SLAResponseThreshold is the default reply delay after which a waiting chat breaches the SLA.
+	SLAResponseThreshold time.Duration
+	// MediaURLSecret signs media URLs; required and distinct from SecretKey.
+	MediaURLSecret string
+	// PrivacyHashSecret keys the phone hashes of the privacy log; required and distinct from SecretKey.
+	PrivacyHashSecret string
+	// MediaURLTTL is how long a signed media URL stays valid.
+	MediaURLTTL time.Duration
+	// MediaBaseURL is the public origin prefixed to media URLs (empty for relative URLs).
+	MediaBaseURL string
+	// StorageDir is the root of the local filesystem storage backend; shared by every replica.
+	StorageDir string
+	// ExportWorkers is the number of export jobs processed concurrently.
+	ExportWorkers int
+	// ExportResumeInterval is how often unfinished export jobs are picked up again.
+	ExportResumeInterval time.Duration
+	// RetentionInterval is how often retention policies are enforced (0 disables enforcement).
+	RetentionInterval time.Duration
+	// ArchiveDir is the root of the storage backend holding message archives (defaults to StorageDir).
+	ArchiveDir string
+	// ArchiveAfterMonths is how many whole months partitions stay in the database before
+	// they are archived (0 disables scheduled archiving).
+	ArchiveAfterMonths int
+	// ArchiveInterval is how often partitions due for archiving are looked for.
+	ArchiveInterval time.Duration
+	// CacheStore is where cached GET responses are kept: memory (per replica) or redis (shared).
+	CacheStore string
+	// CacheTTL is how long a cached response lives unless a write invalidates it (0 disables caching).
+	CacheTTL time.Duration
+	// RedisURL locates the Redis server ("redis://[:password@]host:port/db").
+	RedisURL string
+	// IdempotencyStore is where Idempotency-Keys are kept: postgres (tenant schema) or redis.
+	IdempotencyStore string
+	// IdempotencyTTL is how long a key and its response are kept after the first request.
+	IdempotencyTTL time.Duration
+	// IdempotencyLockTimeout is how long a request holds its key; a retry arriving later
+	// runs again. Set it above the longest request.
+	IdempotencyLockTimeout time.Duration
+	// IdempotencyCleanupInterval is how often expired keys are deleted (0 disables cleanup).
+	IdempotencyCleanupInterval time.Duration
+	// RateLimitStore is where request counters are kept: memory (per replica) or redis (shared).
+	// Defaults to redis when REDIS_URL is set, since per-replica counters multiply the limits.
+	RateLimitStore string
+	// RateLimitRequests is how many requests a company may send per RateLimitWindow,
+	// unless its rate_limits table says otherwise (0 disables the default limit).
+	RateLimitRequests int64
+	RateLimitWindow   time.Duration
+	// RateLimitKeyRequests additionally bounds each API key per window (0: no separate bound).
+	RateLimitKeyRequests int64
+	// MonthlyRequestQuota is the default requests per calendar month (0 is unlimited).
+	MonthlyRequestQuota int64
+	// UsageFlushInterval is how often the counted usage is written to the database.
+	UsageFlushInterval time.Duration
 }
 
 // LoadConfig initializes Viper, reads defaults, then .env (if not prod), then real env vars.
@@ -25,6 +95,39 @@ func LoadConfig() *Config {
 	viper.SetDefault("PORT", "80")
 	viper.SetDefault("POSTGRES_DSN", "")
 	viper.SetDefault("SECRET_KEY", "")
+	viper.SetDefault("PHONE_DEFAULT_REGION", "ID")
+	viper.SetDefault("PHONE_TENANT_REGIONS", "") // e.g. "companyA=MY,companyB=SG"
+	viper.SetDefault("AGENT_STALE_AFTER", "2m")
+	viper.SetDefault("AGENT_SWEEP_INTERVAL", "30s")
+	viper.SetDefault("AGENT_PURGE_RESUME_INTERVAL", "1m")
+	viper.SetDefault("AGENT_QR_TTL", "60s")
+	viper.SetDefault("STATS_CACHE_TTL", "5m")
+	viper.SetDefault("STATS_VIEWS_REFRESH_INTERVAL", "0")
+	viper.SetDefault("SLA_RESPONSE_THRESHOLD", "15m")
+	viper.SetDefault("MEDIA_URL_SECRET", "")
+	viper.SetDefault("PRIVACY_HASH_SECRET", "")
+	viper.SetDefault("MEDIA_URL_TTL", "15m")
+	viper.SetDefault("MEDIA_BASE_URL", "")
+	viper.SetDefault("STORAGE_DIR", "./data")
+	viper.SetDefault("EXPORT_WORKERS", 2)
+	viper.SetDefault("EXPORT_RESUME_INTERVAL", "1m")
+	viper.SetDefault("RETENTION_INTERVAL", "1h")
+	viper.SetDefault("ARCHIVE_DIR", "")
+	viper.SetDefault("ARCHIVE_AFTER_MONTHS", 0)
+	viper.SetDefault("ARCHIVE_INTERVAL", "24h")
+	viper.SetDefault("CACHE_STORE", "memory")
+	viper.SetDefault("CACHE_TTL", "1m")
+	viper.SetDefault("REDIS_URL", "") // redis://localhost:6379/0 when unset
+	viper.SetDefault("IDEMPOTENCY_STORE", "postgres")
+	viper.SetDefault("IDEMPOTENCY_TTL", "24h")
+	viper.SetDefault("IDEMPOTENCY_LOCK_TIMEOUT", "1m")
+	viper.SetDefault("IDEMPOTENCY_CLEANUP_INTERVAL", "1h")
+	viper.SetDefault("RATE_LIMIT_STORE", "") // redis when REDIS_URL is set, else memory
+	viper.SetDefault("RATE_LIMIT_REQUESTS", 600)
+	viper.SetDefault("RATE_LIMIT_WINDOW", "1m")
+	viper.SetDefault("RATE_LIMIT_KEY_REQUESTS", 0)
+	viper.SetDefault("MONTHLY_REQUEST_QUOTA", 0)
+	viper.SetDefault("USAGE_FLUSH_INTERVAL", "15s")
 
 	// load .env in dev (APP_ENV != "production")
 	if !isProduction() {
@@ -37,11 +140,80 @@ func LoadConfig() *Config {
 		}
 	}
 
-	return &Config{
-		Port:      viper.GetString("PORT"),
-		PgDsn:     viper.GetString("POSTGRES_DSN"),
-		SecretKey: viper.GetString("SECRET_KEY"),
+	cfg := &Config{
+		Port:               viper.GetString("PORT"),
+		PgDsn:              viper.GetString("POSTGRES_DSN"),
+		SecretKey:          viper.GetString("SECRET_KEY"),
+		PhoneDefaultRegion: viper.GetString("PHONE_DEFAULT_REGION"),
+		PhoneTenantRegions: parsePairs(viper.GetString("PHONE_TENANT_REGIONS")),
+		AgentStaleAfter:    viper.GetDuration("AGENT_STALE_AFTER"),
+		AgentSweepInterval: viper.GetDuration("AGENT_SWEEP_INTERVAL"),
+		AgentQRTTL:         viper.GetDuration("AGENT_QR_TTL"),
+
+		AgentPurgeResumeInterval: viper.GetDuration("AGENT_PURGE_RESUME_INTERVAL"),
+
+		StatsCacheTTL:             viper.GetDuration("STATS_CACHE_TTL"),
+		StatsViewsRefreshInterval: viper.GetDuration("STATS_VIEWS_REFRESH_INTERVAL"),
+		SLAResponseThreshold:      viper.GetDuration("SLA_RESPONSE_THRESHOLD"),
+
+		MediaURLSecret: viper.GetString("MEDIA_URL_SECRET"),
+		MediaURLTTL:    viper.GetDuration("MEDIA_URL_TTL"),
+		MediaBaseURL:   viper.GetString("MEDIA_BASE_URL"),
+		StorageDir:     viper.GetString("STORAGE_DIR"),
+
+		PrivacyHashSecret: viper.GetString("PRIVACY_HASH_SECRET"),
+
+		ExportWorkers:        viper.GetInt("EXPORT_WORKERS"),
+		ExportResumeInterval: viper.GetDuration("EXPORT_RESUME_INTERVAL"),
+
+		RetentionInterval: viper.GetDuration("RETENTION_INTERVAL"),
+
+		ArchiveDir:         viper.GetString("ARCHIVE_DIR"),
+		ArchiveAfterMonths: viper.GetInt("ARCHIVE_AFTER_MONTHS"),
+		ArchiveInterval:    viper.GetDuration("ARCHIVE_INTERVAL"),
+
+		CacheStore: viper.GetString("CACHE_STORE"),
+		CacheTTL:   viper.GetDuration("CACHE_TTL"),
+		RedisURL:   viper.GetString("REDIS_URL"),
+
+		IdempotencyStore:           viper.GetString("IDEMPOTENCY_STORE"),
+		IdempotencyTTL:             viper.GetDuration("IDEMPOTENCY_TTL"),
+		IdempotencyLockTimeout:     viper.GetDuration("IDEMPOTENCY_LOCK_TIMEOUT"),
+		IdempotencyCleanupInterval: viper.GetDuration("IDEMPOTENCY_CLEANUP_INTERVAL"),
+
+		RateLimitStore:       viper.GetString("RATE_LIMIT_STORE"),
+		RateLimitRequests:    viper.GetInt64("RATE_LIMIT_REQUESTS"),
+		RateLimitWindow:      viper.GetDuration("RATE_LIMIT_WINDOW"),
+		RateLimitKeyRequests: viper.GetInt64("RATE_LIMIT_KEY_REQUESTS"),
+		MonthlyRequestQuota:  viper.GetInt64("MONTHLY_REQUEST_QUOTA"),
+		UsageFlushInterval:   viper.GetDuration("USAGE_FLUSH_INTERVAL"),
+	}
+	if cfg.ArchiveDir == "" {
+		cfg.ArchiveDir = cfg.StorageDir
+	}
+	if cfg.RateLimitStore == "" {
+		cfg.RateLimitStore = "memory"
+		if cfg.RedisURL != "" {
+			cfg.RateLimitStore = "redis"
+		}
+	}
+	if cfg.RedisURL == "" {
+		cfg.RedisURL = "redis://localhost:6379/0"
+	}
+	return cfg
+}
+
+// parsePairs parses "key=value,key2=value2" lists, skipping malformed entries.
+func parsePairs(raw string) map[string]string {
+	pairs := make(map[string]string)
+	for _, item := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || key == "" || value == "" {
+			continue
+		}
+		pairs[strings.TrimSpace(key)] = strings.TrimSpace(value)
 	}
+	return pairs
 }
 
 func isProduction() bool {
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ensured remembers which tenant tables have already been created by this process.
+var ensured sync.Map
+
+// columns caches TenantColumnExists lookups ("schema.table.column" → columnCheck).
+var columns sync.Map
+
+// columnRecheckAfter bounds how long a missing column is cached, so columns added
+// by a backfill are picked up without a restart.
+const columnRecheckAfter = time.Minute
+
+type columnCheck struct {
+	exists    bool
+	checkedAt time.Time
+}
+
+// TenantSchema returns the Postgres schema holding a company's tables.
+func TenantSchema(companyId string) string {
+	return "daisi_" + companyId
+}
+
+// EnsureTenantTable runs the given DDL statements the first time a tenant table
+// is used by this process. Statements must be idempotent (IF NOT EXISTS), since
+// every replica runs them once after startup.
+func EnsureTenantTable(ctx context.Context, companyId, table string, ddl ...string) error {
+	key := TenantSchema(companyId) + "." + table
+	if _, ok := ensured.Load(key); ok {
+		return nil
+	}
+
+	for _, stmt := range ddl {
+		if err := DB.WithContext(ctx).Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+
+	ensured.Store(key, struct{}{})
+	return nil
+}
+
+// ListTenants returns the company IDs of every tenant schema (daisi_<companyId>).
+func ListTenants(ctx context.Context) ([]string, error) {
+	var schemas []string
+	if err := DB.WithContext(ctx).
+		Raw(`SELECT schema_name FROM information_schema.schemata WHERE schema_name LIKE 'daisi\_%' ORDER BY schema_name`).
+		Scan(&schemas).Error; err != nil {
+		return nil, err
+	}
+
+	tenants := make([]string, 0, len(schemas))
+	for _, schema := range schemas {
+		tenants = append(tenants, strings.TrimPrefix(schema, "daisi_"))
+	}
+	return tenants, nil
+}
+
+// TenantColumnExists reports whether a tenant table has the given column.
+// Lookup errors are treated as "missing" so callers fall back to the slower path.
+func TenantColumnExists(ctx context.Context, companyId, table, column string) bool {
+	key := TenantSchema(companyId) + "." + table + "." + column
+	if cached, ok := columns.Load(key); ok {
+		check := cached.(columnCheck)
+		if check.exists || time.Since(check.checkedAt) < columnRecheckAfter {
+			return check.exists
+		}
+	}
+
+	var count int64
+	err := DB.WithContext(ctx).
+		Raw(`SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = ? AND table_name = ? AND column_name = ?`,
+			TenantSchema(companyId), table, column).
+		Scan(&count).Error
+	if err != nil {
+		return false
+	}
+
+	columns.Store(key, columnCheck{exists: count > 0, checkedAt: time.Now()})
+	return count > 0
+}
+
+// RememberColumn records that a tenant column exists, typically right after this
+// process added it, so TenantColumnExists does not serve a stale "missing".
+func RememberColumn(companyId, table, column string) {
+	key := TenantSchema(companyId) + "." + table + "." + column
+	columns.Store(key, columnCheck{exists: true, checkedAt: time.Now()})
+}
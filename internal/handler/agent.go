@@ -2,9 +2,12 @@
 package handler
 
 import (
+	"errors"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/audit"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
 	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/utils"
@@ -17,23 +20,22 @@ func RegisterAgentService(svc service.AgentService) {
 	agentSvc = svc
 }
 
-// ListAgents handles GET /agents?agentids=... or GET /agents
+// ListAgents handles GET /agents?agentids=...&status=...&stale=...
 func ListAgents(c *fiber.Ctx) error {
 	companyId := c.Locals("companyId").(string)
-	idsParam := c.Query("agentids")
 
-	var (
-		agents []*model.Agent
-		err    error
-	)
-
-	if idsParam != "" {
-		agentIds := strings.Split(idsParam, ",")
-		agents, err = agentSvc.ListByAgentIDs(c.Context(), companyId, agentIds)
-	} else {
-		agents, err = agentSvc.ListByCompanyID(c.Context(), companyId)
+	filter := make(map[string]interface{})
+	if idsParam := c.Query("agentids"); idsParam != "" {
+		filter["agent_ids"] = strings.Split(idsParam, ",")
+	}
+	if statusParam := c.Query("status"); statusParam != "" {
+		filter["status"] = strings.Split(statusParam, ",")
+	}
+	if staleParam := c.Query("stale"); staleParam != "" {
+		filter["stale"] = c.QueryBool("stale")
 	}
 
+	agents, err := agentSvc.List(c.Context(), companyId, filter)
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
 	}
@@ -56,6 +58,7 @@ func GetAgent(c *fiber.Ctx) error {
 	if agent == nil {
 		return utils.Error(c, fiber.StatusNotFound, "agent not found")
 	}
+	c.Set(fiber.HeaderETag, service.AgentETag(agent))
 	return utils.Success(c, agent)
 }
 
@@ -75,35 +78,203 @@ func CreateAgent(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusCreated).JSON(utils.APIResponse{Success: true, Data: created})
 }
 
-// UpdateAgentName handles PATCH /agents/:id
-func UpdateAgentName(c *fiber.Ctx) error {
+// UpdateAgent handles PATCH /agents/:agent_id
+// An If-Match header makes the update conditional on the agent's current ETag.
+func UpdateAgent(c *fiber.Ctx) error {
 	companyId := c.Locals("companyId").(string)
-	agentId := c.Params("id")
+	agentId := c.Params("agent_id")
 
-	var body struct {
-		AgentName string `json:"agent_name"`
-	}
+	var body model.AgentUpdateInput
 	if err := c.BodyParser(&body); err != nil {
 		return utils.Error(c, fiber.StatusBadRequest, err.Error())
 	}
 
-	updated, err := agentSvc.UpdateName(c.Context(), companyId, agentId, body.AgentName)
+	updated, err := agentSvc.Update(c.Context(), companyId, agentId, body, c.Get(fiber.HeaderIfMatch))
+	if errors.Is(err, service.ErrPreconditionFailed) {
+		return utils.Error(c, fiber.StatusPreconditionFailed, err.Error())
+	}
 	if err != nil {
 		return utils.Error(c, fiber.StatusBadRequest, err.Error())
 	}
 	if updated == nil {
 		return utils.Error(c, fiber.StatusNotFound, "agent not found")
 	}
+	c.Set(fiber.HeaderETag, service.AgentETag(updated))
 	return utils.Success(c, updated)
 }
 
-// DeleteAgent handles DELETE /agents/:id
+// GetAgentQR handles GET /agents/:agent_id/qr?current=...&timeout=30
+// Long-polls until the QR code differs from current or the agent is connected.
+func GetAgentQR(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	agentId := c.Params("agent_id")
+	current := c.Query("current")
+	timeout := time.Duration(c.QueryInt("timeout", 30)) * time.Second
+
+	qr, err := agentSvc.WaitForQR(c.Context(), companyId, agentId, current, timeout)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+	if qr == nil {
+		return utils.Error(c, fiber.StatusNotFound, "agent not found")
+	}
+	return utils.Success(c, qr)
+}
+
+// DeleteAgent handles DELETE /agents/:agent_id?mode=restrict|soft|purge
 func DeleteAgent(c *fiber.Ctx) error {
 	companyId := c.Locals("companyId").(string)
-	id := c.Params("id")
+	agentId := c.Params("agent_id")
 
-	if err := agentSvc.Delete(c.Context(), companyId, id); err != nil {
+	job, err := agentSvc.Delete(c.Context(), companyId, agentId, c.Query("mode"))
+	switch {
+	case errors.Is(err, service.ErrAgentNotFound):
+		return utils.Error(c, fiber.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrAgentHasData):
+		return utils.Error(c, fiber.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrInvalidDeleteMode):
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	case err != nil:
 		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
 	}
+
+	if job != nil {
+		return c.Status(fiber.StatusAccepted).JSON(utils.APIResponse{Success: true, Data: job})
+	}
 	return c.Status(fiber.StatusNoContent).Send(nil)
 }
+
+// GetAgentPurgeJob handles GET /agents/purge-jobs/:job_id
+func GetAgentPurgeJob(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	id, err := c.ParamsInt("job_id")
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, "invalid job id")
+	}
+
+	job, err := agentSvc.GetPurgeJob(c.Context(), companyId, int64(id))
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+	if job == nil {
+		return utils.Error(c, fiber.StatusNotFound, "purge job not found")
+	}
+	return utils.Success(c, job)
+}
+
+// AgentHeartbeat handles POST /agents/:agent_id/heartbeat
+func AgentHeartbeat(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	agentId := c.Params("agent_id")
+
+	var body struct {
+		Version  string `json:"version"`
+		HostName string `json:"host_name"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return utils.Error(c, fiber.StatusBadRequest, err.Error())
+		}
+	}
+
+	// Heartbeats are too frequent for the audit trail; a status restore is still tracked
+	audit.Skip(c.Context())
+
+	agent, err := agentSvc.Heartbeat(c.Context(), companyId, agentId, body.Version, body.HostName)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	if agent == nil {
+		return utils.Error(c, fiber.StatusNotFound, "agent not found")
+	}
+	return utils.Success(c, agent)
+}
+
+// RecordAgentStatus handles POST /agents/:agent_id/status
+func RecordAgentStatus(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	agentId := c.Params("agent_id")
+
+	var body struct {
+		Status     string    `json:"status"`
+		Reason     string    `json:"reason"`
+		OccurredAt time.Time `json:"occurred_at"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	event, err := agentSvc.RecordStatus(c.Context(), companyId, agentId, body.Status, body.Reason, body.OccurredAt)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	if event == nil {
+		return utils.Error(c, fiber.StatusNotFound, "agent not found")
+	}
+	return c.Status(fiber.StatusCreated).JSON(utils.APIResponse{Success: true, Data: event})
+}
+
+// GetAgentStatusHistory handles GET /agents/:agent_id/status-history?from=...&to=...&limit=...&offset=...
+func GetAgentStatusHistory(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	agentId := c.Params("agent_id")
+	limit := c.QueryInt("limit", 20)
+	offset := c.QueryInt("offset", 0)
+
+	from, err := queryTime(c, "from")
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	to, err := queryTime(c, "to")
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	page, err := agentSvc.FetchStatusHistory(c.Context(), companyId, agentId, from, to, limit, offset)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+	return utils.SuccessWithTotal(c, page.Items, page.Total)
+}
+
+// GetAgentUptime handles GET /agents/:agent_id/uptime?from=...&to=...
+func GetAgentUptime(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	agentId := c.Params("agent_id")
+
+	from, to, err := queryPeriod(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	uptimes, err := agentSvc.Uptime(c.Context(), companyId, []string{agentId}, from, to)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	if len(uptimes) == 0 {
+		return utils.Error(c, fiber.StatusNotFound, "agent not found")
+	}
+	return utils.Success(c, uptimes[0])
+}
+
+// ListAgentsUptime handles GET /agents/uptime?agentids=...&from=...&to=...
+func ListAgentsUptime(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	var agentIds []string
+	if idsParam := c.Query("agentids"); idsParam != "" {
+		agentIds = strings.Split(idsParam, ",")
+	}
+
+	from, to, err := queryPeriod(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	uptimes, err := agentSvc.Uptime(c.Context(), companyId, agentIds, from, to)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	return utils.Success(c, uptimes)
+}
@@ -0,0 +1,174 @@
+// internal/handler/analytics.go
+package handler
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/utils"
+)
+
+var analyticsSvc service.AnalyticsService
+
+// RegisterAnalyticsService wires in the AnalyticsService implementation
+func RegisterAnalyticsService(svc service.AnalyticsService) {
+	analyticsSvc = svc
+}
+
+// GetAgentStats handles GET /agents/:agent_id/stats?from=...&to=...
+func GetAgentStats(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	agentId := c.Params("agent_id")
+
+	from, to, err := queryPeriod(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	agent, err := agentSvc.GetByAgentID(c.Context(), companyId, agentId)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+	if agent == nil {
+		return utils.Error(c, fiber.StatusNotFound, "agent not found")
+	}
+
+	stats, err := analyticsSvc.AgentStats(c.Context(), companyId, []string{agentId}, from, to)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	return utils.Success(c, stats[0])
+}
+
+// ListAgentsStats handles GET /agents/stats?agentids=...&from=...&to=...
+func ListAgentsStats(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	var agentIds []string
+	if idsParam := c.Query("agentids"); idsParam != "" {
+		agentIds = strings.Split(idsParam, ",")
+	}
+
+	from, to, err := queryPeriod(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	stats, err := analyticsSvc.AgentStats(c.Context(), companyId, agentIds, from, to)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	return utils.Success(c, stats)
+}
+
+// GetMessageVolume handles GET /analytics/messages?bucket=...&group_by=...&from=...&to=...
+// Filters: agent_id (comma-separated), flow, message_type
+func GetMessageVolume(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	from, to, err := queryPeriod(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	var groupBy []string
+	if groupParam := c.Query("group_by"); groupParam != "" {
+		groupBy = strings.Split(groupParam, ",")
+	}
+
+	// Build filter map
+	filter := make(map[string]interface{})
+	if agentParam := c.Query("agent_id"); agentParam != "" {
+		filter["agent_ids"] = strings.Split(agentParam, ",")
+	}
+	for _, key := range []string{"flow", "message_type"} {
+		if value := c.Query(key); value != "" {
+			filter[key] = value
+		}
+	}
+
+	volume, err := analyticsSvc.MessageVolume(c.Context(), companyId, filter, c.Query("bucket"), groupBy, from, to)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	return utils.Success(c, volume)
+}
+
+// GetResponseTimes handles GET /analytics/response-times?group_by=agent_id|assigned_to&agent_id=...&from=...&to=...
+func GetResponseTimes(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	from, to, err := queryPeriod(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	filter := make(map[string]interface{})
+	if agentParam := c.Query("agent_id"); agentParam != "" {
+		filter["agent_ids"] = strings.Split(agentParam, ",")
+	}
+
+	stats, err := analyticsSvc.ResponseTimes(c.Context(), companyId, filter, c.Query("group_by"), from, to)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	return utils.Success(c, stats)
+}
+
+// GetSLABreaches handles GET /analytics/sla-breaches?threshold=...&lookback_days=...&agent_id=...&assigned_to=...
+func GetSLABreaches(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	limit := c.QueryInt("limit", 20)
+	offset := c.QueryInt("offset", 0)
+
+	threshold, err := queryDuration(c, "threshold")
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	filter := make(map[string]interface{})
+	if agentParam := c.Query("agent_id"); agentParam != "" {
+		filter["agent_ids"] = strings.Split(agentParam, ",")
+	}
+	if _, ok := c.Queries()["assigned_to"]; ok {
+		filter["assigned_to"] = c.Query("assigned_to")
+	}
+
+	page, err := analyticsSvc.SLABreaches(c.Context(), companyId, filter, threshold, c.QueryInt("lookback_days", 0), limit, offset)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	return utils.SuccessWithTotal(c, page.Items, page.Total)
+}
+
+// GetContactFunnel handles GET /analytics/contacts?bucket=...&group_by=...&from=...&to=...
+// Filters: agent_id (comma-separated), origin
+func GetContactFunnel(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	from, to, err := queryPeriod(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	var groupBy []string
+	if groupParam := c.Query("group_by"); groupParam != "" {
+		groupBy = strings.Split(groupParam, ",")
+	}
+
+	// Build filter map
+	filter := make(map[string]interface{})
+	if agentParam := c.Query("agent_id"); agentParam != "" {
+		filter["agent_ids"] = strings.Split(agentParam, ",")
+	}
+	if _, ok := c.Queries()["origin"]; ok {
+		filter["origin"] = c.Query("origin")
+	}
+
+	funnel, err := analyticsSvc.ContactFunnel(c.Context(), companyId, filter, c.Query("bucket"), groupBy, from, to)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	return utils.Success(c, funnel)
+}
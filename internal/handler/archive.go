@@ -0,0 +1,74 @@
+// internal/handler/archive.go
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/utils"
+)
+
+var archiveSvc service.ArchiveService
+
+// RegisterArchiveService wires in the ArchiveService implementation
+func RegisterArchiveService(svc service.ArchiveService) {
+	archiveSvc = svc
+}
+
+// CreateArchive handles POST /archives
+// Starts archiving the month's partition and returns the archive (202)
+func CreateArchive(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	var in model.ArchiveRequest
+	if err := c.BodyParser(&in); err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+	}
+
+	archive, err := archiveSvc.Archive(c.Context(), companyId, in.Month)
+	switch {
+	case errors.Is(err, service.ErrInvalidArchive):
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrPartitionNotFound):
+		return utils.Error(c, fiber.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrArchiveExists):
+		return utils.Error(c, fiber.StatusConflict, err.Error())
+	case err != nil:
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(utils.APIResponse{Success: true, Data: archive})
+}
+
+// ListArchives handles GET /archives?limit=...&offset=...
+func ListArchives(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	page, err := archiveSvc.List(c.Context(), companyId, c.QueryInt("limit", 20), c.QueryInt("offset", 0))
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return utils.SuccessWithTotal(c, page.Items, page.Total)
+}
+
+// GetArchive handles GET /archives/:id
+func GetArchive(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return utils.Error(c, fiber.StatusBadRequest, "invalid archive id")
+	}
+
+	archive, err := archiveSvc.Get(c.Context(), companyId, int64(id))
+	if errors.Is(err, service.ErrArchiveNotFound) {
+		return utils.Error(c, fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return utils.Success(c, archive)
+}
@@ -0,0 +1,48 @@
+// internal/handler/audit.go
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/utils"
+)
+
+var auditSvc service.AuditService
+
+// RegisterAuditService wires in the AuditService implementation
+func RegisterAuditService(svc service.AuditService) {
+	auditSvc = svc
+}
+
+// FetchAuditLogs handles GET /audit?limit=...&offset=...&<filters>
+// Filters: entity_type, entity_id, actor, method, request_id, from, to
+func FetchAuditLogs(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	limit := c.QueryInt("limit", 20)
+	offset := c.QueryInt("offset", 0)
+
+	// Build filter map
+	filter := make(map[string]interface{})
+
+	for _, key := range []string{"entity_type", "entity_id", "actor", "method", "request_id"} {
+		if value := c.Query(key); value != "" {
+			filter[key] = value
+		}
+	}
+
+	// Time range on created_at
+	for _, key := range []string{"from", "to"} {
+		t, err := queryTime(c, key)
+		if err != nil {
+			return utils.Error(c, fiber.StatusBadRequest, err.Error())
+		}
+		filter[key] = t
+	}
+
+	page, err := auditSvc.FetchAuditLogs(c.Context(), companyId, filter, limit, offset)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return utils.SuccessWithTotal(c, page.Items, page.Total)
+}
@@ -37,6 +37,11 @@ func FetchChats(c *fiber.Ctx) error {
 		filter["assigned_to"] = assignedTo
 	}
 
+	// Phone number in any format (normalized to E.164 for matching)
+	if phoneNumber := c.Query("phone_number"); phoneNumber != "" {
+		filter["phone_number"] = phoneNumber
+	}
+
 	// Unread filter - convert to boolean
 	if hasUnreadStr := c.Query("has_unread"); hasUnreadStr != "" {
 		if hasUnread, err := strconv.ParseBool(hasUnreadStr); err == nil {
@@ -77,6 +82,10 @@ func FetchRangeChats(c *fiber.Ctx) error {
 		filter["assigned_to"] = assignedTo
 	}
 
+	if phoneNumber := c.Query("phone_number"); phoneNumber != "" {
+		filter["phone_number"] = phoneNumber
+	}
+
 	if hasUnreadStr := c.Query("has_unread"); hasUnreadStr != "" {
 		if hasUnread, err := strconv.ParseBool(hasUnreadStr); err == nil {
 			filter["has_unread"] = hasUnread
@@ -2,6 +2,7 @@
 package handler
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
@@ -67,12 +68,23 @@ func FetchContacts(c *fiber.Ctx) error {
 	return utils.SuccessWithTotal(c, page.Items, page.Total)
 }
 
-// GetContactByID handles GET /contacts/:id
+// GetContactByID handles GET /contacts/:id?as_of=...
+// With as_of the contact is reconstructed from its history as it was at that time
 func GetContactByID(c *fiber.Ctx) error {
 	companyId := c.Locals("companyId").(string)
 	id := c.Params("id")
 
-	contact, err := contactSvc.GetContactByID(c.Context(), companyId, id)
+	asOf, err := queryTime(c, "as_of")
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	var contact *model.Contact
+	if asOf.IsZero() {
+		contact, err = contactSvc.GetContactByID(c.Context(), companyId, id)
+	} else {
+		contact, err = contactSvc.GetContactAsOf(c.Context(), companyId, id, asOf)
+	}
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
 	}
@@ -80,9 +92,64 @@ func GetContactByID(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusNotFound, "contact not found")
 	}
 
+	c.Set(fiber.HeaderETag, service.ContactETag(contact))
 	return utils.Success(c, contact)
 }
 
+// FetchContactHistory handles GET /contacts/:id/history?limit=...&offset=...
+func FetchContactHistory(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	id := c.Params("id")
+	limit := c.QueryInt("limit", 20)
+	offset := c.QueryInt("offset", 0)
+
+	page, err := contactSvc.FetchContactHistory(c.Context(), companyId, id, limit, offset)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return utils.SuccessWithTotal(c, page.Items, page.Total)
+}
+
+// FindDuplicateContacts handles GET /contacts/duplicates?agent_id=...&limit=...&offset=...
+// Groups contacts whose phone numbers normalize to the same number
+func FindDuplicateContacts(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	agentId := c.Query("agent_id") // Optional filter
+	limit := c.QueryInt("limit", 20)
+	offset := c.QueryInt("offset", 0)
+
+	page, err := contactSvc.FindDuplicateContacts(c.Context(), companyId, agentId, limit, offset)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return utils.SuccessWithTotal(c, page.Items, page.Total)
+}
+
+// MergeContacts handles POST /contacts/merge
+func MergeContacts(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	var body model.ContactMergeInput
+	if err := c.BodyParser(&body); err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	merged, err := contactSvc.MergeContacts(c.Context(), companyId, body)
+	if errors.Is(err, service.ErrInvalidMerge) {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+	if merged == nil {
+		return utils.Error(c, fiber.StatusNotFound, "contact not found")
+	}
+
+	return utils.Success(c, merged)
+}
+
 // GetContactByPhoneAndAgent handles GET /contacts/by-phone?phone_number=...&agent_id=...
 func GetContactByPhoneAndAgent(c *fiber.Ctx) error {
 	companyId := c.Locals("companyId").(string)
@@ -105,6 +172,7 @@ func GetContactByPhoneAndAgent(c *fiber.Ctx) error {
 }
 
 // UpdateContact handles PATCH /contacts/:id
+// An If-Match header makes the update conditional on the contact's current ETag.
 func UpdateContact(c *fiber.Ctx) error {
 	companyId := c.Locals("companyId").(string)
 	id := c.Params("id")
@@ -114,7 +182,10 @@ func UpdateContact(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusBadRequest, err.Error())
 	}
 
-	updated, err := contactSvc.UpdateContact(c.Context(), companyId, id, body)
+	updated, err := contactSvc.UpdateContact(c.Context(), companyId, id, body, c.Get(fiber.HeaderIfMatch))
+	if errors.Is(err, service.ErrPreconditionFailed) {
+		return utils.Error(c, fiber.StatusPreconditionFailed, err.Error())
+	}
 	if err != nil {
 		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
 	}
@@ -122,6 +193,7 @@ func UpdateContact(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusNotFound, "contact not found")
 	}
 
+	c.Set(fiber.HeaderETag, service.ContactETag(updated))
 	return utils.Success(c, updated)
 }
 
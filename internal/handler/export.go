@@ -0,0 +1,102 @@
+// internal/handler/export.go
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/utils"
+)
+
+var exportSvc service.ExportService
+
+// RegisterExportService wires in the ExportService implementation
+func RegisterExportService(svc service.ExportService) {
+	exportSvc = svc
+}
+
+// CreateExport handles POST /exports
+// Queues the export and returns the pending job (202)
+func CreateExport(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	var in model.ExportRequest
+	if err := c.BodyParser(&in); err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+	}
+
+	job, err := exportSvc.Create(c.Context(), companyId, in)
+	if errors.Is(err, service.ErrInvalidExport) {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(utils.APIResponse{Success: true, Data: job})
+}
+
+// ListExports handles GET /exports?limit=...&offset=...
+func ListExports(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	page, err := exportSvc.List(c.Context(), companyId, c.QueryInt("limit", 20), c.QueryInt("offset", 0))
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return utils.SuccessWithTotal(c, page.Items, page.Total)
+}
+
+// GetExport handles GET /exports/:id
+// Returns the job status, progress and, once completed, its download link
+func GetExport(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return utils.Error(c, fiber.StatusBadRequest, "invalid export id")
+	}
+
+	job, err := exportSvc.Get(c.Context(), companyId, int64(id))
+	if errors.Is(err, service.ErrExportNotFound) {
+		return utils.Error(c, fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return utils.Success(c, job)
+}
+
+// DownloadExport handles GET /exports/:id/download
+// Streams the file of a completed export
+func DownloadExport(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return utils.Error(c, fiber.StatusBadRequest, "invalid export id")
+	}
+
+	body, job, err := exportSvc.Open(c.Context(), companyId, int64(id))
+	switch {
+	case errors.Is(err, service.ErrExportNotFound):
+		return utils.Error(c, fiber.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrExportNotReady):
+		return utils.Error(c, fiber.StatusConflict, err.Error())
+	case err != nil:
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	contentType := "application/x-ndjson"
+	if job.Format == model.ExportFormatCSV {
+		contentType = "text/csv; charset=utf-8"
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment",
+		map[string]string{"filename": fmt.Sprintf("%s-%d.%s", job.Kind, job.ID, job.Format)}))
+	return c.SendStream(body, int(job.FileSize))
+}
@@ -0,0 +1,63 @@
+// internal/handler/media.go
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/media"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/utils"
+)
+
+var mediaSvc service.MediaService
+
+// RegisterMediaService wires in the MediaService implementation
+func RegisterMediaService(svc service.MediaService) {
+	mediaSvc = svc
+}
+
+// GetMedia handles GET /media/:message_id?company=...&agent=...&chat=...&expires=...&sig=...
+// The signature replaces the bearer token, so the URL can be used directly by browsers.
+func GetMedia(c *fiber.Ctx) error {
+	messageId := c.Params("message_id")
+	companyId := c.Query("company")
+	agentId := c.Query("agent")
+	chatId := c.Query("chat")
+	sig := c.Query("sig")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || companyId == "" || agentId == "" || chatId == "" || sig == "" {
+		return utils.Error(c, fiber.StatusForbidden, media.ErrInvalidSignature.Error())
+	}
+
+	obj, err := mediaSvc.Open(c.Context(), companyId, agentId, chatId, messageId, expires, sig)
+	switch {
+	case errors.Is(err, media.ErrInvalidSignature), errors.Is(err, media.ErrURLExpired):
+		return utils.Error(c, fiber.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrMediaNotFound):
+		return utils.Error(c, fiber.StatusNotFound, err.Error())
+	case err != nil:
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	// Frontends on other origins embed media directly (helmet defaults to same-origin)
+	c.Set("Cross-Origin-Resource-Policy", "cross-origin")
+	// Caches may keep the response until the URL expires
+	maxAge := time.Until(time.Unix(expires, 0)) / time.Second
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("private, max-age=%d", maxAge))
+
+	if obj.RedirectURL != "" {
+		return c.Redirect(obj.RedirectURL, fiber.StatusFound)
+	}
+
+	c.Set(fiber.HeaderContentType, obj.ContentType)
+	if obj.FileName != "" {
+		c.Set(fiber.HeaderContentDisposition,
+			mime.FormatMediaType("inline", map[string]string{"filename": obj.FileName}))
+	}
+	return c.SendStream(obj.Body, int(obj.Size))
+}
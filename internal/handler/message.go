@@ -2,6 +2,8 @@
 package handler
 
 import (
+	"errors"
+
 	"github.com/gofiber/fiber/v2"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
 	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/utils"
@@ -14,7 +16,7 @@ func RegisterMessageService(svc service.MessageService) {
 	messageSvc = svc
 }
 
-// FetchMessagesByChatId handles GET /messages?agent_id=...&chat_id=...&limit=...&offset=...&sort=...&order=...
+// FetchMessagesByChatId handles GET /messages?agent_id=...&chat_id=...&limit=...&offset=...&sort=...&order=...&format=...&deleted=...&text=...
 // Returns paginated messages for a specific chat
 func FetchMessagesByChatId(c *fiber.Ctx) error {
 	companyId := c.Locals("companyId").(string)
@@ -30,7 +32,8 @@ func FetchMessagesByChatId(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusBadRequest, "agent_id and chat_id are required")
 	}
 
-	page, err := messageSvc.FetchMessagesByChatId(c.Context(), companyId, agentId, chatId, sort, order, limit, offset)
+	opts := messageOptions(c)
+	page, err := messageSvc.FetchMessagesByChatId(c.Context(), companyId, agentId, chatId, sort, order, limit, offset, opts)
 	if err != nil {
 		return utils.Error(c, fiber.StatusBadRequest, err.Error())
 	}
@@ -38,7 +41,7 @@ func FetchMessagesByChatId(c *fiber.Ctx) error {
 	return utils.SuccessWithTotal(c, page.Items, page.Total)
 }
 
-// FetchRangeMessagesByChatId handles GET /messages/range?agent_id=...&chat_id=...&start=...&end=...&sort=...&order=...
+// FetchRangeMessagesByChatId handles GET /messages/range?agent_id=...&chat_id=...&start=...&end=...&sort=...&order=...&format=...&deleted=...&text=...
 // Returns messages within a specific range for infinite scroll with total count
 func FetchRangeMessagesByChatId(c *fiber.Ctx) error {
 	companyId := c.Locals("companyId").(string)
@@ -54,10 +57,68 @@ func FetchRangeMessagesByChatId(c *fiber.Ctx) error {
 		return utils.Error(c, fiber.StatusBadRequest, "agent_id and chat_id are required")
 	}
 
-	page, err := messageSvc.FetchRangeMessagesByChatId(c.Context(), companyId, agentId, chatId, sort, order, start, end)
+	opts := messageOptions(c)
+	page, err := messageSvc.FetchRangeMessagesByChatId(c.Context(), companyId, agentId, chatId, sort, order, start, end, opts)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	return utils.SuccessWithTotal(c, page.Items, page.Total)
+}
+
+// GetMessageEdits handles GET /messages/:message_id/edits?agent_id=...&chat_id=...
+// Returns the original text of a message followed by its edits
+func GetMessageEdits(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	agentId := c.Query("agent_id")
+	chatId := c.Query("chat_id")
+
+	if agentId == "" || chatId == "" {
+		return utils.Error(c, fiber.StatusBadRequest, "agent_id and chat_id are required")
+	}
+
+	history, err := messageSvc.GetEditHistory(c.Context(), companyId, agentId, chatId, c.Params("message_id"))
+	if errors.Is(err, service.ErrMessageNotFound) {
+		return utils.Error(c, fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return utils.Success(c, history)
+}
+
+// FetchMessageReplies handles GET /messages/:message_id/replies?agent_id=...&chat_id=...&limit=...&offset=...
+// Returns the messages quoting a message, oldest first
+func FetchMessageReplies(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	agentId := c.Query("agent_id")
+	chatId := c.Query("chat_id")
+	limit := c.QueryInt("limit", 20)
+	offset := c.QueryInt("offset", 0)
+
+	if agentId == "" || chatId == "" {
+		return utils.Error(c, fiber.StatusBadRequest, "agent_id and chat_id are required")
+	}
+
+	page, err := messageSvc.FetchReplies(c.Context(), companyId, agentId, chatId, c.Params("message_id"), limit, offset, messageOptions(c))
+	if errors.Is(err, service.ErrMessageNotFound) {
+		return utils.Error(c, fiber.StatusNotFound, err.Error())
+	}
 	if err != nil {
 		return utils.Error(c, fiber.StatusBadRequest, err.Error())
 	}
 
 	return utils.SuccessWithTotal(c, page.Items, page.Total)
 }
+
+// messageOptions reads the presentation parameters shared by the message list endpoints
+func messageOptions(c *fiber.Ctx) service.MessageOptions {
+	return service.MessageOptions{
+		Format:    c.Query("format"),
+		Deleted:   c.Query("deleted"),
+		Text:      c.Query("text"),
+		FromPhone: c.Query("from_phone"),
+		ToPhone:   c.Query("to_phone"),
+	}
+}
@@ -0,0 +1,53 @@
+// internal/handler/params.go
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// queryTime parses an optional time query parameter.
+// Accepts RFC3339 timestamps or plain dates (YYYY-MM-DD, UTC midnight);
+// a missing parameter yields the zero time.
+func queryTime(c *fiber.Ctx, key string) (time.Time, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC3339 timestamp or YYYY-MM-DD date", key)
+}
+
+// queryPeriod parses the optional from and to query parameters.
+func queryPeriod(c *fiber.Ctx) (time.Time, time.Time, error) {
+	from, err := queryTime(c, "from")
+	if err != nil {
+		return from, from, err
+	}
+	to, err := queryTime(c, "to")
+	return from, to, err
+}
+
+// queryDuration parses an optional duration ("15m", "2h") or a number of seconds.
+func queryDuration(c *fiber.Ctx, key string) (time.Duration, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration (e.g. 15m) or a number of seconds", key)
+	}
+	return d, nil
+}
@@ -0,0 +1,99 @@
+// internal/handler/privacy.go
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/utils"
+)
+
+var privacySvc service.PrivacyService
+
+// RegisterPrivacyService wires in the PrivacyService implementation
+func RegisterPrivacyService(svc service.PrivacyService) {
+	privacySvc = svc
+}
+
+// privacyRequest parses the body of the /privacy endpoints
+func privacyRequest(c *fiber.Ctx) (model.PrivacyRequest, error) {
+	var in model.PrivacyRequest
+	if err := c.BodyParser(&in); err != nil {
+		return in, errors.New("invalid request body")
+	}
+	if in.PhoneNumber == "" {
+		return in, errors.New("phone_number is required")
+	}
+	return in, nil
+}
+
+func privacyError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidPrivacyRequest):
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrPrivacySubjectNotFound):
+		return utils.Error(c, fiber.StatusNotFound, err.Error())
+	}
+	return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+}
+
+// ErasePrivacySubject handles POST /privacy/erase
+// Body: { phone_number, agent_id? }
+func ErasePrivacySubject(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	in, err := privacyRequest(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	entry, err := privacySvc.Erase(c.Context(), companyId, in)
+	if err != nil {
+		return privacyError(c, err)
+	}
+
+	return utils.Success(c, entry)
+}
+
+// ExportPrivacySubject handles POST /privacy/export
+// Body: { phone_number, agent_id? }; streams a JSON bundle as an attachment
+func ExportPrivacySubject(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	in, err := privacyRequest(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	subject, err := privacySvc.PrepareExport(c.Context(), companyId, in)
+	if err != nil {
+		return privacyError(c, err)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment",
+		map[string]string{"filename": "privacy-export-" + strconv.FormatInt(subject.LogID, 10) + ".json"}))
+
+	streamBody(c, "privacy export", func(ctx context.Context, w io.Writer) error {
+		return privacySvc.WriteExport(ctx, companyId, subject, w)
+	})
+	return nil
+}
+
+// ListPrivacyLog handles GET /privacy/log?limit=...&offset=...
+func ListPrivacyLog(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	page, err := privacySvc.ListLog(c.Context(), companyId, c.QueryInt("limit", 20), c.QueryInt("offset", 0))
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return utils.SuccessWithTotal(c, page.Items, page.Total)
+}
@@ -0,0 +1,99 @@
+// internal/handler/retention.go
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/utils"
+)
+
+var retentionSvc service.RetentionService
+
+// RegisterRetentionService wires in the RetentionService implementation
+func RegisterRetentionService(svc service.RetentionService) {
+	retentionSvc = svc
+}
+
+// GetRetentionPolicies handles GET /retention
+func GetRetentionPolicies(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	policies, err := retentionSvc.GetPolicies(c.Context(), companyId)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return utils.Success(c, policies)
+}
+
+// SetRetentionPolicy handles PUT /retention (company default)
+func SetRetentionPolicy(c *fiber.Ctx) error {
+	return saveRetentionPolicy(c, "")
+}
+
+// SetAgentRetentionPolicy handles PUT /retention/agents/:agent_id
+func SetAgentRetentionPolicy(c *fiber.Ctx) error {
+	return saveRetentionPolicy(c, c.Params("agent_id"))
+}
+
+func saveRetentionPolicy(c *fiber.Ctx, agentId string) error {
+	companyId := c.Locals("companyId").(string)
+
+	var in model.RetentionPolicyInput
+	if err := c.BodyParser(&in); err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, "invalid request body")
+	}
+
+	policy, err := retentionSvc.SetPolicy(c.Context(), companyId, agentId, in)
+	if errors.Is(err, service.ErrInvalidRetentionPolicy) {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return utils.Success(c, policy)
+}
+
+// DeleteAgentRetentionPolicy handles DELETE /retention/agents/:agent_id
+func DeleteAgentRetentionPolicy(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	err := retentionSvc.DeletePolicy(c.Context(), companyId, c.Params("agent_id"))
+	if errors.Is(err, service.ErrRetentionPolicyNotFound) {
+		return utils.Error(c, fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// GetRetentionReport handles GET /retention/report
+// Dry run: reports what the next enforcement would remove, without removing anything
+func GetRetentionReport(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	report, err := retentionSvc.Report(c.Context(), companyId)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return utils.Success(c, report)
+}
+
+// ListRetentionRuns handles GET /retention/runs?limit=...&offset=...
+func ListRetentionRuns(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+
+	page, err := retentionSvc.ListRuns(c.Context(), companyId, c.QueryInt("limit", 20), c.QueryInt("offset", 0))
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return utils.SuccessWithTotal(c, page.Items, page.Total)
+}
@@ -0,0 +1,37 @@
+// internal/handler/stream.go
+package handler
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+var log = zap.NewNop()
+
+// RegisterLogger wires in the logger of failures that can no longer be reported
+// in the response, such as those of streamed bodies
+func RegisterLogger(l *zap.Logger) {
+	log = l
+}
+
+// streamBody streams the response body produced by write once the handler has
+// returned. write runs with the request context, which ends when the server shuts
+// down. When it fails the error is logged and the connection closed, so the client
+// sees a truncated response instead of a complete-looking one.
+func streamBody(c *fiber.Ctx, name string, write func(ctx context.Context, w io.Writer) error) {
+	ctx := c.Context()
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		err := write(ctx, w)
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			log.Error("Failed to stream response body", zap.String("body", name), zap.Error(err))
+			_ = ctx.Conn().Close()
+		}
+	})
+}
@@ -0,0 +1,61 @@
+// internal/handler/transcript.go
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/transcript"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/utils"
+)
+
+var transcriptSvc service.TranscriptService
+
+// RegisterTranscriptService wires in the TranscriptService implementation
+func RegisterTranscriptService(svc service.TranscriptService) {
+	transcriptSvc = svc
+}
+
+// GetChatTranscript handles GET /chats/:chat_id/transcript?format=...&agent_id=...&from=...&to=...&tz=...
+// Streams every message of the chat; errors are only reported before streaming starts.
+func GetChatTranscript(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	chatId := c.Params("chat_id")
+	// Cloned: Fiber reuses query buffers once the handler returns, before the body is streamed
+	format := strings.Clone(c.Query("format", transcript.FormatText))
+
+	if !transcript.Valid(format) {
+		return utils.Error(c, fiber.StatusBadRequest, "format must be txt, jsonl, html or pdf")
+	}
+	from, to, err := queryPeriod(c)
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+	loc, err := time.LoadLocation(c.Query("tz", "UTC"))
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, "tz must be an IANA time zone such as Asia/Jakarta")
+	}
+
+	header, err := transcriptSvc.Prepare(c.Context(), companyId, chatId, c.Query("agent_id"), from, to, loc)
+	if errors.Is(err, service.ErrChatNotFound) {
+		return utils.Error(c, fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return utils.Error(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	c.Set(fiber.HeaderContentType, transcript.ContentType(format))
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment",
+		map[string]string{"filename": "transcript-" + header.ChatID + "." + format}))
+
+	streamBody(c, "transcript", func(ctx context.Context, w io.Writer) error {
+		return transcriptSvc.Write(ctx, companyId, header, format, w)
+	})
+	return nil
+}
@@ -0,0 +1,27 @@
+// internal/handler/usage.go
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/utils"
+)
+
+var rateLimitSvc service.RateLimitService
+
+// RegisterRateLimitService wires in the RateLimitService implementation
+func RegisterRateLimitService(svc service.RateLimitService) {
+	rateLimitSvc = svc
+}
+
+// GetUsage handles GET /usage?months=12
+func GetUsage(c *fiber.Ctx) error {
+	companyId := c.Locals("companyId").(string)
+	months := c.QueryInt("months", 12)
+
+	report, err := rateLimitSvc.Usage(c.Context(), companyId, months)
+	if err != nil {
+		return utils.Error(c, fiber.StatusInternalServerError, err.Error())
+	}
+	return utils.Success(c, report)
+}
@@ -0,0 +1,76 @@
+// Package media signs the time-limited URLs message attachments are served through.
+package media
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidSignature is returned when a media URL was not signed by this server
+	ErrInvalidSignature = errors.New("invalid media signature")
+	// ErrURLExpired is returned when a media URL is past its expiry
+	ErrURLExpired = errors.New("media URL expired")
+	// ErrNoSecret is returned when a signer is created without a secret
+	ErrNoSecret = errors.New("media URL secret is required")
+)
+
+// Signer issues and verifies HMAC-SHA256 signed media URLs of the form
+// <baseURL>/media/<messageId>?company=<companyId>&agent=<agentId>&chat=<chatId>&expires=<unix>&sig=<hex>.
+// The agent and chat are signed too, since message ids are only unique within a chat.
+type Signer struct {
+	secret  []byte
+	ttl     time.Duration
+	baseURL string
+}
+
+// NewSigner returns a signer whose URLs stay valid for ttl. baseURL is the public
+// origin of the API (e.g. https://api.example.com); empty yields relative URLs.
+func NewSigner(secret string, ttl time.Duration, baseURL string) (*Signer, error) {
+	if secret == "" {
+		return nil, ErrNoSecret
+	}
+	return &Signer{
+		secret:  []byte(secret),
+		ttl:     ttl,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}, nil
+}
+
+// URL returns a signed URL for the message's media and its expiry time.
+func (s *Signer) URL(companyId, agentId, chatId, messageId string, now time.Time) (string, time.Time) {
+	expiresAt := now.Add(s.ttl).Truncate(time.Second)
+	expires := expiresAt.Unix()
+
+	q := url.Values{}
+	q.Set("company", companyId)
+	q.Set("agent", agentId)
+	q.Set("chat", chatId)
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sig", s.signature(companyId, agentId, chatId, messageId, expires))
+	return s.baseURL + "/media/" + url.PathEscape(messageId) + "?" + q.Encode(), expiresAt
+}
+
+// Verify checks a signature produced by URL.
+func (s *Signer) Verify(companyId, agentId, chatId, messageId string, expires int64, sig string, now time.Time) error {
+	expected := s.signature(companyId, agentId, chatId, messageId, expires)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(sig))) {
+		return ErrInvalidSignature
+	}
+	if now.Unix() > expires {
+		return ErrURLExpired
+	}
+	return nil
+}
+
+func (s *Signer) signature(companyId, agentId, chatId, messageId string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strings.Join([]string{companyId, agentId, chatId, messageId, strconv.FormatInt(expires, 10)}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/audit"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
+	"go.uber.org/zap"
+)
+
+// Audit records every successful POST/PUT/PATCH/DELETE in the tenant's audit trail.
+// Must run after AuthenticateBearerToken. Repositories describe the row they changed
+// via audit.Track; otherwise the entity is derived from the route (/contacts/:id → contact, :id).
+// Handlers may opt out with audit.Skip. A failed audit write is logged but never fails the request.
+func Audit(svc service.AuditService, log *zap.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		default:
+			return c.Next()
+		}
+
+		change := &audit.Change{}
+		c.Locals(audit.LocalsKey, change)
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if status >= fiber.StatusBadRequest || change.Skip {
+			return nil
+		}
+
+		companyId, _ := c.Locals("companyId").(string)
+		actor, _ := c.Locals("actor").(string)
+		requestId, _ := c.Locals("requestid").(string)
+
+		entry := &model.AuditLog{
+			Actor:      actor,
+			Method:     c.Method(),
+			Route:      c.Route().Path,
+			Path:       c.Path(),
+			EntityType: change.EntityType,
+			EntityID:   change.EntityID,
+			RequestID:  requestId,
+			StatusCode: status,
+			Before:     marshalChange(change.Before),
+			After:      marshalChange(change.After),
+		}
+		if entry.EntityType == "" {
+			entry.EntityType = entityFromRoute(c.Route().Path)
+		}
+		if entry.EntityID == "" && len(c.Route().Params) > 0 {
+			entry.EntityID = c.Params(c.Route().Params[0])
+		}
+
+		if err := svc.Record(context.Background(), companyId, entry); err != nil {
+			log.Error("Failed to record audit log",
+				zap.String("company_id", companyId),
+				zap.String("route", entry.Route),
+				zap.String("request_id", requestId),
+				zap.Error(err),
+			)
+		}
+		return nil
+	}
+}
+
+// entityFromRoute derives a singular entity name from the first path segment after /api/v1.
+func entityFromRoute(route string) string {
+	route = strings.TrimPrefix(route, "/api/v1/")
+	resource, _, _ := strings.Cut(route, "/")
+	return strings.TrimSuffix(resource, "s")
+}
+
+func marshalChange(fields map[string]interface{}) []byte {
+	if len(fields) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
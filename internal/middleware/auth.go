@@ -1,12 +1,25 @@
 package middleware
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/utils"
 )
 
+// HeaderActor lets the integration name the end user acting through its token
+// (e.g. an operator's email); it is recorded as the actor of audited changes.
+const HeaderActor = "X-Actor"
+
+// maxActorLength bounds the X-Actor header
+const maxActorLength = 255
+
+// AuthenticateBearerToken decrypts the bearer token and stores the caller in locals:
+//   - companyId: the tenant the token belongs to (the whole decrypted token)
+//   - tokenId: a short fingerprint identifying the API key itself
+//   - actor: the caller identity, taken from the X-Actor header, or "token:<tokenId>"
 func AuthenticateBearerToken() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
@@ -22,7 +35,23 @@ func AuthenticateBearerToken() fiber.Handler {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
 		}
 
+		sum := sha256.Sum256([]byte(tokenString))
+		tokenId := hex.EncodeToString(sum[:8])
+
+		actor := strings.TrimSpace(c.Get(HeaderActor))
+		if len(actor) > maxActorLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "X-Actor must be at most 255 characters"})
+		}
+		if actor == "" {
+			actor = "token:" + tokenId
+		} else {
+			// The header value is only valid during the request; the actor outlives it
+			actor = strings.Clone(actor)
+		}
+
 		c.Locals("companyId", decryptedToken)
+		c.Locals("tokenId", tokenId)
+		c.Locals("actor", actor)
 
 		return c.Next()
 	}
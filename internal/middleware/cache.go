@@ -1,34 +1,99 @@
 package middleware
 
 import (
-	"fmt"
-	"time"
+	"encoding/json"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	fibercache "github.com/gofiber/fiber/v2/middleware/cache"
+	"github.com/gofiber/fiber/v2/utils"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
 )
 
-// Cache returns a Fiber middleware that caches GET responses in-memory.
-// - 5 minute expiration
-// - honors Cache-Control headers
+// cachedResponse is a response as kept in the cache store
+type cachedResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	ETag        string `json:"etag,omitempty"`
+	Body        []byte `json:"body"`
+}
+
+// Cache returns a Fiber middleware that caches successful GET responses per company
+// in the shared cache store (see package cache).
+// - entries are attached to tags; "{param}" in a tag stands for the route parameter
+// - writes to the tagged resources purge the entries immediately
+// - a response built while one of its tags was purged is not stored
+// - X-Cache tells hit or miss
+// - Cache-Control: no-cache refreshes the entry, no-store bypasses the cache
 // - bypass with ?refresh=true
-func Cache() fiber.Handler {
-	return fibercache.New(fibercache.Config{
-		Expiration:   1 * time.Minute,
-		CacheControl: true,
-		// Optional manual bypass
-		Next: func(c *fiber.Ctx) bool {
-			return c.Query("refresh") == "true"
-		},
-
-		// Key includes companyId from token
-		KeyGenerator: func(c *fiber.Ctx) string {
-			companyId, ok := c.Locals("companyId").(string)
-			if !ok || companyId == "" {
-				// fallback to unauthenticated cache (or avoid caching)
-				return "cache:unknown:" + c.OriginalURL()
+func Cache(tags ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		companyId, ok := c.Locals("companyId").(string)
+		if !ok || companyId == "" || c.Method() != fiber.MethodGet || !cache.Enabled() ||
+			c.Query("refresh") == "true" || hasCacheDirective(c, "no-store") {
+			return c.Next()
+		}
+
+		key := utils.CopyString(c.OriginalURL())
+		if !hasCacheDirective(c, "no-cache") {
+			if raw, ok := cache.Get(c.Context(), companyId, key); ok {
+				var entry cachedResponse
+				if err := json.Unmarshal(raw, &entry); err == nil {
+					c.Set("X-Cache", "hit")
+					c.Set(fiber.HeaderContentType, entry.ContentType)
+					if entry.ETag != "" {
+						c.Set(fiber.HeaderETag, entry.ETag)
+					}
+					return c.Status(entry.Status).Send(entry.Body)
+				}
+			}
+		}
+
+		// read before the handler, so a write committed while it runs keeps its
+		// response out of the cache
+		entryTags := resolveTags(c, tags)
+		generation, cacheable := cache.Generation(c.Context(), companyId, entryTags...)
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+		c.Set("X-Cache", "miss")
+		if !cacheable || c.Response().StatusCode() != fiber.StatusOK {
+			return nil
+		}
+		raw, err := json.Marshal(cachedResponse{
+			Status:      fiber.StatusOK,
+			ContentType: string(c.Response().Header.ContentType()),
+			ETag:        string(c.Response().Header.Peek(fiber.HeaderETag)),
+			Body:        c.Response().Body(),
+		})
+		if err == nil {
+			cache.Set(c.Context(), companyId, key, raw, generation, entryTags...)
+		}
+		return nil
+	}
+}
+
+// hasCacheDirective tells whether the request's Cache-Control carries directive
+func hasCacheDirective(c *fiber.Ctx, directive string) bool {
+	for _, d := range strings.Split(c.Get(fiber.HeaderCacheControl), ",") {
+		if strings.EqualFold(strings.TrimSpace(d), directive) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTags replaces "{param}" in tags with the route parameter
+func resolveTags(c *fiber.Ctx, tags []string) []string {
+	resolved := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if start := strings.IndexByte(tag, '{'); start >= 0 {
+			if end := strings.IndexByte(tag[start:], '}'); end > 0 {
+				param := utils.CopyString(c.Params(tag[start+1 : start+end]))
+				tag = tag[:start] + param + tag[start+end+1:]
 			}
-			return fmt.Sprintf("cache:%s:%s", companyId, c.OriginalURL())
-		},
-	})
+		}
+		resolved = append(resolved, tag)
+	}
+	return resolved
 }
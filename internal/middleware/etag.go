@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/etag"
+)
+
+// ETag returns a Fiber middleware for conditional GET requests.
+// - successful responses get an ETag: the handler's own, or a hash of the body
+// - a matching If-None-Match is answered with 304 Not Modified and no body
+// - streamed responses (downloads, exports) are left untouched
+// - so are routes marked with SkipETag
+func ETag() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+			return c.Next()
+		}
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		res := c.Response()
+		if skip, _ := c.Locals(skipETagKey).(bool); skip || res.StatusCode() != fiber.StatusOK || res.IsBodyStream() {
+			return nil
+		}
+		tag := string(res.Header.Peek(fiber.HeaderETag))
+		if tag == "" {
+			tag = etag.Of(res.Body())
+			c.Set(fiber.HeaderETag, tag)
+		}
+
+		if etag.NoneMatch(c.Get(fiber.HeaderIfNoneMatch), tag) {
+			res.ResetBody()
+			c.Status(fiber.StatusNotModified)
+		}
+		return nil
+	}
+}
+
+const skipETagKey = "skipETag"
+
+// SkipETag returns a Fiber middleware that keeps ETag from tagging the route's
+// responses, for bodies that change on every request although the resource does
+// not (e.g. message lists carrying signed media URLs).
+func SkipETag() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(skipETagKey, true)
+		return c.Next()
+	}
+}
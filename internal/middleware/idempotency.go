@@ -1,12 +1,132 @@
 package middleware
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
-	idempotency "github.com/gofiber/fiber/v2/middleware/idempotency"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// HeaderIdempotencyKey identifies a retryable request
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// headerLegacyIdempotencyKey is still accepted from clients of the former in-memory middleware
+	headerLegacyIdempotencyKey = "X-Idempotency-Key"
+	// HeaderIdempotentReplayed marks a response replayed from the idempotency store
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
 )
 
-// Idempotency returns Fiber’s built-in idempotency middleware.
-// You can pass in an optional idempotency.Config to tweak store, header names, etc.
-func Idempotency(cfg ...idempotency.Config) fiber.Handler {
-	return idempotency.New(cfg...)
+// replayedHeaders are the response headers stored with the body and replayed
+var replayedHeaders = []string{
+	fiber.HeaderContentType,
+	fiber.HeaderContentDisposition,
+	fiber.HeaderETag,
+	fiber.HeaderLastModified,
+	fiber.HeaderLocation,
+}
+
+// Idempotency returns a Fiber middleware making POST/PUT/PATCH/DELETE requests with an
+// Idempotency-Key safe to retry, across replicas and restarts.
+// Must run after AuthenticateBearerToken: keys are scoped to the company.
+// - the first request runs; its response (below 500) and replayedHeaders are stored for the key's lifetime
+// - a retry with the same method, URL and body gets the stored response (Idempotent-Replayed: true)
+// - the same key with a different request is rejected with 422
+// - a retry while the first request still runs is rejected with 409, until its lock times out
+// - a failed request (error, panic or 5xx) frees the key so it can be retried
+func Idempotency(svc service.IdempotencyService, log *zap.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		default:
+			return c.Next()
+		}
+
+		key := c.Get(HeaderIdempotencyKey)
+		if key == "" {
+			key = c.Get(headerLegacyIdempotencyKey)
+		}
+		companyId, _ := c.Locals("companyId").(string)
+		if key == "" || companyId == "" {
+			return c.Next()
+		}
+		// The header value is only valid during the request; the key outlives it
+		key = strings.Clone(key)
+
+		stored, err := svc.Begin(c.Context(), companyId, key, requestFingerprint(c))
+		switch {
+		case errors.Is(err, service.ErrInvalidIdempotencyKey):
+			return utils.Error(c, fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrIdempotencyKeyReused):
+			return utils.Error(c, fiber.StatusUnprocessableEntity, err.Error())
+		case errors.Is(err, service.ErrIdempotencyKeyInProgress):
+			return utils.Error(c, fiber.StatusConflict, err.Error())
+		case err != nil:
+			log.Error("Failed to reserve idempotency key", zap.String("company_id", companyId), zap.Error(err))
+			return utils.Error(c, fiber.StatusInternalServerError, "idempotency store unavailable")
+		case stored.Completed:
+			var headers map[string]string
+			if len(stored.Headers) > 0 {
+				if err := json.Unmarshal(stored.Headers, &headers); err != nil {
+					log.Error("Invalid stored idempotent response headers", zap.String("company_id", companyId), zap.Error(err))
+				}
+			}
+			for name, value := range headers {
+				c.Set(name, value)
+			}
+			c.Set(HeaderIdempotentReplayed, "true")
+			return c.Status(stored.StatusCode).Send(stored.Body)
+		}
+
+		// Free the key unless the response is stored, also when the handler panics
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := svc.Release(context.Background(), companyId, stored); err != nil {
+				log.Error("Failed to release idempotency key", zap.String("company_id", companyId), zap.Error(err))
+			}
+		}()
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+		res := c.Response()
+		if res.StatusCode() >= fiber.StatusInternalServerError || res.IsBodyStream() {
+			return nil
+		}
+
+		headers := make(map[string]string, len(replayedHeaders))
+		for _, name := range replayedHeaders {
+			if value := res.Header.Peek(name); len(value) > 0 {
+				headers[name] = string(value)
+			}
+		}
+		// The request took effect: a response failing to be stored keeps the key
+		// locked rather than freeing it for a second run
+		completed = true
+		body := append([]byte(nil), res.Body()...)
+		if err := svc.Complete(context.Background(), companyId, stored, res.StatusCode(), headers, body); err != nil {
+			log.Error("Failed to store idempotent response", zap.String("company_id", companyId), zap.Error(err))
+		}
+		return nil
+	}
+}
+
+// requestFingerprint hashes what makes a request distinct: method, URL and body.
+func requestFingerprint(c *fiber.Ctx) string {
+	h := sha256.New()
+	h.Write([]byte(c.Method()))
+	h.Write([]byte{0})
+	h.Write([]byte(c.OriginalURL()))
+	h.Write([]byte{0})
+	h.Write(c.Body())
+	return hex.EncodeToString(h.Sum(nil))
 }
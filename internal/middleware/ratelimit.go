@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/service"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// usagePath stays reachable once the monthly quota is used up
+const usagePath = "/api/v1/usage"
+
+// RateLimit returns a Fiber middleware enforcing the company's rate limits and
+// monthly quota. Must run after AuthenticateBearerToken.
+// - responses carry RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy
+// - refused requests get 429 Too Many Requests with Retry-After
+// - when the limiter is unavailable requests are let through and the failure is logged
+func RateLimit(svc service.RateLimitService, log *zap.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		companyId, _ := c.Locals("companyId").(string)
+		if companyId == "" {
+			return c.Next()
+		}
+		tokenId, _ := c.Locals("tokenId").(string)
+
+		decision, err := svc.Allow(c.Context(), companyId, tokenId, c.Path(), c.Path() != usagePath)
+		if err != nil {
+			log.Warn("Rate limiter unavailable", zap.String("company_id", companyId), zap.Error(err))
+		}
+		if decision == nil {
+			return c.Next()
+		}
+
+		if decision.Limit > 0 {
+			reset := seconds(decision.Reset)
+			c.Set("RateLimit-Limit", strconv.FormatInt(decision.Limit, 10))
+			c.Set("RateLimit-Remaining", strconv.FormatInt(decision.Remaining, 10))
+			c.Set("RateLimit-Reset", strconv.FormatInt(reset, 10))
+			c.Set("RateLimit-Policy", strconv.FormatInt(decision.Limit, 10)+";w="+strconv.FormatInt(seconds(decision.Window), 10))
+			if !decision.Allowed {
+				c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(reset, 10))
+			}
+		}
+
+		switch {
+		case decision.QuotaExceeded:
+			c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(seconds(time.Until(decision.QuotaResetAt)), 10))
+			return utils.Error(c, fiber.StatusTooManyRequests, "monthly request quota exceeded")
+		case !decision.Allowed:
+			return utils.Error(c, fiber.StatusTooManyRequests, "rate limit exceeded")
+		}
+		return c.Next()
+	}
+}
+
+// seconds rounds a duration up to whole seconds
+func seconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
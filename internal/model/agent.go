@@ -12,6 +12,9 @@ type Agent struct {
 	AgentID string `json:"agent_id" gorm:"column:agent_id;uniqueIndex" validate:"required"`
 	// QRCode is the QR code content used for linking/pairing the agent, if applicable.
 	QRCode string `json:"qr_code" gorm:"column:qr_code"`
+	// QRExpiresAt is when the current QR code stops being valid; expired codes are not returned.
+	// Written only by updates (the column is added on first use).
+	QRExpiresAt *time.Time `json:"qr_expires_at" gorm:"column:qr_expires_at;<-:update"`
 	// Status indicates the current connection status of the agent (e.g., 'connected', 'disconnected').
 	Status string `json:"status" gorm:"column:status"`
 	// AgentName is a user-defined custom label or name for the agent.
@@ -23,8 +26,129 @@ type Agent struct {
 	Version string `json:"version" gorm:"column:version"`
 	// CompanyID identifies the company/tenant this agent belongs to.
 	CompanyID string `json:"company_id" gorm:"column:company_id"` // CompanyID is implicitly the tenant ID
+	// LastSeen is the time of the last heartbeat; nil for agents that never sent one.
+	// Written only by heartbeats (the column is added on first use).
+	LastSeen *time.Time `json:"last_seen" gorm:"column:last_seen;<-:update"`
+	// DeletedAt is set when the agent is soft-deleted; such agents and their chats are hidden.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"column:deleted_at;<-:update"`
+	// Stale reports that heartbeats stopped for longer than the configured silence.
+	Stale bool `json:"stale" gorm:"-"`
 	// CreatedAt is the timestamp when the agent record was first created.
 	CreatedAt time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
 	// UpdatedAt is the timestamp when the agent record was last updated.
 	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
 }
+
+// AgentUpdateInput with pointer fields to allow partial updates
+type AgentUpdateInput struct {
+	AgentName   *string `json:"agent_name,omitempty"`
+	HostName    *string `json:"host_name,omitempty"`
+	PhoneNumber *string `json:"phone_number,omitempty"`
+	Version     *string `json:"version,omitempty"`
+	Status      *string `json:"status,omitempty"`
+	// QRCode starts a new pairing round; an empty string clears the code.
+	QRCode *string `json:"qr_code,omitempty"`
+	// QRTTLSeconds overrides how long a new QR code stays valid.
+	QRTTLSeconds *int `json:"qr_ttl_seconds,omitempty"`
+}
+
+// AgentQR is the pairing state returned by the QR long-poll.
+type AgentQR struct {
+	AgentID     string     `json:"agent_id"`
+	Status      string     `json:"status"`
+	QRCode      string     `json:"qr_code"`
+	QRExpiresAt *time.Time `json:"qr_expires_at"`
+	// Connected is true once pairing finished; QRCode is empty then.
+	Connected bool `json:"connected"`
+	// Changed is false when the poll timed out without a new code.
+	Changed bool `json:"changed"`
+}
+
+// Agent connection statuses reported by the WhatsApp client.
+const (
+	AgentStatusConnected    = "connected"
+	AgentStatusDisconnected = "disconnected"
+	AgentStatusQRPending    = "qr_pending"
+	// AgentStatusStale is set by the server when an agent stops sending heartbeats.
+	AgentStatusStale = "stale"
+)
+
+// AgentStatusEvent records one status transition of an agent.
+type AgentStatusEvent struct {
+	ID      int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	AgentID string `json:"agent_id" gorm:"column:agent_id"`
+	// Status is the new status; PreviousStatus is what the agent had before the transition.
+	Status         string `json:"status" gorm:"column:status"`
+	PreviousStatus string `json:"previous_status" gorm:"column:previous_status"`
+	// Reason is an optional free-text explanation (e.g. "logged out from phone").
+	Reason string `json:"reason,omitempty" gorm:"column:reason"`
+	// OccurredAt is when the transition happened on the agent; CreatedAt when it was recorded.
+	OccurredAt time.Time `json:"occurred_at" gorm:"column:occurred_at"`
+	CreatedAt  time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+}
+
+type AgentStatusEventPage struct {
+	Total int64              `json:"total"`
+	Items []AgentStatusEvent `json:"items"`
+}
+
+// AgentUptime summarizes an agent's statuses over [From, To).
+type AgentUptime struct {
+	AgentID string    `json:"agent_id"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	// StatusSeconds is the time spent in each status; time before the first known event is "unknown".
+	StatusSeconds map[string]int64 `json:"status_seconds"`
+	// UptimePercent is the connected share of the time with a known status.
+	UptimePercent float64 `json:"uptime_percent"`
+	// Transitions is the number of status changes inside the period.
+	Transitions int `json:"transitions"`
+}
+
+// Agent deletion modes
+const (
+	// AgentDeleteRestrict refuses to delete an agent that still has chats, contacts or messages.
+	AgentDeleteRestrict = "restrict"
+	// AgentDeleteSoft hides the agent and its chats but keeps every row.
+	AgentDeleteSoft = "soft"
+	// AgentDeletePurge deletes the agent with all its chats, contacts and messages in a background job.
+	AgentDeletePurge = "purge"
+)
+
+// AgentDataCounts is the amount of data still attached to an agent.
+type AgentDataCounts struct {
+	Chats    int64 `json:"chats"`
+	Contacts int64 `json:"contacts"`
+	Messages int64 `json:"messages"`
+}
+
+// Purge job statuses
+const (
+	PurgeJobPending   = "pending"
+	PurgeJobRunning   = "running"
+	PurgeJobCompleted = "completed"
+	PurgeJobFailed    = "failed"
+)
+
+// AgentPurgeJob tracks the background deletion of an agent and its data.
+type AgentPurgeJob struct {
+	ID      int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	AgentID string `json:"agent_id" gorm:"column:agent_id"`
+	Status  string `json:"status" gorm:"column:status"`
+	// Total* are the rows found when the job started; Deleted* the rows removed so far.
+	TotalChats      int64  `json:"total_chats" gorm:"column:total_chats"`
+	TotalContacts   int64  `json:"total_contacts" gorm:"column:total_contacts"`
+	TotalMessages   int64  `json:"total_messages" gorm:"column:total_messages"`
+	DeletedChats    int64  `json:"deleted_chats" gorm:"column:deleted_chats"`
+	DeletedContacts int64  `json:"deleted_contacts" gorm:"column:deleted_contacts"`
+	DeletedMessages int64  `json:"deleted_messages" gorm:"column:deleted_messages"`
+	Error           string `json:"error,omitempty" gorm:"column:error"`
+	Actor           string `json:"actor" gorm:"column:actor"`
+	// Owner identifies the process running the job.
+	Owner string `json:"-" gorm:"column:owner"`
+	// Progress is the percentage of rows deleted (computed).
+	Progress   float64    `json:"progress" gorm:"-"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt  time.Time  `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" gorm:"column:finished_at"`
+}
@@ -0,0 +1,145 @@
+package model
+
+import "time"
+
+// AgentStats summarizes one agent's workload. Chat and contact counts are current
+// totals; message and response figures cover [From, To).
+type AgentStats struct {
+	AgentID     string    `json:"agent_id"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	TotalChats  int64     `json:"total_chats"`
+	UnreadChats int64     `json:"unread_chats"`
+	Contacts    int64     `json:"contacts"`
+	MessagesIn  int64     `json:"messages_in"`
+	MessagesOut int64     `json:"messages_out"`
+	// Daily holds per-day message counts, only for days with messages.
+	Daily         []DailyMessageCount `json:"daily"`
+	FirstResponse ResponseTimeSummary `json:"first_response"`
+	// Source is "live" or "materialized" (daily counts as of the last view refresh).
+	Source string `json:"source"`
+}
+
+// DailyMessageCount is the number of messages of one day per flow.
+type DailyMessageCount struct {
+	Date     string `json:"date"` // YYYY-MM-DD
+	Inbound  int64  `json:"inbound"`
+	Outbound int64  `json:"outbound"`
+}
+
+// ResponseTimeSummary aggregates the delay between an inbound message and the reply.
+type ResponseTimeSummary struct {
+	// Responded is the number of conversations that got a reply; Pending those still waiting.
+	Responded     int64   `json:"responded"`
+	Pending       int64   `json:"pending"`
+	AvgSeconds    float64 `json:"avg_seconds"`
+	MedianSeconds float64 `json:"median_seconds"`
+}
+
+// AgentChatCounts are the current chat and contact totals of an agent.
+type AgentChatCounts struct {
+	AgentID     string `gorm:"column:agent_id"`
+	TotalChats  int64  `gorm:"column:total_chats"`
+	UnreadChats int64  `gorm:"column:unread_chats"`
+	Contacts    int64  `gorm:"column:contacts"`
+}
+
+// AgentDailyCount is one row of per-agent, per-day message counts.
+type AgentDailyCount struct {
+	AgentID     string    `gorm:"column:agent_id"`
+	MessageDate time.Time `gorm:"column:message_date"`
+	Inbound     int64     `gorm:"column:inbound"`
+	Outbound    int64     `gorm:"column:outbound"`
+}
+
+// AgentResponseTimes is the first-response summary of one agent.
+type AgentResponseTimes struct {
+	AgentID string `gorm:"column:agent_id"`
+	ResponseTimeSummary
+}
+
+// MessageVolume is a message count time series over [From, To).
+type MessageVolume struct {
+	Bucket  string               `json:"bucket"` // hour, day, week
+	From    time.Time            `json:"from"`
+	To      time.Time            `json:"to"`
+	GroupBy []string             `json:"group_by"`
+	Points  []MessageVolumePoint `json:"points"`
+}
+
+// MessageVolumePoint is the message count of one bucket and group.
+// Grouping fields are only set when grouped by them.
+type MessageVolumePoint struct {
+	Bucket      time.Time `json:"bucket" gorm:"column:bucket"`
+	AgentID     string    `json:"agent_id,omitempty" gorm:"column:agent_id"`
+	Flow        string    `json:"flow,omitempty" gorm:"column:flow"`
+	MessageType string    `json:"message_type,omitempty" gorm:"column:message_type"`
+	Count       int64     `json:"count" gorm:"column:count"`
+}
+
+// ResponseTimeStats are the reply delays of one agent or assignee over [From, To).
+// A turn starts with an inbound message following an outbound one (or the first
+// message); its response time runs until the next outbound message.
+type ResponseTimeStats struct {
+	AgentID    string    `json:"agent_id,omitempty"`
+	AssignedTo *string   `json:"assigned_to,omitempty"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Chats      int64     `json:"chats"`
+	// FirstResponse only covers the first turn of each chat in the period; Response every turn.
+	FirstResponse ResponseTimeSummary `json:"first_response"`
+	Response      ResponseTimeSummary `json:"response"`
+}
+
+// ResponseTimeRow is one grouped row of the response-time query.
+type ResponseTimeRow struct {
+	GroupKey           string  `gorm:"column:group_key"`
+	Chats              int64   `gorm:"column:chats"`
+	FirstResponded     int64   `gorm:"column:first_responded"`
+	FirstPending       int64   `gorm:"column:first_pending"`
+	FirstAvgSeconds    float64 `gorm:"column:first_avg_seconds"`
+	FirstMedianSeconds float64 `gorm:"column:first_median_seconds"`
+	Responded          int64   `gorm:"column:responded"`
+	Pending            int64   `gorm:"column:pending"`
+	AvgSeconds         float64 `gorm:"column:avg_seconds"`
+	MedianSeconds      float64 `gorm:"column:median_seconds"`
+}
+
+// SLABreach is a chat whose customer has been waiting for a reply longer than the SLA.
+type SLABreach struct {
+	ChatID         string    `json:"chat_id" gorm:"column:chat_id"`
+	AgentID        string    `json:"agent_id" gorm:"column:agent_id"`
+	PhoneNumber    string    `json:"phone_number" gorm:"column:phone_number"`
+	PushName       string    `json:"push_name" gorm:"column:push_name"`
+	AssignedTo     string    `json:"assigned_to" gorm:"column:assigned_to"`
+	WaitingAt      int64     `json:"-" gorm:"column:waiting_at"`
+	WaitingSince   time.Time `json:"waiting_since" gorm:"-"`
+	WaitingSeconds int64     `json:"waiting_seconds" gorm:"-"`
+}
+
+type SLABreachPage struct {
+	Total int64       `json:"total"`
+	Items []SLABreach `json:"items"`
+}
+
+// ContactFunnel counts new contacts per time bucket over [From, To).
+type ContactFunnel struct {
+	Bucket  string               `json:"bucket"` // day, week, month
+	From    time.Time            `json:"from"`
+	To      time.Time            `json:"to"`
+	GroupBy []string             `json:"group_by"`
+	Points  []ContactFunnelPoint `json:"points"`
+}
+
+// ContactFunnelPoint is one bucket and group of the contact funnel. Created counts
+// contacts by created_at, FirstMessage by first_message_timestamp. Grouping fields
+// are only set when grouped by them; a contact counts once per tag.
+type ContactFunnelPoint struct {
+	Bucket       time.Time `json:"bucket" gorm:"column:bucket"`
+	Origin       *string   `json:"origin,omitempty" gorm:"column:origin"`
+	Tag          *string   `json:"tag,omitempty" gorm:"column:tag"`
+	Status       *string   `json:"status,omitempty" gorm:"column:status"`
+	AgentID      *string   `json:"agent_id,omitempty" gorm:"column:agent_id"`
+	Created      int64     `json:"created" gorm:"column:created"`
+	FirstMessage int64     `json:"first_message" gorm:"column:first_message"`
+}
@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+// Message archive statuses
+const (
+	ArchiveStatusArchiving = "archiving"
+	ArchiveStatusArchived  = "archived"
+	ArchiveStatusFailed    = "failed"
+)
+
+// ArchiveRequest is the body of POST /archives: the month ("2024-01") whose partition is archived
+type ArchiveRequest struct {
+	Month string `json:"month"`
+}
+
+// MessageArchive is a messages partition exported to a compressed file and
+// dropped from the messages table. Archived messages stay readable, read-only.
+type MessageArchive struct {
+	ID        int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	Partition string    `json:"partition" gorm:"column:partition_name"`
+	From      time.Time `json:"from" gorm:"column:period_from"`
+	To        time.Time `json:"to" gorm:"column:period_to"`
+	Format    string    `json:"format" gorm:"column:format"`
+	Status    string    `json:"status" gorm:"column:status"`
+	// Rows is the number of messages archived, verified against the partition before it is dropped
+	Rows       int64      `json:"rows" gorm:"column:message_count"`
+	FileKey    string     `json:"-" gorm:"column:file_key"`
+	FileSize   int64      `json:"file_size,omitempty" gorm:"column:file_size"`
+	Error      string     `json:"error,omitempty" gorm:"column:error"`
+	Actor      string     `json:"actor,omitempty" gorm:"column:actor"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt  time.Time  `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty" gorm:"column:archived_at"`
+}
+
+// MessageArchivePage holds a page of archives, newest period first
+type MessageArchivePage struct {
+	Items []MessageArchive `json:"items"`
+	Total int64            `json:"total"`
+}
+
+// MessageArchiveChat indexes the messages of one chat in an archive, so reads
+// only open the archives holding the chat.
+type MessageArchiveChat struct {
+	ArchiveID   int64  `gorm:"column:archive_id"`
+	AgentID     string `gorm:"column:agent_id"`
+	ChatID      string `gorm:"column:chat_id"`
+	Rows        int64  `gorm:"column:message_count"`
+	DeletedRows int64  `gorm:"column:deleted_count"`
+	// FileKey and From are read from the archive
+	FileKey string    `gorm:"column:file_key;->"`
+	From    time.Time `gorm:"column:period_from;->"`
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// AuditLog records one mutating API call (POST/PUT/PATCH/DELETE) within a tenant.
+type AuditLog struct {
+	ID int64 `json:"id" gorm:"primaryKey;autoIncrement"`
+	// CompanyID identifies the tenant the call was made for.
+	CompanyID string `json:"company_id" gorm:"column:company_id"`
+	// Actor is the caller identity: the X-Actor header, or "token:<tokenId>" of the bearer token.
+	Actor string `json:"actor" gorm:"column:actor"`
+	// Method and Route describe the endpoint (route is the pattern, path the concrete URL).
+	Method string `json:"method" gorm:"column:method"`
+	Route  string `json:"route" gorm:"column:route"`
+	Path   string `json:"path" gorm:"column:path"`
+	// EntityType and EntityID identify the affected row (e.g. "contact", contact ID).
+	EntityType string `json:"entity_type" gorm:"column:entity_type"`
+	EntityID   string `json:"entity_id" gorm:"column:entity_id"`
+	// RequestID is the X-Request-ID assigned by the RequestID middleware.
+	RequestID  string `json:"request_id" gorm:"column:request_id"`
+	StatusCode int    `json:"status_code" gorm:"column:status_code"`
+	// Before and After hold only the fields that changed.
+	Before    datatypes.JSON `json:"before,omitempty" gorm:"type:jsonb;column:before"`
+	After     datatypes.JSON `json:"after,omitempty" gorm:"type:jsonb;column:after"`
+	CreatedAt time.Time      `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+}
+
+type AuditPage struct {
+	Total int64      `json:"total"`
+	Items []AuditLog `json:"items"`
+}
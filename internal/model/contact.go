@@ -2,6 +2,8 @@ package model
 
 import (
 	"time"
+
+	"gorm.io/datatypes"
 )
 
 type Contact struct {
@@ -51,3 +53,49 @@ type ContactPage struct {
 	Total int64     `json:"total"`
 	Items []Contact `json:"items"`
 }
+
+// ContactHistory is one recorded change to a contact (update or merge).
+// Previous and Snapshot hold the full contact before and after the change,
+// so the state at any point in time can be reconstructed.
+type ContactHistory struct {
+	ID        int64          `json:"id" gorm:"primaryKey;autoIncrement"`
+	ContactID string         `json:"contact_id" gorm:"column:contact_id"`
+	Action    string         `json:"action" gorm:"column:action"`              // update, merge
+	Changes   datatypes.JSON `json:"changes" gorm:"type:jsonb;column:changes"` // { field: { from, to } }
+	Previous  datatypes.JSON `json:"previous,omitempty" gorm:"type:jsonb;column:previous"`
+	Snapshot  datatypes.JSON `json:"snapshot,omitempty" gorm:"type:jsonb;column:snapshot"`
+	Actor     string         `json:"actor" gorm:"column:actor"`
+	RequestID string         `json:"request_id" gorm:"column:request_id"`
+	CreatedAt time.Time      `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+}
+
+// FieldChange describes the old and new value of a single field.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type ContactHistoryPage struct {
+	Total int64            `json:"total"`
+	Items []ContactHistory `json:"items"`
+}
+
+// ContactDuplicateGroup lists contacts that share the same normalized phone number.
+type ContactDuplicateGroup struct {
+	NormalizedPhone string    `json:"normalized_phone"`
+	Contacts        []Contact `json:"contacts"`
+}
+
+type ContactDuplicatePage struct {
+	Total int64                   `json:"total"`
+	Items []ContactDuplicateGroup `json:"items"`
+}
+
+// ContactMergeInput merges DuplicateIDs into SurvivorID.
+// Fields optionally picks, per field, the contact whose value wins (field → contact ID);
+// unlisted fields keep the survivor's value and fall back to the first non-empty duplicate.
+type ContactMergeInput struct {
+	SurvivorID   string            `json:"survivor_id"`
+	DuplicateIDs []string          `json:"duplicate_ids"`
+	Fields       map[string]string `json:"fields,omitempty"`
+}
@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+// Export kinds
+const (
+	ExportKindContacts = "contacts"
+	ExportKindMessages = "messages"
+)
+
+// Export file formats
+const (
+	ExportFormatJSONL = "jsonl"
+	ExportFormatCSV   = "csv"
+)
+
+// Export job statuses
+const (
+	ExportJobPending   = "pending"
+	ExportJobRunning   = "running"
+	ExportJobCompleted = "completed"
+	ExportJobFailed    = "failed"
+)
+
+// ExportRequest is the body of POST /exports
+type ExportRequest struct {
+	Kind    string     `json:"kind"`
+	Format  string     `json:"format"`
+	AgentID string     `json:"agent_id"`
+	ChatID  string     `json:"chat_id"`
+	From    *time.Time `json:"from"`
+	To      *time.Time `json:"to"`
+}
+
+// ExportJob tracks an asynchronous export and the file it produces.
+type ExportJob struct {
+	ID      int64      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Kind    string     `json:"kind" gorm:"column:kind"`
+	Format  string     `json:"format" gorm:"column:format"`
+	AgentID string     `json:"agent_id,omitempty" gorm:"column:agent_id"`
+	ChatID  string     `json:"chat_id,omitempty" gorm:"column:chat_id"`
+	From    *time.Time `json:"from,omitempty" gorm:"column:period_from"`
+	To      *time.Time `json:"to,omitempty" gorm:"column:period_to"`
+	Status  string     `json:"status" gorm:"column:status"`
+	// Total is the number of rows found when the job started; Processed the rows written so far.
+	Total     int64  `json:"total" gorm:"column:total"`
+	Processed int64  `json:"processed" gorm:"column:processed"`
+	FileKey   string `json:"-" gorm:"column:file_key"`
+	FileSize  int64  `json:"file_size,omitempty" gorm:"column:file_size"`
+	Error     string `json:"error,omitempty" gorm:"column:error"`
+	Actor     string `json:"actor" gorm:"column:actor"`
+	// Progress is the percentage of rows written (computed).
+	Progress float64 `json:"progress" gorm:"-"`
+	// DownloadURL is set once the job completed.
+	DownloadURL string     `json:"download_url,omitempty" gorm:"-"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt   time.Time  `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+	StartedAt   *time.Time `json:"started_at,omitempty" gorm:"column:started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty" gorm:"column:finished_at"`
+}
+
+// ExportJobPage holds a page of export jobs, newest first
+type ExportJobPage struct {
+	Items []ExportJob `json:"items"`
+	Total int64       `json:"total"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// IdempotencyKey is a client-supplied Idempotency-Key claimed by a mutating request
+// within a tenant, with the response to replay when the request is retried.
+type IdempotencyKey struct {
+	Key string `json:"key" gorm:"column:key;primaryKey"`
+	// Fingerprint hashes the method, path and body; a retry must send the same request.
+	Fingerprint string `json:"fingerprint" gorm:"column:fingerprint"`
+	// Completed is false while the first request is still being processed.
+	Completed bool `json:"completed" gorm:"column:completed"`
+	// Holder identifies the request processing the key; only it completes or releases it.
+	Holder string `json:"holder,omitempty" gorm:"column:holder"`
+	// LockedUntil bounds the request in progress: past it, a retry takes the key over.
+	LockedUntil *time.Time `json:"locked_until,omitempty" gorm:"column:locked_until"`
+	StatusCode  int        `json:"status_code,omitempty" gorm:"column:status_code"`
+	// Headers holds the response headers to replay (Content-Type, ETag, Location...), by name.
+	Headers   datatypes.JSON `json:"headers,omitempty" gorm:"type:jsonb;column:headers"`
+	Body      []byte         `json:"body,omitempty" gorm:"column:body"`
+	CreatedAt time.Time      `json:"created_at" gorm:"column:created_at"`
+	// ExpiresAt is when the key may be reused and the row removed by the cleanup job.
+	ExpiresAt time.Time `json:"expires_at" gorm:"column:expires_at"`
+}
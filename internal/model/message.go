@@ -25,9 +25,148 @@ type Message struct {
 	Key              datatypes.JSON `json:"key" gorm:"type:jsonb;column:key"`
 	Status           string         `json:"status" gorm:"column:status"`
 	IsDeleted        bool           `json:"is_deleted" gorm:"column:is_deleted;default:false"`
-	MessageTimestamp int64          `json:"message_timestamp" gorm:"column:message_timestamp;index"`
+	MessageTimestamp int64          `json:"message_timestamp" gorm:"column:message_timestamp;index"` // Unix seconds, as sent by WhatsApp
 	MessageDate      time.Time      `json:"message_date" gorm:"column:message_date;type:date;not null"`
 	CreatedAt        time.Time      `json:"created_at,omitempty" gorm:"column:created_at;autoCreateTime"`
 	UpdatedAt        time.Time      `json:"updated_at,omitempty" gorm:"column:updated_at;autoUpdateTime"`
+	// Media is derived from MessageObj when the message carries an attachment
+	Media *MessageMedia `json:"media,omitempty" gorm:"-"`
+	// Normalized is set when the typed representation is requested (format=normalized)
+	Normalized *NormalizedMessage `json:"normalized,omitempty" gorm:"-"`
+	// Reactions aggregates the reactions other messages made to this one
+	Reactions []MessageReactionSummary `json:"reactions,omitempty" gorm:"-"`
+	// Quoted previews the message this one replies to
+	Quoted *QuotedMessage `json:"quoted,omitempty" gorm:"-"`
 	// LastMetadata     datatypes.JSON `json:"last_metadata,omitempty" gorm:"type:jsonb;column:last_metadata"`
 }
+
+// Message flows: inbound messages come from the contact, outbound ones from the agent.
+const (
+	MessageFlowInbound  = "inbound"
+	MessageFlowOutbound = "outbound"
+)
+
+// MessageMedia describes the attachment of an image, video, audio or document message.
+// URL is a signed, time-limited link to GET /media/:message_id.
+type MessageMedia struct {
+	Type            string     `json:"type"`
+	Mimetype        string     `json:"mimetype,omitempty"`
+	Size            int64      `json:"size,omitempty"`
+	Width           int        `json:"width,omitempty"`
+	Height          int        `json:"height,omitempty"`
+	DurationSeconds int        `json:"duration_seconds,omitempty"`
+	Caption         string     `json:"caption,omitempty"`
+	FileName        string     `json:"file_name,omitempty"`
+	Voice           bool       `json:"voice,omitempty"`
+	URL             string     `json:"url,omitempty"`
+	URLExpiresAt    *time.Time `json:"url_expires_at,omitempty"`
+}
+
+// Media types reported in MessageMedia.Type
+const (
+	MediaTypeImage    = "image"
+	MediaTypeVideo    = "video"
+	MediaTypeAudio    = "audio"
+	MediaTypeDocument = "document"
+)
+
+// NormalizedMessage is the typed reading of a message's raw payloads, returned
+// alongside them with format=normalized.
+type NormalizedMessage struct {
+	Kind        string               `json:"kind"`
+	Text        string               `json:"text,omitempty"`
+	Media       *MessageMedia        `json:"media,omitempty"`
+	Location    *MessageLocation     `json:"location,omitempty"`
+	Contacts    []MessageContactCard `json:"contacts,omitempty"`
+	Reaction    *MessageReaction     `json:"reaction,omitempty"`
+	ReplyTo     *MessageReference    `json:"reply_to,omitempty"`
+	FromMe      bool                 `json:"from_me"`
+	Participant string               `json:"participant,omitempty"`
+	Edited      bool                 `json:"edited"`
+	Deleted     bool                 `json:"deleted"`
+}
+
+// Message kinds reported in NormalizedMessage.Kind; attachments use the media types
+const (
+	MessageKindText     = "text"
+	MessageKindLocation = "location"
+	MessageKindContact  = "contact"
+	MessageKindReaction = "reaction"
+	MessageKindUnknown  = "unknown"
+)
+
+// MessageLocation is a shared (possibly live) location
+type MessageLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+	URL       string  `json:"url,omitempty"`
+	Live      bool    `json:"live,omitempty"`
+}
+
+// MessageContactCard is a shared contact (vCard)
+type MessageContactCard struct {
+	DisplayName string   `json:"display_name"`
+	Phones      []string `json:"phones,omitempty"`
+	VCard       string   `json:"vcard,omitempty"`
+}
+
+// MessageReaction is an emoji reaction to another message; Removed when the emoji was withdrawn
+type MessageReaction struct {
+	Emoji        string `json:"emoji,omitempty"`
+	TargetID     string `json:"target_id"`
+	TargetFromMe bool   `json:"target_from_me"`
+	Removed      bool   `json:"removed,omitempty"`
+}
+
+// MessageReference points to the message a reply quotes
+type MessageReference struct {
+	MessageID   string `json:"message_id"`
+	Participant string `json:"participant,omitempty"`
+	Text        string `json:"text,omitempty"`
+}
+
+// MessageEdit is one recorded version of an edited message
+type MessageEdit struct {
+	ID               int64          `json:"-" gorm:"column:id;primaryKey"`
+	MessageID        string         `json:"-" gorm:"column:message_id"`
+	Text             string         `json:"text" gorm:"-"`
+	EditedMessageObj datatypes.JSON `json:"edited_message_obj" gorm:"type:jsonb;column:edited_message_obj"`
+	// RecordedAt is when the edit was stored; nil for edits made before history was recorded
+	RecordedAt *time.Time `json:"recorded_at" gorm:"column:recorded_at"`
+}
+
+// MessageEditHistory is the original text of a message followed by its edits, oldest first
+type MessageEditHistory struct {
+	MessageID    string         `json:"message_id"`
+	ChatID       string         `json:"chat_id"`
+	AgentID      string         `json:"agent_id"`
+	OriginalText string         `json:"original_text"`
+	CurrentText  string         `json:"current_text"`
+	Edited       bool           `json:"edited"`
+	Deleted      bool           `json:"deleted"`
+	MessageObj   datatypes.JSON `json:"message_obj"`
+	Edits        []MessageEdit  `json:"edits"`
+}
+
+// MessageReactionSummary counts one emoji reacted to a message; Reactors are the senders' phones
+type MessageReactionSummary struct {
+	Emoji    string   `json:"emoji"`
+	Count    int      `json:"count"`
+	Reactors []string `json:"reactors"`
+}
+
+// QuotedMessage previews the message a reply refers to. Found is false when the
+// quoted message is not stored; the preview then comes from the reply's payload.
+type QuotedMessage struct {
+	ID               string `json:"id"`
+	Found            bool   `json:"found"`
+	FromPhone        string `json:"from_phone,omitempty"`
+	Flow             string `json:"flow,omitempty"`
+	MessageType      string `json:"message_type,omitempty"`
+	Text             string `json:"text,omitempty"`
+	MediaType        string `json:"media_type,omitempty"`
+	IsDeleted        bool   `json:"is_deleted,omitempty"`
+	MessageTimestamp int64  `json:"message_timestamp,omitempty"`
+}
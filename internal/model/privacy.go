@@ -0,0 +1,64 @@
+package model
+
+import "time"
+
+// Privacy actions recorded in the privacy log
+const (
+	PrivacyActionErase  = "erase"
+	PrivacyActionExport = "export"
+)
+
+// PrivacyRequest is the body of POST /privacy/erase and POST /privacy/export.
+// Without AgentID the request covers the number across every agent.
+type PrivacyRequest struct {
+	PhoneNumber string `json:"phone_number"`
+	AgentID     string `json:"agent_id"`
+}
+
+// PrivacyScope selects the messages of a data subject: those of its chats, or
+// sent from or to its phone number (e.g. in groups), optionally of one agent.
+type PrivacyScope struct {
+	PhoneNumber string
+	AgentID     string
+	ChatIDs     []string
+}
+
+// PrivacySubject is everything stored about a phone number, except the messages,
+// which are streamed into the export bundle after this header.
+type PrivacySubject struct {
+	PhoneNumber    string           `json:"phone_number"`
+	AgentID        string           `json:"agent_id,omitempty"`
+	GeneratedAt    time.Time        `json:"generated_at"`
+	Contacts       []Contact        `json:"contacts"`
+	ContactHistory []ContactHistory `json:"contact_history"`
+	Chats          []Chat           `json:"chats"`
+	MessageCount   int64            `json:"message_count"`
+	// LogID is the privacy log entry of the request
+	LogID int64 `json:"-"`
+	// Scope selects the subject's messages
+	Scope PrivacyScope `json:"-"`
+}
+
+// PrivacyLog is an immutable record of an erasure or export. The phone number is
+// only kept as a SHA-256 hash of its E.164 form, so erased numbers are not stored again.
+type PrivacyLog struct {
+	ID        int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Action    string `json:"action" gorm:"column:action"`
+	PhoneHash string `json:"phone_hash" gorm:"column:phone_hash"`
+	AgentID   string `json:"agent_id,omitempty" gorm:"column:agent_id"`
+	// ContactIDs lists the contacts found (comma-separated)
+	ContactIDs string    `json:"contact_ids,omitempty" gorm:"column:contact_ids"`
+	Contacts   int64     `json:"contacts" gorm:"column:contacts"`
+	Chats      int64     `json:"chats" gorm:"column:chats"`
+	Messages   int64     `json:"messages" gorm:"column:messages"`
+	MediaFiles int64     `json:"media_files" gorm:"column:media_files"`
+	Actor      string    `json:"actor" gorm:"column:actor"`
+	RequestID  string    `json:"request_id" gorm:"column:request_id"`
+	CreatedAt  time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+}
+
+// PrivacyLogPage holds a page of privacy log entries, newest first
+type PrivacyLogPage struct {
+	Items []PrivacyLog `json:"items"`
+	Total int64        `json:"total"`
+}
@@ -0,0 +1,60 @@
+package model
+
+import "time"
+
+// RateLimit is a tenant's request allowance. The limit with an empty PathPrefix is
+// the company default; a limit with a prefix (e.g. "/api/v1/contacts/search")
+// counts the matching requests separately, the longest prefix winning.
+// Limits are set in the tenant's rate_limits table; without rows the server
+// defaults apply.
+type RateLimit struct {
+	ID         int64  `json:"-" gorm:"primaryKey;autoIncrement"`
+	PathPrefix string `json:"path_prefix" gorm:"column:path_prefix"`
+	// Requests is how many requests the company may send per window.
+	Requests int64 `json:"requests" gorm:"column:requests"`
+	// KeyRequests additionally bounds each API key per window (nil: no separate bound).
+	KeyRequests   *int64 `json:"key_requests,omitempty" gorm:"column:key_requests"`
+	WindowSeconds int    `json:"window_seconds" gorm:"column:window_seconds"`
+	// MonthlyQuota bounds the company's requests per calendar month (UTC). Only
+	// read from the company default; nil or 0 is unlimited.
+	MonthlyQuota *int64 `json:"monthly_quota,omitempty" gorm:"column:monthly_quota"`
+	// UpdatedAt is nil for the server default.
+	UpdatedAt *time.Time `json:"updated_at,omitempty" gorm:"column:updated_at"`
+}
+
+// RateLimitDecision is the outcome of counting one request.
+type RateLimitDecision struct {
+	Allowed bool
+	// Limit, Remaining and Reset describe the tightest window that applied.
+	Limit     int64
+	Remaining int64
+	Reset     time.Duration
+	Window    time.Duration
+	// QuotaExceeded is set when the request was refused because of the monthly
+	// quota, which renews at QuotaResetAt.
+	QuotaExceeded bool
+	QuotaResetAt  time.Time
+}
+
+// MonthlyUsage counts a company's requests in a calendar month (UTC, "2006-01").
+type MonthlyUsage struct {
+	Month    string `json:"month" gorm:"column:month;primaryKey"`
+	Requests int64  `json:"requests" gorm:"column:requests"`
+	// Rejected counts the requests refused by a rate limit or the quota.
+	Rejected int64 `json:"rejected" gorm:"column:rejected"`
+	// UpdatedAt is when the usage was last stored, nil while only counted in memory.
+	UpdatedAt *time.Time `json:"updated_at,omitempty" gorm:"column:updated_at"`
+}
+
+// UsageReport is the response of GET /usage.
+type UsageReport struct {
+	Month    string `json:"month"`
+	Requests int64  `json:"requests"`
+	Rejected int64  `json:"rejected"`
+	// Quota and Remaining are omitted when the company has no monthly quota.
+	Quota     *int64         `json:"quota,omitempty"`
+	Remaining *int64         `json:"remaining,omitempty"`
+	ResetsAt  time.Time      `json:"resets_at"`
+	Limits    []RateLimit    `json:"limits"`
+	History   []MonthlyUsage `json:"history"`
+}
@@ -0,0 +1,107 @@
+package model
+
+import "time"
+
+// RetentionPartitionDrop is the action taken on expired message partitions. They
+// are never only detached: a detached table would escape later privacy erasures.
+const RetentionPartitionDrop = "drop"
+
+// Retention run statuses
+const (
+	RetentionRunRunning   = "running"
+	RetentionRunCompleted = "completed"
+	RetentionRunFailed    = "failed"
+)
+
+// RetentionPolicy is how long a tenant keeps its data. The policy with an empty
+// AgentID is the company default; agent policies override it per field.
+// A nil field inherits (the default keeps forever), 0 keeps forever.
+type RetentionPolicy struct {
+	ID      int64  `json:"-" gorm:"primaryKey;autoIncrement"`
+	AgentID string `json:"agent_id,omitempty" gorm:"column:agent_id"`
+	// MessageDays deletes messages whose message_date is older than this many days.
+	MessageDays *int `json:"message_days" gorm:"column:message_days"`
+	// InactiveContactDays deletes contacts without update nor conversation for this many days.
+	InactiveContactDays *int      `json:"inactive_contact_days" gorm:"column:inactive_contact_days"`
+	Actor               string    `json:"actor,omitempty" gorm:"column:actor"`
+	CreatedAt           time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt           time.Time `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+}
+
+// RetentionPolicyInput is the body of PUT /retention and PUT /retention/agents/:agent_id
+type RetentionPolicyInput struct {
+	MessageDays         *int `json:"message_days"`
+	InactiveContactDays *int `json:"inactive_contact_days"`
+}
+
+// RetentionScope selects the rows of one retention target: those older than Before,
+// of AgentID when set, otherwise of every agent except ExcludeAgents.
+// Messages in SkipPartitions are left out (they are removed as a whole).
+type RetentionScope struct {
+	AgentID        string
+	ExcludeAgents  []string
+	Before         time.Time
+	SkipPartitions []string
+}
+
+// MessagePartition is a range partition of the messages table, [From, To) on message_date.
+type MessagePartition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// RetentionTarget reports the rows a policy expires. AgentID is empty for the
+// company default, which then applies to every agent without its own policy.
+type RetentionTarget struct {
+	AgentID string    `json:"agent_id,omitempty"`
+	Days    int       `json:"days"`
+	Before  time.Time `json:"before"`
+	Rows    int64     `json:"rows"`
+}
+
+// RetentionPartition reports a whole messages partition that expired.
+type RetentionPartition struct {
+	Name   string    `json:"name"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Rows   int64     `json:"rows"`
+	Action string    `json:"action"`
+}
+
+// RetentionReport is what enforcing the tenant's policies would remove now.
+// Message rows of expired partitions are not counted again in Messages.
+// Archives holds the message archives that would be removed; their messages
+// are counted in TotalMessages.
+type RetentionReport struct {
+	GeneratedAt   time.Time            `json:"generated_at"`
+	Policies      []RetentionPolicy    `json:"policies"`
+	Partitions    []RetentionPartition `json:"partitions"`
+	Archives      []MessageArchive     `json:"archives"`
+	Messages      []RetentionTarget    `json:"messages"`
+	Contacts      []RetentionTarget    `json:"contacts"`
+	TotalMessages int64                `json:"total_messages"`
+	TotalContacts int64                `json:"total_contacts"`
+}
+
+// RetentionRun records one enforcement of a tenant's retention policies.
+type RetentionRun struct {
+	ID     int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Status string `json:"status" gorm:"column:status"`
+	// Partitions lists the dropped or detached partitions (comma-separated).
+	Partitions      string `json:"partitions,omitempty" gorm:"column:partitions"`
+	DeletedMessages int64  `json:"deleted_messages" gorm:"column:deleted_messages"`
+	DeletedContacts int64  `json:"deleted_contacts" gorm:"column:deleted_contacts"`
+	// DeletedArchives counts the removed message archives.
+	DeletedArchives int64      `json:"deleted_archives" gorm:"column:deleted_archives"`
+	Error           string     `json:"error,omitempty" gorm:"column:error"`
+	StartedAt       time.Time  `json:"started_at" gorm:"column:started_at"`
+	UpdatedAt       time.Time  `json:"updated_at" gorm:"column:updated_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty" gorm:"column:finished_at"`
+}
+
+// RetentionRunPage holds a page of retention runs, newest first
+type RetentionRunPage struct {
+	Items []RetentionRun `json:"items"`
+	Total int64          `json:"total"`
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// TranscriptHeader identifies the chat a transcript covers
+type TranscriptHeader struct {
+	ChatID       string     `json:"chat_id"`
+	AgentID      string     `json:"agent_id"`
+	AgentName    string     `json:"agent_name"`
+	ContactName  string     `json:"contact_name"`
+	ContactPhone string     `json:"contact_phone"`
+	IsGroup      bool       `json:"is_group"`
+	From         *time.Time `json:"from,omitempty"`
+	To           *time.Time `json:"to,omitempty"`
+	GeneratedAt  time.Time  `json:"generated_at"`
+	// Location is the time zone timestamps are rendered in
+	Location *time.Location `json:"-"`
+}
+
+// TranscriptEntry is one message as it appears in a transcript
+type TranscriptEntry struct {
+	MessageID string        `json:"message_id"`
+	Timestamp time.Time     `json:"timestamp"`
+	Sender    string        `json:"sender"`
+	Flow      string        `json:"flow"`
+	Kind      string        `json:"kind"`
+	Text      string        `json:"text,omitempty"`
+	Media     *MessageMedia `json:"media,omitempty"`
+	Edited    bool          `json:"edited,omitempty"`
+	Deleted   bool          `json:"deleted,omitempty"`
+}
@@ -0,0 +1,68 @@
+package payload
+
+import (
+	"encoding/json"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+)
+
+// mediaFields maps the payload key of each attachment kind to its media type
+var mediaFields = []struct {
+	key       string
+	mediaType string
+}{
+	{"imageMessage", model.MediaTypeImage},
+	{"videoMessage", model.MediaTypeVideo},
+	{"audioMessage", model.MediaTypeAudio},
+	{"documentMessage", model.MediaTypeDocument},
+}
+
+// attachment holds the fields shared by the WhatsApp media message types.
+// Numbers may be encoded as strings (protobuf JSON encodes 64-bit integers that way).
+type attachment struct {
+	Mimetype   string     `json:"mimetype"`
+	FileLength flexNumber `json:"fileLength"`
+	Width      flexNumber `json:"width"`
+	Height     flexNumber `json:"height"`
+	Seconds    flexNumber `json:"seconds"`
+	Caption    string     `json:"caption"`
+	FileName   string     `json:"fileName"`
+	Title      string     `json:"title"`
+	PTT        bool       `json:"ptt"`
+}
+
+// Media returns the attachment metadata of a message payload, or nil when the
+// payload is not an image, video, audio or document message.
+func Media(messageObj []byte) *model.MessageMedia {
+	return mediaOf(Unwrap(messageObj))
+}
+
+// mediaOf reads the attachment of already unwrapped payload fields
+func mediaOf(msg map[string]json.RawMessage) *model.MessageMedia {
+	for _, field := range mediaFields {
+		raw, ok := msg[field.key]
+		if !ok || len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+		var a attachment
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return nil
+		}
+		m := &model.MessageMedia{
+			Type:            field.mediaType,
+			Mimetype:        a.Mimetype,
+			Size:            int64(a.FileLength),
+			Width:           int(a.Width),
+			Height:          int(a.Height),
+			DurationSeconds: int(a.Seconds),
+			Caption:         a.Caption,
+			FileName:        a.FileName,
+			Voice:           field.mediaType == model.MediaTypeAudio && a.PTT,
+		}
+		if m.FileName == "" && field.mediaType == model.MediaTypeDocument {
+			m.FileName = a.Title
+		}
+		return m
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+)
+
+// textFields carry the caption or body of a message, in lookup order
+var textFields = []struct {
+	key   string
+	field string
+}{
+	{"extendedTextMessage", "text"},
+	{"imageMessage", "caption"},
+	{"videoMessage", "caption"},
+	{"documentMessage", "caption"},
+}
+
+// contextFields may carry a contextInfo with the quoted message of a reply
+var contextFields = []string{
+	"extendedTextMessage",
+	"imageMessage",
+	"videoMessage",
+	"audioMessage",
+	"documentMessage",
+	"stickerMessage",
+	"locationMessage",
+	"liveLocationMessage",
+	"contactMessage",
+	"contactsArrayMessage",
+}
+
+// messageKey is the WhatsApp message key stored in key and referenced by
+// reactions, replies and protocol messages
+type messageKey struct {
+	RemoteJid   string `json:"remoteJid"`
+	FromMe      bool   `json:"fromMe"`
+	ID          string `json:"id"`
+	Participant string `json:"participant"`
+}
+
+// protocolRevoke is the protocolMessage type of "delete for everyone"
+const protocolRevoke = "REVOKE"
+
+type protocolMessage struct {
+	Type          json.RawMessage `json:"type"`
+	Key           *messageKey     `json:"key"`
+	EditedMessage json.RawMessage `json:"editedMessage"`
+}
+
+// Normalize returns the typed representation of a message. Media already attached
+// to the message (with its signed URL) is reused; otherwise it is read from the payload.
+func Normalize(m *model.Message) *model.NormalizedMessage {
+	fields := Unwrap(m.MessageObj)
+
+	n := &model.NormalizedMessage{
+		Kind:    model.MessageKindUnknown,
+		Text:    textOf(fields),
+		Deleted: m.IsDeleted,
+	}
+
+	var key messageKey
+	if isPresent(m.Key) && json.Unmarshal(m.Key, &key) == nil {
+		n.FromMe = key.FromMe
+		n.Participant = key.Participant
+	}
+
+	switch {
+	case has(fields, "conversation") || has(fields, "extendedTextMessage"):
+		n.Kind = model.MessageKindText
+	case has(fields, "locationMessage"), has(fields, "liveLocationMessage"):
+		n.Kind = model.MessageKindLocation
+		n.Location = locationOf(fields)
+	case has(fields, "contactMessage"), has(fields, "contactsArrayMessage"):
+		n.Kind = model.MessageKindContact
+		n.Contacts = contactsOf(fields)
+	case has(fields, "reactionMessage"):
+		n.Kind = model.MessageKindReaction
+		n.Reaction = reactionOf(fields)
+	default:
+		if media := mediaOf(fields); media != nil {
+			n.Kind = media.Type
+			n.Media = media
+		}
+	}
+	if m.Media != nil {
+		n.Media = m.Media
+	}
+
+	if p := protocolOf(fields); p != nil && isRevoke(p) {
+		n.Deleted = true
+	}
+
+	n.ReplyTo = replyOf(fields)
+
+	if isPresent(m.EditedMessageObj) {
+		n.Edited = true
+		if text := editedTextOf(m.EditedMessageObj); text != "" {
+			n.Text = text
+		}
+	}
+	return n
+}
+
+// Text returns the text or caption of a message payload.
+func Text(messageObj []byte) string {
+	return textOf(Unwrap(messageObj))
+}
+
+// Reaction returns the reaction carried by a message payload, or nil.
+func Reaction(messageObj []byte) *model.MessageReaction {
+	fields := Unwrap(messageObj)
+	if !has(fields, "reactionMessage") {
+		return nil
+	}
+	return reactionOf(fields)
+}
+
+// ReplyTo returns the message a payload quotes, or nil when it is not a reply.
+func ReplyTo(messageObj []byte) *model.MessageReference {
+	return replyOf(Unwrap(messageObj))
+}
+
+// EditedText returns the current text of an edited_message_obj, or "" when it carries none.
+func EditedText(editedObj []byte) string {
+	if !isPresent(editedObj) {
+		return ""
+	}
+	return editedTextOf(editedObj)
+}
+
+// editedTextOf reads the new text of an edit, which is either the replacement
+// message itself or a MESSAGE_EDIT protocol message wrapping it.
+func editedTextOf(editedObj []byte) string {
+	fields := Unwrap(editedObj)
+	if p := protocolOf(fields); p != nil && len(p.EditedMessage) > 0 {
+		fields = Unwrap(p.EditedMessage)
+	}
+	return textOf(fields)
+}
+
+func textOf(fields map[string]json.RawMessage) string {
+	if raw, ok := fields["conversation"]; ok {
+		var text string
+		if json.Unmarshal(raw, &text) == nil && text != "" {
+			return text
+		}
+	}
+	for _, tf := range textFields {
+		raw, ok := fields[tf.key]
+		if !ok {
+			continue
+		}
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(raw, &obj) != nil {
+			continue
+		}
+		var text string
+		if json.Unmarshal(obj[tf.field], &text) == nil && text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+func locationOf(fields map[string]json.RawMessage) *model.MessageLocation {
+	var loc struct {
+		DegreesLatitude  float64 `json:"degreesLatitude"`
+		DegreesLongitude float64 `json:"degreesLongitude"`
+		Name             string  `json:"name"`
+		Address          string  `json:"address"`
+		URL              string  `json:"url"`
+		Caption          string  `json:"caption"`
+	}
+	raw, live := fields["liveLocationMessage"]
+	if !live {
+		raw = fields["locationMessage"]
+	}
+	if json.Unmarshal(raw, &loc) != nil {
+		return nil
+	}
+	name := loc.Name
+	if name == "" {
+		name = loc.Caption
+	}
+	return &model.MessageLocation{
+		Latitude:  loc.DegreesLatitude,
+		Longitude: loc.DegreesLongitude,
+		Name:      name,
+		Address:   loc.Address,
+		URL:       loc.URL,
+		Live:      live,
+	}
+}
+
+type contactCard struct {
+	DisplayName string `json:"displayName"`
+	Vcard       string `json:"vcard"`
+}
+
+func contactsOf(fields map[string]json.RawMessage) []model.MessageContactCard {
+	var cards []contactCard
+	if raw, ok := fields["contactMessage"]; ok {
+		var card contactCard
+		if json.Unmarshal(raw, &card) == nil {
+			cards = append(cards, card)
+		}
+	}
+	if raw, ok := fields["contactsArrayMessage"]; ok {
+		var arr struct {
+			Contacts []contactCard `json:"contacts"`
+		}
+		if json.Unmarshal(raw, &arr) == nil {
+			cards = append(cards, arr.Contacts...)
+		}
+	}
+
+	out := make([]model.MessageContactCard, 0, len(cards))
+	for _, card := range cards {
+		out = append(out, model.MessageContactCard{
+			DisplayName: card.DisplayName,
+			Phones:      vcardPhones(card.Vcard),
+			VCard:       card.Vcard,
+		})
+	}
+	return out
+}
+
+// vcardPhones returns the values of a vCard's TEL lines,
+// e.g. "TEL;type=CELL;waid=6281234567:+62 812-3456-7" → "+62 812-3456-7".
+func vcardPhones(vcard string) []string {
+	var phones []string
+	for _, line := range strings.Split(vcard, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(strings.ToUpper(line), "TEL") {
+			continue
+		}
+		i := strings.LastIndex(line, ":")
+		if i < 0 {
+			continue
+		}
+		if phone := strings.TrimSpace(line[i+1:]); phone != "" {
+			phones = append(phones, phone)
+		}
+	}
+	return phones
+}
+
+func reactionOf(fields map[string]json.RawMessage) *model.MessageReaction {
+	var r struct {
+		Key  messageKey `json:"key"`
+		Text string     `json:"text"`
+	}
+	if json.Unmarshal(fields["reactionMessage"], &r) != nil {
+		return nil
+	}
+	return &model.MessageReaction{
+		Emoji:        r.Text,
+		TargetID:     r.Key.ID,
+		TargetFromMe: r.Key.FromMe,
+		Removed:      r.Text == "",
+	}
+}
+
+func replyOf(fields map[string]json.RawMessage) *model.MessageReference {
+	for _, key := range contextFields {
+		raw, ok := fields[key]
+		if !ok {
+			continue
+		}
+		var content struct {
+			ContextInfo *struct {
+				StanzaID      string          `json:"stanzaId"`
+				Participant   string          `json:"participant"`
+				QuotedMessage json.RawMessage `json:"quotedMessage"`
+			} `json:"contextInfo"`
+		}
+		if json.Unmarshal(raw, &content) != nil || content.ContextInfo == nil || content.ContextInfo.StanzaID == "" {
+			continue
+		}
+		ctx := content.ContextInfo
+		return &model.MessageReference{
+			MessageID:   ctx.StanzaID,
+			Participant: ctx.Participant,
+			Text:        textOf(Unwrap(ctx.QuotedMessage)),
+		}
+	}
+	return nil
+}
+
+func protocolOf(fields map[string]json.RawMessage) *protocolMessage {
+	raw, ok := fields["protocolMessage"]
+	if !ok {
+		return nil
+	}
+	var p protocolMessage
+	if json.Unmarshal(raw, &p) != nil {
+		return nil
+	}
+	return &p
+}
+
+// isRevoke reports whether a protocol message deletes its target. REVOKE is
+// enum value 0, which protobuf JSON may encode as a number, a name or omit.
+func isRevoke(p *protocolMessage) bool {
+	if p.Key == nil || len(p.EditedMessage) > 0 {
+		return false
+	}
+	t := strings.Trim(string(p.Type), `"`)
+	return t == "" || t == "0" || t == protocolRevoke
+}
+
+func has(fields map[string]json.RawMessage, key string) bool {
+	raw, ok := fields[key]
+	return ok && isPresent(raw)
+}
+
+// isPresent reports whether a JSON value carries content (not empty, null or {})
+func isPresent(raw []byte) bool {
+	v := bytes.TrimSpace(raw)
+	return len(v) > 0 && !bytes.Equal(v, []byte("null")) && !bytes.Equal(v, []byte("{}"))
+}
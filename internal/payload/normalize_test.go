@@ -0,0 +1,67 @@
+package payload
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+)
+
+// Each testdata/*.json fixture holds a stored message and its expected normalized form.
+type fixture struct {
+	Message model.Message           `json:"message"`
+	Want    model.NormalizedMessage `json:"want"`
+}
+
+func TestNormalizeFixtures(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no fixtures found")
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fx fixture
+			if err := json.Unmarshal(raw, &fx); err != nil {
+				t.Fatalf("invalid fixture: %v", err)
+			}
+
+			got := Normalize(&fx.Message)
+			if !reflect.DeepEqual(*got, fx.Want) {
+				gotJSON, _ := json.MarshalIndent(got, "", "  ")
+				wantJSON, _ := json.MarshalIndent(fx.Want, "", "  ")
+				t.Errorf("Normalize mismatch\ngot:  %s\nwant: %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestNormalizeReusesAttachedMedia(t *testing.T) {
+	msg := &model.Message{
+		MessageObj: []byte(`{"imageMessage": {"mimetype": "image/png"}}`),
+		Media:      &model.MessageMedia{Type: model.MediaTypeImage, URL: "/media/x?sig=abc"},
+	}
+	if got := Normalize(msg); got.Media != msg.Media {
+		t.Errorf("expected the attached media to be reused, got %+v", got.Media)
+	}
+}
+
+func TestMediaIgnoresNonAttachments(t *testing.T) {
+	for _, obj := range []string{``, `null`, `not json`, `{"conversation": "hi"}`} {
+		if m := Media([]byte(obj)); m != nil {
+			t.Errorf("Media(%q) = %+v, want nil", obj, m)
+		}
+	}
+}
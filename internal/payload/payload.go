@@ -0,0 +1,73 @@
+// Package payload decodes the WhatsApp message payloads stored in message_obj,
+// edited_message_obj and key into typed values. It is the single place that
+// knows the payload layout; services and handlers only see model types.
+package payload
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// wrapperFields hold an inner message, e.g. {"ephemeralMessage": {"message": {...}}}
+var wrapperFields = []string{
+	"ephemeralMessage",
+	"viewOnceMessage",
+	"viewOnceMessageV2",
+	"viewOnceMessageV2Extension",
+	"documentWithCaptionMessage",
+	"editedMessage",
+}
+
+// Unwrap decodes a message payload into its top-level fields, descending through
+// ephemeral, view-once and similar wrappers. It returns nil for invalid payloads.
+func Unwrap(messageObj []byte) map[string]json.RawMessage {
+	var msg map[string]json.RawMessage
+	if len(messageObj) == 0 || json.Unmarshal(messageObj, &msg) != nil {
+		return nil
+	}
+
+	// Some producers store the full event with the payload under "message"
+	if inner, ok := msg["message"]; ok {
+		if fields := Unwrap(inner); fields != nil {
+			msg = fields
+		}
+	}
+
+	for _, key := range wrapperFields {
+		raw, ok := msg[key]
+		if !ok {
+			continue
+		}
+		var wrapper struct {
+			Message json.RawMessage `json:"message"`
+		}
+		if json.Unmarshal(raw, &wrapper) == nil && len(wrapper.Message) > 0 {
+			if fields := Unwrap(wrapper.Message); fields != nil {
+				return fields
+			}
+		}
+	}
+	return msg
+}
+
+// flexNumber accepts both JSON numbers and numeric strings
+type flexNumber int64
+
+func (n *flexNumber) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*n = flexNumber(v)
+		return nil
+	}
+	// Fall back to floats and ignore values that are not numbers at all
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		*n = flexNumber(v)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxMemoryCounters triggers a sweep of expired counters on insert
+const maxMemoryCounters = 10000
+
+// MemoryStore keeps counters in the process. Each replica counts on its own, so
+// limits are only exact for single-replica deployments.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]memoryCounter
+}
+
+type memoryCounter struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// NewMemoryStore returns an empty in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]memoryCounter)}
+}
+
+func (s *MemoryStore) Incr(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	counter, ok := s.counters[key]
+	if !ok || now.After(counter.expiresAt) {
+		if len(s.counters) >= maxMemoryCounters {
+			for k, c := range s.counters {
+				if now.After(c.expiresAt) {
+					delete(s.counters, k)
+				}
+			}
+		}
+		counter = memoryCounter{expiresAt: now.Add(ttl)}
+	}
+	counter.count++
+	s.counters[key] = counter
+	return counter.count, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,39 @@
+// Package ratelimit counts requests in fixed time windows for the rate limiter.
+// Counters live in a Store shared by the API replicas (Redis) or in the process.
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Store keeps request counters. Implementations must be safe for concurrent use.
+type Store interface {
+	// Incr adds one to the counter under key and returns the new count. A new
+	// counter expires after ttl.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Close releases the store's resources
+	Close() error
+}
+
+// Window is the fixed window holding a point in time.
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// WindowAt returns the window of length size holding t; windows are aligned on the Unix epoch.
+func WindowAt(t time.Time, size time.Duration) Window {
+	start := t.Truncate(size)
+	return Window{Start: start, End: start.Add(size)}
+}
+
+// Key returns the counter key of a window for the given scope parts.
+func Key(w Window, parts ...string) string {
+	key := "ratelimit"
+	for _, part := range parts {
+		key += ":" + part
+	}
+	return key + ":" + strconv.FormatInt(w.Start.Unix(), 10)
+}
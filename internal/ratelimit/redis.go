@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps counters in Redis, shared by every replica.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// incrScript increments a counter and sets its expiry when it is created
+var incrScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// NewRedisStore connects to the Redis server at url ("redis://[:password@]host:port/db")
+func NewRedisStore(ctx context.Context, url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &RedisStore{client: client}, nil
+}
+
+func (s *RedisStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return incrScript.Run(ctx, s.client, []string{key}, ttl.Milliseconds()).Int64()
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
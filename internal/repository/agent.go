@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/audit"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
 	"gorm.io/gorm"
@@ -16,8 +19,41 @@ type AgentRepository interface {
 	ListByCompanyID(ctx context.Context, companyId string) ([]*model.Agent, error)
 	ListByAgentIDs(ctx context.Context, companyId string, agentIds []string) ([]*model.Agent, error)
 	Create(ctx context.Context, companyId string, a *model.Agent) (*model.Agent, error)
-	UpdateName(ctx context.Context, companyId, agentId, newName string) (*model.Agent, error)
-	Delete(ctx context.Context, companyId, id string) error
+	// Update applies a partial update; a status change is also recorded as a transition.
+	// check, when not nil, is called with the locked current agent and aborts the
+	// update by returning an error.
+	Update(ctx context.Context, companyId, agentId string, updates map[string]interface{}, check func(*model.Agent) error) (*model.Agent, error)
+	// Delete removes the agent row; false when it does not exist
+	Delete(ctx context.Context, companyId, agentId string) (bool, error)
+	// DeleteWithoutData removes the agent row unless it still has data, checked in the
+	// same transaction; nil counts when the agent does not exist
+	DeleteWithoutData(ctx context.Context, companyId, agentId string) (*model.AgentDataCounts, bool, error)
+	// CountAgentData counts the chats, contacts and messages of an agent
+	CountAgentData(ctx context.Context, companyId, agentId string) (*model.AgentDataCounts, error)
+	// SoftDelete hides an agent and its chats
+	SoftDelete(ctx context.Context, companyId, agentId string) (*model.Agent, error)
+	// CreatePurgeJob hides the agent and queues the deletion of its data
+	CreatePurgeJob(ctx context.Context, companyId, agentId string) (*model.AgentPurgeJob, error)
+	GetPurgeJob(ctx context.Context, companyId string, id int64) (*model.AgentPurgeJob, error)
+	// ClaimPurgeJob hands a pending or stale job to owner; false when another worker holds it
+	ClaimPurgeJob(ctx context.Context, companyId string, id int64, owner string, staleBefore time.Time) (bool, error)
+	UnfinishedPurgeJobs(ctx context.Context, companyId string) ([]model.AgentPurgeJob, error)
+	// UpdatePurgeJob stores progress; false when job.Owner no longer holds the job
+	UpdatePurgeJob(ctx context.Context, companyId string, job *model.AgentPurgeJob) (bool, error)
+	// PurgeAgentBatch deletes up to batch rows of the agent from messages, contacts or chats
+	PurgeAgentBatch(ctx context.Context, companyId, agentId, table string, batch int) (int64, error)
+	// List returns agents filtered by IDs, statuses and staleness
+	List(ctx context.Context, companyId string, filter map[string]interface{}) ([]*model.Agent, error)
+	// Heartbeat stores liveness plus the reported version and host
+	Heartbeat(ctx context.Context, companyId, agentId, version, hostName string, at time.Time) (*model.Agent, error)
+	// MarkStaleAgents flags agents silent since before cutoff and returns their IDs
+	MarkStaleAgents(ctx context.Context, companyId string, cutoff, at time.Time) ([]string, error)
+	// RecordStatus stores a status transition and updates the current status
+	RecordStatus(ctx context.Context, companyId, agentId, status, reason string, occurredAt time.Time) (*model.AgentStatusEvent, error)
+	// FetchStatusEvents returns an agent's status transitions, newest first
+	FetchStatusEvents(ctx context.Context, companyId, agentId string, from, to time.Time, limit, offset int) (*model.AgentStatusEventPage, error)
+	// StatusEventsForPeriod returns the events needed to replay statuses over [from, to)
+	StatusEventsForPeriod(ctx context.Context, companyId string, agentIds []string, from, to time.Time) ([]model.AgentStatusEvent, error)
 }
 
 // NewAgentRepository returns the GORM-backed implementation.
@@ -29,18 +65,21 @@ type agentRepo struct {
 	db *gorm.DB
 }
 
+// agentsTable returns the tenant’s agents table.
+func (r *agentRepo) agentsTable(companyId string) string {
+	return fmt.Sprintf("daisi_%s.agents", companyId)
+}
+
 // tableFor scopes all queries to the tenant’s schema.
 func (r *agentRepo) tableFor(companyId string) *gorm.DB {
-	schemaTable := fmt.Sprintf("daisi_%s.agents", companyId)
 	// Use a fresh session to avoid cross-request state
-	return r.db.Session(&gorm.Session{}).Table(schemaTable)
+	return r.db.Session(&gorm.Session{}).Table(r.agentsTable(companyId))
 }
 
 func (r *agentRepo) GetByAgentID(ctx context.Context, companyId, agentId string) (*model.Agent, error) {
 	var a model.Agent
 	err := r.
-		tableFor(companyId).
-		WithContext(ctx).
+		visible(ctx, companyId, r.tableFor(companyId).WithContext(ctx)).
 		Where("agent_id = ?", agentId).
 		First(&a).Error
 
@@ -53,8 +92,7 @@ func (r *agentRepo) GetByAgentID(ctx context.Context, companyId, agentId string)
 func (r *agentRepo) ListByCompanyID(ctx context.Context, companyId string) ([]*model.Agent, error) {
 	var agents []*model.Agent
 	if err := r.
-		tableFor(companyId).
-		WithContext(ctx).
+		visible(ctx, companyId, r.tableFor(companyId).WithContext(ctx)).
 		Find(&agents).
 		Error; err != nil {
 		return nil, err
@@ -64,7 +102,7 @@ func (r *agentRepo) ListByCompanyID(ctx context.Context, companyId string) ([]*m
 
 func (r *agentRepo) ListByAgentIDs(ctx context.Context, companyId string, agentIds []string) ([]*model.Agent, error) {
 	var agents []*model.Agent
-	db := r.tableFor(companyId).WithContext(ctx)
+	db := r.visible(ctx, companyId, r.tableFor(companyId).WithContext(ctx))
 
 	if len(agentIds) > 0 {
 		db = db.Where("agent_id IN ?", agentIds)
@@ -82,42 +120,7 @@ func (r *agentRepo) Create(ctx context.Context, companyId string, a *model.Agent
 		Create(a).Error; err != nil {
 		return nil, err
 	}
+	audit.Track(ctx, "agent", a.AgentID, nil, a)
+	cache.Invalidate(ctx, companyId, cache.TagAgents, cache.AgentTag(a.AgentID))
 	return a, nil
 }
-
-func (r *agentRepo) UpdateName(ctx context.Context, companyId, agentId, newName string) (*model.Agent, error) {
-	// Fetch existing
-	var a model.Agent
-	err := r.
-		tableFor(companyId).
-		WithContext(ctx).
-		Where("agent_id = ?", agentId).
-		First(&a).Error
-
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	// Update name
-	a.AgentName = newName
-	if err := r.
-		tableFor(companyId).
-		WithContext(ctx).
-		Model(&a).
-		Update("agent_name", newName).
-		Error; err != nil {
-		return nil, err
-	}
-	return &a, nil
-}
-
-func (r *agentRepo) Delete(ctx context.Context, companyId, id string) error {
-	return r.
-		tableFor(companyId).
-		WithContext(ctx).
-		Delete(&model.Agent{}, "id = ?", id).
-		Error
-}
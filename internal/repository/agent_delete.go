@@ -0,0 +1,356 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/audit"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// purgeTables are the tenant tables holding an agent's data, in deletion order,
+// with the key column used to delete in batches.
+var purgeTables = []struct {
+	table string
+	key   string
+}{
+	{"messages", "id"},
+	{"contacts", "id"},
+	{"chats", "id"},
+}
+
+func (r *agentRepo) purgeJobsTable(companyId string) string {
+	return fmt.Sprintf(`"%s"."%s"`, database.TenantSchema(companyId), "agent_purge_jobs")
+}
+
+func (r *agentRepo) tenantTable(companyId, table string) string {
+	return fmt.Sprintf(`"%s"."%s"`, database.TenantSchema(companyId), table)
+}
+
+// ensureSoftDeleteColumn adds the soft-delete column to the tenant's agents table.
+func (r *agentRepo) ensureSoftDeleteColumn(ctx context.Context, companyId string) error {
+	if err := database.EnsureTenantTable(ctx, companyId, "agents.deleted_at",
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ`, r.agentsTable(companyId)),
+	); err != nil {
+		return err
+	}
+	database.RememberColumn(companyId, "agents", "deleted_at")
+	return nil
+}
+
+// ensurePurgeJobsTable creates the agent_purge_jobs table the first time it is needed.
+func (r *agentRepo) ensurePurgeJobsTable(ctx context.Context, companyId string) error {
+	tbl := r.purgeJobsTable(companyId)
+	if err := database.EnsureTenantTable(ctx, companyId, "agent_purge_jobs",
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGSERIAL PRIMARY KEY,
+			agent_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			total_chats BIGINT NOT NULL DEFAULT 0,
+			total_contacts BIGINT NOT NULL DEFAULT 0,
+			total_messages BIGINT NOT NULL DEFAULT 0,
+			deleted_chats BIGINT NOT NULL DEFAULT 0,
+			deleted_contacts BIGINT NOT NULL DEFAULT 0,
+			deleted_messages BIGINT NOT NULL DEFAULT 0,
+			error TEXT,
+			actor TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			finished_at TIMESTAMPTZ
+		)`, tbl),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS agent_purge_jobs_status_idx ON %s (status)`, tbl),
+		// Tables created before jobs were claimed
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS owner TEXT`, tbl),
+	); err != nil {
+		return err
+	}
+	database.RememberColumn(companyId, "agent_purge_jobs", "id")
+	return nil
+}
+
+// HiddenAgentsCondition returns a condition excluding rows of soft-deleted agents,
+// for a column holding agent IDs. ok is false when the tenant never soft-deleted
+// an agent, so callers can skip the subquery.
+func HiddenAgentsCondition(ctx context.Context, companyId, column string) (cond string, ok bool) {
+	if !database.TenantColumnExists(ctx, companyId, "agents", "deleted_at") {
+		return "", false
+	}
+	return fmt.Sprintf(`%s NOT IN (SELECT agent_id FROM "%s"."agents" WHERE deleted_at IS NOT NULL)`,
+		column, database.TenantSchema(companyId)), true
+}
+
+// visible hides soft-deleted agents from a query on the agents table.
+func (r *agentRepo) visible(ctx context.Context, companyId string, db *gorm.DB) *gorm.DB {
+	if database.TenantColumnExists(ctx, companyId, "agents", "deleted_at") {
+		db = db.Where("deleted_at IS NULL")
+	}
+	return db
+}
+
+// CountAgentData counts the chats, contacts and messages attached to an agent.
+func (r *agentRepo) CountAgentData(ctx context.Context, companyId, agentId string) (*model.AgentDataCounts, error) {
+	return r.countAgentData(r.db.WithContext(ctx), companyId, agentId)
+}
+
+func (r *agentRepo) countAgentData(db *gorm.DB, companyId, agentId string) (*model.AgentDataCounts, error) {
+	var counts model.AgentDataCounts
+	targets := map[string]*int64{
+		"chats":    &counts.Chats,
+		"contacts": &counts.Contacts,
+		"messages": &counts.Messages,
+	}
+	for table, dest := range targets {
+		if err := db.
+			Table(r.tenantTable(companyId, table)).
+			Where("agent_id = ?", agentId).
+			Count(dest).Error; err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", table, err)
+		}
+	}
+	return &counts, nil
+}
+
+// SoftDelete hides an agent and its chats. Returns nil when the agent does not exist.
+func (r *agentRepo) SoftDelete(ctx context.Context, companyId, agentId string) (*model.Agent, error) {
+	if err := r.ensureSoftDeleteColumn(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare agents table: %w", err)
+	}
+
+	var a model.Agent
+	err := r.
+		tableFor(companyId).
+		WithContext(ctx).
+		Where("agent_id = ? AND deleted_at IS NULL", agentId).
+		First(&a).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	before := a
+	now := time.Now()
+	if err := r.
+		tableFor(companyId).
+		WithContext(ctx).
+		Where("agent_id = ?", agentId).
+		Updates(map[string]interface{}{"deleted_at": now, "updated_at": now}).Error; err != nil {
+		return nil, err
+	}
+	a.DeletedAt = &now
+	audit.Track(ctx, "agent", agentId, before, a)
+	// The agent's chats and messages disappear from every listing
+	cache.Invalidate(ctx, companyId, cache.TagAll)
+	return &a, nil
+}
+
+// CreatePurgeJob hides the agent and queues the deletion of its data.
+// Returns nil when the agent does not exist.
+func (r *agentRepo) CreatePurgeJob(ctx context.Context, companyId, agentId string) (*model.AgentPurgeJob, error) {
+	if err := r.ensurePurgeJobsTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare purge jobs table: %w", err)
+	}
+
+	// Hide the agent right away; an already hidden agent may still be purged
+	a, err := r.SoftDelete(ctx, companyId, agentId)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		var exists int64
+		if err := r.tableFor(companyId).WithContext(ctx).
+			Where("agent_id = ?", agentId).
+			Count(&exists).Error; err != nil {
+			return nil, err
+		}
+		if exists == 0 {
+			return nil, nil
+		}
+	}
+
+	counts, err := r.CountAgentData(ctx, companyId, agentId)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &model.AgentPurgeJob{
+		AgentID:       agentId,
+		Status:        model.PurgeJobPending,
+		TotalChats:    counts.Chats,
+		TotalContacts: counts.Contacts,
+		TotalMessages: counts.Messages,
+	}
+	job.Actor, _ = ctx.Value("actor").(string)
+	if err := r.db.Table(r.purgeJobsTable(companyId)).WithContext(ctx).Create(job).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (r *agentRepo) GetPurgeJob(ctx context.Context, companyId string, id int64) (*model.AgentPurgeJob, error) {
+	if err := r.ensurePurgeJobsTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare purge jobs table: %w", err)
+	}
+
+	var job model.AgentPurgeJob
+	err := r.db.Table(r.purgeJobsTable(companyId)).WithContext(ctx).Where("id = ?", id).First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ClaimPurgeJob hands a job to owner if it is pending, or running without progress
+// since staleBefore (its worker died). Returns false when another worker owns it.
+func (r *agentRepo) ClaimPurgeJob(ctx context.Context, companyId string, id int64, owner string, staleBefore time.Time) (bool, error) {
+	if err := r.ensurePurgeJobsTable(ctx, companyId); err != nil {
+		return false, fmt.Errorf("failed to prepare purge jobs table: %w", err)
+	}
+
+	res := r.db.Table(r.purgeJobsTable(companyId)).WithContext(ctx).
+		Where("id = ?", id).
+		Where("status = ? OR (status = ? AND updated_at < ?)", model.PurgeJobPending, model.PurgeJobRunning, staleBefore).
+		Updates(map[string]interface{}{
+			"status":     model.PurgeJobRunning,
+			"owner":      owner,
+			"updated_at": time.Now(),
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+// UnfinishedPurgeJobs returns the pending and running jobs of a tenant, oldest first.
+// Tenants that never purged an agent have none.
+func (r *agentRepo) UnfinishedPurgeJobs(ctx context.Context, companyId string) ([]model.AgentPurgeJob, error) {
+	if !database.TenantColumnExists(ctx, companyId, "agent_purge_jobs", "id") {
+		return nil, nil
+	}
+
+	var jobs []model.AgentPurgeJob
+	if err := r.db.Table(r.purgeJobsTable(companyId)).WithContext(ctx).
+		Where("status IN ?", []string{model.PurgeJobPending, model.PurgeJobRunning}).
+		Order("id").
+		Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// UpdatePurgeJob stores the job's status and progress, which also keeps the claim
+// alive. Returns false when the job is no longer owned by job.Owner.
+func (r *agentRepo) UpdatePurgeJob(ctx context.Context, companyId string, job *model.AgentPurgeJob) (bool, error) {
+	res := r.db.Table(r.purgeJobsTable(companyId)).WithContext(ctx).
+		Where("id = ? AND owner = ?", job.ID, job.Owner).
+		Updates(map[string]interface{}{
+			"status":           job.Status,
+			"deleted_chats":    job.DeletedChats,
+			"deleted_contacts": job.DeletedContacts,
+			"deleted_messages": job.DeletedMessages,
+			"error":            job.Error,
+			"updated_at":       time.Now(),
+			"finished_at":      job.FinishedAt,
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+// PurgeAgentBatch deletes up to batch rows of an agent from one of its data
+// tables (messages, contacts, chats) and returns how many were removed.
+func (r *agentRepo) PurgeAgentBatch(ctx context.Context, companyId, agentId, table string, batch int) (int64, error) {
+	for _, t := range purgeTables {
+		if t.table != table {
+			continue
+		}
+		tbl := r.tenantTable(companyId, table)
+		res := r.db.WithContext(ctx).Exec(
+			fmt.Sprintf(`DELETE FROM %s WHERE %s IN (SELECT %s FROM %s WHERE agent_id = ? LIMIT ?)`,
+				tbl, t.key, t.key, tbl),
+			agentId, batch,
+		)
+		if res.RowsAffected > 0 {
+			cache.Invalidate(ctx, companyId, cache.TagAll)
+		}
+		return res.RowsAffected, res.Error
+	}
+	return 0, fmt.Errorf("table %s cannot be purged", table)
+}
+
+// DeleteWithoutData removes the agent row if it owns no chats, contacts or messages.
+// The agent is locked while its data is counted, so the count and the delete see
+// the same state. Returns nil counts when the agent does not exist, and deleted
+// false when it still has data.
+func (r *agentRepo) DeleteWithoutData(ctx context.Context, companyId, agentId string) (*model.AgentDataCounts, bool, error) {
+	var (
+		a       model.Agent
+		counts  *model.AgentDataCounts
+		deleted bool
+	)
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(r.agentsTable(companyId)).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("agent_id = ?", agentId).
+			First(&a).Error; err != nil {
+			return err
+		}
+
+		var err error
+		if counts, err = r.countAgentData(tx, companyId, agentId); err != nil {
+			return err
+		}
+		if counts.Chats > 0 || counts.Contacts > 0 || counts.Messages > 0 {
+			return nil
+		}
+
+		deleted = true
+		return tx.Table(r.agentsTable(companyId)).
+			Delete(&model.Agent{}, "agent_id = ?", agentId).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if deleted {
+		audit.Track(ctx, "agent", a.AgentID, a, nil)
+		cache.Invalidate(ctx, companyId, cache.TagAll)
+	}
+	return counts, deleted, nil
+}
+
+// Delete removes the agent row. Returns false when the agent does not exist.
+func (r *agentRepo) Delete(ctx context.Context, companyId, agentId string) (bool, error) {
+	// Keep the deleted row for the audit trail
+	var a model.Agent
+	err := r.
+		tableFor(companyId).
+		WithContext(ctx).
+		Where("agent_id = ?", agentId).
+		First(&a).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.
+		tableFor(companyId).
+		WithContext(ctx).
+		Delete(&model.Agent{}, "agent_id = ?", agentId).
+		Error; err != nil {
+		return false, err
+	}
+	audit.Track(ctx, "agent", a.AgentID, a, nil)
+	cache.Invalidate(ctx, companyId, cache.TagAll)
+	return true, nil
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ensureHeartbeatColumns adds the liveness column to the tenant's agents table.
+func (r *agentRepo) ensureHeartbeatColumns(ctx context.Context, companyId string) error {
+	return database.EnsureTenantTable(ctx, companyId, "agents.last_seen",
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS last_seen TIMESTAMPTZ`, r.agentsTable(companyId)),
+	)
+}
+
+// List returns the tenant's agents matching the filter:
+//   - agent_ids ([]string): only these agents
+//   - status ([]string): any of these statuses
+//   - stale (bool) with stale_before (time.Time): agents marked stale or silent
+//     since before stale_before (true), or the opposite (false)
+func (r *agentRepo) List(ctx context.Context, companyId string, filter map[string]interface{}) ([]*model.Agent, error) {
+	db := r.visible(ctx, companyId, r.tableFor(companyId).WithContext(ctx))
+
+	for key, value := range filter {
+		switch key {
+		case "agent_ids":
+			db = db.Where("agent_id IN ?", value)
+		case "status":
+			db = db.Where("status IN ?", value)
+		case "stale":
+			stale, ok := value.(bool)
+			cutoff, hasCutoff := filter["stale_before"].(time.Time)
+			if !ok || !hasCutoff {
+				continue
+			}
+			if err := r.ensureHeartbeatColumns(ctx, companyId); err != nil {
+				return nil, fmt.Errorf("failed to prepare agents table: %w", err)
+			}
+			if stale {
+				db = db.Where("(status = ? OR last_seen < ?)", model.AgentStatusStale, cutoff)
+			} else {
+				db = db.Where("status IS DISTINCT FROM ? AND (last_seen IS NULL OR last_seen >= ?)", model.AgentStatusStale, cutoff)
+			}
+		}
+	}
+
+	var agents []*model.Agent
+	if err := db.Order("agent_id").Find(&agents).Error; err != nil {
+		return nil, err
+	}
+	return agents, nil
+}
+
+// Heartbeat stores the agent's liveness and, when given, its version and host.
+// Returns nil when the agent does not exist.
+func (r *agentRepo) Heartbeat(ctx context.Context, companyId, agentId, version, hostName string, at time.Time) (*model.Agent, error) {
+	if err := r.ensureHeartbeatColumns(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare agents table: %w", err)
+	}
+
+	var a model.Agent
+	err := r.
+		tableFor(companyId).
+		WithContext(ctx).
+		Where("agent_id = ?", agentId).
+		First(&a).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{"last_seen": at}
+	if version != "" && version != a.Version {
+		updates["version"] = version
+		updates["updated_at"] = at
+	}
+	if hostName != "" && hostName != a.HostName {
+		updates["host_name"] = hostName
+		updates["updated_at"] = at
+	}
+
+	if err := r.
+		tableFor(companyId).
+		WithContext(ctx).
+		Where("agent_id = ?", agentId).
+		Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	if version != "" {
+		a.Version = version
+	}
+	if hostName != "" {
+		a.HostName = hostName
+	}
+	a.LastSeen = &at
+	// A plain beat only moves last_seen; the agent list keeps its cached copy until
+	// it expires rather than being rebuilt every few seconds
+	tags := []string{cache.AgentTag(agentId)}
+	if _, changed := updates["updated_at"]; changed {
+		tags = append(tags, cache.TagAgents)
+	}
+	cache.Invalidate(ctx, companyId, tags...)
+	return &a, nil
+}
+
+// MarkStaleAgents sets status "stale" on agents whose last heartbeat is older than
+// cutoff and records the transition. Agents that never sent a heartbeat are left
+// alone. Rows locked by another replica's sweep are skipped. Returns the agent IDs
+// that were marked.
+func (r *agentRepo) MarkStaleAgents(ctx context.Context, companyId string, cutoff, at time.Time) ([]string, error) {
+	// Tenants that never received a heartbeat have nothing to sweep
+	if !database.TenantColumnExists(ctx, companyId, "agents", "last_seen") {
+		return nil, nil
+	}
+	if err := r.ensureStatusEventsTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare status events table: %w", err)
+	}
+
+	var marked []string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var silent []model.Agent
+		if err := r.visible(ctx, companyId, tx.Table(r.agentsTable(companyId))).
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("last_seen < ? AND status IS DISTINCT FROM ?", cutoff, model.AgentStatusStale).
+			Find(&silent).Error; err != nil {
+			return err
+		}
+
+		for _, a := range silent {
+			event := model.AgentStatusEvent{
+				AgentID:        a.AgentID,
+				Status:         model.AgentStatusStale,
+				PreviousStatus: a.Status,
+				Reason:         fmt.Sprintf("no heartbeat since %s", a.LastSeen.UTC().Format(time.RFC3339)),
+				OccurredAt:     at,
+			}
+			if err := tx.Table(r.statusEventsTable(companyId)).Create(&event).Error; err != nil {
+				return err
+			}
+			if err := tx.Table(r.agentsTable(companyId)).
+				Where("agent_id = ?", a.AgentID).
+				Updates(map[string]interface{}{"status": model.AgentStatusStale, "updated_at": at}).Error; err != nil {
+				return err
+			}
+			marked = append(marked, a.AgentID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(marked) > 0 {
+		tags := []string{cache.TagAgents}
+		for _, agentId := range marked {
+			tags = append(tags, cache.AgentTag(agentId))
+		}
+		cache.Invalidate(ctx, companyId, tags...)
+	}
+	return marked, nil
+}
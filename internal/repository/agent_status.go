@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/audit"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *agentRepo) statusEventsTable(companyId string) string {
+	return fmt.Sprintf(`"%s"."%s"`, database.TenantSchema(companyId), "agent_status_events")
+}
+
+// ensureStatusEventsTable creates the agent_status_events table the first time it is needed.
+func (r *agentRepo) ensureStatusEventsTable(ctx context.Context, companyId string) error {
+	tbl := r.statusEventsTable(companyId)
+	return database.EnsureTenantTable(ctx, companyId, "agent_status_events",
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGSERIAL PRIMARY KEY,
+			agent_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			previous_status TEXT,
+			reason TEXT,
+			occurred_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`, tbl),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS agent_status_events_agent_idx ON %s (agent_id, occurred_at)`, tbl),
+	)
+}
+
+// RecordStatus stores a status transition and updates the agent's current status.
+// Events reported out of order (older than the latest recorded one) are kept in
+// the history but do not overwrite the current status. Returns nil when the agent
+// does not exist or is soft-deleted.
+func (r *agentRepo) RecordStatus(
+	ctx context.Context,
+	companyId, agentId, status, reason string,
+	occurredAt time.Time,
+) (*model.AgentStatusEvent, error) {
+	if err := r.ensureStatusEventsTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare status events table: %w", err)
+	}
+
+	var (
+		event  model.AgentStatusEvent
+		before model.Agent
+		after  model.Agent
+	)
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the agent so concurrent transitions are serialized
+		// Soft-deleted agents are not found, as for GET
+		if err := r.visible(ctx, companyId, tx.Table(r.agentsTable(companyId))).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("agent_id = ?", agentId).
+			First(&before).Error; err != nil {
+			return err
+		}
+		after = before
+
+		var latest time.Time
+		if err := tx.Table(r.statusEventsTable(companyId)).
+			Where("agent_id = ?", agentId).
+			Select("COALESCE(MAX(occurred_at), 'epoch'::timestamptz)").
+			Scan(&latest).Error; err != nil {
+			return err
+		}
+
+		event = model.AgentStatusEvent{
+			AgentID:        agentId,
+			Status:         status,
+			PreviousStatus: before.Status,
+			Reason:         reason,
+			OccurredAt:     occurredAt,
+		}
+		if err := tx.Table(r.statusEventsTable(companyId)).Create(&event).Error; err != nil {
+			return err
+		}
+
+		if occurredAt.Before(latest) || before.Status == status {
+			return nil
+		}
+		after.Status = status
+		updates := map[string]interface{}{"status": status, "updated_at": time.Now()}
+		// Pairing finished: the QR code is spent
+		if status == model.AgentStatusConnected && before.QRCode != "" {
+			updates["qr_code"] = ""
+			after.QRCode = ""
+		}
+		// Only set when the tenant has the qr_expires_at column
+		if status == model.AgentStatusConnected && before.QRExpiresAt != nil {
+			updates["qr_expires_at"] = nil
+			after.QRExpiresAt = nil
+		}
+		return tx.Table(r.agentsTable(companyId)).
+			Where("agent_id = ?", agentId).
+			Updates(updates).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Track(ctx, "agent", agentId, before, after)
+	cache.Invalidate(ctx, companyId, cache.TagAgents, cache.AgentTag(agentId))
+	return &event, nil
+}
+
+func (r *agentRepo) FetchStatusEvents(
+	ctx context.Context,
+	companyId, agentId string,
+	from, to time.Time,
+	limit, offset int,
+) (*model.AgentStatusEventPage, error) {
+	if err := r.ensureStatusEventsTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare status events table: %w", err)
+	}
+
+	query := r.db.
+		Table(r.statusEventsTable(companyId)).
+		WithContext(ctx).
+		Where("agent_id = ?", agentId)
+	if !from.IsZero() {
+		query = query.Where("occurred_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("occurred_at < ?", to)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count status events: %w", err)
+	}
+
+	var items []model.AgentStatusEvent
+	if err := query.
+		Order("occurred_at DESC, id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch status events: %w", err)
+	}
+
+	if items == nil {
+		items = make([]model.AgentStatusEvent, 0)
+	}
+
+	return &model.AgentStatusEventPage{Total: total, Items: items}, nil
+}
+
+// StatusEventsForPeriod returns, per agent, the last event before from (the status
+// the period starts with) followed by every event in [from, to), in chronological order.
+// An empty agentIds list means every agent of the tenant.
+func (r *agentRepo) StatusEventsForPeriod(
+	ctx context.Context,
+	companyId string,
+	agentIds []string,
+	from, to time.Time,
+) ([]model.AgentStatusEvent, error) {
+	if err := r.ensureStatusEventsTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare status events table: %w", err)
+	}
+	tbl := r.statusEventsTable(companyId)
+
+	scope := func(db *gorm.DB) *gorm.DB {
+		if len(agentIds) > 0 {
+			db = db.Where("agent_id IN ?", agentIds)
+		}
+		return db
+	}
+
+	var initial []model.AgentStatusEvent
+	if err := scope(r.db.Table(tbl).WithContext(ctx)).
+		Select("DISTINCT ON (agent_id) *").
+		Where("occurred_at < ?", from).
+		Order("agent_id, occurred_at DESC, id DESC").
+		Find(&initial).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch initial statuses: %w", err)
+	}
+
+	var inPeriod []model.AgentStatusEvent
+	if err := scope(r.db.Table(tbl).WithContext(ctx)).
+		Where("occurred_at >= ? AND occurred_at < ?", from, to).
+		Order("agent_id, occurred_at ASC, id ASC").
+		Find(&inPeriod).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch status events: %w", err)
+	}
+
+	return append(initial, inPeriod...), nil
+}
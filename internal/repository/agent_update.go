@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/audit"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ensureQRColumns adds the QR expiry column to the tenant's agents table.
+func (r *agentRepo) ensureQRColumns(ctx context.Context, companyId string) error {
+	return database.EnsureTenantTable(ctx, companyId, "agents.qr_expires_at",
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS qr_expires_at TIMESTAMPTZ`, r.agentsTable(companyId)),
+	)
+}
+
+// Update applies the column updates to an agent. When the status changes, the
+// transition is stored in the status history like a reported one.
+// Returns nil when the agent does not exist or is soft-deleted.
+func (r *agentRepo) Update(
+	ctx context.Context,
+	companyId, agentId string,
+	updates map[string]interface{},
+	check func(*model.Agent) error,
+) (*model.Agent, error) {
+	if _, ok := updates["qr_expires_at"]; ok {
+		if err := r.ensureQRColumns(ctx, companyId); err != nil {
+			return nil, fmt.Errorf("failed to prepare agents table: %w", err)
+		}
+	}
+	if _, ok := updates["status"]; ok {
+		if err := r.ensureStatusEventsTable(ctx, companyId); err != nil {
+			return nil, fmt.Errorf("failed to prepare status events table: %w", err)
+		}
+	}
+
+	var before, after model.Agent
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Soft-deleted agents are not found, as for GET
+		if err := r.visible(ctx, companyId, tx.Table(r.agentsTable(companyId))).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("agent_id = ?", agentId).
+			First(&before).Error; err != nil {
+			return err
+		}
+		if check != nil {
+			if err := check(&before); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		if status, ok := updates["status"].(string); ok && status != before.Status {
+			event := model.AgentStatusEvent{
+				AgentID:        agentId,
+				Status:         status,
+				PreviousStatus: before.Status,
+				Reason:         "agent update",
+				OccurredAt:     now,
+			}
+			if err := tx.Table(r.statusEventsTable(companyId)).Create(&event).Error; err != nil {
+				return err
+			}
+		}
+
+		updates["updated_at"] = now
+		if err := tx.Table(r.agentsTable(companyId)).
+			Where("agent_id = ?", agentId).
+			Updates(updates).Error; err != nil {
+			return err
+		}
+
+		return tx.Table(r.agentsTable(companyId)).
+			Where("agent_id = ?", agentId).
+			First(&after).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Track(ctx, "agent", agentId, before, after)
+	cache.Invalidate(ctx, companyId, cache.TagAgents, cache.AgentTag(agentId))
+	return &after, nil
+}
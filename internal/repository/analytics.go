@@ -0,0 +1,604 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+)
+
+// AnalyticsRepository runs the reporting queries of a tenant.
+// Message queries always bound message_date, the partition key of messages,
+// so Postgres only scans the partitions of the requested period.
+type AnalyticsRepository interface {
+	// AgentChatCounts returns current chat, unread chat and contact totals per agent
+	AgentChatCounts(ctx context.Context, companyId string, agentIds []string) ([]model.AgentChatCounts, error)
+	// AgentDailyCounts returns inbound/outbound message counts per agent and day in [from, to)
+	AgentDailyCounts(ctx context.Context, companyId string, agentIds []string, from, to time.Time, materialized bool) ([]model.AgentDailyCount, error)
+	// FirstResponseTimes summarizes, per agent, the delay between the first inbound
+	// message of each chat in [from, to) and the first outbound reply within
+	// replyHorizonDays
+	FirstResponseTimes(ctx context.Context, companyId string, agentIds []string, from, to time.Time) ([]model.AgentResponseTimes, error)
+	// MessageVolume counts messages in [from, to) per time bucket (hour, day, week)
+	// and per groupBy column (agent_id, flow, message_type). Filters: agent_ids ([]string),
+	// flow (string), message_type (string).
+	MessageVolume(ctx context.Context, companyId string, filter map[string]interface{}, bucket string, groupBy []string, from, to time.Time) ([]model.MessageVolumePoint, error)
+	// ResponseTimes computes first-response and response delays of the turns started in
+	// [from, to), found over the chats' whole history, grouped by agent_id or by the
+	// contact's assigned_to. Filters: agent_ids ([]string).
+	ResponseTimes(ctx context.Context, companyId string, filter map[string]interface{}, groupBy string, from, to time.Time) ([]model.ResponseTimeRow, error)
+	// SLABreaches lists chats waiting for a reply since before waitingBefore (unix seconds),
+	// looking at messages since the given day. Filters: agent_ids ([]string), assigned_to (string).
+	SLABreaches(ctx context.Context, companyId string, filter map[string]interface{}, waitingBefore int64, since time.Time, limit, offset int) (*model.SLABreachPage, error)
+	// ContactFunnel counts contacts created and contacts whose first message falls in
+	// [from, to), per time bucket (day, week, month) and per groupBy column (origin, tag,
+	// status, agent_id). Filters: agent_ids ([]string), origin (string).
+	ContactFunnel(ctx context.Context, companyId string, filter map[string]interface{}, bucket string, groupBy []string, from, to time.Time) ([]model.ContactFunnelPoint, error)
+	// RefreshStatsViews creates (if needed) and refreshes the tenant's statistics views
+	RefreshStatsViews(ctx context.Context, companyId string) error
+	// StatsViewsReady reports whether this process refreshed the tenant's views
+	StatsViewsReady(companyId string) bool
+}
+
+// NewAnalyticsRepository returns the GORM-backed implementation.
+func NewAnalyticsRepository() AnalyticsRepository {
+	return &analyticsRepo{db: database.DB}
+}
+
+type analyticsRepo struct {
+	db *gorm.DB
+	// refreshed holds the tenants whose statistics views were refreshed by this process
+	refreshed sync.Map
+}
+
+func (r *analyticsRepo) table(companyId, name string) string {
+	return fmt.Sprintf(`"%s"."%s"`, database.TenantSchema(companyId), name)
+}
+
+// agentScope restricts a query to the given agents and hides soft-deleted ones.
+func (r *analyticsRepo) agentScope(ctx context.Context, companyId, column string, agentIds []string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(agentIds) > 0 {
+			db = db.Where(column+" IN ?", agentIds)
+		}
+		if cond, ok := HiddenAgentsCondition(ctx, companyId, column); ok {
+			db = db.Where(cond)
+		}
+		return db
+	}
+}
+
+// replyHorizonDays bounds how many days after a message its reply is looked for;
+// messages answered later count as pending. It keeps the reply lookups to a few
+// partitions.
+const replyHorizonDays = 30
+
+// messageDateRange bounds a messages query to the days of [from, to) on the
+// partition key; a to within a day includes that day.
+func messageDateRange(column string, from, to time.Time) (string, []interface{}) {
+	toDay := to.UTC().Truncate(24 * time.Hour)
+	if toDay.Before(to) {
+		toDay = toDay.AddDate(0, 0, 1)
+	}
+	return fmt.Sprintf("%s >= ? AND %s < ?", column, column),
+		[]interface{}{from.UTC().Format(time.DateOnly), toDay.Format(time.DateOnly)}
+}
+
+// unixTime converts a unix timestamp column to a UTC timestamp. Ingestion stores
+// message_timestamp and first_message_timestamp in seconds, as WhatsApp sends them.
+func unixTime(column string) string {
+	return "(to_timestamp(" + column + ") AT TIME ZONE 'UTC')"
+}
+
+func (r *analyticsRepo) AgentChatCounts(ctx context.Context, companyId string, agentIds []string) ([]model.AgentChatCounts, error) {
+	var chats []model.AgentChatCounts
+	if err := r.db.
+		Table(r.table(companyId, "chats")).
+		WithContext(ctx).
+		Scopes(r.agentScope(ctx, companyId, "agent_id", agentIds)).
+		Select("agent_id, COUNT(*) AS total_chats, COUNT(*) FILTER (WHERE unread_count > 0) AS unread_chats").
+		Group("agent_id").
+		Scan(&chats).Error; err != nil {
+		return nil, fmt.Errorf("failed to count chats: %w", err)
+	}
+
+	var contacts []model.AgentChatCounts
+	if err := r.db.
+		Table(r.table(companyId, "contacts")).
+		WithContext(ctx).
+		Scopes(r.agentScope(ctx, companyId, "agent_id", agentIds)).
+		Select("agent_id, COUNT(*) AS contacts").
+		Group("agent_id").
+		Scan(&contacts).Error; err != nil {
+		return nil, fmt.Errorf("failed to count contacts: %w", err)
+	}
+
+	byAgent := make(map[string]*model.AgentChatCounts, len(chats))
+	result := make([]model.AgentChatCounts, 0, len(chats)+len(contacts))
+	for _, c := range chats {
+		result = append(result, c)
+	}
+	for i := range result {
+		byAgent[result[i].AgentID] = &result[i]
+	}
+	for _, c := range contacts {
+		if existing, ok := byAgent[c.AgentID]; ok {
+			existing.Contacts = c.Contacts
+			continue
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+func (r *analyticsRepo) AgentDailyCounts(
+	ctx context.Context,
+	companyId string,
+	agentIds []string,
+	from, to time.Time,
+	materialized bool,
+) ([]model.AgentDailyCount, error) {
+	cond, args := messageDateRange("message_date", from, to)
+
+	query := r.db.WithContext(ctx)
+	if materialized {
+		query = query.
+			Table(r.table(companyId, "agent_daily_message_stats")).
+			Select("agent_id, message_date, inbound, outbound")
+	} else {
+		query = query.
+			Table(r.table(companyId, "messages")).
+			Select("agent_id, message_date, "+
+				"COUNT(*) FILTER (WHERE flow = ?) AS inbound, "+
+				"COUNT(*) FILTER (WHERE flow = ?) AS outbound",
+				model.MessageFlowInbound, model.MessageFlowOutbound).
+			Group("agent_id, message_date")
+	}
+
+	var rows []model.AgentDailyCount
+	if err := query.
+		Scopes(r.agentScope(ctx, companyId, "agent_id", agentIds)).
+		Where(cond, args...).
+		Order("agent_id, message_date").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count messages: %w", err)
+	}
+	return rows, nil
+}
+
+func (r *analyticsRepo) FirstResponseTimes(
+	ctx context.Context,
+	companyId string,
+	agentIds []string,
+	from, to time.Time,
+) ([]model.AgentResponseTimes, error) {
+	msgTbl := r.table(companyId, "messages")
+	cond, args := messageDateRange("message_date", from, to)
+	args = append(args, model.MessageFlowInbound)
+
+	var filters []string
+	if len(agentIds) > 0 {
+		filters = append(filters, "agent_id IN ?")
+		args = append(args, agentIds)
+	}
+	if hidden, ok := HiddenAgentsCondition(ctx, companyId, "agent_id"); ok {
+		filters = append(filters, hidden)
+	}
+	extra := ""
+	if len(filters) > 0 {
+		extra = " AND " + strings.Join(filters, " AND ")
+	}
+
+	// The reply is the agent's next outbound message in the chat other than a
+	// reaction. It may come after the period ends, so the lateral lookup is bounded
+	// by the inbound message's day and the reply horizon instead of the period.
+	sql := fmt.Sprintf(`
+		WITH first_inbound AS (
+			SELECT agent_id, chat_id, MIN(message_timestamp) AS inbound_at, MIN(message_date) AS inbound_date
+			FROM %[1]s
+			WHERE %[2]s AND flow = ?%[3]s
+			GROUP BY agent_id, chat_id
+		), replies AS (
+			SELECT f.agent_id, reply.outbound_at - f.inbound_at AS delay
+			FROM first_inbound f
+			LEFT JOIN LATERAL (
+				SELECT MIN(m.message_timestamp) AS outbound_at
+				FROM %[1]s m
+				WHERE m.agent_id = f.agent_id AND m.chat_id = f.chat_id
+				  AND m.flow = ?
+				  AND m.message_date >= f.inbound_date
+				  AND m.message_date < f.inbound_date + %[4]d
+				  AND m.message_timestamp >= f.inbound_at
+				  AND %[5]s IS NULL
+			) reply ON TRUE
+		)
+		SELECT agent_id,
+			COUNT(delay) AS responded,
+			COUNT(*) - COUNT(delay) AS pending,
+			COALESCE(AVG(delay), 0) AS avg_seconds,
+			COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY delay), 0) AS median_seconds
+		FROM replies
+		GROUP BY agent_id
+		ORDER BY agent_id`, msgTbl, cond, extra, replyHorizonDays, reactionTargetExpr)
+
+	args = append(args, model.MessageFlowOutbound)
+
+	var rows []model.AgentResponseTimes
+	if err := r.db.WithContext(ctx).Raw(sql, args...).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to compute response times: %w", err)
+	}
+	return rows, nil
+}
+
+func (r *analyticsRepo) RefreshStatsViews(ctx context.Context, companyId string) error {
+	view := r.table(companyId, "agent_daily_message_stats")
+	if err := database.EnsureTenantTable(ctx, companyId, "agent_daily_message_stats",
+		fmt.Sprintf(`CREATE MATERIALIZED VIEW IF NOT EXISTS %s AS
+			SELECT agent_id, message_date,
+				COUNT(*) FILTER (WHERE flow = '%s') AS inbound,
+				COUNT(*) FILTER (WHERE flow = '%s') AS outbound
+			FROM %s
+			GROUP BY agent_id, message_date`,
+			view, model.MessageFlowInbound, model.MessageFlowOutbound, r.table(companyId, "messages")),
+		// A unique index allows concurrent refreshes that do not block readers
+		fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS agent_daily_message_stats_key ON %s (agent_id, message_date)`, view),
+	); err != nil {
+		return fmt.Errorf("failed to create statistics view: %w", err)
+	}
+
+	if err := r.db.WithContext(ctx).
+		Exec(fmt.Sprintf(`REFRESH MATERIALIZED VIEW CONCURRENTLY %s`, view)).Error; err != nil {
+		return fmt.Errorf("failed to refresh statistics view: %w", err)
+	}
+	r.refreshed.Store(companyId, struct{}{})
+	return nil
+}
+
+func (r *analyticsRepo) StatsViewsReady(companyId string) bool {
+	_, ok := r.refreshed.Load(companyId)
+	return ok
+}
+
+func (r *analyticsRepo) MessageVolume(
+	ctx context.Context,
+	companyId string,
+	filter map[string]interface{},
+	bucket string,
+	groupBy []string,
+	from, to time.Time,
+) ([]model.MessageVolumePoint, error) {
+	// Day and week buckets only need the partition key; hours need the timestamp
+	bucketExpr := fmt.Sprintf("date_trunc('%s', message_date::timestamp)", bucket)
+	if bucket == "hour" {
+		bucketExpr = "date_trunc('hour', " + unixTime("message_timestamp") + ")"
+	}
+
+	columns := append([]string{bucketExpr + " AS bucket"}, groupBy...)
+	groups := append([]string{"1"}, groupBy...)
+
+	cond, args := messageDateRange("message_date", from, to)
+	query := r.db.
+		Table(r.table(companyId, "messages")).
+		WithContext(ctx).
+		Select(strings.Join(columns, ", ")+", COUNT(*) AS count").
+		Where(cond, args...)
+	if bucket == "hour" {
+		// Hourly periods may start and end within a day
+		query = query.Where("message_timestamp >= ? AND message_timestamp < ?", from.Unix(), to.Unix())
+	}
+
+	var agentIds []string
+	for key, value := range filter {
+		switch key {
+		case "agent_ids":
+			agentIds, _ = value.([]string)
+		case "flow", "message_type":
+			query = query.Where(key+" = ?", value)
+		}
+	}
+	query = query.Scopes(r.agentScope(ctx, companyId, "agent_id", agentIds))
+
+	var points []model.MessageVolumePoint
+	if err := query.
+		Group(strings.Join(groups, ", ")).
+		Order(strings.Join(groups, ", ")).
+		Scan(&points).Error; err != nil {
+		return nil, fmt.Errorf("failed to count messages: %w", err)
+	}
+	return points, nil
+}
+
+// agentConditions renders the agent filter and hidden agents condition for raw SQL.
+func (r *analyticsRepo) agentConditions(ctx context.Context, companyId, column string, agentIds []string) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if len(agentIds) > 0 {
+		conds = append(conds, column+" IN ?")
+		args = append(args, agentIds)
+	}
+	if hidden, ok := HiddenAgentsCondition(ctx, companyId, column); ok {
+		conds = append(conds, hidden)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " AND " + strings.Join(conds, " AND "), args
+}
+
+func (r *analyticsRepo) ResponseTimes(
+	ctx context.Context,
+	companyId string,
+	filter map[string]interface{},
+	groupBy string,
+	from, to time.Time,
+) ([]model.ResponseTimeRow, error) {
+	msgTbl := r.table(companyId, "messages")
+	agentIds, _ := filter["agent_ids"].([]string)
+
+	groupExpr := "t.agent_id"
+	join := ""
+	if groupBy == "assigned_to" {
+		groupExpr = "COALESCE(ct.assigned_to, '')"
+		join = fmt.Sprintf(`LEFT JOIN LATERAL (
+				SELECT assigned_to FROM %s c WHERE c.agent_id = t.agent_id AND c.chat_id = t.chat_id LIMIT 1
+			) ct ON TRUE`, r.table(companyId, "contacts"))
+	}
+
+	dateCond, args := messageDateRange("message_date", from, to)
+	agentCond, agentArgs := r.agentConditions(ctx, companyId, "agent_id", agentIds)
+	args = append(args, model.MessageFlowInbound, model.MessageFlowOutbound)
+	args = append(args, agentArgs...)
+	args = append(args, model.MessageFlowInbound, model.MessageFlowInbound, model.MessageFlowOutbound)
+	args = append(args, model.MessageFlowInbound, model.MessageFlowInbound, model.MessageFlowOutbound)
+
+	// A turn starts at an inbound message whose predecessor in the chat is not inbound.
+	// Turns are found in the chat's whole history: the message preceding a chat's
+	// first message of the period is looked up before it, and the first turn is the
+	// chat's first inbound message ever. The reply may come after the period ends,
+	// so the lookup is bounded by the turn's day and the reply horizon.
+	sql := fmt.Sprintf(`
+		WITH period AS (
+			SELECT id, agent_id, chat_id, flow, message_timestamp, message_date
+			FROM %[1]s
+			WHERE %[2]s AND flow IN (?, ?)%[3]s
+		), firsts AS (
+			SELECT DISTINCT ON (agent_id, chat_id) agent_id, chat_id, message_timestamp, message_date
+			FROM period
+			ORDER BY agent_id, chat_id, message_timestamp, id
+		), earlier AS (
+			SELECT f.agent_id, f.chat_id, prev.flow AS previous_flow,
+				EXISTS (
+					SELECT 1 FROM %[1]s m
+					WHERE m.agent_id = f.agent_id AND m.chat_id = f.chat_id
+					  AND m.flow = ?
+					  AND m.message_date <= f.message_date
+					  AND m.message_timestamp < f.message_timestamp
+				) AS asked_before
+			FROM firsts f
+			LEFT JOIN LATERAL (
+				SELECT m.flow
+				FROM %[1]s m
+				WHERE m.agent_id = f.agent_id AND m.chat_id = f.chat_id
+				  AND m.flow IN (?, ?)
+				  AND m.message_date <= f.message_date
+				  AND m.message_timestamp < f.message_timestamp
+				ORDER BY m.message_timestamp DESC, m.id DESC
+				LIMIT 1
+			) prev ON TRUE
+		), ordered AS (
+			SELECT p.agent_id, p.chat_id, p.flow, p.message_timestamp, p.message_date, e.asked_before,
+				CASE WHEN ROW_NUMBER() OVER w = 1 THEN e.previous_flow ELSE LAG(p.flow) OVER w END AS previous_flow
+			FROM period p
+			JOIN earlier e ON e.agent_id = p.agent_id AND e.chat_id = p.chat_id
+			WINDOW w AS (PARTITION BY p.agent_id, p.chat_id ORDER BY p.message_timestamp, p.id)
+		), turns AS (
+			SELECT agent_id, chat_id, message_timestamp AS asked_at, message_date AS asked_date,
+				ROW_NUMBER() OVER (PARTITION BY agent_id, chat_id ORDER BY message_timestamp) = 1
+					AND NOT asked_before AS first_turn
+			FROM ordered
+			WHERE flow = ? AND previous_flow IS DISTINCT FROM ?
+		), answered AS (
+			SELECT t.agent_id, t.chat_id, t.first_turn, reply.replied_at - t.asked_at AS delay
+			FROM turns t
+			LEFT JOIN LATERAL (
+				SELECT MIN(m.message_timestamp) AS replied_at
+				FROM %[1]s m
+				WHERE m.agent_id = t.agent_id AND m.chat_id = t.chat_id
+				  AND m.flow = ?
+				  AND m.message_date >= t.asked_date
+				  AND m.message_date < t.asked_date + %[6]d
+				  AND m.message_timestamp >= t.asked_at
+			) reply ON TRUE
+		)
+		SELECT %[4]s AS group_key,
+			COUNT(DISTINCT t.chat_id) AS chats,
+			COUNT(t.delay) FILTER (WHERE t.first_turn) AS first_responded,
+			COUNT(*) FILTER (WHERE t.first_turn AND t.delay IS NULL) AS first_pending,
+			COALESCE(AVG(t.delay) FILTER (WHERE t.first_turn), 0) AS first_avg_seconds,
+			COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY t.delay) FILTER (WHERE t.first_turn), 0) AS first_median_seconds,
+			COUNT(t.delay) AS responded,
+			COUNT(*) - COUNT(t.delay) AS pending,
+			COALESCE(AVG(t.delay), 0) AS avg_seconds,
+			COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY t.delay), 0) AS median_seconds
+		FROM answered t
+		%[5]s
+		GROUP BY 1
+		ORDER BY 1`, msgTbl, dateCond, agentCond, groupExpr, join, replyHorizonDays)
+
+	var rows []model.ResponseTimeRow
+	if err := r.db.WithContext(ctx).Raw(sql, args...).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to compute response times: %w", err)
+	}
+	return rows, nil
+}
+
+func (r *analyticsRepo) SLABreaches(
+	ctx context.Context,
+	companyId string,
+	filter map[string]interface{},
+	waitingBefore int64,
+	since time.Time,
+	limit, offset int,
+) (*model.SLABreachPage, error) {
+	msgTbl := r.table(companyId, "messages")
+	agentIds, _ := filter["agent_ids"].([]string)
+	sinceDay := since.Format(time.DateOnly)
+
+	agentCond, agentArgs := r.agentConditions(ctx, companyId, "agent_id", agentIds)
+	args := []interface{}{model.MessageFlowOutbound, model.MessageFlowInbound, sinceDay}
+	args = append(args, agentArgs...)
+	args = append(args, model.MessageFlowInbound, sinceDay, waitingBefore)
+
+	assignedCond := ""
+	if assignedTo, ok := filter["assigned_to"].(string); ok {
+		assignedCond = " AND COALESCE(ct.assigned_to, '') = ?"
+		args = append(args, assignedTo)
+	}
+
+	// A chat is waiting when its last inbound message is newer than its last reply;
+	// the wait started at the first inbound message after that reply. A chat_id may
+	// be shared by several agents, so every lookup is matched on the agent too.
+	base := fmt.Sprintf(`
+		WITH latest AS (
+			SELECT chat_id, agent_id,
+				MAX(message_timestamp) FILTER (WHERE flow = ?) AS replied_at,
+				MAX(message_timestamp) FILTER (WHERE flow = ?) AS last_inbound_at
+			FROM %[1]s
+			WHERE message_date >= ?%[2]s
+			GROUP BY chat_id, agent_id
+		), waiting AS (
+			SELECT l.chat_id, l.agent_id,
+				(SELECT MIN(m.message_timestamp)
+				 FROM %[1]s m
+				 WHERE m.agent_id = l.agent_id AND m.chat_id = l.chat_id
+				   AND m.flow = ?
+				   AND m.message_date >= ?
+				   AND m.message_timestamp > COALESCE(l.replied_at, 0)) AS waiting_at
+			FROM latest l
+			WHERE l.last_inbound_at > COALESCE(l.replied_at, 0)
+		)
+		SELECT w.chat_id, w.agent_id, w.waiting_at,
+			COALESCE(ch.phone_number, '') AS phone_number,
+			COALESCE(ch.push_name, '') AS push_name,
+			COALESCE(ct.assigned_to, '') AS assigned_to
+		FROM waiting w
+		LEFT JOIN %[3]s ch ON ch.agent_id = w.agent_id AND ch.chat_id = w.chat_id
+		LEFT JOIN LATERAL (
+			SELECT assigned_to FROM %[4]s c WHERE c.agent_id = w.agent_id AND c.chat_id = w.chat_id LIMIT 1
+		) ct ON TRUE
+		WHERE w.waiting_at <= ?%[5]s`,
+		msgTbl, agentCond, r.table(companyId, "chats"), r.table(companyId, "contacts"), assignedCond)
+
+	var total int64
+	if err := r.db.WithContext(ctx).
+		Raw("SELECT COUNT(*) FROM ("+base+") breaches", args...).
+		Scan(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count SLA breaches: %w", err)
+	}
+
+	var items []model.SLABreach
+	if err := r.db.WithContext(ctx).
+		Raw(base+" ORDER BY w.waiting_at ASC LIMIT ? OFFSET ?", append(args, limit, offset)...).
+		Scan(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch SLA breaches: %w", err)
+	}
+
+	if items == nil {
+		items = make([]model.SLABreach, 0)
+	}
+	return &model.SLABreachPage{Total: total, Items: items}, nil
+}
+
+// contactGroupColumns maps funnel groupings to their SQL expression on contacts c
+// (tags are split into one row per tag by a lateral join aliased tg).
+var contactGroupColumns = map[string]string{
+	"origin":   "COALESCE(c.origin, '')",
+	"tag":      "COALESCE(tg.tag, '')",
+	"status":   "COALESCE(c.status, '')",
+	"agent_id": "c.agent_id",
+}
+
+func (r *analyticsRepo) ContactFunnel(
+	ctx context.Context,
+	companyId string,
+	filter map[string]interface{},
+	bucket string,
+	groupBy []string,
+	from, to time.Time,
+) ([]model.ContactFunnelPoint, error) {
+	var (
+		selects  []string
+		outer    []string
+		joinTags bool
+	)
+	for _, g := range groupBy {
+		expr, ok := contactGroupColumns[g]
+		if !ok {
+			return nil, fmt.Errorf("cannot group by %s", g)
+		}
+		selects = append(selects, expr+" AS "+g)
+		outer = append(outer, g)
+		joinTags = joinTags || g == "tag"
+	}
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+	agentIds, _ := filter["agent_ids"].([]string)
+	if agentCond, agentArgs := r.agentConditions(ctx, companyId, "c.agent_id", agentIds); agentCond != "" {
+		conds = append(conds, strings.TrimPrefix(agentCond, " AND "))
+		args = append(args, agentArgs...)
+	}
+	if origin, ok := filter["origin"].(string); ok {
+		conds = append(conds, "COALESCE(c.origin, '') = ?")
+		args = append(args, origin)
+	}
+
+	source := fmt.Sprintf("%s c", r.table(companyId, "contacts"))
+	if joinTags {
+		source += ` LEFT JOIN LATERAL (
+			SELECT DISTINCT btrim(t) AS tag
+			FROM unnest(string_to_array(NULLIF(c.tags, ''), ',')) AS t
+			WHERE btrim(t) <> ''
+		) tg ON TRUE`
+	}
+
+	// One branch per date: a contact may count as created in one bucket and as
+	// first messaging in another
+	branch := func(dateExpr, createdCol, firstCol, dateCond string) (string, []interface{}) {
+		cols := append([]string{fmt.Sprintf("date_trunc('%s', %s) AS bucket", bucket, dateExpr)}, selects...)
+		cols = append(cols, createdCol+" AS created", firstCol+" AS first_message")
+		where := append([]string{dateCond}, conds...)
+		branchArgs := append([]interface{}{from, to}, args...)
+		return fmt.Sprintf("SELECT %s FROM %s WHERE %s",
+			strings.Join(cols, ", "), source, strings.Join(where, " AND ")), branchArgs
+	}
+
+	created, createdArgs := branch("c.created_at AT TIME ZONE 'UTC'", "1", "0",
+		"c.created_at >= ? AND c.created_at < ?")
+	firstMsg, firstArgs := branch(unixTime("c.first_message_timestamp"), "0", "1",
+		"c.first_message_timestamp > 0 AND to_timestamp(c.first_message_timestamp) >= ? AND to_timestamp(c.first_message_timestamp) < ?")
+
+	groups := append([]string{"bucket"}, outer...)
+	sql := fmt.Sprintf(`
+		SELECT %[1]s, SUM(created) AS created, SUM(first_message) AS first_message
+		FROM (%[2]s UNION ALL %[3]s) funnel
+		GROUP BY %[1]s
+		ORDER BY %[1]s`, strings.Join(groups, ", "), created, firstMsg)
+
+	var points []model.ContactFunnelPoint
+	if err := r.db.WithContext(ctx).
+		Raw(sql, append(createdArgs, firstArgs...)...).
+		Scan(&points).Error; err != nil {
+		return nil, fmt.Errorf("failed to count contacts: %w", err)
+	}
+	return points, nil
+}
@@ -0,0 +1,306 @@
+// internal/repository/archive.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ArchiveRepository keeps the catalog of archived message partitions
+type ArchiveRepository interface {
+	// MessagePartitions lists the range partitions of the messages table
+	MessagePartitions(ctx context.Context, companyId string) ([]model.MessagePartition, error)
+	// Begin records that a partition is being archived. Returns the existing entry
+	// with claimed false when the partition is archived, or being archived by a
+	// worker that made progress since staleBefore.
+	Begin(ctx context.Context, companyId string, archive *model.MessageArchive, staleBefore time.Time) (claimed bool, err error)
+	Get(ctx context.Context, companyId string, id int64) (*model.MessageArchive, error)
+	List(ctx context.Context, companyId string, limit, offset int) (*model.MessageArchivePage, error)
+	// ListArchived returns the archived partitions, oldest first
+	ListArchived(ctx context.Context, companyId string) ([]model.MessageArchive, error)
+	// Update stores an archive's status and output
+	Update(ctx context.Context, companyId string, archive *model.MessageArchive) error
+	// Delete removes an archive and its chat index from the catalog
+	Delete(ctx context.Context, companyId string, id int64) error
+
+	// StreamPartition passes every message of a partition to fn, ordered by chat
+	// (byte order), agent, timestamp and id, in a single pass
+	StreamPartition(ctx context.Context, companyId, name string, fn func(*model.Message) error) error
+	// DropPartition drops a partition of messages if it still holds expectedRows
+	// rows. Returns false, leaving it attached, when rows changed.
+	DropPartition(ctx context.Context, companyId, name string, expectedRows int64) (bool, error)
+
+	// SaveChats replaces the chat index of an archive
+	SaveChats(ctx context.Context, companyId string, archiveId int64, chats []model.MessageArchiveChat) error
+	// FindChats returns the archived entries of chats, oldest archive first. An empty
+	// agentId matches every agent.
+	FindChats(ctx context.Context, companyId, agentId string, chatIds []string) ([]model.MessageArchiveChat, error)
+}
+
+func NewArchiveRepository() ArchiveRepository {
+	return &archiveRepo{db: database.DB}
+}
+
+type archiveRepo struct {
+	db *gorm.DB
+}
+
+func (r *archiveRepo) tenantTable(companyId, table string) string {
+	return fmt.Sprintf(`"%s"."%s"`, database.TenantSchema(companyId), table)
+}
+
+// ensureTables creates the message_archives catalog and its chat index the first time they are needed.
+func (r *archiveRepo) ensureTables(ctx context.Context, companyId string) error {
+	archives := r.tenantTable(companyId, "message_archives")
+	chats := r.tenantTable(companyId, "message_archive_chats")
+	if err := database.EnsureTenantTable(ctx, companyId, "message_archives",
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGSERIAL PRIMARY KEY,
+			partition_name TEXT NOT NULL UNIQUE,
+			period_from DATE NOT NULL,
+			period_to DATE NOT NULL,
+			format TEXT NOT NULL,
+			status TEXT NOT NULL,
+			message_count BIGINT NOT NULL DEFAULT 0,
+			file_key TEXT,
+			file_size BIGINT NOT NULL DEFAULT 0,
+			error TEXT,
+			actor TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			archived_at TIMESTAMPTZ
+		)`, archives),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			archive_id BIGINT NOT NULL REFERENCES %s (id) ON DELETE CASCADE,
+			agent_id TEXT NOT NULL,
+			chat_id TEXT NOT NULL,
+			message_count BIGINT NOT NULL,
+			deleted_count BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (archive_id, agent_id, chat_id)
+		)`, chats, archives),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS message_archive_chats_chat_idx ON %s (chat_id, agent_id)`, chats),
+	); err != nil {
+		return err
+	}
+	database.RememberColumn(companyId, "message_archives", "id")
+	return nil
+}
+
+func (r *archiveRepo) archives(ctx context.Context, companyId string) *gorm.DB {
+	return r.db.Table(r.tenantTable(companyId, "message_archives")).WithContext(ctx)
+}
+
+func (r *archiveRepo) MessagePartitions(ctx context.Context, companyId string) ([]model.MessagePartition, error) {
+	return messagePartitions(ctx, r.db, companyId)
+}
+
+func (r *archiveRepo) Begin(ctx context.Context, companyId string, archive *model.MessageArchive, staleBefore time.Time) (bool, error) {
+	if err := r.ensureTables(ctx, companyId); err != nil {
+		return false, fmt.Errorf("failed to prepare archive tables: %w", err)
+	}
+
+	archive.Status = model.ArchiveStatusArchiving
+	archive.Actor, _ = ctx.Value("actor").(string)
+	tbl := r.tenantTable(companyId, "message_archives")
+	// A failed or abandoned attempt is taken over; anything else is left alone
+	res := r.archives(ctx, companyId).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "partition_name"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"status":        archive.Status,
+				"file_key":      archive.FileKey,
+				"message_count": 0,
+				"file_size":     0,
+				"error":         "",
+				"actor":         archive.Actor,
+				"updated_at":    gorm.Expr("now()"),
+			}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Expr{
+					SQL:  tbl + ".status = ? OR (" + tbl + ".status = ? AND " + tbl + ".updated_at < ?)",
+					Vars: []interface{}{model.ArchiveStatusFailed, model.ArchiveStatusArchiving, staleBefore},
+				},
+			}},
+		}).
+		Create(archive)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return true, nil
+	}
+
+	return false, r.archives(ctx, companyId).Where("partition_name = ?", archive.Partition).First(archive).Error
+}
+
+func (r *archiveRepo) Get(ctx context.Context, companyId string, id int64) (*model.MessageArchive, error) {
+	if err := r.ensureTables(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare archive tables: %w", err)
+	}
+
+	var a model.MessageArchive
+	err := r.archives(ctx, companyId).Where("id = ?", id).First(&a).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *archiveRepo) List(ctx context.Context, companyId string, limit, offset int) (*model.MessageArchivePage, error) {
+	if err := r.ensureTables(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare archive tables: %w", err)
+	}
+
+	var total int64
+	if err := r.archives(ctx, companyId).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count archives: %w", err)
+	}
+	var items []model.MessageArchive
+	if err := r.archives(ctx, companyId).Order("period_from DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch archives: %w", err)
+	}
+	if items == nil {
+		items = make([]model.MessageArchive, 0)
+	}
+	return &model.MessageArchivePage{Items: items, Total: total}, nil
+}
+
+// ListArchived returns nothing for tenants that never archived a partition.
+func (r *archiveRepo) ListArchived(ctx context.Context, companyId string) ([]model.MessageArchive, error) {
+	if !database.TenantColumnExists(ctx, companyId, "message_archives", "id") {
+		return nil, nil
+	}
+
+	var items []model.MessageArchive
+	if err := r.archives(ctx, companyId).
+		Where("status = ?", model.ArchiveStatusArchived).
+		Order("period_from ASC").
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch archives: %w", err)
+	}
+	return items, nil
+}
+
+func (r *archiveRepo) Update(ctx context.Context, companyId string, archive *model.MessageArchive) error {
+	if err := r.archives(ctx, companyId).
+		Where("id = ?", archive.ID).
+		Updates(map[string]interface{}{
+			"status":        archive.Status,
+			"message_count": archive.Rows,
+			"file_size":     archive.FileSize,
+			"error":         archive.Error,
+			"updated_at":    time.Now(),
+			"archived_at":   archive.ArchivedAt,
+		}).Error; err != nil {
+		return err
+	}
+	// Archived messages are read from the file from now on, or it was rewritten
+	if archive.Status == model.ArchiveStatusArchived {
+		cache.Invalidate(ctx, companyId, cache.TagMessages)
+	}
+	return nil
+}
+
+func (r *archiveRepo) Delete(ctx context.Context, companyId string, id int64) error {
+	if err := r.archives(ctx, companyId).Where("id = ?", id).Delete(&model.MessageArchive{}).Error; err != nil {
+		return err
+	}
+	cache.Invalidate(ctx, companyId, cache.TagMessages)
+	return nil
+}
+
+func (r *archiveRepo) StreamPartition(ctx context.Context, companyId, name string, fn func(*model.Message) error) error {
+	rows, err := r.db.Table(partitionTable(companyId, name)).WithContext(ctx).
+		Order(`chat_id COLLATE "C", agent_id COLLATE "C", message_timestamp, id`).
+		Rows()
+	if err != nil {
+		return fmt.Errorf("failed to read partition %s: %w", name, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m model.Message
+		if err := r.db.ScanRows(rows, &m); err != nil {
+			return fmt.Errorf("failed to read partition %s: %w", name, err)
+		}
+		if err := fn(&m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// DropPartition blocks writes to the partition while recounting it, so no row
+// can arrive between the check and the drop. The table is dropped rather than
+// only detached: a detached table would escape retention and privacy erasure.
+func (r *archiveRepo) DropPartition(ctx context.Context, companyId, name string, expectedRows int64) (bool, error) {
+	tbl := partitionTable(companyId, name)
+	dropped := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := setLockTimeout(tx); err != nil {
+			return err
+		}
+		if err := tx.Exec(fmt.Sprintf(`LOCK TABLE %s IN SHARE MODE`, tbl)).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Table(tbl).Count(&count).Error; err != nil {
+			return err
+		}
+		if count != expectedRows {
+			return nil
+		}
+		if err := tx.Exec(fmt.Sprintf(`DROP TABLE %s`, tbl)).Error; err != nil {
+			return err
+		}
+		dropped = true
+		return nil
+	})
+	return dropped, err
+}
+
+func (r *archiveRepo) SaveChats(ctx context.Context, companyId string, archiveId int64, chats []model.MessageArchiveChat) error {
+	tbl := r.tenantTable(companyId, "message_archive_chats")
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(tbl).Where("archive_id = ?", archiveId).Delete(&model.MessageArchiveChat{}).Error; err != nil {
+			return err
+		}
+		if len(chats) == 0 {
+			return nil
+		}
+		return tx.Table(tbl).Omit("file_key", "period_from").CreateInBatches(chats, 1000).Error
+	})
+}
+
+// FindChats returns nothing for tenants that never archived a partition.
+func (r *archiveRepo) FindChats(ctx context.Context, companyId, agentId string, chatIds []string) ([]model.MessageArchiveChat, error) {
+	if len(chatIds) == 0 || !database.TenantColumnExists(ctx, companyId, "message_archives", "id") {
+		return nil, nil
+	}
+
+	query := r.db.Table(r.tenantTable(companyId, "message_archive_chats")+" AS c").WithContext(ctx).
+		Select("c.*, a.file_key, a.period_from").
+		Joins(fmt.Sprintf("JOIN %s a ON a.id = c.archive_id", r.tenantTable(companyId, "message_archives"))).
+		Where("a.status = ?", model.ArchiveStatusArchived).
+		Where("c.chat_id IN ?", chatIds)
+	if agentId != "" {
+		query = query.Where("c.agent_id = ?", agentId)
+	}
+
+	var items []model.MessageArchiveChat
+	if err := query.Order("a.period_from ASC").Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to find archived chats: %w", err)
+	}
+	return items, nil
+}
@@ -0,0 +1,113 @@
+// internal/repository/audit.go
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+)
+
+// AuditRepository stores and queries a tenant's audit trail
+type AuditRepository interface {
+	Create(ctx context.Context, companyId string, entry *model.AuditLog) error
+	FetchAuditLogs(ctx context.Context, companyId string, filter map[string]interface{}, limit, offset int) (*model.AuditPage, error)
+}
+
+func NewAuditRepository() AuditRepository {
+	return &auditRepo{db: database.DB}
+}
+
+type auditRepo struct {
+	db *gorm.DB
+}
+
+func (r *auditRepo) auditTable(companyId string) string {
+	return fmt.Sprintf(`"%s"."%s"`, database.TenantSchema(companyId), "audit_logs")
+}
+
+// ensureTable creates the audit_logs table the first time a tenant is audited
+func (r *auditRepo) ensureTable(ctx context.Context, companyId string) error {
+	tbl := r.auditTable(companyId)
+	return database.EnsureTenantTable(ctx, companyId, "audit_logs",
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGSERIAL PRIMARY KEY,
+			company_id TEXT NOT NULL,
+			actor TEXT,
+			method TEXT NOT NULL,
+			route TEXT,
+			path TEXT,
+			entity_type TEXT,
+			entity_id TEXT,
+			request_id TEXT,
+			status_code INTEGER,
+			before JSONB,
+			after JSONB,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`, tbl),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS audit_logs_entity_idx ON %s (entity_type, entity_id, created_at DESC)`, tbl),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS audit_logs_actor_idx ON %s (actor, created_at DESC)`, tbl),
+	)
+}
+
+func (r *auditRepo) Create(ctx context.Context, companyId string, entry *model.AuditLog) error {
+	if err := r.ensureTable(ctx, companyId); err != nil {
+		return fmt.Errorf("failed to prepare audit table: %w", err)
+	}
+
+	return r.db.
+		Table(r.auditTable(companyId)).
+		WithContext(ctx).
+		Create(entry).Error
+}
+
+func (r *auditRepo) FetchAuditLogs(
+	ctx context.Context,
+	companyId string,
+	filter map[string]interface{},
+	limit, offset int,
+) (*model.AuditPage, error) {
+	if err := r.ensureTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare audit table: %w", err)
+	}
+
+	query := r.db.
+		Table(r.auditTable(companyId)).
+		WithContext(ctx)
+
+	for key, value := range filter {
+		switch key {
+		case "entity_type", "entity_id", "actor", "method", "request_id":
+			query = query.Where(key+" = ?", value)
+		case "from":
+			query = query.Where("created_at >= ?", value)
+		case "to":
+			query = query.Where("created_at < ?", value)
+		}
+	}
+
+	// Make the filtered query safe to reuse for count and fetch
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count audit logs: %w", err)
+	}
+
+	var items []model.AuditLog
+	if err := query.
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch audit logs: %w", err)
+	}
+
+	if items == nil {
+		items = make([]model.AuditLog, 0)
+	}
+
+	return &model.AuditPage{Total: total, Items: items}, nil
+}
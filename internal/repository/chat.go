@@ -3,14 +3,17 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
 
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
 	"gorm.io/gorm"
 )
 
+// ErrAmbiguousChat is returned when a chat looked up without its agent belongs to several agents
+var ErrAmbiguousChat = errors.New("chat belongs to several agents")
+
 type ChatPage struct {
 	Items []model.Chat `json:"items"`
 	Total int64        `json:"total"`
@@ -19,6 +22,9 @@ type ChatPage struct {
 type ChatRepository interface {
 	FetchChats(ctx context.Context, companyId string, filter map[string]interface{}, limit, offset int) (*ChatPage, error)
 	FetchRangeChats(ctx context.Context, companyId string, filter map[string]interface{}, start, end int) (*ChatPage, error)
+	// GetChat returns a chat with its contact fields, or nil if none. agentId is optional;
+	// without it, a chat held by several agents is ErrAmbiguousChat.
+	GetChat(ctx context.Context, companyId, chatId, agentId string) (*model.Chat, error)
 	SearchChats(ctx context.Context, companyId string, q string, agentId string) (*ChatPage, error)
 }
 
@@ -65,19 +71,31 @@ func (r *chatRepo) buildBaseQuery(ctx context.Context, companyId string) *gorm.D
 		fmt.Sprintf("CASE WHEN %s.id IS NULL THEN FALSE ELSE TRUE END AS has_contact", contactsTbl),
 	}
 
-	return r.db.
+	query := r.db.
 		Table(chatTbl).
 		WithContext(ctx).
 		Joins(joinSQL).
 		Select(selectFields)
+
+	// Chats of soft-deleted agents are hidden
+	if cond, ok := HiddenAgentsCondition(ctx, companyId, chatTbl+".agent_id"); ok {
+		query = query.Where(cond)
+	}
+	return query
 }
 
 // applyFilters handles the most common filters
-func (r *chatRepo) applyFilters(query *gorm.DB, filter map[string]interface{}, chatTbl, contactsTbl string) *gorm.DB {
+func (r *chatRepo) applyFilters(ctx context.Context, companyId string, query *gorm.DB, filter map[string]interface{}, chatTbl, contactsTbl string) *gorm.DB {
 	for key, value := range filter {
 		switch key {
 		case "agent_id":
 			query = query.Where(fmt.Sprintf("%s.agent_id = ?", chatTbl), value)
+		case "phone_number":
+			// Matches regardless of the format the number was stored in
+			if phoneStr, ok := value.(string); ok && phoneStr != "" {
+				cond, args := phoneCondition(ctx, companyId, "chats", "phone_number", chatTbl+".phone_number", phoneStr)
+				query = query.Where(cond, args...)
+			}
 		case "assigned_to":
 			// This filters by contact's assigned_to field
 			query = query.Where(fmt.Sprintf("%s.assigned_to = ?", contactsTbl), value)
@@ -105,11 +123,20 @@ func (r *chatRepo) buildCountQuery(ctx context.Context, companyId string, filter
 		Table(chatTbl).
 		WithContext(ctx)
 
+	if cond, ok := HiddenAgentsCondition(ctx, companyId, chatTbl+".agent_id"); ok {
+		countQuery = countQuery.Where(cond)
+	}
+
 	// Apply filters for count (only chat table filters for performance)
 	for key, value := range filter {
 		switch key {
 		case "agent_id":
 			countQuery = countQuery.Where(fmt.Sprintf("%s.agent_id = ?", chatTbl), value)
+		case "phone_number":
+			if phoneStr, ok := value.(string); ok && phoneStr != "" {
+				cond, args := phoneCondition(ctx, companyId, "chats", "phone_number", chatTbl+".phone_number", phoneStr)
+				countQuery = countQuery.Where(cond, args...)
+			}
 		case "has_unread":
 			if hasUnread, ok := value.(bool); ok {
 				if hasUnread {
@@ -144,7 +171,7 @@ func (r *chatRepo) FetchChats(
 
 	// Build data query with JOIN
 	dataQuery := r.buildBaseQuery(ctx, companyId)
-	dataQuery = r.applyFilters(dataQuery, filter, chatTbl, contactsTbl)
+	dataQuery = r.applyFilters(ctx, companyId, dataQuery, filter, chatTbl, contactsTbl)
 
 	// Always sort by conversation_timestamp DESC (newest first)
 	dataQuery = dataQuery.Order(fmt.Sprintf("%s.conversation_timestamp DESC", chatTbl))
@@ -188,7 +215,7 @@ func (r *chatRepo) FetchRangeChats(
 
 	// Build query with JOIN
 	query := r.buildBaseQuery(ctx, companyId)
-	query = r.applyFilters(query, filter, chatTbl, contactsTbl)
+	query = r.applyFilters(ctx, companyId, query, filter, chatTbl, contactsTbl)
 
 	// Always sort by conversation_timestamp DESC for range queries
 	query = query.Order(fmt.Sprintf("%s.conversation_timestamp DESC", chatTbl))
@@ -229,8 +256,8 @@ func (r *chatRepo) SearchChats(
 	chatTbl := r.chatTable(companyId)
 	contactTbl := r.contactsTable(companyId)
 
-	// Build search query with proper escaping
-	searchPattern := "%" + strings.ReplaceAll(query, "%", "\\%") + "%"
+	// Build search query with proper escaping (phone-like queries match any stored phone format)
+	pattern := searchPattern(companyId, query)
 
 	db := r.buildBaseQuery(ctx, companyId)
 
@@ -242,7 +269,7 @@ func (r *chatRepo) SearchChats(
 		%s.custom_name ILIKE ?
 	`, chatTbl, chatTbl, chatTbl, contactTbl)
 
-	db = db.Where(searchConditions, searchPattern, searchPattern, searchPattern, searchPattern)
+	db = db.Where(searchConditions, pattern, pattern, pattern, pattern)
 
 	// Apply agent_id filter if provided
 	if agentId != "" {
@@ -267,3 +294,24 @@ func (r *chatRepo) SearchChats(
 
 	return &ChatPage{Items: items, Total: int64(len(items))}, nil
 }
+
+func (r *chatRepo) GetChat(ctx context.Context, companyId, chatId, agentId string) (*model.Chat, error) {
+	chatTbl := r.chatTable(companyId)
+	query := r.buildBaseQuery(ctx, companyId).
+		Where(fmt.Sprintf("%s.chat_id = ?", chatTbl), chatId)
+	if agentId != "" {
+		query = query.Where(fmt.Sprintf("%s.agent_id = ?", chatTbl), agentId)
+	}
+
+	var chats []model.Chat
+	if err := query.Order(fmt.Sprintf("%s.agent_id", chatTbl)).Limit(2).Find(&chats).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch chat: %w", err)
+	}
+	if len(chats) == 0 {
+		return nil, nil
+	}
+	if len(chats) > 1 {
+		return nil, fmt.Errorf("%w: pass agent_id", ErrAmbiguousChat)
+	}
+	return &chats[0], nil
+}
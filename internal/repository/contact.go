@@ -5,18 +5,33 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/audit"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ContactRepository interface {
 	FetchContacts(ctx context.Context, companyId string, filter map[string]interface{}, sort, order string, limit, offset int) (*model.ContactPage, error)
 	GetContactByID(ctx context.Context, companyId, id string) (*model.Contact, error)
 	GetContactByPhoneAndAgent(ctx context.Context, companyId, phoneNumber, agentId string) (*model.Contact, error)
-	UpdateContact(ctx context.Context, companyId, id string, updates map[string]interface{}) (*model.Contact, error)
+	// UpdateContact applies a partial update. check, when not nil, is called with the
+	// locked current contact and aborts the update by returning an error.
+	UpdateContact(ctx context.Context, companyId, id string, updates map[string]interface{}, check func(*model.Contact) error) (*model.Contact, error)
 	SearchContacts(ctx context.Context, companyId string, query, agentId string, limit int) (*model.ContactPage, error)
+	// FetchContactHistory returns the recorded changes of a contact, newest first
+	FetchContactHistory(ctx context.Context, companyId, id string, limit, offset int) (*model.ContactHistoryPage, error)
+	// GetContactAsOf reconstructs a contact as it was at the given time
+	GetContactAsOf(ctx context.Context, companyId, id string, asOf time.Time) (*model.Contact, error)
+	// FindDuplicateContacts returns a page of the groups of contacts sharing a normalized
+	// phone number; contacts inside a group are oldest first
+	FindDuplicateContacts(ctx context.Context, companyId, agentId string, limit, offset int) (*model.ContactDuplicatePage, error)
+	// MergeContacts folds the duplicates into the survivor and deletes them
+	MergeContacts(ctx context.Context, companyId, survivorId string, duplicateIds []string, fieldSources map[string]string) (*model.Contact, error)
 }
 
 func NewContactRepository() ContactRepository {
@@ -71,11 +86,15 @@ func (r *contactRepo) buildBaseQuery(ctx context.Context, companyId string, incl
 }
 
 // applyFilters applies common filters for contacts
-func (r *contactRepo) applyFilters(query *gorm.DB, filter map[string]interface{}) *gorm.DB {
+func (r *contactRepo) applyFilters(ctx context.Context, companyId string, query *gorm.DB, filter map[string]interface{}) *gorm.DB {
 	for key, value := range filter {
 		switch key {
 		case "phone_number":
-			query = query.Where("c.phone_number = ?", value)
+			// Matches regardless of the format the number was stored in
+			if phoneStr, ok := value.(string); ok && phoneStr != "" {
+				cond, args := phoneCondition(ctx, companyId, "contacts", "phone_number", "c.phone_number", phoneStr)
+				query = query.Where(cond, args...)
+			}
 		case "agent_id":
 			query = query.Where("c.agent_id = ?", value)
 		case "assigned_to":
@@ -116,7 +135,7 @@ func (r *contactRepo) FetchContacts(
 	query := r.buildBaseQuery(ctx, companyId, true)
 
 	// Apply filters
-	query = r.applyFilters(query, filter)
+	query = r.applyFilters(ctx, companyId, query, filter)
 
 	// Count total before pagination
 	var total int64
@@ -192,11 +211,16 @@ func (r *contactRepo) GetContactByID(ctx context.Context, companyId, id string)
 func (r *contactRepo) GetContactByPhoneAndAgent(ctx context.Context, companyId, phoneNumber, agentId string) (*model.Contact, error) {
 	var contact model.Contact
 
+	// Normalized match so "+62812..." finds a contact stored as "0812..."
+	phoneCond, phoneArgs := phoneCondition(ctx, companyId, "contacts", "phone_number", "phone_number", phoneNumber)
+
 	// Use the raw table name without alias for simple queries
 	err := r.db.
 		Table(r.contactTable(companyId)).
 		WithContext(ctx).
-		Where("phone_number = ? AND agent_id = ?", phoneNumber, agentId).
+		Where(phoneCond, phoneArgs...).
+		Where("agent_id = ?", agentId).
+		Order("created_at ASC").
 		First(&contact).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -205,32 +229,55 @@ func (r *contactRepo) GetContactByPhoneAndAgent(ctx context.Context, companyId,
 	return &contact, err
 }
 
-func (r *contactRepo) UpdateContact(ctx context.Context, companyId, id string, updates map[string]interface{}) (*model.Contact, error) {
+func (r *contactRepo) UpdateContact(
+	ctx context.Context,
+	companyId, id string,
+	updates map[string]interface{},
+	check func(*model.Contact) error,
+) (*model.Contact, error) {
+	if err := r.ensureHistoryTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare contact history table: %w", err)
+	}
+
 	var contact model.Contact
+	var before model.Contact
 
-	// Use the raw table name without alias for simple queries
-	db := r.db.
-		Table(r.contactTable(companyId)).
-		WithContext(ctx)
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Use the raw table name without alias for simple queries
+		db := tx.Table(r.contactTable(companyId))
 
-	// First, fetch the existing contact
-	if err := db.Where("id = ?", id).First(&contact).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, nil
+		// First, fetch the existing contact (locked so concurrent updates are recorded in order)
+		if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&contact).Error; err != nil {
+			return err
+		}
+		before = contact
+		if check != nil {
+			if err := check(&before); err != nil {
+				return err
+			}
 		}
-		return nil, err
-	}
 
-	// Apply updates
-	if err := db.Model(&contact).Updates(updates).Error; err != nil {
-		return nil, err
-	}
+		// Apply updates
+		if err := db.Model(&contact).Updates(updates).Error; err != nil {
+			return err
+		}
 
-	// Fetch updated contact
-	if err := db.Where("id = ?", id).First(&contact).Error; err != nil {
+		// Fetch updated contact
+		if err := db.Where("id = ?", id).First(&contact).Error; err != nil {
+			return err
+		}
+
+		return r.recordHistory(ctx, tx, companyId, id, "update", before, contact, contactChanges(before, contact, updates))
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
 		return nil, err
 	}
 
+	audit.Track(ctx, "contact", contact.ID, before, contact)
+	cache.Invalidate(ctx, companyId, cache.TagContacts, cache.TagChats, cache.ContactTag(contact.ID))
 	return &contact, nil
 }
 
@@ -251,8 +298,8 @@ func (r *contactRepo) SearchContacts(ctx context.Context, companyId string, quer
 			chatTbl,
 		))
 
-	// Search pattern
-	searchPattern := "%" + query + "%"
+	// Search pattern (phone-like queries match any stored phone format)
+	pattern := searchPattern(companyId, query)
 
 	// Search in multiple fields
 	searchConditions := `
@@ -261,7 +308,7 @@ func (r *contactRepo) SearchContacts(ctx context.Context, companyId string, quer
 		ch.push_name ILIKE ?
 	`
 
-	db = db.Where(searchConditions, searchPattern, searchPattern, searchPattern)
+	db = db.Where(searchConditions, pattern, pattern, pattern)
 
 	// Apply agent filter if provided
 	if agentId != "" {
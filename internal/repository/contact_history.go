@@ -0,0 +1,174 @@
+// internal/repository/contact_history.go
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+)
+
+func (r *contactRepo) historyTable(companyId string) string {
+	return fmt.Sprintf(`"%s"."%s"`, database.TenantSchema(companyId), "contact_history")
+}
+
+// ensureHistoryTable creates the contact_history table the first time it is needed
+func (r *contactRepo) ensureHistoryTable(ctx context.Context, companyId string) error {
+	tbl := r.historyTable(companyId)
+	return database.EnsureTenantTable(ctx, companyId, "contact_history",
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGSERIAL PRIMARY KEY,
+			contact_id TEXT NOT NULL,
+			action TEXT NOT NULL,
+			changes JSONB,
+			previous JSONB,
+			snapshot JSONB,
+			actor TEXT,
+			request_id TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`, tbl),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS contact_history_contact_idx ON %s (contact_id, created_at)`, tbl),
+	)
+}
+
+// recordHistory writes one history row for contactId inside the caller's transaction.
+// The actor and request ID are read from the request locals when available.
+func (r *contactRepo) recordHistory(
+	ctx context.Context,
+	tx *gorm.DB,
+	companyId, contactId, action string,
+	before, after model.Contact,
+	changes map[string]model.FieldChange,
+) error {
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	previousJSON, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	snapshotJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	entry := model.ContactHistory{
+		ContactID: contactId,
+		Action:    action,
+		Changes:   changesJSON,
+		Previous:  previousJSON,
+		Snapshot:  snapshotJSON,
+	}
+	entry.Actor, _ = ctx.Value("actor").(string)
+	entry.RequestID, _ = ctx.Value("requestid").(string)
+
+	return tx.Table(r.historyTable(companyId)).Create(&entry).Error
+}
+
+// contactChanges lists the updated columns whose value actually changed
+func contactChanges(before, after model.Contact, updates map[string]interface{}) map[string]model.FieldChange {
+	beforeFields := contactFields(before)
+	afterFields := contactFields(after)
+
+	changes := make(map[string]model.FieldChange)
+	for column := range updates {
+		from, to := beforeFields[column], afterFields[column]
+		if reflect.DeepEqual(from, to) {
+			continue
+		}
+		changes[column] = model.FieldChange{From: from, To: to}
+	}
+	return changes
+}
+
+// contactFields maps a contact to its JSON field names, which match the column names
+func contactFields(c model.Contact) map[string]interface{} {
+	fields := make(map[string]interface{})
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(raw, &fields)
+	return fields
+}
+
+func (r *contactRepo) FetchContactHistory(
+	ctx context.Context,
+	companyId, id string,
+	limit, offset int,
+) (*model.ContactHistoryPage, error) {
+	if err := r.ensureHistoryTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare contact history table: %w", err)
+	}
+
+	query := r.db.
+		Table(r.historyTable(companyId)).
+		WithContext(ctx).
+		Where("contact_id = ?", id).
+		Session(&gorm.Session{}) // safe to reuse for count and fetch
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count contact history: %w", err)
+	}
+
+	var items []model.ContactHistory
+	if err := query.
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch contact history: %w", err)
+	}
+
+	if items == nil {
+		items = make([]model.ContactHistory, 0)
+	}
+
+	return &model.ContactHistoryPage{Total: total, Items: items}, nil
+}
+
+// GetContactAsOf returns the contact as it was at asOf.
+// The earliest change recorded after asOf holds the state in its Previous snapshot;
+// without such a change the current row is still valid. Returns nil when the
+// contact did not exist yet.
+func (r *contactRepo) GetContactAsOf(ctx context.Context, companyId, id string, asOf time.Time) (*model.Contact, error) {
+	current, err := r.GetContactByID(ctx, companyId, id)
+	if err != nil || current == nil {
+		return current, err
+	}
+	if current.CreatedAt.After(asOf) {
+		return nil, nil
+	}
+
+	if err := r.ensureHistoryTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare contact history table: %w", err)
+	}
+
+	var next model.ContactHistory
+	err = r.db.
+		Table(r.historyTable(companyId)).
+		WithContext(ctx).
+		Where("contact_id = ? AND created_at > ?", id, asOf).
+		Order("created_at ASC, id ASC").
+		First(&next).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return current, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch contact history: %w", err)
+	}
+
+	var contact model.Contact
+	if err := json.Unmarshal(next.Previous, &contact); err != nil {
+		return nil, fmt.Errorf("failed to decode contact snapshot: %w", err)
+	}
+	return &contact, nil
+}
@@ -0,0 +1,399 @@
+// internal/repository/contact_merge.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/audit"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/phone"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// mergeableStringFields are the text columns a merge may fill from duplicates
+var mergeableStringFields = map[string]func(c *model.Contact) *string{
+	"custom_name": func(c *model.Contact) *string { return &c.CustomName },
+	"chat_id":     func(c *model.Contact) *string { return &c.ChatID },
+	"type":        func(c *model.Contact) *string { return &c.Type },
+	"avatar":      func(c *model.Contact) *string { return &c.Avatar },
+	"assigned_to": func(c *model.Contact) *string { return &c.AssignedTo },
+	"pob":         func(c *model.Contact) *string { return &c.Pob },
+	"gender":      func(c *model.Contact) *string { return &c.Gender },
+	"origin":      func(c *model.Contact) *string { return &c.Origin },
+	"push_name":   func(c *model.Contact) *string { return &c.PushName },
+	"status":      func(c *model.Contact) *string { return &c.Status },
+}
+
+// ErrInvalidMerge is returned when the contacts cannot be merged as requested
+var ErrInvalidMerge = errors.New("invalid merge")
+
+// duplicatePhoneExpr returns the normalized phone of a contact row: the generated
+// column once the backfill added it, the equivalent expression until then.
+func (r *contactRepo) duplicatePhoneExpr(ctx context.Context, companyId string) string {
+	if database.TenantColumnExists(ctx, companyId, "contacts", NormalizedPhoneColumn("phone_number")) {
+		return NormalizedPhoneColumn("phone_number")
+	}
+	return phone.SQLExpr("phone_number", phone.RegionFor(companyId))
+}
+
+// FindDuplicateContacts groups the contacts by normalized phone in the database and
+// returns one page of the groups with more than one contact, ordered by phone.
+func (r *contactRepo) FindDuplicateContacts(
+	ctx context.Context,
+	companyId, agentId string,
+	limit, offset int,
+) (*model.ContactDuplicatePage, error) {
+	tbl := r.contactTable(companyId)
+	expr := r.duplicatePhoneExpr(ctx, companyId)
+
+	groups := r.db.
+		Table(tbl).
+		WithContext(ctx).
+		Select(expr + " AS normalized_phone").
+		Where(expr + " IS NOT NULL").
+		Group("1").
+		Having("count(*) > 1")
+	if agentId != "" {
+		groups = groups.Where("agent_id = ?", agentId)
+	}
+
+	page := &model.ContactDuplicatePage{Items: []model.ContactDuplicateGroup{}}
+	if err := r.db.WithContext(ctx).
+		Table("(?) AS g", groups).
+		Count(&page.Total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count duplicate contacts: %w", err)
+	}
+
+	var phones []string
+	if err := groups.Order("1").Limit(limit).Offset(offset).Pluck("normalized_phone", &phones).Error; err != nil {
+		return nil, fmt.Errorf("failed to list duplicate contacts: %w", err)
+	}
+	if len(phones) == 0 {
+		return page, nil
+	}
+
+	// The members of the page's groups, oldest first
+	var rows []struct {
+		model.Contact
+		NormalizedPhone string `gorm:"column:normalized_phone"`
+	}
+	members := r.db.
+		Table(tbl).
+		WithContext(ctx).
+		Select("id, phone_number, agent_id, chat_id, custom_name, push_name, status, created_at, updated_at, "+expr+" AS normalized_phone").
+		Where(expr+" IN ?", phones)
+	if agentId != "" {
+		members = members.Where("agent_id = ?", agentId)
+	}
+	if err := members.Order("created_at ASC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list duplicate contacts: %w", err)
+	}
+
+	byPhone := make(map[string][]model.Contact, len(phones))
+	for _, row := range rows {
+		byPhone[row.NormalizedPhone] = append(byPhone[row.NormalizedPhone], row.Contact)
+	}
+	for _, p := range phones {
+		page.Items = append(page.Items, model.ContactDuplicateGroup{NormalizedPhone: p, Contacts: byPhone[p]})
+	}
+	return page, nil
+}
+
+// MergeContacts merges duplicateIds into survivorId in a single transaction:
+//   - fields listed in fieldSources take the value of the chosen contact
+//   - other empty survivor fields are filled from the first duplicate that has a value
+//   - the survivor keeps the chat of the contacts involved (see repointChat)
+//   - tags are united and distinct notes are concatenated
+//   - the earliest first message wins
+//
+// The duplicates are deleted and the merge is recorded in the history of every
+// contact involved, including full snapshots of the removed rows.
+// Returns nil when the survivor does not exist.
+func (r *contactRepo) MergeContacts(
+	ctx context.Context,
+	companyId, survivorId string,
+	duplicateIds []string,
+	fieldSources map[string]string,
+) (*model.Contact, error) {
+	if err := r.ensureHistoryTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare contact history table: %w", err)
+	}
+
+	var before, after model.Contact
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		contactTbl := r.contactTable(companyId)
+
+		// Lock every contact involved
+		var rows []model.Contact
+		if err := tx.Table(contactTbl).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", append([]string{survivorId}, duplicateIds...)).
+			Find(&rows).Error; err != nil {
+			return err
+		}
+
+		byId := make(map[string]model.Contact, len(rows))
+		for _, row := range rows {
+			byId[row.ID] = row
+		}
+
+		survivor, ok := byId[survivorId]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+
+		duplicates := make([]model.Contact, 0, len(duplicateIds))
+		for _, id := range duplicateIds {
+			dup, ok := byId[id]
+			if !ok {
+				return fmt.Errorf("%w: duplicate contact %s not found", ErrInvalidMerge, id)
+			}
+			duplicates = append(duplicates, dup)
+		}
+
+		sources := make(map[string]model.Contact, len(fieldSources))
+		for field, contactId := range fieldSources {
+			src, ok := byId[contactId]
+			if !ok {
+				return fmt.Errorf("%w: field %s: contact %s is not part of the merge", ErrInvalidMerge, field, contactId)
+			}
+			sources[field] = src
+		}
+
+		before = survivor
+		updates, err := mergeContactFields(survivor, duplicates, sources)
+		if err != nil {
+			return err
+		}
+		if err := r.repointChat(tx, companyId, survivor, duplicates, sources, updates); err != nil {
+			return err
+		}
+
+		// Remove duplicates first so the survivor can take over their chat_id
+		if err := tx.Table(contactTbl).
+			Where("id IN ?", duplicateIds).
+			Delete(&model.Contact{}).Error; err != nil {
+			return err
+		}
+
+		if len(updates) > 0 {
+			if err := tx.Table(contactTbl).
+				Where("id = ?", survivorId).
+				Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Table(contactTbl).Where("id = ?", survivorId).First(&after).Error; err != nil {
+			return err
+		}
+
+		changes := contactChanges(before, after, updates)
+		changes["merged_contacts"] = model.FieldChange{From: duplicates, To: survivorId}
+		if err := r.recordHistory(ctx, tx, companyId, survivorId, "merge", before, after, changes); err != nil {
+			return err
+		}
+
+		for _, dup := range duplicates {
+			dupChanges := map[string]model.FieldChange{
+				"merged_into": {From: dup.ID, To: survivorId},
+			}
+			if err := r.recordHistory(ctx, tx, companyId, dup.ID, "merged", dup, after, dupChanges); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Track(ctx, "contact", survivorId, before, after)
+	tags := []string{cache.TagContacts, cache.TagChats, cache.ContactTag(survivorId)}
+	for _, id := range duplicateIds {
+		tags = append(tags, cache.ContactTag(id))
+	}
+	cache.Invalidate(ctx, companyId, tags...)
+	return &after, nil
+}
+
+// repointChat makes sure no chat loses its contact in the merge. Chats find their
+// contact through contacts.chat_id, so the survivor keeps the one chat that
+// exists among the contacts involved: a survivor chat_id that points to no chat
+// is replaced by the duplicate's. A merge that would leave a second chat without
+// contact is refused.
+func (r *contactRepo) repointChat(
+	tx *gorm.DB,
+	companyId string,
+	survivor model.Contact,
+	duplicates []model.Contact,
+	sources map[string]model.Contact,
+	updates map[string]interface{},
+) error {
+	chatIds := make([]string, 0, len(duplicates)+1)
+	for _, c := range append([]model.Contact{survivor}, duplicates...) {
+		if c.ChatID != "" {
+			chatIds = append(chatIds, c.ChatID)
+		}
+	}
+	if len(chatIds) == 0 {
+		return nil
+	}
+
+	var existing []string
+	if err := tx.Table(r.chatTable(companyId)).
+		Where("chat_id IN ?", chatIds).
+		Distinct().
+		Pluck("chat_id", &existing).Error; err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+
+	target := survivor.ChatID
+	if v, ok := updates["chat_id"].(string); ok {
+		target = v
+	}
+	if !slices.Contains(existing, target) {
+		if _, chosen := sources["chat_id"]; chosen && target != "" {
+			return fmt.Errorf("%w: chat %s chosen for chat_id does not exist", ErrInvalidMerge, target)
+		}
+		// The first existing chat in merge order: the survivor's, then the duplicates'
+		for _, chatId := range chatIds {
+			if slices.Contains(existing, chatId) {
+				target = chatId
+				break
+			}
+		}
+	}
+	for _, chatId := range existing {
+		if chatId != target {
+			return fmt.Errorf("%w: the contacts belong to different chats (%s, %s); a contact keeps one chat",
+				ErrInvalidMerge, target, chatId)
+		}
+	}
+
+	if target != survivor.ChatID {
+		updates["chat_id"] = target
+	} else {
+		delete(updates, "chat_id")
+	}
+	return nil
+}
+
+// mergeContactFields applies the merge rules and returns the column updates
+// to apply to the survivor.
+func mergeContactFields(
+	survivor model.Contact,
+	duplicates []model.Contact,
+	sources map[string]model.Contact,
+) (map[string]interface{}, error) {
+	merged := survivor
+	updates := make(map[string]interface{})
+
+	for field := range sources {
+		if _, ok := mergeableStringFields[field]; !ok && field != "tags" && field != "notes" && field != "dob" {
+			return nil, fmt.Errorf("%w: field %s cannot be merged", ErrInvalidMerge, field)
+		}
+	}
+
+	for column, get := range mergeableStringFields {
+		target := get(&merged)
+		if src, ok := sources[column]; ok {
+			*target = *get(&src)
+		} else if *target == "" {
+			for i := range duplicates {
+				if v := *get(&duplicates[i]); v != "" {
+					*target = v
+					break
+				}
+			}
+		}
+		if *target != *get(&survivor) {
+			updates[column] = *target
+		}
+	}
+
+	// Tags: union in first-seen order
+	if src, ok := sources["tags"]; ok {
+		merged.Tags = src.Tags
+	} else {
+		merged.Tags = joinDistinct(",", append([]model.Contact{survivor}, duplicates...), func(c model.Contact) []string {
+			return strings.Split(c.Tags, ",")
+		})
+	}
+	if merged.Tags != survivor.Tags {
+		updates["tags"] = merged.Tags
+	}
+
+	// Notes: keep every distinct note
+	if src, ok := sources["notes"]; ok {
+		merged.Notes = src.Notes
+	} else {
+		merged.Notes = joinDistinct("\n", append([]model.Contact{survivor}, duplicates...), func(c model.Contact) []string {
+			return []string{c.Notes}
+		})
+	}
+	if merged.Notes != survivor.Notes {
+		updates["notes"] = merged.Notes
+	}
+
+	// Date of birth
+	if src, ok := sources["dob"]; ok {
+		merged.Dob = src.Dob
+	} else if merged.Dob == nil {
+		for _, dup := range duplicates {
+			if dup.Dob != nil {
+				merged.Dob = dup.Dob
+				break
+			}
+		}
+	}
+	if merged.Dob != survivor.Dob {
+		updates["dob"] = merged.Dob
+	}
+
+	// Earliest first message across all contacts
+	for _, dup := range duplicates {
+		if dup.FirstMessageTimestamp > 0 &&
+			(merged.FirstMessageTimestamp == 0 || dup.FirstMessageTimestamp < merged.FirstMessageTimestamp) {
+			merged.FirstMessageTimestamp = dup.FirstMessageTimestamp
+			merged.FirstMessageID = dup.FirstMessageID
+		}
+	}
+	if merged.FirstMessageTimestamp != survivor.FirstMessageTimestamp {
+		updates["first_message_timestamp"] = merged.FirstMessageTimestamp
+		updates["first_message_id"] = merged.FirstMessageID
+	}
+
+	return updates, nil
+}
+
+// joinDistinct joins the non-empty values of every contact, dropping repeats
+func joinDistinct(sep string, contacts []model.Contact, values func(model.Contact) []string) string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, c := range contacts {
+		for _, v := range values(c) {
+			v = strings.TrimSpace(v)
+			if v == "" || seen[v] {
+				continue
+			}
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return strings.Join(out, sep)
+}
@@ -0,0 +1,259 @@
+// internal/repository/export.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/audit"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+)
+
+// ExportRepository stores export jobs and reads the rows they export
+type ExportRepository interface {
+	Create(ctx context.Context, companyId string, job *model.ExportJob) error
+	Get(ctx context.Context, companyId string, id int64) (*model.ExportJob, error)
+	List(ctx context.Context, companyId string, limit, offset int) (*model.ExportJobPage, error)
+	// Unfinished returns the tenant's pending and running jobs, oldest first
+	Unfinished(ctx context.Context, companyId string) ([]model.ExportJob, error)
+	// Claim marks a job running if it is pending, or running without progress since
+	// staleBefore (its worker died). Returns false when another worker owns it.
+	Claim(ctx context.Context, companyId string, id int64, staleBefore time.Time) (bool, error)
+	// Update stores the job's status, progress and output
+	Update(ctx context.Context, companyId string, job *model.ExportJob) error
+	// Touch refreshes a running job's updated_at, so it is not taken over while its
+	// worker is busy without countable progress (counting rows, waiting on storage)
+	Touch(ctx context.Context, companyId string, id int64) error
+
+	// CountRows counts the rows a job exports
+	CountRows(ctx context.Context, companyId string, job *model.ExportJob) (int64, error)
+	// StreamContacts passes the job's contacts to fn in batches ordered by id
+	StreamContacts(ctx context.Context, companyId string, job *model.ExportJob, batchSize int, fn func([]model.Contact) error) error
+	// StreamMessages passes the job's messages to fn in chronological batches
+	StreamMessages(ctx context.Context, companyId string, job *model.ExportJob, batchSize int, fn func([]model.Message) error) error
+}
+
+func NewExportRepository() ExportRepository {
+	return &exportRepo{db: database.DB}
+}
+
+type exportRepo struct {
+	db *gorm.DB
+}
+
+func (r *exportRepo) tenantTable(companyId, table string) string {
+	return fmt.Sprintf(`"%s"."%s"`, database.TenantSchema(companyId), table)
+}
+
+// ensureJobsTable creates the export_jobs table the first time it is needed.
+func (r *exportRepo) ensureJobsTable(ctx context.Context, companyId string) error {
+	tbl := r.tenantTable(companyId, "export_jobs")
+	if err := database.EnsureTenantTable(ctx, companyId, "export_jobs",
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGSERIAL PRIMARY KEY,
+			kind TEXT NOT NULL,
+			format TEXT NOT NULL,
+			agent_id TEXT,
+			chat_id TEXT,
+			period_from TIMESTAMPTZ,
+			period_to TIMESTAMPTZ,
+			status TEXT NOT NULL,
+			total BIGINT NOT NULL DEFAULT 0,
+			processed BIGINT NOT NULL DEFAULT 0,
+			file_key TEXT,
+			file_size BIGINT NOT NULL DEFAULT 0,
+			error TEXT,
+			actor TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			started_at TIMESTAMPTZ,
+			finished_at TIMESTAMPTZ
+		)`, tbl),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS export_jobs_status_idx ON %s (status)`, tbl),
+	); err != nil {
+		return err
+	}
+	database.RememberColumn(companyId, "export_jobs", "id")
+	return nil
+}
+
+func (r *exportRepo) jobs(ctx context.Context, companyId string) *gorm.DB {
+	return r.db.Table(r.tenantTable(companyId, "export_jobs")).WithContext(ctx)
+}
+
+func (r *exportRepo) Create(ctx context.Context, companyId string, job *model.ExportJob) error {
+	if err := r.ensureJobsTable(ctx, companyId); err != nil {
+		return fmt.Errorf("failed to prepare export jobs table: %w", err)
+	}
+	job.Actor, _ = ctx.Value("actor").(string)
+	if err := r.jobs(ctx, companyId).Create(job).Error; err != nil {
+		return err
+	}
+	audit.Track(ctx, "export", strconv.FormatInt(job.ID, 10), nil, job)
+	return nil
+}
+
+func (r *exportRepo) Get(ctx context.Context, companyId string, id int64) (*model.ExportJob, error) {
+	if err := r.ensureJobsTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare export jobs table: %w", err)
+	}
+
+	var job model.ExportJob
+	err := r.jobs(ctx, companyId).Where("id = ?", id).First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *exportRepo) List(ctx context.Context, companyId string, limit, offset int) (*model.ExportJobPage, error) {
+	if err := r.ensureJobsTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare export jobs table: %w", err)
+	}
+
+	var total int64
+	if err := r.jobs(ctx, companyId).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count export jobs: %w", err)
+	}
+	var items []model.ExportJob
+	if err := r.jobs(ctx, companyId).Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch export jobs: %w", err)
+	}
+	if items == nil {
+		items = make([]model.ExportJob, 0)
+	}
+	return &model.ExportJobPage{Items: items, Total: total}, nil
+}
+
+// Unfinished returns nothing for tenants that never created an export.
+func (r *exportRepo) Unfinished(ctx context.Context, companyId string) ([]model.ExportJob, error) {
+	if !database.TenantColumnExists(ctx, companyId, "export_jobs", "id") {
+		return nil, nil
+	}
+
+	var jobs []model.ExportJob
+	if err := r.jobs(ctx, companyId).
+		Where("status IN ?", []string{model.ExportJobPending, model.ExportJobRunning}).
+		Order("id").
+		Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (r *exportRepo) Claim(ctx context.Context, companyId string, id int64, staleBefore time.Time) (bool, error) {
+	now := time.Now()
+	res := r.jobs(ctx, companyId).
+		Where("id = ?", id).
+		Where("status = ? OR (status = ? AND updated_at < ?)", model.ExportJobPending, model.ExportJobRunning, staleBefore).
+		Updates(map[string]interface{}{
+			"status":     model.ExportJobRunning,
+			"processed":  0,
+			"started_at": now,
+			"updated_at": now,
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *exportRepo) Update(ctx context.Context, companyId string, job *model.ExportJob) error {
+	return r.jobs(ctx, companyId).
+		Where("id = ?", job.ID).
+		Updates(map[string]interface{}{
+			"status":      job.Status,
+			"total":       job.Total,
+			"processed":   job.Processed,
+			"file_key":    job.FileKey,
+			"file_size":   job.FileSize,
+			"error":       job.Error,
+			"updated_at":  time.Now(),
+			"finished_at": job.FinishedAt,
+		}).Error
+}
+
+func (r *exportRepo) Touch(ctx context.Context, companyId string, id int64) error {
+	return r.jobs(ctx, companyId).
+		Where("id = ? AND status = ?", id, model.ExportJobRunning).
+		Update("updated_at", time.Now()).Error
+}
+
+// contactsQuery selects the contacts of an export, optionally of one agent
+func (r *exportRepo) contactsQuery(ctx context.Context, companyId string, job *model.ExportJob) *gorm.DB {
+	query := r.db.Table(r.tenantTable(companyId, "contacts")).WithContext(ctx)
+	if job.AgentID != "" {
+		query = query.Where("agent_id = ?", job.AgentID)
+	}
+	return query
+}
+
+// messagesQuery selects the messages of an export. Bounding message_date as well
+// as message_timestamp lets Postgres skip partitions outside the period.
+func (r *exportRepo) messagesQuery(ctx context.Context, companyId string, job *model.ExportJob) *gorm.DB {
+	query := r.db.Table(r.tenantTable(companyId, "messages")).WithContext(ctx).
+		Where("key IS NOT NULL")
+	if job.AgentID != "" {
+		query = query.Where("agent_id = ?", job.AgentID)
+	}
+	if job.ChatID != "" {
+		query = query.Where("chat_id = ?", job.ChatID)
+	}
+	if job.From != nil {
+		query = query.Where("message_date >= ? AND message_timestamp >= ?",
+			job.From.UTC().Format(time.DateOnly), job.From.Unix())
+	}
+	if job.To != nil {
+		query = query.Where("message_date <= ? AND message_timestamp < ?",
+			job.To.UTC().Format(time.DateOnly), job.To.Unix())
+	}
+	return query
+}
+
+func (r *exportRepo) CountRows(ctx context.Context, companyId string, job *model.ExportJob) (int64, error) {
+	var count int64
+	var err error
+	switch job.Kind {
+	case model.ExportKindContacts:
+		err = r.contactsQuery(ctx, companyId, job).Count(&count).Error
+	case model.ExportKindMessages:
+		err = r.messagesQuery(ctx, companyId, job).Count(&count).Error
+	default:
+		err = fmt.Errorf("unknown export kind %q", job.Kind)
+	}
+	return count, err
+}
+
+func (r *exportRepo) StreamContacts(ctx context.Context, companyId string, job *model.ExportJob, batchSize int, fn func([]model.Contact) error) error {
+	lastID := ""
+	for {
+		query := r.contactsQuery(ctx, companyId, job).Order("id ASC").Limit(batchSize)
+		if lastID != "" {
+			query = query.Where("id > ?", lastID)
+		}
+
+		var batch []model.Contact
+		if err := query.Find(&batch).Error; err != nil {
+			return fmt.Errorf("failed to read contacts: %w", err)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+func (r *exportRepo) StreamMessages(ctx context.Context, companyId string, job *model.ExportJob, batchSize int, fn func([]model.Message) error) error {
+	return streamMessages(r.messagesQuery(ctx, companyId, job), batchSize, fn)
+}
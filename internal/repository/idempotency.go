@@ -0,0 +1,159 @@
+// internal/repository/idempotency.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+)
+
+// IdempotencyRepository stores the Idempotency-Keys claimed by a tenant's requests
+type IdempotencyRepository interface {
+	// Reserve claims rec.Key for a request in progress until rec.LockedUntil. When
+	// the key is completed and unexpired, or locked by another request, nothing is
+	// written and the stored key is returned.
+	Reserve(ctx context.Context, companyId string, rec *model.IdempotencyKey) (*model.IdempotencyKey, error)
+	// Complete stores the response, unless rec.Holder lost the key meanwhile
+	Complete(ctx context.Context, companyId string, rec *model.IdempotencyKey) error
+	// Release frees a key whose request did not complete, so it can be retried,
+	// unless rec.Holder lost it meanwhile
+	Release(ctx context.Context, companyId string, rec *model.IdempotencyKey) error
+	// DeleteExpired removes the keys that expired before the given time
+	DeleteExpired(ctx context.Context, companyId string, before time.Time) (int64, error)
+	Close() error
+}
+
+func NewIdempotencyRepository() IdempotencyRepository {
+	return &idempotencyRepo{db: database.DB}
+}
+
+type idempotencyRepo struct {
+	db *gorm.DB
+}
+
+func (r *idempotencyRepo) keysTable(companyId string) string {
+	return fmt.Sprintf(`"%s"."%s"`, database.TenantSchema(companyId), "idempotency_keys")
+}
+
+// ensureTable creates the idempotency_keys table the first time a tenant sends a key.
+func (r *idempotencyRepo) ensureTable(ctx context.Context, companyId string) error {
+	tbl := r.keysTable(companyId)
+	if err := database.EnsureTenantTable(ctx, companyId, "idempotency_keys",
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			key TEXT PRIMARY KEY,
+			fingerprint TEXT NOT NULL,
+			completed BOOLEAN NOT NULL DEFAULT false,
+			holder TEXT,
+			locked_until TIMESTAMPTZ,
+			status_code INTEGER,
+			headers JSONB,
+			body BYTEA,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			expires_at TIMESTAMPTZ NOT NULL
+		)`, tbl),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idempotency_keys_expires_idx ON %s (expires_at)`, tbl),
+		fmt.Sprintf(`ALTER TABLE %s
+			ADD COLUMN IF NOT EXISTS holder TEXT,
+			ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ,
+			ADD COLUMN IF NOT EXISTS headers JSONB`, tbl),
+	); err != nil {
+		return err
+	}
+	database.RememberColumn(companyId, "idempotency_keys", "key")
+	return nil
+}
+
+func (r *idempotencyRepo) keys(ctx context.Context, companyId string) *gorm.DB {
+	return r.db.Table(r.keysTable(companyId)).WithContext(ctx)
+}
+
+// Reserve inserts the key, taking over an expired row the cleanup job has not
+// removed yet or a row whose request outlived its lock (e.g. its replica died);
+// the primary key serializes concurrent requests across replicas.
+func (r *idempotencyRepo) Reserve(ctx context.Context, companyId string, rec *model.IdempotencyKey) (*model.IdempotencyKey, error) {
+	if err := r.ensureTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare idempotency table: %w", err)
+	}
+
+	// A key released between the INSERT and the SELECT is claimed on the next attempt
+	for attempt := 0; attempt < 3; attempt++ {
+		reserved, existing, err := r.reserve(ctx, companyId, rec)
+		if err != nil || reserved || existing != nil {
+			return existing, err
+		}
+	}
+	return nil, fmt.Errorf("idempotency key %q keeps changing", rec.Key)
+}
+
+func (r *idempotencyRepo) reserve(ctx context.Context, companyId string, rec *model.IdempotencyKey) (bool, *model.IdempotencyKey, error) {
+	tbl := r.keysTable(companyId)
+	res := r.db.WithContext(ctx).Exec(
+		fmt.Sprintf(`INSERT INTO %s AS k (key, fingerprint, completed, holder, locked_until, created_at, expires_at)
+			VALUES (?, ?, false, ?, ?, ?, ?)
+			ON CONFLICT (key) DO UPDATE SET
+				fingerprint = EXCLUDED.fingerprint,
+				completed = false,
+				holder = EXCLUDED.holder,
+				locked_until = EXCLUDED.locked_until,
+				status_code = NULL,
+				headers = NULL,
+				body = NULL,
+				created_at = EXCLUDED.created_at,
+				expires_at = EXCLUDED.expires_at
+			WHERE k.expires_at <= now() OR (NOT k.completed AND k.locked_until <= now())`, tbl),
+		rec.Key, rec.Fingerprint, rec.Holder, rec.LockedUntil, rec.CreatedAt, rec.ExpiresAt,
+	)
+	if res.Error != nil || res.RowsAffected == 1 {
+		return res.Error == nil, nil, res.Error
+	}
+
+	var existing model.IdempotencyKey
+	err := r.keys(ctx, companyId).Where("key = ?", rec.Key).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	return false, &existing, nil
+}
+
+func (r *idempotencyRepo) Complete(ctx context.Context, companyId string, rec *model.IdempotencyKey) error {
+	return r.keys(ctx, companyId).
+		Where("key = ? AND holder = ? AND NOT completed", rec.Key, rec.Holder).
+		Updates(map[string]interface{}{
+			"completed":    true,
+			"locked_until": nil,
+			"status_code":  rec.StatusCode,
+			"headers":      rec.Headers,
+			"body":         rec.Body,
+		}).Error
+}
+
+func (r *idempotencyRepo) Release(ctx context.Context, companyId string, rec *model.IdempotencyKey) error {
+	return r.keys(ctx, companyId).
+		Where("key = ? AND holder = ? AND NOT completed", rec.Key, rec.Holder).
+		Delete(&model.IdempotencyKey{}).Error
+}
+
+// DeleteExpired does nothing for tenants that never sent a key.
+func (r *idempotencyRepo) DeleteExpired(ctx context.Context, companyId string, before time.Time) (int64, error) {
+	if !database.TenantColumnExists(ctx, companyId, "idempotency_keys", "key") {
+		return 0, nil
+	}
+
+	res := r.keys(ctx, companyId).
+		Where("expires_at < ?", before).
+		Delete(&model.IdempotencyKey{})
+	return res.RowsAffected, res.Error
+}
+
+// Close is a no-op: the database connection is shared with the other repositories.
+func (r *idempotencyRepo) Close() error {
+	return nil
+}
@@ -0,0 +1,126 @@
+// internal/repository/idempotency_redis.go
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+)
+
+// releaseScript deletes a key only while ARGV[1] still holds it in progress, so a
+// completed response or a key taken over is never lost to a late release
+var releaseScript = redis.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if not value then
+	return 0
+end
+local stored = cjson.decode(value)
+if stored.completed or stored.holder ~= ARGV[1] then
+	return 0
+end
+return redis.call('DEL', KEYS[1])
+`)
+
+// completeScript replaces a key held in progress by ARGV[1] with the completed
+// record ARGV[2], living ARGV[3] more milliseconds
+var completeScript = redis.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if not value then
+	return 0
+end
+local stored = cjson.decode(value)
+if stored.completed or stored.holder ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// NewIdempotencyRedisRepository keeps idempotency keys in the Redis server at url
+// ("redis://[:password@]host:port/db"). Keys expire in Redis, so there is nothing
+// for the cleanup job to delete: a key in progress lives until its lock ends, so a
+// retry takes it over once its request is gone, and a completed key until ExpiresAt.
+func NewIdempotencyRedisRepository(ctx context.Context, url string) (IdempotencyRepository, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &idempotencyRedisRepo{client: client}, nil
+}
+
+type idempotencyRedisRepo struct {
+	client *redis.Client
+}
+
+func (r *idempotencyRedisRepo) redisKey(companyId, key string) string {
+	return "idempotency:" + companyId + ":" + key
+}
+
+func (r *idempotencyRedisRepo) Reserve(ctx context.Context, companyId string, rec *model.IdempotencyKey) (*model.IdempotencyKey, error) {
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	key := r.redisKey(companyId, rec.Key)
+
+	// A key that expires between SET NX and GET is claimed on the next attempt
+	for attempt := 0; attempt < 3; attempt++ {
+		err := r.client.SetArgs(ctx, key, value, redis.SetArgs{Mode: "NX", ExpireAt: *rec.LockedUntil}).Err()
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+
+		raw, err := r.client.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var existing model.IdempotencyKey
+		if err := json.Unmarshal(raw, &existing); err != nil {
+			return nil, fmt.Errorf("invalid idempotency record %q: %w", rec.Key, err)
+		}
+		return &existing, nil
+	}
+	return nil, fmt.Errorf("idempotency key %q keeps changing", rec.Key)
+}
+
+// Complete replaces the reserved record with rec and extends it to rec.ExpiresAt
+func (r *idempotencyRedisRepo) Complete(ctx context.Context, companyId string, rec *model.IdempotencyKey) error {
+	ttl := time.Until(rec.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return completeScript.Run(ctx, r.client, []string{r.redisKey(companyId, rec.Key)},
+		rec.Holder, value, ttl.Milliseconds()).Err()
+}
+
+func (r *idempotencyRedisRepo) Release(ctx context.Context, companyId string, rec *model.IdempotencyKey) error {
+	return releaseScript.Run(ctx, r.client, []string{r.redisKey(companyId, rec.Key)}, rec.Holder).Err()
+}
+
+func (r *idempotencyRedisRepo) DeleteExpired(ctx context.Context, companyId string, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *idempotencyRedisRepo) Close() error {
+	return r.client.Close()
+}
@@ -3,7 +3,9 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
@@ -18,10 +20,24 @@ type MessagePage struct {
 
 // MessageRepository defines read operations on a tenant's partitioned messages table
 type MessageRepository interface {
-	// FetchMessagesByChatId returns messages for a specific chat with pagination
-	FetchMessagesByChatId(ctx context.Context, companyId, agentId, chatId string, sort, order string, limit, offset int) (*MessagePage, error)
+	// FetchMessagesByChatId returns messages for a specific chat with pagination.
+	// filter supports is_deleted (bool), reactions (false drops reaction messages)
+	// and from_phone / to_phone (string, any format).
+	FetchMessagesByChatId(ctx context.Context, companyId, agentId, chatId string, filter map[string]interface{}, sort, order string, limit, offset int) (*MessagePage, error)
 	// FetchRangeMessagesByChatId returns messages in [start,end] range for infinite scroll
-	FetchRangeMessagesByChatId(ctx context.Context, companyId, agentId, chatId string, sort, order string, start, end int) (*MessagePage, error)
+	FetchRangeMessagesByChatId(ctx context.Context, companyId, agentId, chatId string, filter map[string]interface{}, sort, order string, start, end int) (*MessagePage, error)
+	// GetByMessageID returns the most recent message with the given message_id in a chat, or nil if none
+	GetByMessageID(ctx context.Context, companyId, agentId, chatId, messageId string) (*model.Message, error)
+	// FetchEdits returns the recorded edits of a chat's message, oldest first
+	FetchEdits(ctx context.Context, companyId, agentId, chatId, messageId string) ([]model.MessageEdit, error)
+	// FetchByMessageIDs returns the chat's messages with the given message_ids
+	FetchByMessageIDs(ctx context.Context, companyId, agentId, chatId string, messageIds []string) ([]model.Message, error)
+	// FetchReactions returns the chat's reaction messages targeting the given message_ids, oldest first
+	FetchReactions(ctx context.Context, companyId, agentId, chatId string, targetIds []string) ([]model.Message, error)
+	// FetchReplies returns the chat's messages quoting messageId, oldest first
+	FetchReplies(ctx context.Context, companyId, agentId, chatId, messageId string, limit, offset int) (*MessagePage, error)
+	// StreamMessages passes a chat's messages within [from, to) to fn in chronological batches
+	StreamMessages(ctx context.Context, companyId, agentId, chatId string, from, to time.Time, batchSize int, fn func([]model.Message) error) error
 }
 
 func NewMessageRepository() MessageRepository {
@@ -38,7 +54,9 @@ func (r *messageRepo) messageTable(companyId string) string {
 	return fmt.Sprintf(`"%s"."%s"`, schema, "messages")
 }
 
-func (r *messageRepo) validateSort(sort, order string) (string, string) {
+// ValidateMessageSort returns the sort field and order message reads actually use:
+// unknown fields fall back to message_timestamp and unknown orders to DESC.
+func ValidateMessageSort(sort, order string) (string, string) {
 	// Allowed sort fields
 	allowedSortFields := map[string]bool{
 		"message_timestamp": true,
@@ -64,28 +82,43 @@ func (r *messageRepo) validateSort(sort, order string) (string, string) {
 }
 
 // buildBaseQuery creates the base query for messages
-func (r *messageRepo) buildBaseQuery(ctx context.Context, companyId, agentId, chatId string) *gorm.DB {
+func (r *messageRepo) buildBaseQuery(ctx context.Context, companyId, agentId, chatId string, filter map[string]interface{}) *gorm.DB {
 	tbl := r.messageTable(companyId)
 
-	return r.db.
+	query := r.db.
 		Table(tbl).
 		WithContext(ctx).
 		Where("agent_id = ?", agentId).
 		Where("chat_id = ?", chatId).
 		Where("key IS NOT NULL") // Only get valid messages
+
+	if deleted, ok := filter["is_deleted"].(bool); ok {
+		query = query.Where("COALESCE(is_deleted, false) = ?", deleted)
+	}
+	if reactions, ok := filter["reactions"].(bool); ok && !reactions {
+		query = query.Where(reactionTargetExpr + " IS NULL")
+	}
+	for _, column := range PhoneColumns["messages"] {
+		if raw, ok := filter[column].(string); ok && raw != "" {
+			cond, args := phoneCondition(ctx, companyId, "messages", column, column, raw)
+			query = query.Where(cond, args...)
+		}
+	}
+	return query
 }
 
 func (r *messageRepo) FetchMessagesByChatId(
 	ctx context.Context,
 	companyId, agentId, chatId string,
+	filter map[string]interface{},
 	sort, order string,
 	limit, offset int,
 ) (*MessagePage, error) {
 	// Validate sort parameters
-	sort, order = r.validateSort(sort, order)
+	sort, order = ValidateMessageSort(sort, order)
 
 	// Build base query
-	baseQuery := r.buildBaseQuery(ctx, companyId, agentId, chatId)
+	baseQuery := r.buildBaseQuery(ctx, companyId, agentId, chatId, filter)
 
 	// Get total count
 	var total int64
@@ -94,7 +127,7 @@ func (r *messageRepo) FetchMessagesByChatId(
 	}
 
 	// Fetch messages with pagination
-	query := r.buildBaseQuery(ctx, companyId, agentId, chatId).
+	query := r.buildBaseQuery(ctx, companyId, agentId, chatId, filter).
 		Order(fmt.Sprintf("%s %s", sort, order)).
 		Limit(limit).
 		Offset(offset)
@@ -114,11 +147,12 @@ func (r *messageRepo) FetchMessagesByChatId(
 func (r *messageRepo) FetchRangeMessagesByChatId(
 	ctx context.Context,
 	companyId, agentId, chatId string,
+	filter map[string]interface{},
 	sort, order string,
 	start, end int,
 ) (*MessagePage, error) {
 	// Validate sort parameters
-	sort, order = r.validateSort(sort, order)
+	sort, order = ValidateMessageSort(sort, order)
 
 	// Calculate limit from range
 	limit := end - start + 1
@@ -127,7 +161,7 @@ func (r *messageRepo) FetchRangeMessagesByChatId(
 	}
 
 	// Build query
-	baseQuery := r.buildBaseQuery(ctx, companyId, agentId, chatId)
+	baseQuery := r.buildBaseQuery(ctx, companyId, agentId, chatId, filter)
 
 	// Get total count
 	var total int64
@@ -136,7 +170,7 @@ func (r *messageRepo) FetchRangeMessagesByChatId(
 	}
 
 	// Build query for range
-	query := r.buildBaseQuery(ctx, companyId, agentId, chatId).
+	query := r.buildBaseQuery(ctx, companyId, agentId, chatId, filter).
 		Order(fmt.Sprintf("%s %s", sort, order)).
 		Offset(start).
 		Limit(limit)
@@ -152,3 +186,20 @@ func (r *messageRepo) FetchRangeMessagesByChatId(
 
 	return &MessagePage{Items: items, Total: total}, nil
 }
+
+func (r *messageRepo) GetByMessageID(ctx context.Context, companyId, agentId, chatId, messageId string) (*model.Message, error) {
+	var msg model.Message
+	err := r.db.
+		Table(r.messageTable(companyId)).
+		WithContext(ctx).
+		Where("agent_id = ? AND chat_id = ? AND message_id = ?", agentId, chatId, messageId).
+		Order("message_date DESC").
+		Take(&msg).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch message: %w", err)
+	}
+	return &msg, nil
+}
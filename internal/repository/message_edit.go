@@ -0,0 +1,79 @@
+// internal/repository/message_edit.go
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+)
+
+func (r *messageRepo) editsTable(companyId string) string {
+	return fmt.Sprintf(`"%s"."%s"`, database.TenantSchema(companyId), "message_edits")
+}
+
+// EditHistoryDDL returns the statements creating a tenant's message_edits table and
+// the trigger that copies every new edited_message_obj into it. Messages are written
+// by the ingestion workers, so the trigger is what captures edits; earlier versions
+// are not recoverable. The statements are idempotent and run once per tenant by
+// cmd/enable-edit-history, never by the API: creating the trigger locks the messages table.
+func EditHistoryDDL(companyId string) []string {
+	schema := database.TenantSchema(companyId)
+	messages := fmt.Sprintf(`"%s"."messages"`, schema)
+	tbl := fmt.Sprintf(`"%s"."message_edits"`, schema)
+	fn := fmt.Sprintf(`"%s"."record_message_edit"`, schema)
+
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGSERIAL PRIMARY KEY,
+			message_id TEXT NOT NULL,
+			agent_id TEXT,
+			chat_id TEXT,
+			edited_message_obj JSONB NOT NULL,
+			recorded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`, tbl),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS message_edits_message_idx ON %s (message_id, recorded_at)`, tbl),
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s() RETURNS trigger LANGUAGE plpgsql AS $fn$
+		BEGIN
+			IF NEW.edited_message_obj IS NOT NULL
+				AND (TG_OP = 'INSERT' OR NEW.edited_message_obj IS DISTINCT FROM OLD.edited_message_obj) THEN
+				INSERT INTO %s (message_id, agent_id, chat_id, edited_message_obj)
+				VALUES (NEW.message_id, NEW.agent_id, NEW.chat_id, NEW.edited_message_obj);
+			END IF;
+			RETURN NULL;
+		END
+		$fn$`, fn, tbl),
+		fmt.Sprintf(`DO $do$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM pg_trigger
+				WHERE tgname = 'messages_record_edit' AND tgrelid = '%s'::regclass
+			) THEN
+				CREATE TRIGGER messages_record_edit
+					AFTER INSERT OR UPDATE OF edited_message_obj ON %s
+					FOR EACH ROW EXECUTE FUNCTION %s();
+			END IF;
+		END
+		$do$`, messages, messages, fn),
+	}
+}
+
+func (r *messageRepo) FetchEdits(ctx context.Context, companyId, agentId, chatId, messageId string) ([]model.MessageEdit, error) {
+	// Tenants where cmd/enable-edit-history has not run yet have no recorded edits
+	if !database.TenantColumnExists(ctx, companyId, "message_edits", "id") {
+		return []model.MessageEdit{}, nil
+	}
+
+	var edits []model.MessageEdit
+	err := r.db.
+		Table(r.editsTable(companyId)).
+		WithContext(ctx).
+		Where("message_id = ? AND agent_id = ? AND chat_id = ?", messageId, agentId, chatId).
+		Order("recorded_at ASC, id ASC").
+		Find(&edits).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch message edits: %w", err)
+	}
+	return edits, nil
+}
@@ -0,0 +1,68 @@
+// internal/repository/message_stream.go
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+)
+
+// StreamMessages calls fn with successive batches of a chat's messages in
+// chronological order, across every message_date partition.
+// A zero from or to leaves that side of the period open.
+func (r *messageRepo) StreamMessages(
+	ctx context.Context,
+	companyId, agentId, chatId string,
+	from, to time.Time,
+	batchSize int,
+	fn func([]model.Message) error,
+) error {
+	base := r.buildBaseQuery(ctx, companyId, agentId, chatId, nil)
+	// Bounding message_date as well lets Postgres skip partitions outside the period
+	if !from.IsZero() {
+		base = base.Where("message_date >= ?", from.UTC().Format(time.DateOnly)).
+			Where("message_timestamp >= ?", from.Unix())
+	}
+	if !to.IsZero() {
+		base = base.Where("message_date <= ?", to.UTC().Format(time.DateOnly)).
+			Where("message_timestamp < ?", to.Unix())
+	}
+	return streamMessages(base, batchSize, fn)
+}
+
+// streamMessages calls fn with successive batches of the messages selected by base,
+// in chronological order. Batches are read with keyset pagination on
+// (message_timestamp, id), so large selections never load at once and later
+// batches cost no more than the first.
+func streamMessages(base *gorm.DB, batchSize int, fn func([]model.Message) error) error {
+	var lastTimestamp, lastID int64
+	first := true
+	for {
+		query := base.Session(&gorm.Session{}).
+			Order("message_timestamp ASC, id ASC").
+			Limit(batchSize)
+		if !first {
+			query = query.Where("(message_timestamp, id) > (?, ?)", lastTimestamp, lastID)
+		}
+
+		var batch []model.Message
+		if err := query.Find(&batch).Error; err != nil {
+			return fmt.Errorf("failed to stream messages: %w", err)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+
+		last := batch[len(batch)-1]
+		lastTimestamp, lastID, first = last.MessageTimestamp, last.ID, false
+	}
+}
@@ -0,0 +1,85 @@
+// internal/repository/message_thread.go
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+)
+
+// Expressions extracting the message a reaction targets and the message a reply quotes.
+// The recursive lax paths also match payloads nested in ephemeral or view-once wrappers.
+// Both are immutable, so MessageThreadIndexDDL indexes them; queries must use them verbatim.
+const (
+	reactionTargetExpr = `(jsonb_path_query_first(message_obj, 'lax $.**.reactionMessage.key.id') #>> '{}')`
+	replyTargetExpr    = `(jsonb_path_query_first(message_obj, 'lax $.**.contextInfo.stanzaId') #>> '{}')`
+)
+
+// MessageThreadIndexDDL returns the statements indexing, per chat, the reaction and
+// reply targets of a tenant's messages. They are partial indexes, holding only reactions
+// and replies. The statements are idempotent and run once per tenant by
+// cmd/index-message-threads, since building them scans the messages table.
+func MessageThreadIndexDDL(companyId string) []string {
+	messages := fmt.Sprintf(`"%s"."messages"`, database.TenantSchema(companyId))
+	return []string{
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS messages_reaction_target_idx ON %s (agent_id, chat_id, %s) WHERE %s IS NOT NULL`,
+			messages, reactionTargetExpr, reactionTargetExpr),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS messages_reply_target_idx ON %s (agent_id, chat_id, %s) WHERE %s IS NOT NULL`,
+			messages, replyTargetExpr, replyTargetExpr),
+	}
+}
+
+func (r *messageRepo) FetchByMessageIDs(ctx context.Context, companyId, agentId, chatId string, messageIds []string) ([]model.Message, error) {
+	if len(messageIds) == 0 {
+		return nil, nil
+	}
+	var items []model.Message
+	err := r.buildBaseQuery(ctx, companyId, agentId, chatId, nil).
+		Where("message_id IN ?", messageIds).
+		Find(&items).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch messages by id: %w", err)
+	}
+	return items, nil
+}
+
+func (r *messageRepo) FetchReactions(ctx context.Context, companyId, agentId, chatId string, targetIds []string) ([]model.Message, error) {
+	if len(targetIds) == 0 {
+		return nil, nil
+	}
+	var items []model.Message
+	err := r.buildBaseQuery(ctx, companyId, agentId, chatId, nil).
+		Where(reactionTargetExpr+" IN ?", targetIds).
+		Order("message_timestamp ASC, id ASC").
+		Find(&items).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reactions: %w", err)
+	}
+	return items, nil
+}
+
+func (r *messageRepo) FetchReplies(ctx context.Context, companyId, agentId, chatId, messageId string, limit, offset int) (*MessagePage, error) {
+	var total int64
+	if err := r.buildBaseQuery(ctx, companyId, agentId, chatId, nil).
+		Where(replyTargetExpr+" = ?", messageId).
+		Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count replies: %w", err)
+	}
+
+	var items []model.Message
+	err := r.buildBaseQuery(ctx, companyId, agentId, chatId, nil).
+		Where(replyTargetExpr+" = ?", messageId).
+		Order("message_timestamp ASC, id ASC").
+		Limit(limit).
+		Offset(offset).
+		Find(&items).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch replies: %w", err)
+	}
+	if items == nil {
+		items = make([]model.Message, 0)
+	}
+	return &MessagePage{Items: items, Total: total}, nil
+}
@@ -0,0 +1,77 @@
+// internal/repository/partition.go
+package repository
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+)
+
+// partitionLockTimeout bounds the wait for the lock needed to drop or detach a
+// partition, rather than blocking ingestion behind a long query.
+const partitionLockTimeout = 5 * time.Second
+
+// partitionBound parses pg_get_expr(relpartbound) of a range partition,
+// e.g. FOR VALUES FROM ('2024-06-01') TO ('2024-07-01').
+var partitionBound = regexp.MustCompile(`FROM \((.+?)\) TO \((.+?)\)`)
+
+// messagePartitions lists the range partitions of a tenant's messages table,
+// leaving out the default partition and partitions without upper bound.
+func messagePartitions(ctx context.Context, db *gorm.DB, companyId string) ([]model.MessagePartition, error) {
+	var rows []struct {
+		Name  string
+		Bound string
+	}
+	if err := db.WithContext(ctx).Raw(`
+		SELECT c.relname AS name, pg_get_expr(c.relpartbound, c.oid) AS bound
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		JOIN pg_namespace n ON n.oid = p.relnamespace
+		WHERE n.nspname = ? AND p.relname = 'messages'
+		ORDER BY c.relname`, database.TenantSchema(companyId)).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list message partitions: %w", err)
+	}
+
+	partitions := make([]model.MessagePartition, 0, len(rows))
+	for _, row := range rows {
+		m := partitionBound.FindStringSubmatch(row.Bound)
+		if m == nil {
+			continue // DEFAULT partition
+		}
+		to, ok := boundDate(m[2])
+		if !ok {
+			continue // MAXVALUE or not a date range
+		}
+		from, _ := boundDate(m[1]) // MINVALUE is the zero time
+		partitions = append(partitions, model.MessagePartition{Name: row.Name, From: from, To: to})
+	}
+	return partitions, nil
+}
+
+// boundDate reads a partition bound value such as '2024-06-01' or '2024-06-01 00:00:00'.
+func boundDate(value string) (time.Time, bool) {
+	value = strings.Trim(strings.TrimSpace(value), "'")
+	if len(value) < len(time.DateOnly) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.DateOnly, value[:len(time.DateOnly)])
+	return t, err == nil
+}
+
+// partitionTable quotes a partition name read from pg_class.
+func partitionTable(companyId, name string) string {
+	return fmt.Sprintf(`"%s"."%s"`, database.TenantSchema(companyId), strings.ReplaceAll(name, `"`, `""`))
+}
+
+// setLockTimeout applies partitionLockTimeout to the rest of the transaction.
+func setLockTimeout(tx *gorm.DB) error {
+	return tx.Exec(fmt.Sprintf(`SET LOCAL lock_timeout = '%dms'`, partitionLockTimeout.Milliseconds())).Error
+}
@@ -0,0 +1,53 @@
+// internal/repository/phone.go
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/phone"
+)
+
+// PhoneColumns lists the raw phone columns per tenant table.
+// cmd/backfill-phone adds a generated E.164 column next to each of them.
+var PhoneColumns = map[string][]string{
+	"contacts": {"phone_number"},
+	"chats":    {"phone_number"},
+	"messages": {"from_phone", "to_phone"},
+}
+
+// NormalizedPhoneColumn names the generated E.164 column for a raw phone column
+func NormalizedPhoneColumn(column string) string {
+	return column + "_e164"
+}
+
+// phoneCondition matches a phone column against raw in whatever format it was stored.
+// Once the backfill has added the normalized column the lookup uses it directly;
+// until then it matches every known format of the number.
+// qualified is the column as it appears in the query (e.g. "c.phone_number").
+func phoneCondition(ctx context.Context, companyId, table, column, qualified, raw string) (string, []interface{}) {
+	region := phone.RegionFor(companyId)
+
+	normalized := phone.Normalize(raw, region)
+	if normalized == "" {
+		return qualified + " = ?", []interface{}{raw}
+	}
+
+	if database.TenantColumnExists(ctx, companyId, table, NormalizedPhoneColumn(column)) {
+		return NormalizedPhoneColumn(qualified) + " = ?", []interface{}{normalized}
+	}
+	return qualified + " IN ?", []interface{}{phone.Variants(raw, region)}
+}
+
+// searchPattern builds an ILIKE pattern for free-text search.
+// Phone-like queries search on the subscriber number, which appears in every
+// stored format (+62812..., 62812..., 0812...).
+func searchPattern(companyId, query string) string {
+	if phone.LooksLikeNumber(query) {
+		if subscriber := phone.Subscriber(query, phone.RegionFor(companyId)); subscriber != "" {
+			query = subscriber
+		}
+	}
+	return "%" + strings.ReplaceAll(query, "%", "\\%") + "%"
+}
@@ -0,0 +1,364 @@
+// internal/repository/privacy.go
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/audit"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+)
+
+// PrivacyRepository finds, exports and erases the data of one phone number
+type PrivacyRepository interface {
+	// FindContacts returns the contacts with the phone number, optionally of one agent
+	FindContacts(ctx context.Context, companyId, phoneNumber, agentId string) ([]model.Contact, error)
+	// FindChats returns the chats with the phone number or one of chatIds, optionally of one agent
+	FindChats(ctx context.Context, companyId, phoneNumber, agentId string, chatIds []string) ([]model.Chat, error)
+	FetchContactHistory(ctx context.Context, companyId string, contactIds []string) ([]model.ContactHistory, error)
+
+	CountMessages(ctx context.Context, companyId string, scope model.PrivacyScope) (int64, error)
+	// StreamMessages passes the subject's messages to fn in chronological batches, across every partition
+	StreamMessages(ctx context.Context, companyId string, scope model.PrivacyScope, batchSize int, fn func([]model.Message) error) error
+	// FetchUnredacted returns up to batch of the subject's messages that still carry content
+	FetchUnredacted(ctx context.Context, companyId string, scope model.PrivacyScope, batch int) ([]model.Message, error)
+	// RedactMessages clears the content of messages, and their from_phone / to_phone
+	// when it is the subject's number, and drops their recorded edits
+	RedactMessages(ctx context.Context, companyId, phoneNumber string, messages []model.Message) error
+	// AnonymizeContacts clears the contacts' personal fields, their history and the
+	// personal fields of their audit entries
+	AnonymizeContacts(ctx context.Context, companyId string, contacts []model.Contact) error
+	// AnonymizeChats clears the phone number, push name and last message of chats
+	AnonymizeChats(ctx context.Context, companyId string, chats []model.Chat) error
+
+	// CreateLog appends an entry to the privacy log, which cannot be updated or deleted
+	CreateLog(ctx context.Context, companyId string, entry *model.PrivacyLog) error
+	ListLog(ctx context.Context, companyId string, limit, offset int) (*model.PrivacyLogPage, error)
+}
+
+func NewPrivacyRepository() PrivacyRepository {
+	return &privacyRepo{db: database.DB}
+}
+
+type privacyRepo struct {
+	db *gorm.DB
+}
+
+func (r *privacyRepo) tenantTable(companyId, table string) string {
+	return fmt.Sprintf(`"%s"."%s"`, database.TenantSchema(companyId), table)
+}
+
+// ensureLogTable creates the privacy_log table and the trigger rejecting any
+// change to its rows the first time it is needed.
+func (r *privacyRepo) ensureLogTable(ctx context.Context, companyId string) error {
+	tbl := r.tenantTable(companyId, "privacy_log")
+	fn := fmt.Sprintf(`"%s"."privacy_log_immutable"`, database.TenantSchema(companyId))
+
+	return database.EnsureTenantTable(ctx, companyId, "privacy_log",
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGSERIAL PRIMARY KEY,
+			action TEXT NOT NULL,
+			phone_hash TEXT NOT NULL,
+			agent_id TEXT,
+			contact_ids TEXT,
+			contacts BIGINT NOT NULL DEFAULT 0,
+			chats BIGINT NOT NULL DEFAULT 0,
+			messages BIGINT NOT NULL DEFAULT 0,
+			media_files BIGINT NOT NULL DEFAULT 0,
+			actor TEXT,
+			request_id TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`, tbl),
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s() RETURNS trigger LANGUAGE plpgsql AS $fn$
+		BEGIN
+			RAISE EXCEPTION 'privacy_log is append-only';
+		END
+		$fn$`, fn),
+		fmt.Sprintf(`DO $do$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM pg_trigger
+				WHERE tgname = 'privacy_log_immutable' AND tgrelid = '%s'::regclass
+			) THEN
+				CREATE TRIGGER privacy_log_immutable
+					BEFORE UPDATE OR DELETE ON %s
+					FOR EACH ROW EXECUTE FUNCTION %s();
+				CREATE TRIGGER privacy_log_immutable_truncate
+					BEFORE TRUNCATE ON %s
+					FOR EACH STATEMENT EXECUTE FUNCTION %s();
+			END IF;
+		END
+		$do$`, tbl, tbl, fn, tbl, fn),
+	)
+}
+
+func (r *privacyRepo) FindContacts(ctx context.Context, companyId, phoneNumber, agentId string) ([]model.Contact, error) {
+	phoneCond, phoneArgs := phoneCondition(ctx, companyId, "contacts", "phone_number", "phone_number", phoneNumber)
+	query := r.db.Table(r.tenantTable(companyId, "contacts")).WithContext(ctx).
+		Where(phoneCond, phoneArgs...)
+	if agentId != "" {
+		query = query.Where("agent_id = ?", agentId)
+	}
+
+	var contacts []model.Contact
+	if err := query.Order("created_at ASC").Find(&contacts).Error; err != nil {
+		return nil, fmt.Errorf("failed to find contacts: %w", err)
+	}
+	return contacts, nil
+}
+
+func (r *privacyRepo) FindChats(ctx context.Context, companyId, phoneNumber, agentId string, chatIds []string) ([]model.Chat, error) {
+	phoneCond, phoneArgs := phoneCondition(ctx, companyId, "chats", "phone_number", "phone_number", phoneNumber)
+	match := r.db.Where(phoneCond, phoneArgs...)
+	if len(chatIds) > 0 {
+		match = match.Or("chat_id IN ?", chatIds)
+	}
+	query := r.db.Table(r.tenantTable(companyId, "chats")).WithContext(ctx).Where(match)
+	if agentId != "" {
+		query = query.Where("agent_id = ?", agentId)
+	}
+
+	var chats []model.Chat
+	if err := query.Order("id ASC").Find(&chats).Error; err != nil {
+		return nil, fmt.Errorf("failed to find chats: %w", err)
+	}
+	return chats, nil
+}
+
+// FetchContactHistory returns nothing for tenants that never updated a contact.
+func (r *privacyRepo) FetchContactHistory(ctx context.Context, companyId string, contactIds []string) ([]model.ContactHistory, error) {
+	if len(contactIds) == 0 || !database.TenantColumnExists(ctx, companyId, "contact_history", "id") {
+		return nil, nil
+	}
+
+	var items []model.ContactHistory
+	if err := r.db.Table(r.tenantTable(companyId, "contact_history")).WithContext(ctx).
+		Where("contact_id IN ?", contactIds).
+		Order("created_at ASC, id ASC").
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch contact history: %w", err)
+	}
+	return items, nil
+}
+
+// messagesQuery selects the subject's messages. There is no message_date bound:
+// every partition is searched.
+func (r *privacyRepo) messagesQuery(ctx context.Context, companyId string, scope model.PrivacyScope) *gorm.DB {
+	fromCond, fromArgs := phoneCondition(ctx, companyId, "messages", "from_phone", "from_phone", scope.PhoneNumber)
+	toCond, toArgs := phoneCondition(ctx, companyId, "messages", "to_phone", "to_phone", scope.PhoneNumber)
+	match := r.db.Where(fromCond, fromArgs...).Or(toCond, toArgs...)
+	if len(scope.ChatIDs) > 0 {
+		match = match.Or("chat_id IN ?", scope.ChatIDs)
+	}
+
+	query := r.db.Table(r.tenantTable(companyId, "messages")).WithContext(ctx).Where(match)
+	if scope.AgentID != "" {
+		query = query.Where("agent_id = ?", scope.AgentID)
+	}
+	return query
+}
+
+func (r *privacyRepo) CountMessages(ctx context.Context, companyId string, scope model.PrivacyScope) (int64, error) {
+	var count int64
+	err := r.messagesQuery(ctx, companyId, scope).Count(&count).Error
+	return count, err
+}
+
+func (r *privacyRepo) StreamMessages(ctx context.Context, companyId string, scope model.PrivacyScope, batchSize int, fn func([]model.Message) error) error {
+	return streamMessages(r.messagesQuery(ctx, companyId, scope), batchSize, fn)
+}
+
+func (r *privacyRepo) FetchUnredacted(ctx context.Context, companyId string, scope model.PrivacyScope, batch int) ([]model.Message, error) {
+	fromCond, fromArgs := phoneCondition(ctx, companyId, "messages", "from_phone", "from_phone", scope.PhoneNumber)
+	toCond, toArgs := phoneCondition(ctx, companyId, "messages", "to_phone", "to_phone", scope.PhoneNumber)
+	unredacted := r.db.Where(fmt.Sprintf(`COALESCE(message_text, '') <> '' OR COALESCE(message_url, '') <> ''
+			OR COALESCE(message_obj, '{}'::jsonb) <> '{}'::jsonb OR edited_message_obj IS NOT NULL
+			OR COALESCE(jid, '') <> '' OR %s IS DISTINCT FROM key`, strippedKeyExpr())).
+		Or(fromCond, fromArgs...).
+		Or(toCond, toArgs...)
+
+	var items []model.Message
+	if err := r.messagesQuery(ctx, companyId, scope).
+		Where(unredacted).
+		Order("id ASC").
+		Limit(batch).
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch messages: %w", err)
+	}
+	return items, nil
+}
+
+// KeyJIDFields lists the fields of a message key that hold a WhatsApp JID.
+// Erase strips them and keeps id and fromMe, which replies and reactions use.
+var KeyJIDFields = []string{"remoteJid", "remoteJidAlt", "participant", "participantAlt"}
+
+// strippedKeyExpr returns the key column without its KeyJIDFields
+func strippedKeyExpr() string {
+	expr := "key"
+	for _, field := range KeyJIDFields {
+		expr += fmt.Sprintf(" - '%s'", field)
+	}
+	return "(" + expr + ")"
+}
+
+func (r *privacyRepo) RedactMessages(ctx context.Context, companyId, phoneNumber string, messages []model.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	keys := make([][]interface{}, 0, len(messages))
+	messageIds := make([]string, 0, len(messages))
+	for _, m := range messages {
+		keys = append(keys, []interface{}{m.ID, m.MessageDate})
+		messageIds = append(messageIds, m.MessageID)
+	}
+
+	updates := map[string]interface{}{
+		"message_text":       "",
+		"message_url":        "",
+		"message_obj":        gorm.Expr("'{}'::jsonb"),
+		"edited_message_obj": nil,
+		"jid":                "",
+		"key":                gorm.Expr(strippedKeyExpr()),
+	}
+	// Only the subject's side is cleared: the other side is the agent's own number
+	for _, column := range PhoneColumns["messages"] {
+		cond, args := phoneCondition(ctx, companyId, "messages", column, column, phoneNumber)
+		updates[column] = gorm.Expr(fmt.Sprintf("CASE WHEN %s THEN '' ELSE %s END", cond, column), args...)
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(r.tenantTable(companyId, "messages")).
+			Where("(id, message_date) IN ?", keys).
+			Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to redact messages: %w", err)
+		}
+		if database.TenantColumnExists(ctx, companyId, "message_edits", "id") {
+			if err := tx.Table(r.tenantTable(companyId, "message_edits")).
+				Where("message_id IN ?", messageIds).
+				Delete(&model.MessageEdit{}).Error; err != nil {
+				return fmt.Errorf("failed to delete message edits: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	cache.Invalidate(ctx, companyId, cache.TagMessages)
+	return nil
+}
+
+func (r *privacyRepo) AnonymizeContacts(ctx context.Context, companyId string, contacts []model.Contact) error {
+	if len(contacts) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(contacts))
+	for _, c := range contacts {
+		ids = append(ids, c.ID)
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// phone_number stays unique per agent: it becomes a placeholder derived from the ID
+		if err := tx.Table(r.tenantTable(companyId, "contacts")).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{
+				"phone_number": gorm.Expr("'erased:' || id"),
+				"custom_name":  "",
+				"notes":        "",
+				"tags":         "",
+				"avatar":       "",
+				"pob":          "",
+				"dob":          nil,
+				"push_name":    "",
+				"updated_at":   gorm.Expr("now()"),
+			}).Error; err != nil {
+			return fmt.Errorf("failed to anonymize contacts: %w", err)
+		}
+		if database.TenantColumnExists(ctx, companyId, "contact_history", "id") {
+			if err := tx.Table(r.tenantTable(companyId, "contact_history")).
+				Where("contact_id IN ?", ids).
+				Delete(&model.ContactHistory{}).Error; err != nil {
+				return fmt.Errorf("failed to delete contact history: %w", err)
+			}
+		}
+		if database.TenantColumnExists(ctx, companyId, "audit_logs", "id") {
+			if err := tx.Table(r.tenantTable(companyId, "audit_logs")).
+				Where("entity_type = ? AND entity_id IN ?", "contact", ids).
+				Updates(map[string]interface{}{"before": nil, "after": nil}).Error; err != nil {
+				return fmt.Errorf("failed to redact audit logs: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	tags := []string{cache.TagContacts, cache.TagChats}
+	for _, id := range ids {
+		tags = append(tags, cache.ContactTag(id))
+	}
+	cache.Invalidate(ctx, companyId, tags...)
+	return nil
+}
+
+func (r *privacyRepo) AnonymizeChats(ctx context.Context, companyId string, chats []model.Chat) error {
+	if len(chats) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(chats))
+	for _, c := range chats {
+		ids = append(ids, c.ID)
+	}
+	if err := r.db.Table(r.tenantTable(companyId, "chats")).WithContext(ctx).
+		Where("id IN ?", ids).
+		Updates(map[string]interface{}{
+			// Like contacts, the number becomes a placeholder derived from the ID
+			"phone_number":        gorm.Expr("'erased:' || id"),
+			"jid":                 "",
+			"push_name":           "",
+			"contact_custom_name": "",
+			"contact_tags":        "",
+			"last_message":        nil,
+		}).Error; err != nil {
+		return err
+	}
+	cache.Invalidate(ctx, companyId, cache.TagChats)
+	return nil
+}
+
+func (r *privacyRepo) CreateLog(ctx context.Context, companyId string, entry *model.PrivacyLog) error {
+	if err := r.ensureLogTable(ctx, companyId); err != nil {
+		return fmt.Errorf("failed to prepare privacy log: %w", err)
+	}
+	entry.Actor, _ = ctx.Value("actor").(string)
+	entry.RequestID, _ = ctx.Value("requestid").(string)
+	if err := r.db.Table(r.tenantTable(companyId, "privacy_log")).WithContext(ctx).Create(entry).Error; err != nil {
+		return err
+	}
+	audit.Track(ctx, "privacy", strconv.FormatInt(entry.ID, 10), nil, entry)
+	return nil
+}
+
+func (r *privacyRepo) ListLog(ctx context.Context, companyId string, limit, offset int) (*model.PrivacyLogPage, error) {
+	if err := r.ensureLogTable(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare privacy log: %w", err)
+	}
+
+	tbl := r.tenantTable(companyId, "privacy_log")
+	var total int64
+	if err := r.db.Table(tbl).WithContext(ctx).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count privacy log: %w", err)
+	}
+	var items []model.PrivacyLog
+	if err := r.db.Table(tbl).WithContext(ctx).Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch privacy log: %w", err)
+	}
+	if items == nil {
+		items = make([]model.PrivacyLog, 0)
+	}
+	return &model.PrivacyLogPage{Items: items, Total: total}, nil
+}
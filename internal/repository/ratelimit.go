@@ -0,0 +1,113 @@
+// internal/repository/ratelimit.go
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+)
+
+// RateLimitRepository reads a tenant's rate limits and stores its monthly usage
+type RateLimitRepository interface {
+	// ListLimits returns the configured limits, longest path prefix first; nil when
+	// the tenant has none
+	ListLimits(ctx context.Context, companyId string) ([]model.RateLimit, error)
+	// AddUsage adds to the request counters of a month ("2006-01")
+	AddUsage(ctx context.Context, companyId, month string, requests, rejected int64) error
+	// ListUsage returns up to limit months of usage, newest first
+	ListUsage(ctx context.Context, companyId string, limit int) ([]model.MonthlyUsage, error)
+}
+
+func NewRateLimitRepository() RateLimitRepository {
+	return &rateLimitRepo{db: database.DB}
+}
+
+type rateLimitRepo struct {
+	db *gorm.DB
+}
+
+func (r *rateLimitRepo) tenantTable(companyId, table string) string {
+	return fmt.Sprintf(`"%s"."%s"`, database.TenantSchema(companyId), table)
+}
+
+// ensureTables creates the rate_limits and usage_months tables the first time a
+// tenant's usage is recorded, so operators find the limits table to fill in.
+func (r *rateLimitRepo) ensureTables(ctx context.Context, companyId string) error {
+	if err := database.EnsureTenantTable(ctx, companyId, "rate_limits",
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGSERIAL PRIMARY KEY,
+			path_prefix TEXT NOT NULL DEFAULT '' UNIQUE,
+			requests BIGINT NOT NULL CHECK (requests > 0),
+			key_requests BIGINT CHECK (key_requests > 0),
+			window_seconds INTEGER NOT NULL DEFAULT 60 CHECK (window_seconds > 0),
+			monthly_quota BIGINT,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`, r.tenantTable(companyId, "rate_limits")),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			month TEXT PRIMARY KEY,
+			requests BIGINT NOT NULL DEFAULT 0,
+			rejected BIGINT NOT NULL DEFAULT 0,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`, r.tenantTable(companyId, "usage_months")),
+	); err != nil {
+		return err
+	}
+	database.RememberColumn(companyId, "rate_limits", "id")
+	database.RememberColumn(companyId, "usage_months", "month")
+	return nil
+}
+
+// ListLimits returns nothing for tenants without usage yet.
+func (r *rateLimitRepo) ListLimits(ctx context.Context, companyId string) ([]model.RateLimit, error) {
+	if !database.TenantColumnExists(ctx, companyId, "rate_limits", "id") {
+		return nil, nil
+	}
+
+	var items []model.RateLimit
+	if err := r.db.
+		Table(r.tenantTable(companyId, "rate_limits")).
+		WithContext(ctx).
+		Order("length(path_prefix) DESC").
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch rate limits: %w", err)
+	}
+	return items, nil
+}
+
+func (r *rateLimitRepo) AddUsage(ctx context.Context, companyId, month string, requests, rejected int64) error {
+	if err := r.ensureTables(ctx, companyId); err != nil {
+		return fmt.Errorf("failed to prepare rate limit tables: %w", err)
+	}
+
+	tbl := r.tenantTable(companyId, "usage_months")
+	return r.db.WithContext(ctx).Exec(
+		fmt.Sprintf(`INSERT INTO %s AS u (month, requests, rejected, updated_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (month) DO UPDATE SET
+				requests = u.requests + EXCLUDED.requests,
+				rejected = u.rejected + EXCLUDED.rejected,
+				updated_at = EXCLUDED.updated_at`, tbl),
+		month, requests, rejected, time.Now(),
+	).Error
+}
+
+// ListUsage returns nothing for tenants without usage yet.
+func (r *rateLimitRepo) ListUsage(ctx context.Context, companyId string, limit int) ([]model.MonthlyUsage, error) {
+	if !database.TenantColumnExists(ctx, companyId, "usage_months", "month") {
+		return nil, nil
+	}
+
+	var items []model.MonthlyUsage
+	if err := r.db.
+		Table(r.tenantTable(companyId, "usage_months")).
+		WithContext(ctx).
+		Order("month DESC").
+		Limit(limit).
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch usage: %w", err)
+	}
+	return items, nil
+}
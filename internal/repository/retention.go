@@ -0,0 +1,368 @@
+// internal/repository/retention.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/audit"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/database"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RetentionRepository stores retention policies and removes expired rows
+type RetentionRepository interface {
+	// ListPolicies returns the company default (agent_id "") first, then agent policies
+	ListPolicies(ctx context.Context, companyId string) ([]model.RetentionPolicy, error)
+	// SavePolicy creates or replaces the policy of policy.AgentID
+	SavePolicy(ctx context.Context, companyId string, policy *model.RetentionPolicy) error
+	// DeletePolicy removes an agent policy. Returns false when there was none.
+	DeletePolicy(ctx context.Context, companyId, agentId string) (bool, error)
+
+	// MessagePartitions lists the range partitions of the messages table; the default
+	// partition and partitions without upper bound are left out
+	MessagePartitions(ctx context.Context, companyId string) ([]model.MessagePartition, error)
+	CountPartition(ctx context.Context, companyId, name string) (int64, error)
+	// RemovePartition drops a messages partition
+	RemovePartition(ctx context.Context, companyId, name string) error
+
+	CountExpiredMessages(ctx context.Context, companyId string, scope model.RetentionScope) (int64, error)
+	// DeleteExpiredMessages deletes up to batch expired messages (and their recorded edits)
+	DeleteExpiredMessages(ctx context.Context, companyId string, scope model.RetentionScope, batch int) (int64, error)
+	CountInactiveContacts(ctx context.Context, companyId string, scope model.RetentionScope) (int64, error)
+	DeleteInactiveContacts(ctx context.Context, companyId string, scope model.RetentionScope, batch int) (int64, error)
+
+	// StartRun records a new running enforcement. Returns nil when another run of
+	// the tenant is in progress; runs without progress since staleBefore are failed first.
+	StartRun(ctx context.Context, companyId string, staleBefore time.Time) (*model.RetentionRun, error)
+	UpdateRun(ctx context.Context, companyId string, run *model.RetentionRun) error
+	ListRuns(ctx context.Context, companyId string, limit, offset int) (*model.RetentionRunPage, error)
+}
+
+func NewRetentionRepository() RetentionRepository {
+	return &retentionRepo{db: database.DB}
+}
+
+type retentionRepo struct {
+	db *gorm.DB
+}
+
+func (r *retentionRepo) tenantTable(companyId, table string) string {
+	return fmt.Sprintf(`"%s"."%s"`, database.TenantSchema(companyId), table)
+}
+
+// ensureTables creates the retention_policies and retention_runs tables the first time they are needed.
+func (r *retentionRepo) ensureTables(ctx context.Context, companyId string) error {
+	policies := r.tenantTable(companyId, "retention_policies")
+	runs := r.tenantTable(companyId, "retention_runs")
+	if err := database.EnsureTenantTable(ctx, companyId, "retention_policies",
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGSERIAL PRIMARY KEY,
+			agent_id TEXT NOT NULL DEFAULT '' UNIQUE,
+			message_days INTEGER,
+			inactive_contact_days INTEGER,
+			actor TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`, policies),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGSERIAL PRIMARY KEY,
+			status TEXT NOT NULL,
+			partitions TEXT,
+			deleted_messages BIGINT NOT NULL DEFAULT 0,
+			deleted_contacts BIGINT NOT NULL DEFAULT 0,
+			error TEXT,
+			started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			finished_at TIMESTAMPTZ
+		)`, runs),
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS deleted_archives BIGINT NOT NULL DEFAULT 0`, runs),
+		// At most one running enforcement per tenant, across replicas
+		fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS retention_runs_running_idx ON %s (status) WHERE status = '%s'`,
+			runs, model.RetentionRunRunning),
+	); err != nil {
+		return err
+	}
+	database.RememberColumn(companyId, "retention_policies", "id")
+	return nil
+}
+
+func (r *retentionRepo) policies(ctx context.Context, companyId string) *gorm.DB {
+	return r.db.Table(r.tenantTable(companyId, "retention_policies")).WithContext(ctx)
+}
+
+func (r *retentionRepo) runs(ctx context.Context, companyId string) *gorm.DB {
+	return r.db.Table(r.tenantTable(companyId, "retention_runs")).WithContext(ctx)
+}
+
+// ListPolicies returns nothing for tenants that never set a policy.
+func (r *retentionRepo) ListPolicies(ctx context.Context, companyId string) ([]model.RetentionPolicy, error) {
+	if !database.TenantColumnExists(ctx, companyId, "retention_policies", "id") {
+		return nil, nil
+	}
+
+	var items []model.RetentionPolicy
+	if err := r.policies(ctx, companyId).Order("agent_id").Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch retention policies: %w", err)
+	}
+	return items, nil
+}
+
+func (r *retentionRepo) SavePolicy(ctx context.Context, companyId string, policy *model.RetentionPolicy) error {
+	if err := r.ensureTables(ctx, companyId); err != nil {
+		return fmt.Errorf("failed to prepare retention tables: %w", err)
+	}
+
+	var before *model.RetentionPolicy
+	var existing model.RetentionPolicy
+	err := r.policies(ctx, companyId).Where("agent_id = ?", policy.AgentID).First(&existing).Error
+	switch {
+	case err == nil:
+		before = &existing
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	policy.Actor, _ = ctx.Value("actor").(string)
+	policy.UpdatedAt = time.Now()
+	if err := r.policies(ctx, companyId).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "agent_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"message_days", "inactive_contact_days", "actor", "updated_at"}),
+		}).
+		Create(policy).Error; err != nil {
+		return err
+	}
+	if before != nil {
+		policy.ID, policy.CreatedAt = before.ID, before.CreatedAt
+	}
+	audit.Track(ctx, "retention_policy", policy.AgentID, before, policy)
+	return nil
+}
+
+func (r *retentionRepo) DeletePolicy(ctx context.Context, companyId, agentId string) (bool, error) {
+	if !database.TenantColumnExists(ctx, companyId, "retention_policies", "id") {
+		return false, nil
+	}
+
+	var existing model.RetentionPolicy
+	err := r.policies(ctx, companyId).Where("agent_id = ?", agentId).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := r.policies(ctx, companyId).Where("agent_id = ?", agentId).Delete(&model.RetentionPolicy{}).Error; err != nil {
+		return false, err
+	}
+	audit.Track(ctx, "retention_policy", agentId, existing, nil)
+	return true, nil
+}
+
+func (r *retentionRepo) MessagePartitions(ctx context.Context, companyId string) ([]model.MessagePartition, error) {
+	return messagePartitions(ctx, r.db, companyId)
+}
+
+func (r *retentionRepo) CountPartition(ctx context.Context, companyId, name string) (int64, error) {
+	var count int64
+	err := r.db.Table(partitionTable(companyId, name)).WithContext(ctx).Count(&count).Error
+	return count, err
+}
+
+// RemovePartition needs an exclusive lock on messages; it gives up after
+// partitionLockTimeout rather than blocking ingestion behind a long query.
+func (r *retentionRepo) RemovePartition(ctx context.Context, companyId, name string) error {
+	stmt := fmt.Sprintf(`DROP TABLE %s`, partitionTable(companyId, name))
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := setLockTimeout(tx); err != nil {
+			return err
+		}
+		return tx.Exec(stmt).Error
+	})
+	if err == nil {
+		cache.Invalidate(ctx, companyId, cache.TagMessages)
+	}
+	return err
+}
+
+// scoped restricts a query to the agents of a retention scope
+func scoped(query *gorm.DB, column string, scope model.RetentionScope) *gorm.DB {
+	if scope.AgentID != "" {
+		return query.Where(column+" = ?", scope.AgentID)
+	}
+	if len(scope.ExcludeAgents) > 0 {
+		query = query.Where(column+" IS NULL OR "+column+" NOT IN ?", scope.ExcludeAgents)
+	}
+	return query
+}
+
+// expiredMessages selects messages before the scope's cutoff, on the partition key
+func (r *retentionRepo) expiredMessages(ctx context.Context, companyId string, scope model.RetentionScope) *gorm.DB {
+	query := r.db.Table(r.tenantTable(companyId, "messages")).WithContext(ctx).
+		Where("message_date < ?", scope.Before.Format(time.DateOnly))
+	for _, name := range scope.SkipPartitions {
+		query = query.Where("tableoid <> ?::regclass", partitionTable(companyId, name))
+	}
+	return scoped(query, "agent_id", scope)
+}
+
+func (r *retentionRepo) CountExpiredMessages(ctx context.Context, companyId string, scope model.RetentionScope) (int64, error) {
+	var count int64
+	err := r.expiredMessages(ctx, companyId, scope).Count(&count).Error
+	return count, err
+}
+
+func (r *retentionRepo) DeleteExpiredMessages(ctx context.Context, companyId string, scope model.RetentionScope, batch int) (int64, error) {
+	// Selecting the partition key along with id lets Postgres prune partitions
+	ids := r.expiredMessages(ctx, companyId, scope).Select("id, message_date").Limit(batch)
+	res := r.db.WithContext(ctx).Exec(
+		fmt.Sprintf(`DELETE FROM %s WHERE (id, message_date) IN (?)`, r.tenantTable(companyId, "messages")), ids)
+	if res.RowsAffected > 0 {
+		cache.Invalidate(ctx, companyId, cache.TagMessages)
+	}
+	if res.Error != nil || res.RowsAffected == int64(batch) {
+		return res.RowsAffected, res.Error
+	}
+
+	// Last batch: drop the edits recorded before the cutoff too
+	if database.TenantColumnExists(ctx, companyId, "message_edits", "recorded_at") {
+		edits := r.db.Table(r.tenantTable(companyId, "message_edits")).WithContext(ctx).
+			Where("recorded_at < ?", scope.Before)
+		if err := scoped(edits, "agent_id", scope).Delete(&model.MessageEdit{}).Error; err != nil {
+			return 0, fmt.Errorf("failed to delete message edits: %w", err)
+		}
+	}
+	return res.RowsAffected, nil
+}
+
+// inactiveContacts selects contacts neither updated nor in a conversation since the cutoff
+func (r *retentionRepo) inactiveContacts(ctx context.Context, companyId string, scope model.RetentionScope) *gorm.DB {
+	query := r.db.Table(r.tenantTable(companyId, "contacts")+" AS c").WithContext(ctx).
+		Where("c.updated_at < ?", scope.Before).
+		Where(fmt.Sprintf(`NOT EXISTS (
+			SELECT 1 FROM %s ch
+			WHERE ch.chat_id = c.chat_id AND ch.agent_id = c.agent_id AND ch.conversation_timestamp >= ?
+		)`, r.tenantTable(companyId, "chats")), scope.Before.Unix())
+	return scoped(query, "c.agent_id", scope)
+}
+
+func (r *retentionRepo) CountInactiveContacts(ctx context.Context, companyId string, scope model.RetentionScope) (int64, error) {
+	var count int64
+	err := r.inactiveContacts(ctx, companyId, scope).Count(&count).Error
+	return count, err
+}
+
+// DeleteInactiveContacts deletes a batch of inactive contacts together with their
+// change history, and clears the contact snapshots of their audit entries, like a
+// privacy erase does: none of their personal data outlives the contact.
+func (r *retentionRepo) DeleteInactiveContacts(ctx context.Context, companyId string, scope model.RetentionScope, batch int) (int64, error) {
+	var ids []string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// RETURNING yields the contacts actually deleted, whose history must go too
+		if err := tx.Raw(fmt.Sprintf(`DELETE FROM %s WHERE id IN (?) RETURNING id`, r.tenantTable(companyId, "contacts")),
+			r.inactiveContacts(ctx, companyId, scope).Select("c.id").Limit(batch)).
+			Scan(&ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if database.TenantColumnExists(ctx, companyId, "contact_history", "id") {
+			if err := tx.Table(r.tenantTable(companyId, "contact_history")).
+				Where("contact_id IN ?", ids).
+				Delete(&model.ContactHistory{}).Error; err != nil {
+				return fmt.Errorf("failed to delete contact history: %w", err)
+			}
+		}
+		if database.TenantColumnExists(ctx, companyId, "audit_logs", "id") {
+			if err := tx.Table(r.tenantTable(companyId, "audit_logs")).
+				Where("entity_type = ? AND entity_id IN ?", "contact", ids).
+				Updates(map[string]interface{}{"before": nil, "after": nil}).Error; err != nil {
+				return fmt.Errorf("failed to redact audit logs: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	tags := []string{cache.TagContacts, cache.TagChats}
+	for _, id := range ids {
+		tags = append(tags, cache.ContactTag(id))
+	}
+	cache.Invalidate(ctx, companyId, tags...)
+	return int64(len(ids)), nil
+}
+
+func (r *retentionRepo) StartRun(ctx context.Context, companyId string, staleBefore time.Time) (*model.RetentionRun, error) {
+	if err := r.ensureTables(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare retention tables: %w", err)
+	}
+
+	now := time.Now()
+	if err := r.runs(ctx, companyId).
+		Where("status = ? AND updated_at < ?", model.RetentionRunRunning, staleBefore).
+		Updates(map[string]interface{}{
+			"status":      model.RetentionRunFailed,
+			"error":       "interrupted",
+			"finished_at": now,
+		}).Error; err != nil {
+		return nil, err
+	}
+
+	run := &model.RetentionRun{Status: model.RetentionRunRunning, StartedAt: now, UpdatedAt: now}
+	res := r.runs(ctx, companyId).Clauses(clause.OnConflict{DoNothing: true}).Create(run)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+	return run, nil
+}
+
+func (r *retentionRepo) UpdateRun(ctx context.Context, companyId string, run *model.RetentionRun) error {
+	run.UpdatedAt = time.Now()
+	return r.runs(ctx, companyId).
+		Where("id = ?", run.ID).
+		Updates(map[string]interface{}{
+			"status":           run.Status,
+			"partitions":       run.Partitions,
+			"deleted_messages": run.DeletedMessages,
+			"deleted_contacts": run.DeletedContacts,
+			"deleted_archives": run.DeletedArchives,
+			"error":            run.Error,
+			"updated_at":       run.UpdatedAt,
+			"finished_at":      run.FinishedAt,
+		}).Error
+}
+
+func (r *retentionRepo) ListRuns(ctx context.Context, companyId string, limit, offset int) (*model.RetentionRunPage, error) {
+	if err := r.ensureTables(ctx, companyId); err != nil {
+		return nil, fmt.Errorf("failed to prepare retention tables: %w", err)
+	}
+
+	var total int64
+	if err := r.runs(ctx, companyId).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count retention runs: %w", err)
+	}
+	var items []model.RetentionRun
+	if err := r.runs(ctx, companyId).Order("id DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch retention runs: %w", err)
+	}
+	if items == nil {
+		items = make([]model.RetentionRun, 0)
+	}
+	return &model.RetentionRunPage{Items: items, Total: total}, nil
+}
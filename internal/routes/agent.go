@@ -2,6 +2,7 @@ package routes
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/handler"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/middleware"
 )
@@ -10,18 +11,56 @@ import (
 func AgentRoutes(r fiber.Router) {
 	agents := r.Group("/agents")
 
-	// GET /agents?agentids=... or /agents — cached
-	agents.Get("/", middleware.Cache(), handler.ListAgents)
+	// GET /agents?agentids=...&status=connected,qr_pending&stale=true|false — cached
+	// stale=true lists agents marked stale or silent for longer than AGENT_STALE_AFTER
+	agents.Get("/", middleware.Cache(cache.TagAgents), handler.ListAgents)
+
+	// GET /agents/uptime?agentids=...&from=...&to=... — uptime of every (or the listed) agent
+	// Period defaults to the last 24 hours, max 93 days
+	agents.Get("/uptime", handler.ListAgentsUptime)
+
+	// GET /agents/stats?agentids=...&from=...&to=... — statistics of every (or the listed) agent
+	// Period [from, to) in whole days, defaults to the last 30 days, max 366 days
+	agents.Get("/stats", handler.ListAgentsStats)
+
+	// GET /agents/purge-jobs/:job_id — progress of a purge started by DELETE ?mode=purge
+	agents.Get("/purge-jobs/:job_id", handler.GetAgentPurgeJob)
 
 	// GET /agents/:agent_id — cached
-	agents.Get("/:agent_id", middleware.Cache(), handler.GetAgent)
+	agents.Get("/:agent_id", middleware.Cache(cache.AgentTag("{agent_id}")), handler.GetAgent)
+
+	// GET /agents/:agent_id/qr?current=...&timeout=30 — long-poll (max 60s) until the QR code
+	// differs from current or the agent is connected
+	agents.Get("/:agent_id/qr", handler.GetAgentQR)
+
+	// POST /agents/:agent_id/heartbeat — liveness ping, body: { version?, host_name? }
+	// A stale agent returns to the status it had before it went silent
+	agents.Post("/:agent_id/heartbeat", handler.AgentHeartbeat)
+
+	// POST /agents/:agent_id/status — record a status transition
+	// Body: { status: connected|disconnected|qr_pending, reason?, occurred_at? }
+	agents.Post("/:agent_id/status", handler.RecordAgentStatus)
+
+	// GET /agents/:agent_id/status-history?from=...&to=...&limit=...&offset=... — newest first
+	agents.Get("/:agent_id/status-history", handler.GetAgentStatusHistory)
+
+	// GET /agents/:agent_id/uptime?from=...&to=... — time per status and uptime percentage
+	agents.Get("/:agent_id/uptime", handler.GetAgentUptime)
+
+	// GET /agents/:agent_id/stats?from=...&to=... — chats, contacts, daily messages, first response
+	agents.Get("/:agent_id/stats", handler.GetAgentStats)
 
 	// POST  /agents
 	agents.Post("/", handler.CreateAgent)
 
-	// PATCH /agents/:id
-	agents.Patch("/:id", handler.UpdateAgentName)
+	// PATCH /agents/:agent_id — partial update
+	// Body: { agent_name?, host_name?, phone_number?, version?, status?, qr_code?, qr_ttl_seconds? }
+	// Headers: If-Match (optional) - ETag from GET /agents/:agent_id; 412 when the agent changed since
+	agents.Patch("/:agent_id", handler.UpdateAgent)
 
-	// DELETE /agents/:id
-	agents.Delete("/:id", handler.DeleteAgent)
+	// DELETE /agents/:agent_id?mode=restrict|soft|purge
+	//   restrict (default): 409 while the agent has chats, contacts or messages
+	//   soft: hide the agent and its chats, keep all rows
+	//   purge: 202 with a job deleting the agent and all its data in the background
+	agents.Delete("/:agent_id", handler.DeleteAgent)
 }
@@ -0,0 +1,53 @@
+// internal/routes/analytics.go
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/handler"
+)
+
+// AnalyticsRoutes registers all /analytics endpoints on the given router group
+func AnalyticsRoutes(r fiber.Router) {
+	analytics := r.Group("/analytics")
+
+	// GET /analytics/messages - Message volume time series
+	// Query params:
+	// - bucket (string): hour, day or week (default: day); hourly series span at most 31 days
+	// - group_by (string): comma-separated agent_id, flow, message_type
+	// - from, to (RFC3339 or YYYY-MM-DD): [from, to) in whole UTC days (default: last 30 days, max 366)
+	// - agent_id (string): comma-separated agent filter
+	// - flow (string): inbound or outbound
+	// - message_type (string): Filter by message type
+	// Response: { success: true, data: { bucket, from, to, group_by, points: [...] } }
+	// Results are cached per company for STATS_CACHE_TTL
+	analytics.Get("/messages", handler.GetMessageVolume)
+
+	// GET /analytics/contacts - New contacts per period
+	// Query params:
+	// - bucket (string): day (default), week or month
+	// - group_by (string): comma-separated origin, tag, status, agent_id (a contact counts once per tag)
+	// - from, to (RFC3339 or YYYY-MM-DD): [from, to) in whole UTC days (default: last 30 days, max 366)
+	// - agent_id (string): comma-separated agent filter
+	// - origin (string): Filter by origin ("" for contacts without origin)
+	// Response: { success: true, data: { bucket, from, to, group_by, points: [ { bucket, ..., created, first_message } ] } }
+	analytics.Get("/contacts", handler.GetContactFunnel)
+
+	// GET /analytics/response-times - Reply delays per agent or assignee
+	// Query params:
+	// - group_by (string): agent_id (default) or assigned_to (the contact's assignee)
+	// - from, to (RFC3339 or YYYY-MM-DD): turns started in [from, to) (default: last 30 days)
+	// - agent_id (string): comma-separated agent filter
+	// Response: { success: true, data: [ { agent_id|assigned_to, chats, first_response, response } ] }
+	analytics.Get("/response-times", handler.GetResponseTimes)
+
+	// GET /analytics/sla-breaches - Chats currently waiting for a reply longer than the SLA
+	// Query params:
+	// - threshold (duration like 15m, or seconds): default SLA_RESPONSE_THRESHOLD
+	// - lookback_days (int): how far back to look for waiting chats (default: 7, max: 31)
+	// - agent_id (string): comma-separated agent filter
+	// - assigned_to (string): Filter by the contact's assignee ("" for unassigned)
+	// - limit, offset (int): Pagination (default 20, max 100), longest wait first
+	// Response: { success: true, data: [...], total: X }
+	// Not cached: reflects the current state
+	analytics.Get("/sla-breaches", handler.GetSLABreaches)
+}
@@ -0,0 +1,31 @@
+// internal/routes/archive.go
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/handler"
+)
+
+// ArchiveRoutes registers all /archives endpoints on the given router group
+func ArchiveRoutes(r fiber.Router) {
+	archives := r.Group("/archives")
+
+	// POST /archives - Archive the messages partition of a past month
+	// Body: { month: "2024-01" }
+	// The partition is exported to a compressed file, verified and dropped;
+	// its messages stay readable (read-only) through the chat message endpoints.
+	// Response (202): { success: true, data: { id, partition, status: "archiving", ... } }
+	// 404 when no partition holds the month, 409 when it is archived or being archived
+	archives.Post("/", handler.CreateArchive)
+
+	// GET /archives - List archives, newest period first
+	// Query params:
+	// - limit (int): default 20, max 100
+	// - offset (int): default 0
+	// Response: { success: true, data: [...], total: X }
+	archives.Get("/", handler.ListArchives)
+
+	// GET /archives/:id - Archive status
+	// Response: { success: true, data: { id, partition, from, to, status, rows, file_size, ... } }
+	archives.Get("/:id", handler.GetArchive)
+}
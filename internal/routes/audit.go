@@ -0,0 +1,26 @@
+// internal/routes/audit.go
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/handler"
+)
+
+// AuditRoutes registers all /audit endpoints on the given router group
+func AuditRoutes(r fiber.Router) {
+	audit := r.Group("/audit")
+
+	// GET /audit - Fetch paginated audit trail of mutating calls (newest first)
+	// Query params:
+	// - limit (int): Number of items per page (default: 20, max: 100)
+	// - offset (int): Number of items to skip (default: 0)
+	// - entity_type (string): Filter by entity (agent, contact, ...)
+	// - entity_id (string): Filter by target ID
+	// - actor (string): Filter by caller identity
+	// - method (string): Filter by HTTP method (POST, PATCH, DELETE)
+	// - request_id (string): Filter by X-Request-ID
+	// - from, to (RFC3339 or YYYY-MM-DD): created_at range [from, to)
+	// Response: { success: true, data: [...], total: X }
+	// Not cached: entries must be visible immediately after a write
+	audit.Get("/", handler.FetchAuditLogs)
+}
@@ -3,6 +3,7 @@ package routes
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/handler"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/middleware"
 )
@@ -17,10 +18,11 @@ func ChatRoutes(r fiber.Router) {
 	// - offset (int): Number of items to skip (default: 0)
 	// - agent_id (string): Filter by agent ID
 	// - assigned_to (string): Filter by contact's assigned_to field
+	// - phone_number (string): Filter by phone number in any format (+62..., 62..., 0...)
 	// - has_unread (bool): Filter by unread status (true = unread_count > 0, false = unread_count = 0)
 	// - is_group (bool): Filter by group chats
 	// Response: { success: true, data: [...], total: X }
-	chats.Get("/", middleware.Cache(), handler.FetchChats)
+	chats.Get("/", middleware.Cache(cache.TagChats, cache.TagContacts), handler.FetchChats)
 
 	// GET /chats/range - Fetch chats by range for infinite scroll
 	// Query params:
@@ -28,15 +30,27 @@ func ChatRoutes(r fiber.Router) {
 	// - end (int): End index (inclusive, default: start)
 	// - agent_id (string): Filter by agent ID
 	// - assigned_to (string): Filter by contact's assigned_to field
+	// - phone_number (string): Filter by phone number in any format (+62..., 62..., 0...)
 	// - has_unread (bool): Filter by unread status
 	// - is_group (bool): Filter by group chats
 	// Response: { success: true, data: [...] }
-	chats.Get("/range", middleware.Cache(), handler.FetchRangeChats)
+	chats.Get("/range", middleware.Cache(cache.TagChats, cache.TagContacts), handler.FetchRangeChats)
 
 	// GET /chats/search - Search chats and contacts
 	// Query params:
 	// - q (string): Search query (required) - searches in phone_number, push_name, group_name, custom_name
+	//   Phone-like queries match the number in any stored format
 	// - agent_id (string): Optional filter by agent ID
 	// Response: { success: true, data: [...], total: X }
-	chats.Get("/search", middleware.Cache(), handler.SearchChats)
+	chats.Get("/search", middleware.Cache(cache.TagChats, cache.TagContacts), handler.SearchChats)
+
+	// GET /chats/:chat_id/transcript - Download the full transcript of a chat
+	// Query params:
+	// - format (string): txt (default), jsonl, html or pdf
+	// - agent_id (string): Agent owning the chat (optional unless several agents have the chat)
+	// - from, to (RFC3339 or YYYY-MM-DD): Only messages in [from, to)
+	// - tz (string): IANA time zone for timestamps (default: UTC)
+	// Response: the transcript as an attachment, streamed oldest message first with
+	// the contact and agent names in a header; no message limit
+	chats.Get("/:chat_id/transcript", handler.GetChatTranscript)
 }
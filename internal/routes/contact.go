@@ -3,6 +3,7 @@ package routes
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/handler"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/middleware"
 )
@@ -17,7 +18,7 @@ func ContactRoutes(r fiber.Router) {
 	// - offset (int): Number of items to skip (default: 0)
 	// - sort (string): Sort field (created_at, updated_at, custom_name, phone_number, last_conversation_timestamp)
 	// - order (string): Sort order (asc, desc)
-	// - phone_number (string): Filter by exact phone number
+	// - phone_number (string): Filter by phone number in any format (+62..., 62..., 0...)
 	// - agent_id (string): Filter by agent ID
 	// - assigned_to (string): Filter by assigned user
 	// - tags (string): Filter by exact tag match (e.g., "TAG1" will match contacts with TAG1 but not TAG11)
@@ -25,29 +26,57 @@ func ContactRoutes(r fiber.Router) {
 	// - origin (string): Filter by origin
 	// - has_chat (bool): Filter contacts with/without associated chats
 	// Response: { success: true, data: [...], total: X }
-	contacts.Get("/", middleware.Cache(), handler.FetchContacts)
+	contacts.Get("/", middleware.Cache(cache.TagContacts), handler.FetchContacts)
 
 	// GET /contacts/search - Search contacts
 	// Query params:
 	// - q (string): Search query (required) - searches in phone_number, custom_name, push_name
+	//   Phone-like queries match the number in any stored format
 	// - agent_id (string): Optional filter by agent ID
 	// Response: { success: true, data: [...], total: X }
-	contacts.Get("/search", middleware.Cache(), handler.SearchContacts)
+	contacts.Get("/search", middleware.Cache(cache.TagContacts), handler.SearchContacts)
+
+	// GET /contacts/duplicates - Groups of likely duplicate contacts
+	// Phone numbers are normalized (+62 / 62 / 0 prefixes, WA JIDs) before grouping
+	// Query params:
+	// - agent_id (string): Optional filter by agent ID
+	// - limit (int): Groups per page (default: 20, max: 100)
+	// - offset (int): Groups to skip (default: 0)
+	// Response: { success: true, data: [{ normalized_phone, contacts: [...] }], total: X }
+	contacts.Get("/duplicates", handler.FindDuplicateContacts)
+
+	// POST /contacts/merge - Merge duplicates into a survivor
+	// Body: { survivor_id, duplicate_ids: [...], fields?: { field: contact_id } }
+	// Empty survivor fields are filled from duplicates, tags are united, notes concatenated.
+	// The survivor keeps the contacts' chat; contacts of different chats are not merged (400).
+	// Duplicates are deleted and the merge is recorded in contact history.
+	// Response: { success: true, data: {...survivor} }
+	contacts.Post("/merge", handler.MergeContacts)
 
 	// GET /contacts/by-phone - Get contact by phone number and agent
 	// Query params:
-	// - phone_number (string): Phone number (required)
+	// - phone_number (string): Phone number in any format (required)
 	// - agent_id (string): Agent ID (required)
 	// Response: { success: true, data: {...} }
-	contacts.Get("/by-phone", middleware.Cache(), handler.GetContactByPhoneAndAgent)
+	contacts.Get("/by-phone", middleware.Cache(cache.TagContacts), handler.GetContactByPhoneAndAgent)
 
 	// GET /contacts/:id - Get single contact by ID
+	// Query params:
+	// - as_of (RFC3339 or YYYY-MM-DD): Optional, reconstruct the contact as it was at that time
 	// Response: { success: true, data: {...} }
-	contacts.Get("/:id", middleware.Cache(), handler.GetContactByID)
+	contacts.Get("/:id", middleware.Cache(cache.ContactTag("{id}")), handler.GetContactByID)
+
+	// GET /contacts/:id/history - Recorded changes of a contact (newest first)
+	// Query params:
+	// - limit (int): Number of items per page (default: 20, max: 100)
+	// - offset (int): Number of items to skip (default: 0)
+	// Response: { success: true, data: [{ action, changes: { field: { from, to } }, actor, created_at, ... }], total: X }
+	contacts.Get("/:id/history", handler.FetchContactHistory)
 
 	// PATCH /contacts/:id - Update contact
 	// Body: { custom_name?, assigned_to?, tags?, avatar?, notes? }
 	// All fields are optional, only provided fields will be updated
+	// Headers: If-Match (optional) - ETag from GET /contacts/:id; 412 when the contact changed since
 	// Response: { success: true, data: {...} }
 	contacts.Patch("/:id", handler.UpdateContact)
 }
@@ -0,0 +1,33 @@
+// internal/routes/export.go
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/handler"
+)
+
+// ExportRoutes registers all /exports endpoints on the given router group
+func ExportRoutes(r fiber.Router) {
+	exports := r.Group("/exports")
+
+	// POST /exports - Queue an asynchronous export
+	// Body: { kind: "contacts"|"messages", format: "jsonl"|"csv", agent_id?, chat_id?, from?, to? }
+	// - contacts: all contacts, optionally of one agent
+	// - messages: messages in [from, to) (required, at most 366 days), optionally of one agent or chat
+	// Response (202): { success: true, data: { id, status: "pending", ... } }
+	exports.Post("/", handler.CreateExport)
+
+	// GET /exports - List export jobs, newest first
+	// Query params:
+	// - limit (int): default 20, max 100
+	// - offset (int): default 0
+	// Response: { success: true, data: [...], total: X }
+	exports.Get("/", handler.ListExports)
+
+	// GET /exports/:id - Export job status
+	// Response: { success: true, data: { id, status, total, processed, progress, download_url, ... } }
+	exports.Get("/:id", handler.GetExport)
+
+	// GET /exports/:id/download - Download the file of a completed export (409 until completed)
+	exports.Get("/:id/download", handler.DownloadExport)
+}
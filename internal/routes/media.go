@@ -0,0 +1,21 @@
+// internal/routes/media.go
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/handler"
+)
+
+// MediaRoutes registers the signed media endpoint. It sits outside /api/v1:
+// the URL signature authorizes the request instead of a bearer token.
+func MediaRoutes(app *fiber.App) {
+	// GET /media/:message_id - Serve a message attachment
+	// Query params (all produced by the signed URL in a message's media.url):
+	// - company (string): Company ID
+	// - agent, chat (string): Agent and chat of the message
+	// - expires (int): Unix time after which the URL is rejected
+	// - sig (string): HMAC-SHA256 signature
+	// Response: the attachment body with its mimetype, or a redirect for media kept
+	// outside our storage; 403 for invalid or expired signatures, 404 without media
+	app.Get("/media/:message_id", handler.GetMedia)
+}
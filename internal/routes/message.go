@@ -3,6 +3,7 @@ package routes
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/handler"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/middleware"
 )
@@ -19,9 +20,16 @@ func MessageRoutes(r fiber.Router) {
 	// - offset (int): Number of messages to skip (default: 0)
 	// - sort (string): Sort field (message_timestamp, created_at, updated_at, from_phone, to_phone, message_type, flow)
 	// - order (string): Sort order (asc, desc) - default: desc
+	// - format (string): raw (default) or normalized to add a typed "normalized" object, reactions and
+	//   quoted previews per message; normalized lists leave reaction messages out
+	// - deleted (string): include (default), exclude or only deleted messages
+	// - text (string): message_text as original (before edits) or current (latest edit); stored value when omitted
+	// - from_phone, to_phone (string): Optional sender / recipient, in any phone format (normalized to E.164)
 	// Response: { success: true, data: [...], total: X }
 	// Messages are sorted by the specified field (default: message_timestamp DESC - newest first)
-	messages.Get("/", middleware.Cache(), handler.FetchMessagesByChatId)
+	// Each message carries its aggregated reactions and, for replies, a "quoted" preview
+	// Message lists carry no ETag: their signed media URLs change with every response
+	messages.Get("/", middleware.SkipETag(), middleware.Cache(cache.TagMessages), handler.FetchMessagesByChatId)
 
 	// GET /messages/range - Fetch messages by range for infinite scroll with total count
 	// Query params:
@@ -31,8 +39,31 @@ func MessageRoutes(r fiber.Router) {
 	// - end (int): End index (inclusive, default: start)
 	// - sort (string): Sort field (message_timestamp, created_at, updated_at, from_phone, to_phone, message_type, flow)
 	// - order (string): Sort order (asc, desc) - default: desc
+	// - format (string): raw (default) or normalized
+	// - deleted (string): include (default), exclude or only
+	// - text (string): original or current
+	// - from_phone, to_phone (string): Optional sender / recipient, in any phone format
 	// Response: { success: true, data: [...], total: X }
 	// Maximum range size: 100 messages
 	// Now returns total count like other paginated endpoints
-	messages.Get("/range", middleware.Cache(), handler.FetchRangeMessagesByChatId)
+	messages.Get("/range", middleware.SkipETag(), middleware.Cache(cache.TagMessages), handler.FetchRangeMessagesByChatId)
+
+	// GET /messages/:message_id/edits - Edit history of a message
+	// Query params:
+	// - agent_id (string): Required - Agent ID
+	// - chat_id (string): Required - Chat ID
+	// Response: { success: true, data: { message_id, original_text, current_text, edited, deleted, message_obj, edits: [ { text, edited_message_obj, recorded_at } ] } }
+	// Edits are recorded once cmd/enable-edit-history has run for the tenant;
+	// older edits only appear as the current version, with recorded_at null
+	messages.Get("/:message_id/edits", handler.GetMessageEdits)
+
+	// GET /messages/:message_id/replies - Messages quoting a message, oldest first
+	// Query params:
+	// - agent_id (string): Required - Agent ID
+	// - chat_id (string): Required - Chat ID
+	// - limit (int): Number of replies per page (default: 20, max: 100)
+	// - offset (int): Number of replies to skip (default: 0)
+	// - format, deleted, text: as for GET /messages
+	// Response: { success: true, data: [...], total: X }
+	messages.Get("/:message_id/replies", middleware.SkipETag(), middleware.Cache(cache.TagMessages), handler.FetchMessageReplies)
 }
@@ -0,0 +1,30 @@
+// internal/routes/privacy.go
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/handler"
+)
+
+// PrivacyRoutes registers all /privacy endpoints on the given router group
+func PrivacyRoutes(r fiber.Router) {
+	privacy := r.Group("/privacy")
+
+	// POST /privacy/export - Everything stored about a phone number, as a JSON attachment
+	// Body: { phone_number: string, agent_id?: string }
+	// Response: { phone_number, agent_id, generated_at, contacts, contact_history, chats, message_count, messages }
+	// 404 when nothing is stored about the number
+	privacy.Post("/export", handler.ExportPrivacySubject)
+
+	// POST /privacy/erase - Redact the messages and media of a phone number and anonymize its contacts
+	// Body: { phone_number: string, agent_id?: string }
+	// Response: { success: true, data: { id, action: "erase", contacts, chats, messages, media_files, ... } }
+	privacy.Post("/erase", handler.ErasePrivacySubject)
+
+	// GET /privacy/log - Immutable log of erasures and exports, newest first
+	// Query params:
+	// - limit (int): default 20, max 100
+	// - offset (int): default 0
+	// Response: { success: true, data: [...], total: X }
+	privacy.Get("/log", handler.ListPrivacyLog)
+}
@@ -0,0 +1,38 @@
+// internal/routes/retention.go
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/handler"
+)
+
+// RetentionRoutes registers all /retention endpoints on the given router group
+func RetentionRoutes(r fiber.Router) {
+	retention := r.Group("/retention")
+
+	// GET /retention - Company default policy (agent_id omitted) and agent policies
+	// Response: { success: true, data: [ { agent_id?, message_days, inactive_contact_days, ... } ] }
+	retention.Get("/", handler.GetRetentionPolicies)
+
+	// PUT /retention - Replace the company default policy
+	// Body: { message_days?: int, inactive_contact_days?: int } (null or 0 keeps forever)
+	retention.Put("/", handler.SetRetentionPolicy)
+
+	// PUT /retention/agents/:agent_id - Replace an agent's policy
+	// Body: { message_days?: int, inactive_contact_days?: int } (null inherits the default, 0 keeps forever)
+	retention.Put("/agents/:agent_id", handler.SetAgentRetentionPolicy)
+
+	// DELETE /retention/agents/:agent_id - Remove an agent's policy (204); the agent inherits the default
+	retention.Delete("/agents/:agent_id", handler.DeleteAgentRetentionPolicy)
+
+	// GET /retention/report - Dry run of the scheduled enforcement
+	// Response: { success: true, data: { partitions: [...], messages: [...], contacts: [...], total_messages, total_contacts } }
+	retention.Get("/report", handler.GetRetentionReport)
+
+	// GET /retention/runs - Past enforcements, newest first
+	// Query params:
+	// - limit (int): default 20, max 100
+	// - offset (int): default 0
+	// Response: { success: true, data: [...], total: X }
+	retention.Get("/runs", handler.ListRetentionRuns)
+}
@@ -5,14 +5,24 @@ import (
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/middleware"
 )
 
-// RegisterRoutes mounts all sub-route groups under /api/v1
-func RegisterV1Routes(app *fiber.App) {
+// RegisterRoutes mounts all sub-route groups under /api/v1.
+// Extra middleware runs after authentication, so it can rely on the companyId local.
+// GET responses carry an ETag and honor If-None-Match (304).
+func RegisterV1Routes(app *fiber.App, mw ...fiber.Handler) {
 	// Create /api/v1 group
-	v1 := app.Group("/api/v1", middleware.AuthenticateBearerToken())
+	handlers := append([]fiber.Handler{middleware.AuthenticateBearerToken(), middleware.ETag()}, mw...)
+	v1 := app.Group("/api/v1", handlers...)
 
 	// Mount each resource under /api/v1
 	AgentRoutes(v1)
 	ChatRoutes(v1)
 	MessageRoutes(v1)
 	ContactRoutes(v1)
+	AuditRoutes(v1)
+	AnalyticsRoutes(v1)
+	ExportRoutes(v1)
+	RetentionRoutes(v1)
+	ArchiveRoutes(v1)
+	PrivacyRoutes(v1)
+	UsageRoutes(v1)
 }
@@ -0,0 +1,17 @@
+// internal/routes/usage.go
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/handler"
+)
+
+// UsageRoutes registers the /usage endpoint on the given router group
+func UsageRoutes(r fiber.Router) {
+	// GET /usage - Requests of the current month, quota, rate limits in force and monthly history
+	// Query params:
+	// - months (int): Months of history, newest first (default: 12, max: 36)
+	// Response: { success: true, data: {...UsageReport} }
+	// Not subject to the monthly quota, so it stays readable once the quota is used up
+	r.Get("/usage", handler.GetUsage)
+}
@@ -3,9 +3,15 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
 
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/phone"
 )
 
 // AgentService defines business operations on agents in a tenant schema.
@@ -14,38 +20,137 @@ type AgentService interface {
 	ListByCompanyID(ctx context.Context, companyId string) ([]*model.Agent, error)
 	ListByAgentIDs(ctx context.Context, companyId string, agentIds []string) ([]*model.Agent, error)
 	Create(ctx context.Context, companyId string, in *model.Agent) (*model.Agent, error)
-	UpdateName(ctx context.Context, companyId, agentId, newName string) (*model.Agent, error)
-	Delete(ctx context.Context, companyId, id string) error
+	// Update validates and applies a partial update (name, host, phone, version, status, QR code);
+	// a non-empty ifMatch must match the agent's current ETag or ErrPreconditionFailed is returned
+	Update(ctx context.Context, companyId, agentId string, in model.AgentUpdateInput, ifMatch string) (*model.Agent, error)
+	// WaitForQR blocks until the agent's QR code differs from current, the agent is
+	// connected or timeout elapses
+	WaitForQR(ctx context.Context, companyId, agentId, current string, timeout time.Duration) (*model.AgentQR, error)
+	// Delete removes an agent according to mode (restrict, soft, purge); purge returns the queued job
+	Delete(ctx context.Context, companyId, agentId, mode string) (*model.AgentPurgeJob, error)
+	// GetPurgeJob returns a purge job with its progress
+	GetPurgeJob(ctx context.Context, companyId string, id int64) (*model.AgentPurgeJob, error)
+	// ResumePurges restarts the tenant's pending purge jobs and those whose worker stopped
+	ResumePurges(ctx context.Context, companyId string) (int, error)
+	// Start lets purge jobs run until ctx is done; jobs created before stay pending
+	Start(ctx context.Context)
+	// Wait blocks until the purge jobs of this process have stopped
+	Wait()
+	// List returns agents filtered by agent_ids, status and stale
+	List(ctx context.Context, companyId string, filter map[string]interface{}) ([]*model.Agent, error)
+	// Heartbeat records liveness; a stale agent returns to the status it had before
+	Heartbeat(ctx context.Context, companyId, agentId, version, hostName string) (*model.Agent, error)
+	// MarkStale flags the tenant's agents that stopped sending heartbeats
+	MarkStale(ctx context.Context, companyId string) ([]string, error)
+	// RecordStatus validates and stores a status transition (connected, disconnected, qr_pending)
+	RecordStatus(ctx context.Context, companyId, agentId, status, reason string, occurredAt time.Time) (*model.AgentStatusEvent, error)
+	// FetchStatusHistory returns an agent's status transitions within [from, to), newest first
+	FetchStatusHistory(ctx context.Context, companyId, agentId string, from, to time.Time, limit, offset int) (*model.AgentStatusEventPage, error)
+	// Uptime computes per-agent status durations over [from, to); no agentIds means every agent
+	Uptime(ctx context.Context, companyId string, agentIds []string, from, to time.Time) ([]model.AgentUptime, error)
 }
 
+// reportableStatuses are the statuses agents may report through the API
+var reportableStatuses = map[string]bool{
+	model.AgentStatusConnected:    true,
+	model.AgentStatusDisconnected: true,
+	model.AgentStatusQRPending:    true,
+}
+
+// ErrAgentNotFound is returned when the agent to delete does not exist
+var ErrAgentNotFound = errors.New("agent not found")
+
+// ErrAgentHasData is returned by restrict deletes of agents that still own data
+var ErrAgentHasData = errors.New("agent still has data")
+
+// ErrInvalidDeleteMode is returned for unknown deletion modes
+var ErrInvalidDeleteMode = errors.New("invalid delete mode")
+
+// purgeBatchSize bounds the rows removed per statement, keeping locks short
+const purgeBatchSize = 1000
+
+// purgeStaleAfter is how long a running purge may go without progress before
+// another worker takes it over
+const purgeStaleAfter = 2 * time.Minute
+
+// QR polling bounds. Waiters poll every qrPollInterval at first, backing off to
+// maxQRPollInterval so long waits cost a few queries.
+const (
+	maxQRTTL          = time.Hour
+	maxQRWait         = time.Minute
+	qrPollInterval    = 2 * time.Second
+	maxQRPollInterval = 5 * time.Second
+	maxQRCodeLength   = 4096
+)
+
+// maxUptimePeriod bounds uptime queries to keep the event replay cheap
+const maxUptimePeriod = 93 * 24 * time.Hour
+
 // NewAgentService wires the repository into the service.
-func NewAgentService(repo repository.AgentRepository) AgentService {
-	return &agentService{repo: repo}
+// Agents are considered stale after staleAfter without a heartbeat;
+// new QR codes stay valid for qrTTL unless the update sets its own lifetime.
+func NewAgentService(repo repository.AgentRepository, staleAfter, qrTTL time.Duration) AgentService {
+	return &agentService{repo: repo, staleAfter: staleAfter, qrTTL: qrTTL, owner: workerID()}
 }
 
 type agentService struct {
-	repo repository.AgentRepository
+	repo       repository.AgentRepository
+	staleAfter time.Duration
+	qrTTL      time.Duration
+
+	// owner identifies this process in the purge jobs it claims
+	owner   string
+	mu      sync.Mutex
+	jobsCtx context.Context
+	running sync.WaitGroup
+}
+
+// workerID names this process uniquely among the replicas
+func workerID() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+}
+
+// present fills the computed Stale flag and hides expired QR codes
+func (s *agentService) present(agents ...*model.Agent) {
+	now := time.Now()
+	cutoff := now.Add(-s.staleAfter)
+	for _, a := range agents {
+		if a == nil {
+			continue
+		}
+		a.Stale = a.Status == model.AgentStatusStale || (a.LastSeen != nil && a.LastSeen.Before(cutoff))
+		if a.QRExpiresAt != nil && !a.QRExpiresAt.After(now) {
+			a.QRCode = ""
+		}
+	}
 }
 
 func (s *agentService) GetByAgentID(ctx context.Context, companyId, agentId string) (*model.Agent, error) {
 	if companyId == "" || agentId == "" {
 		return nil, errors.New("companyId and agentId are required")
 	}
-	return s.repo.GetByAgentID(ctx, companyId, agentId)
+	a, err := s.repo.GetByAgentID(ctx, companyId, agentId)
+	s.present(a)
+	return a, err
 }
 
 func (s *agentService) ListByCompanyID(ctx context.Context, companyId string) ([]*model.Agent, error) {
 	if companyId == "" {
 		return nil, errors.New("companyId is required")
 	}
-	return s.repo.ListByCompanyID(ctx, companyId)
+	agents, err := s.repo.ListByCompanyID(ctx, companyId)
+	s.present(agents...)
+	return agents, err
 }
 
 func (s *agentService) ListByAgentIDs(ctx context.Context, companyId string, agentIds []string) ([]*model.Agent, error) {
 	if companyId == "" {
 		return nil, errors.New("companyId is required")
 	}
-	return s.repo.ListByAgentIDs(ctx, companyId, agentIds)
+	agents, err := s.repo.ListByAgentIDs(ctx, companyId, agentIds)
+	s.present(agents...)
+	return agents, err
 }
 
 func (s *agentService) Create(ctx context.Context, companyId string, a *model.Agent) (*model.Agent, error) {
@@ -57,19 +162,571 @@ func (s *agentService) Create(ctx context.Context, companyId string, a *model.Ag
 	return s.repo.Create(ctx, companyId, a)
 }
 
-func (s *agentService) UpdateName(ctx context.Context, companyId, agentId, newName string) (*model.Agent, error) {
+func (s *agentService) Update(
+	ctx context.Context,
+	companyId, agentId string,
+	in model.AgentUpdateInput,
+	ifMatchTag string,
+) (*model.Agent, error) {
 	if companyId == "" || agentId == "" {
 		return nil, errors.New("companyId and agentId are required")
 	}
-	if newName == "" {
-		return nil, errors.New("newName is required")
+
+	// Build updates map - only include provided values
+	updates := make(map[string]interface{})
+
+	if in.AgentName != nil {
+		if *in.AgentName == "" || len(*in.AgentName) > 255 {
+			return nil, errors.New("agent_name must be 1-255 characters")
+		}
+		updates["agent_name"] = *in.AgentName
 	}
-	return s.repo.UpdateName(ctx, companyId, agentId, newName)
+
+	if in.HostName != nil {
+		if len(*in.HostName) > 255 {
+			return nil, errors.New("host_name is too long")
+		}
+		updates["host_name"] = *in.HostName
+	}
+
+	if in.Version != nil {
+		if len(*in.Version) > 100 {
+			return nil, errors.New("version is too long")
+		}
+		updates["version"] = *in.Version
+	}
+
+	// Allow empty string to clear the number
+	if in.PhoneNumber != nil {
+		if *in.PhoneNumber != "" && !phone.LooksLikeNumber(*in.PhoneNumber) {
+			return nil, errors.New("phone_number is not a valid phone number")
+		}
+		updates["phone_number"] = *in.PhoneNumber
+	}
+
+	if in.Status != nil {
+		if !reportableStatuses[*in.Status] {
+			return nil, fmt.Errorf("status must be one of %s, %s, %s",
+				model.AgentStatusConnected, model.AgentStatusDisconnected, model.AgentStatusQRPending)
+		}
+		updates["status"] = *in.Status
+	}
+
+	if in.QRCode != nil {
+		if len(*in.QRCode) > maxQRCodeLength {
+			return nil, errors.New("qr_code is too long")
+		}
+		ttl := s.qrTTL
+		if in.QRTTLSeconds != nil {
+			ttl = time.Duration(*in.QRTTLSeconds) * time.Second
+		}
+		if ttl <= 0 || ttl > maxQRTTL {
+			return nil, errors.New("qr_ttl_seconds must be between 1 and 3600")
+		}
+
+		updates["qr_code"] = *in.QRCode
+		if *in.QRCode == "" {
+			updates["qr_expires_at"] = nil
+		} else {
+			updates["qr_expires_at"] = time.Now().Add(ttl)
+			// A new code means the agent waits for pairing
+			if in.Status == nil {
+				updates["status"] = model.AgentStatusQRPending
+			}
+		}
+	} else if in.QRTTLSeconds != nil {
+		return nil, errors.New("qr_ttl_seconds requires qr_code")
+	}
+
+	// Pairing finished: the QR code is spent
+	if updates["status"] == model.AgentStatusConnected {
+		if code, ok := updates["qr_code"].(string); ok && code != "" {
+			return nil, errors.New("qr_code cannot be set on a connected agent")
+		}
+		updates["qr_code"] = ""
+		updates["qr_expires_at"] = nil
+	}
+
+	if len(updates) == 0 {
+		return nil, errors.New("no fields to update")
+	}
+
+	check := ifMatch(ifMatchTag, AgentETag)
+	a, err := s.repo.Update(ctx, companyId, agentId, updates, check)
+	s.present(a)
+	return a, err
 }
 
-func (s *agentService) Delete(ctx context.Context, companyId, id string) error {
-	if companyId == "" || id == "" {
-		return errors.New("companyId and id are required")
+func (s *agentService) WaitForQR(
+	ctx context.Context,
+	companyId, agentId, current string,
+	timeout time.Duration,
+) (*model.AgentQR, error) {
+	if companyId == "" || agentId == "" {
+		return nil, errors.New("companyId and agentId are required")
+	}
+	if timeout < 0 {
+		timeout = 0
+	} else if timeout > maxQRWait {
+		timeout = maxQRWait
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	interval := qrPollInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		// Poll with a fresh context so the final check still runs after the deadline
+		a, err := s.repo.GetByAgentID(context.WithoutCancel(ctx), companyId, agentId)
+		if err != nil || a == nil {
+			return nil, err
+		}
+		s.present(a)
+
+		qr := &model.AgentQR{
+			AgentID:     a.AgentID,
+			Status:      a.Status,
+			QRCode:      a.QRCode,
+			QRExpiresAt: a.QRExpiresAt,
+			Connected:   a.Status == model.AgentStatusConnected,
+		}
+		if a.QRCode == "" {
+			qr.QRExpiresAt = nil
+		}
+		qr.Changed = a.QRCode != current
+		if qr.Connected || qr.Changed {
+			return qr, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return qr, nil
+		case <-timer.C:
+		}
+		interval = min(interval*2, maxQRPollInterval)
+		timer.Reset(interval)
+	}
+}
+
+func (s *agentService) Delete(ctx context.Context, companyId, agentId, mode string) (*model.AgentPurgeJob, error) {
+	if companyId == "" || agentId == "" {
+		return nil, errors.New("companyId and agentId are required")
+	}
+	if mode == "" {
+		mode = model.AgentDeleteRestrict
+	}
+
+	switch mode {
+	case model.AgentDeleteRestrict:
+		counts, deleted, err := s.repo.DeleteWithoutData(ctx, companyId, agentId)
+		if err != nil {
+			return nil, err
+		}
+		if counts == nil {
+			return nil, ErrAgentNotFound
+		}
+		if !deleted {
+			return nil, fmt.Errorf("%w: %d chats, %d contacts, %d messages",
+				ErrAgentHasData, counts.Chats, counts.Contacts, counts.Messages)
+		}
+		return nil, nil
+
+	case model.AgentDeleteSoft:
+		a, err := s.repo.SoftDelete(ctx, companyId, agentId)
+		if err != nil {
+			return nil, err
+		}
+		if a == nil {
+			return nil, ErrAgentNotFound
+		}
+		return nil, nil
+
+	case model.AgentDeletePurge:
+		job, err := s.repo.CreatePurgeJob(ctx, companyId, agentId)
+		if err != nil {
+			return nil, err
+		}
+		if job == nil {
+			return nil, ErrAgentNotFound
+		}
+		// The job outlives the request
+		s.startPurge(companyId, *job)
+		withProgress(job)
+		return job, nil
+
+	default:
+		return nil, fmt.Errorf("%w: mode must be one of %s, %s, %s", ErrInvalidDeleteMode,
+			model.AgentDeleteRestrict, model.AgentDeleteSoft, model.AgentDeletePurge)
+	}
+}
+
+func (s *agentService) GetPurgeJob(ctx context.Context, companyId string, id int64) (*model.AgentPurgeJob, error) {
+	if companyId == "" || id <= 0 {
+		return nil, errors.New("companyId and id are required")
+	}
+	job, err := s.repo.GetPurgeJob(ctx, companyId, id)
+	if job != nil {
+		withProgress(job)
+	}
+	return job, err
+}
+
+func (s *agentService) ResumePurges(ctx context.Context, companyId string) (int, error) {
+	if companyId == "" {
+		return 0, errors.New("companyId is required")
+	}
+	jobs, err := s.repo.UnfinishedPurgeJobs(ctx, companyId)
+	if err != nil {
+		return 0, err
+	}
+	staleBefore := time.Now().Add(-purgeStaleAfter)
+	resumed := 0
+	for _, job := range jobs {
+		// Running jobs still making progress belong to a live worker
+		if job.Status == model.PurgeJobRunning && job.UpdatedAt.After(staleBefore) {
+			continue
+		}
+		if s.startPurge(companyId, job) {
+			resumed++
+		}
+	}
+	return resumed, nil
+}
+
+func (s *agentService) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobsCtx = ctx
+}
+
+func (s *agentService) Wait() {
+	s.running.Wait()
+}
+
+// startPurge runs a job in the background until the context given to Start is
+// done. Before Start, or after shutdown began, the job stays pending for the next
+// ResumePurges. Jobs are claimed in the database, so a job already run by this
+// or another replica is skipped.
+func (s *agentService) startPurge(companyId string, job model.AgentPurgeJob) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.jobsCtx == nil || s.jobsCtx.Err() != nil {
+		return false
+	}
+	s.running.Add(1)
+	go func(ctx context.Context) {
+		defer s.running.Done()
+		s.runPurge(ctx, companyId, job)
+	}(s.jobsCtx)
+	return true
+}
+
+// runPurge claims the job, deletes the agent's messages, contacts and chats in
+// batches, storing progress after each batch, then removes the agent row. Deletes
+// are idempotent, so an interrupted job is safely resumed from the start.
+func (s *agentService) runPurge(ctx context.Context, companyId string, job model.AgentPurgeJob) {
+	claimed, err := s.repo.ClaimPurgeJob(ctx, companyId, job.ID, s.owner, time.Now().Add(-purgeStaleAfter))
+	if err != nil || !claimed {
+		return
+	}
+	job.Status = model.PurgeJobRunning
+	job.Owner = s.owner
+
+	progress := map[string]*int64{
+		"messages": &job.DeletedMessages,
+		"contacts": &job.DeletedContacts,
+		"chats":    &job.DeletedChats,
+	}
+
+	fail := func(err error) {
+		job.Status = model.PurgeJobFailed
+		job.Error = err.Error()
+		now := time.Now()
+		job.FinishedAt = &now
+		_, _ = s.repo.UpdatePurgeJob(context.WithoutCancel(ctx), companyId, &job)
+	}
+	// On shutdown the job goes back to pending, so any replica resumes it right away
+	release := func() {
+		job.Status = model.PurgeJobPending
+		_, _ = s.repo.UpdatePurgeJob(context.WithoutCancel(ctx), companyId, &job)
+	}
+
+	for _, table := range []string{"messages", "contacts", "chats"} {
+		for {
+			if ctx.Err() != nil {
+				release()
+				return
+			}
+			n, err := s.repo.PurgeAgentBatch(ctx, companyId, job.AgentID, table, purgeBatchSize)
+			if err != nil {
+				if ctx.Err() != nil {
+					release()
+					return
+				}
+				fail(err)
+				return
+			}
+			*progress[table] += n
+			owned, err := s.repo.UpdatePurgeJob(ctx, companyId, &job)
+			if err != nil {
+				if ctx.Err() != nil {
+					release()
+					return
+				}
+				fail(err)
+				return
+			}
+			if !owned {
+				// Taken over by another worker after this one stalled
+				return
+			}
+			if n < purgeBatchSize {
+				break
+			}
+		}
+	}
+
+	if _, err := s.repo.Delete(ctx, companyId, job.AgentID); err != nil {
+		if ctx.Err() != nil {
+			release()
+			return
+		}
+		fail(err)
+		return
+	}
+
+	job.Status = model.PurgeJobCompleted
+	now := time.Now()
+	job.FinishedAt = &now
+	_, _ = s.repo.UpdatePurgeJob(context.WithoutCancel(ctx), companyId, &job)
+}
+
+// withProgress fills the computed completion percentage of a purge job
+func withProgress(job *model.AgentPurgeJob) {
+	if job.Status == model.PurgeJobCompleted {
+		job.Progress = 100
+		return
+	}
+	total := job.TotalChats + job.TotalContacts + job.TotalMessages
+	if total == 0 {
+		return
+	}
+	done := job.DeletedChats + job.DeletedContacts + job.DeletedMessages
+	percent := math.Min(float64(done)*100/float64(total), 100)
+	job.Progress = math.Round(percent*100) / 100
+}
+
+func (s *agentService) List(ctx context.Context, companyId string, filter map[string]interface{}) ([]*model.Agent, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+
+	// Validate filter values
+	validatedFilter := make(map[string]interface{})
+	for key, value := range filter {
+		switch key {
+		case "agent_ids", "status":
+			if list, ok := value.([]string); ok && len(list) > 0 {
+				validatedFilter[key] = list
+			}
+		case "stale":
+			if boolVal, ok := value.(bool); ok {
+				validatedFilter[key] = boolVal
+				validatedFilter["stale_before"] = time.Now().Add(-s.staleAfter)
+			}
+		}
+	}
+
+	agents, err := s.repo.List(ctx, companyId, validatedFilter)
+	s.present(agents...)
+	return agents, err
+}
+
+func (s *agentService) Heartbeat(ctx context.Context, companyId, agentId, version, hostName string) (*model.Agent, error) {
+	if companyId == "" || agentId == "" {
+		return nil, errors.New("companyId and agentId are required")
+	}
+	if len(version) > 100 || len(hostName) > 255 {
+		return nil, errors.New("version or host_name is too long")
+	}
+
+	a, err := s.repo.Heartbeat(ctx, companyId, agentId, version, hostName, time.Now())
+	if err != nil || a == nil {
+		return a, err
+	}
+
+	// Back from silence: restore the status the agent had before it went stale
+	if a.Status == model.AgentStatusStale {
+		restored := model.AgentStatusConnected
+		history, err := s.repo.FetchStatusEvents(ctx, companyId, agentId, time.Time{}, time.Time{}, 1, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(history.Items) > 0 {
+			last := history.Items[0]
+			if last.Status == model.AgentStatusStale && reportableStatuses[last.PreviousStatus] {
+				restored = last.PreviousStatus
+			}
+		}
+		if _, err := s.repo.RecordStatus(ctx, companyId, agentId, restored, "heartbeat resumed", time.Now()); err != nil {
+			return nil, err
+		}
+		a.Status = restored
+	}
+
+	s.present(a)
+	return a, nil
+}
+
+func (s *agentService) MarkStale(ctx context.Context, companyId string) ([]string, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	now := time.Now()
+	return s.repo.MarkStaleAgents(ctx, companyId, now.Add(-s.staleAfter), now)
+}
+
+func (s *agentService) RecordStatus(
+	ctx context.Context,
+	companyId, agentId, status, reason string,
+	occurredAt time.Time,
+) (*model.AgentStatusEvent, error) {
+	if companyId == "" || agentId == "" {
+		return nil, errors.New("companyId and agentId are required")
+	}
+	if !reportableStatuses[status] {
+		return nil, fmt.Errorf("status must be one of %s, %s, %s",
+			model.AgentStatusConnected, model.AgentStatusDisconnected, model.AgentStatusQRPending)
+	}
+	if len(reason) > 500 {
+		reason = reason[:500]
+	}
+
+	now := time.Now()
+	if occurredAt.IsZero() || occurredAt.After(now) {
+		occurredAt = now
+	}
+
+	return s.repo.RecordStatus(ctx, companyId, agentId, status, reason, occurredAt)
+}
+
+func (s *agentService) FetchStatusHistory(
+	ctx context.Context,
+	companyId, agentId string,
+	from, to time.Time,
+	limit, offset int,
+) (*model.AgentStatusEventPage, error) {
+	if companyId == "" || agentId == "" {
+		return nil, errors.New("companyId and agentId are required")
+	}
+
+	// Apply default pagination
+	if limit <= 0 {
+		limit = 20
+	} else if limit > 100 {
+		limit = 100
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+
+	return s.repo.FetchStatusEvents(ctx, companyId, agentId, from, to, limit, offset)
+}
+
+func (s *agentService) Uptime(
+	ctx context.Context,
+	companyId string,
+	agentIds []string,
+	from, to time.Time,
+) ([]model.AgentUptime, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+
+	// Default period: the last 24 hours
+	now := time.Now()
+	if to.IsZero() || to.After(now) {
+		to = now
+	}
+	if from.IsZero() {
+		from = to.Add(-24 * time.Hour)
+	}
+	if !from.Before(to) {
+		return nil, errors.New("from must be before to")
+	}
+	if to.Sub(from) > maxUptimePeriod {
+		return nil, errors.New("period cannot exceed 93 days")
+	}
+
+	// Resolve the agents so those without any event still show up
+	agents, err := s.repo.ListByAgentIDs(ctx, companyId, agentIds)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(agents))
+	for _, a := range agents {
+		ids = append(ids, a.AgentID)
+	}
+	if len(ids) == 0 {
+		return []model.AgentUptime{}, nil
+	}
+
+	events, err := s.repo.StatusEventsForPeriod(ctx, companyId, ids, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	byAgent := make(map[string][]model.AgentStatusEvent, len(ids))
+	for _, e := range events {
+		byAgent[e.AgentID] = append(byAgent[e.AgentID], e)
+	}
+
+	result := make([]model.AgentUptime, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, computeUptime(id, byAgent[id], from, to))
+	}
+	return result, nil
+}
+
+// computeUptime replays chronologically ordered events over [from, to).
+// Events before from only set the starting status.
+func computeUptime(agentId string, events []model.AgentStatusEvent, from, to time.Time) model.AgentUptime {
+	const unknown = "unknown"
+
+	uptime := model.AgentUptime{
+		AgentID:       agentId,
+		From:          from,
+		To:            to,
+		StatusSeconds: make(map[string]int64),
+	}
+
+	status := unknown
+	cursor := from
+	for _, e := range events {
+		if e.OccurredAt.Before(from) {
+			status = e.Status
+			continue
+		}
+		uptime.StatusSeconds[status] += int64(e.OccurredAt.Sub(cursor).Seconds())
+		if e.Status != status && status != unknown {
+			uptime.Transitions++
+		}
+		status = e.Status
+		cursor = e.OccurredAt
+	}
+	uptime.StatusSeconds[status] += int64(to.Sub(cursor).Seconds())
+
+	known := int64(to.Sub(from).Seconds()) - uptime.StatusSeconds[unknown]
+	if known > 0 {
+		percent := float64(uptime.StatusSeconds[model.AgentStatusConnected]) * 100 / float64(known)
+		uptime.UptimePercent = math.Round(percent*100) / 100
+	}
+	if uptime.StatusSeconds[unknown] == 0 {
+		delete(uptime.StatusSeconds, unknown)
 	}
-	return s.repo.Delete(ctx, companyId, id)
+	return uptime
 }
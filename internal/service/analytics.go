@@ -0,0 +1,524 @@
+// internal/service/analytics.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+)
+
+// AnalyticsService computes reporting figures for a tenant
+type AnalyticsService interface {
+	// AgentStats returns per-agent statistics over [from, to); no agentIds means every agent
+	AgentStats(ctx context.Context, companyId string, agentIds []string, from, to time.Time) ([]model.AgentStats, error)
+	// MessageVolume returns message counts bucketed by hour, day or week over [from, to),
+	// grouped by any of agent_id, flow and message_type
+	MessageVolume(ctx context.Context, companyId string, filter map[string]interface{}, bucket string, groupBy []string, from, to time.Time) (*model.MessageVolume, error)
+	// ResponseTimes returns reply delays over [from, to) grouped by agent_id or assigned_to
+	ResponseTimes(ctx context.Context, companyId string, filter map[string]interface{}, groupBy string, from, to time.Time) ([]model.ResponseTimeStats, error)
+	// SLABreaches lists chats waiting for a reply longer than threshold (0 uses the configured SLA)
+	SLABreaches(ctx context.Context, companyId string, filter map[string]interface{}, threshold time.Duration, lookbackDays, limit, offset int) (*model.SLABreachPage, error)
+	// ContactFunnel returns new contacts per day, week or month over [from, to),
+	// grouped by any of origin, tag, status and agent_id
+	ContactFunnel(ctx context.Context, companyId string, filter map[string]interface{}, bucket string, groupBy []string, from, to time.Time) (*model.ContactFunnel, error)
+	// RefreshStatsViews refreshes the tenant's materialized statistics views
+	RefreshStatsViews(ctx context.Context, companyId string) error
+}
+
+// maxAnalyticsPeriod bounds reporting queries to a year of partitions
+const maxAnalyticsPeriod = 366 * 24 * time.Hour
+
+// maxHourlyPeriod keeps hourly series to a readable number of points
+const maxHourlyPeriod = 31 * 24 * time.Hour
+
+// volumeGroupColumns are the columns message volume may be grouped by
+var volumeGroupColumns = map[string]bool{
+	"agent_id":     true,
+	"flow":         true,
+	"message_type": true,
+}
+
+// funnelGroupColumns are the columns the contact funnel may be grouped by
+var funnelGroupColumns = map[string]bool{
+	"origin":   true,
+	"tag":      true,
+	"status":   true,
+	"agent_id": true,
+}
+
+// SLA breach lookup bounds
+const (
+	defaultSLALookbackDays = 7
+	maxSLALookbackDays     = 31
+)
+
+// NewAnalyticsService constructs an AnalyticsService. Results are cached per tenant
+// for cacheTTL (0 disables caching); with useViews, daily counts are read from the
+// materialized views once they have been refreshed. slaThreshold is the default
+// reply delay after which a waiting chat breaches the SLA.
+func NewAnalyticsService(
+	repo repository.AnalyticsRepository,
+	cacheTTL time.Duration,
+	useViews bool,
+	slaThreshold time.Duration,
+) AnalyticsService {
+	return &analyticsService{
+		repo:         repo,
+		cache:        newResultCache(cache.TagAnalytics, cacheTTL),
+		useViews:     useViews,
+		slaThreshold: slaThreshold,
+	}
+}
+
+type analyticsService struct {
+	repo         repository.AnalyticsRepository
+	cache        *resultCache
+	useViews     bool
+	slaThreshold time.Duration
+}
+
+// analyticsDay is the precision of daily analytics periods
+const analyticsDay = 24 * time.Hour
+
+// analyticsPeriod normalizes [from, to) to whole UTC units (days, or hours for
+// hourly series). Defaults to the last 30 days including today.
+func analyticsPeriod(from, to time.Time, unit time.Duration) (time.Time, time.Time, error) {
+	today := time.Now().UTC().Truncate(analyticsDay)
+	if to.IsZero() {
+		to = today.AddDate(0, 0, 1)
+	}
+	to = to.UTC().Truncate(unit)
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -30)
+	}
+	from = from.UTC().Truncate(unit)
+
+	if !from.Before(to) {
+		return from, to, errors.New("from must be before to")
+	}
+	if to.Sub(from) > maxAnalyticsPeriod {
+		return from, to, errors.New("period cannot exceed 366 days")
+	}
+	return from, to, nil
+}
+
+func (s *analyticsService) AgentStats(
+	ctx context.Context,
+	companyId string,
+	agentIds []string,
+	from, to time.Time,
+) ([]model.AgentStats, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	from, to, err := analyticsPeriod(from, to, analyticsDay)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := append([]string(nil), agentIds...)
+	sort.Strings(ids)
+	key := fmt.Sprintf("agent-stats:%s:%s:%s", strings.Join(ids, ","), from.Format(time.DateOnly), to.Format(time.DateOnly))
+	var cached []model.AgentStats
+	generation, ok := s.cache.Get(ctx, companyId, key, &cached)
+	if ok {
+		return cached, nil
+	}
+
+	counts, err := s.repo.AgentChatCounts(ctx, companyId, agentIds)
+	if err != nil {
+		return nil, err
+	}
+
+	materialized := s.useViews && s.repo.StatsViewsReady(companyId)
+	daily, err := s.repo.AgentDailyCounts(ctx, companyId, agentIds, from, to, materialized)
+	if err != nil {
+		return nil, err
+	}
+
+	responses, err := s.repo.FirstResponseTimes(ctx, companyId, agentIds, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	source := "live"
+	if materialized {
+		source = "materialized"
+	}
+
+	byAgent := make(map[string]*model.AgentStats)
+	statsFor := func(agentId string) *model.AgentStats {
+		if st, ok := byAgent[agentId]; ok {
+			return st
+		}
+		st := &model.AgentStats{
+			AgentID: agentId,
+			From:    from,
+			To:      to,
+			Daily:   make([]model.DailyMessageCount, 0),
+			Source:  source,
+		}
+		byAgent[agentId] = st
+		return st
+	}
+
+	// Requested agents show up even without any data
+	for _, id := range agentIds {
+		statsFor(id)
+	}
+	for _, c := range counts {
+		st := statsFor(c.AgentID)
+		st.TotalChats = c.TotalChats
+		st.UnreadChats = c.UnreadChats
+		st.Contacts = c.Contacts
+	}
+	for _, d := range daily {
+		st := statsFor(d.AgentID)
+		st.MessagesIn += d.Inbound
+		st.MessagesOut += d.Outbound
+		st.Daily = append(st.Daily, model.DailyMessageCount{
+			Date:     d.MessageDate.Format(time.DateOnly),
+			Inbound:  d.Inbound,
+			Outbound: d.Outbound,
+		})
+	}
+	for _, r := range responses {
+		st := statsFor(r.AgentID)
+		st.FirstResponse = r.ResponseTimeSummary
+		st.FirstResponse.AvgSeconds = math.Round(r.AvgSeconds*100) / 100
+		st.FirstResponse.MedianSeconds = math.Round(r.MedianSeconds*100) / 100
+	}
+
+	result := make([]model.AgentStats, 0, len(byAgent))
+	for _, st := range byAgent {
+		result = append(result, *st)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].AgentID < result[j].AgentID })
+
+	s.cache.Set(ctx, companyId, key, generation, result)
+	return result, nil
+}
+
+func (s *analyticsService) MessageVolume(
+	ctx context.Context,
+	companyId string,
+	filter map[string]interface{},
+	bucket string,
+	groupBy []string,
+	from, to time.Time,
+) (*model.MessageVolume, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+
+	if bucket == "" {
+		bucket = "day"
+	}
+	if bucket != "hour" && bucket != "day" && bucket != "week" {
+		return nil, errors.New("bucket must be one of hour, day, week")
+	}
+
+	unit := analyticsDay
+	if bucket == "hour" {
+		unit = time.Hour
+	}
+	from, to, err := analyticsPeriod(from, to, unit)
+	if err != nil {
+		return nil, err
+	}
+	if bucket == "hour" && to.Sub(from) > maxHourlyPeriod {
+		return nil, errors.New("hourly buckets cannot span more than 31 days")
+	}
+
+	groups, err := validGroups(groupBy, volumeGroupColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate filter values
+	validatedFilter := make(map[string]interface{})
+	keyParts := []string{bucket, strings.Join(groups, ","), from.Format(time.RFC3339), to.Format(time.RFC3339)}
+	for _, key := range []string{"agent_ids", "flow", "message_type"} {
+		switch value := filter[key].(type) {
+		case []string:
+			if len(value) > 0 {
+				ids := append([]string(nil), value...)
+				sort.Strings(ids)
+				validatedFilter[key] = ids
+				keyParts = append(keyParts, key+"="+strings.Join(ids, ","))
+			}
+		case string:
+			if value != "" {
+				validatedFilter[key] = value
+				keyParts = append(keyParts, key+"="+value)
+			}
+		}
+	}
+
+	key := "message-volume:" + strings.Join(keyParts, ":")
+	var cached model.MessageVolume
+	generation, ok := s.cache.Get(ctx, companyId, key, &cached)
+	if ok {
+		return &cached, nil
+	}
+
+	points, err := s.repo.MessageVolume(ctx, companyId, validatedFilter, bucket, groups, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if points == nil {
+		points = make([]model.MessageVolumePoint, 0)
+	}
+
+	volume := &model.MessageVolume{
+		Bucket:  bucket,
+		From:    from,
+		To:      to,
+		GroupBy: groups,
+		Points:  points,
+	}
+	s.cache.Set(ctx, companyId, key, generation, volume)
+	return volume, nil
+}
+
+func (s *analyticsService) ResponseTimes(
+	ctx context.Context,
+	companyId string,
+	filter map[string]interface{},
+	groupBy string,
+	from, to time.Time,
+) ([]model.ResponseTimeStats, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	if groupBy == "" {
+		groupBy = "agent_id"
+	}
+	if groupBy != "agent_id" && groupBy != "assigned_to" {
+		return nil, errors.New("group_by must be agent_id or assigned_to")
+	}
+	from, to, err := analyticsPeriod(from, to, analyticsDay)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate filter values
+	validatedFilter := make(map[string]interface{})
+	var agentIds []string
+	if ids, ok := filter["agent_ids"].([]string); ok && len(ids) > 0 {
+		agentIds = append(agentIds, ids...)
+		sort.Strings(agentIds)
+		validatedFilter["agent_ids"] = agentIds
+	}
+
+	key := fmt.Sprintf("response-times:%s:%s:%s:%s",
+		groupBy, strings.Join(agentIds, ","), from.Format(time.DateOnly), to.Format(time.DateOnly))
+	var cached []model.ResponseTimeStats
+	generation, ok := s.cache.Get(ctx, companyId, key, &cached)
+	if ok {
+		return cached, nil
+	}
+
+	rows, err := s.repo.ResponseTimes(ctx, companyId, validatedFilter, groupBy, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]model.ResponseTimeStats, 0, len(rows))
+	for _, row := range rows {
+		stats := model.ResponseTimeStats{
+			From:  from,
+			To:    to,
+			Chats: row.Chats,
+			FirstResponse: model.ResponseTimeSummary{
+				Responded:     row.FirstResponded,
+				Pending:       row.FirstPending,
+				AvgSeconds:    math.Round(row.FirstAvgSeconds*100) / 100,
+				MedianSeconds: math.Round(row.FirstMedianSeconds*100) / 100,
+			},
+			Response: model.ResponseTimeSummary{
+				Responded:     row.Responded,
+				Pending:       row.Pending,
+				AvgSeconds:    math.Round(row.AvgSeconds*100) / 100,
+				MedianSeconds: math.Round(row.MedianSeconds*100) / 100,
+			},
+		}
+		if groupBy == "assigned_to" {
+			assignedTo := row.GroupKey
+			stats.AssignedTo = &assignedTo
+		} else {
+			stats.AgentID = row.GroupKey
+		}
+		result = append(result, stats)
+	}
+
+	s.cache.Set(ctx, companyId, key, generation, result)
+	return result, nil
+}
+
+func (s *analyticsService) SLABreaches(
+	ctx context.Context,
+	companyId string,
+	filter map[string]interface{},
+	threshold time.Duration,
+	lookbackDays, limit, offset int,
+) (*model.SLABreachPage, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	if threshold == 0 {
+		threshold = s.slaThreshold
+	}
+	if threshold <= 0 {
+		return nil, errors.New("threshold must be positive")
+	}
+	if lookbackDays <= 0 {
+		lookbackDays = defaultSLALookbackDays
+	} else if lookbackDays > maxSLALookbackDays {
+		return nil, fmt.Errorf("lookback_days cannot exceed %d", maxSLALookbackDays)
+	}
+
+	// Apply default pagination
+	if limit <= 0 {
+		limit = 20
+	} else if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	// Validate filter values
+	validatedFilter := make(map[string]interface{})
+	for key, value := range filter {
+		switch key {
+		case "agent_ids":
+			if ids, ok := value.([]string); ok && len(ids) > 0 {
+				validatedFilter[key] = ids
+			}
+		case "assigned_to":
+			if str, ok := value.(string); ok {
+				validatedFilter[key] = str
+			}
+		}
+	}
+
+	// Breaches reflect the current state, so they are never cached
+	now := time.Now()
+	since := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -lookbackDays)
+	page, err := s.repo.SLABreaches(ctx, companyId, validatedFilter, now.Add(-threshold).Unix(), since, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range page.Items {
+		item := &page.Items[i]
+		item.WaitingSince = time.Unix(item.WaitingAt, 0).UTC()
+		item.WaitingSeconds = now.Unix() - item.WaitingAt
+	}
+	return page, nil
+}
+
+func (s *analyticsService) ContactFunnel(
+	ctx context.Context,
+	companyId string,
+	filter map[string]interface{},
+	bucket string,
+	groupBy []string,
+	from, to time.Time,
+) (*model.ContactFunnel, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+
+	if bucket == "" {
+		bucket = "day"
+	}
+	if bucket != "day" && bucket != "week" && bucket != "month" {
+		return nil, errors.New("bucket must be one of day, week, month")
+	}
+
+	from, to, err := analyticsPeriod(from, to, analyticsDay)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := validGroups(groupBy, funnelGroupColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate filter values
+	validatedFilter := make(map[string]interface{})
+	keyParts := []string{bucket, strings.Join(groups, ","), from.Format(time.DateOnly), to.Format(time.DateOnly)}
+	if ids, ok := filter["agent_ids"].([]string); ok && len(ids) > 0 {
+		ids = append([]string(nil), ids...)
+		sort.Strings(ids)
+		validatedFilter["agent_ids"] = ids
+		keyParts = append(keyParts, "agent_ids="+strings.Join(ids, ","))
+	}
+	if origin, ok := filter["origin"].(string); ok {
+		validatedFilter["origin"] = origin
+		keyParts = append(keyParts, "origin="+origin)
+	}
+
+	key := "contact-funnel:" + strings.Join(keyParts, ":")
+	var cached model.ContactFunnel
+	generation, ok := s.cache.Get(ctx, companyId, key, &cached)
+	if ok {
+		return &cached, nil
+	}
+
+	points, err := s.repo.ContactFunnel(ctx, companyId, validatedFilter, bucket, groups, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if points == nil {
+		points = make([]model.ContactFunnelPoint, 0)
+	}
+
+	funnel := &model.ContactFunnel{
+		Bucket:  bucket,
+		From:    from,
+		To:      to,
+		GroupBy: groups,
+		Points:  points,
+	}
+	s.cache.Set(ctx, companyId, key, generation, funnel)
+	return funnel, nil
+}
+
+// validGroups checks the requested groupings against allowed, dropping blanks and
+// repeats and sorting them so equal requests share a cache key.
+func validGroups(groupBy []string, allowed map[string]bool) ([]string, error) {
+	seen := make(map[string]bool)
+	groups := make([]string, 0, len(groupBy))
+	for _, g := range groupBy {
+		g = strings.TrimSpace(g)
+		if g == "" || seen[g] {
+			continue
+		}
+		if !allowed[g] {
+			return nil, fmt.Errorf("cannot group by %s", g)
+		}
+		seen[g] = true
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+func (s *analyticsService) RefreshStatsViews(ctx context.Context, companyId string) error {
+	if companyId == "" {
+		return errors.New("companyId is required")
+	}
+	return s.repo.RefreshStatsViews(ctx, companyId)
+}
@@ -0,0 +1,574 @@
+// internal/service/archive.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/archive"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/payload"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/storage"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/phone"
+)
+
+// ArchiveService moves old message partitions to compressed files and reads them back
+type ArchiveService interface {
+	// Archive starts archiving the partition holding month ("2024-01") in the background
+	Archive(ctx context.Context, companyId, month string) (*model.MessageArchive, error)
+	// ArchiveOlderThan archives, one after the other, every partition that ended
+	// at least months whole months ago. Returns how many were archived.
+	ArchiveOlderThan(ctx context.Context, companyId string, months int) (int, error)
+	Get(ctx context.Context, companyId string, id int64) (*model.MessageArchive, error)
+	// List returns the tenant's archives, newest period first
+	List(ctx context.Context, companyId string, limit, offset int) (*model.MessageArchivePage, error)
+
+	// CountChat counts a chat's archived messages; filter supports is_deleted (bool)
+	// and from_phone / to_phone (string, any format)
+	CountChat(ctx context.Context, companyId, agentId, chatId string, filter map[string]interface{}) (int64, error)
+	// FetchChat returns a page of a chat's archived messages ordered by message_timestamp
+	FetchChat(ctx context.Context, companyId, agentId, chatId string, filter map[string]interface{}, desc bool, limit, offset int) ([]model.Message, error)
+	// StreamChats passes the archived messages of chats to fn; an empty agentId matches every agent
+	StreamChats(ctx context.Context, companyId, agentId string, chatIds []string, fn func(*model.Message) error) error
+	// RewriteChats rewrites the archives holding chats after fn modified their messages.
+	// Returns how many messages were passed to fn.
+	RewriteChats(ctx context.Context, companyId, agentId string, chatIds []string, fn func(*model.Message) error) (int64, error)
+
+	// Expired returns the archives whose period ended before the given day
+	Expired(ctx context.Context, companyId string, before time.Time) ([]model.MessageArchive, error)
+	// Remove deletes an archive's file and catalog entry
+	Remove(ctx context.Context, companyId string, a *model.MessageArchive) error
+}
+
+var (
+	// ErrInvalidArchive is returned for invalid archive requests
+	ErrInvalidArchive = errors.New("invalid archive request")
+	// ErrPartitionNotFound is returned when no messages partition holds the month
+	ErrPartitionNotFound = errors.New("no messages partition holds this month")
+	// ErrArchiveExists is returned when the partition is archived or being archived
+	ErrArchiveExists = errors.New("partition is already archived or being archived")
+	// ErrArchiveNotFound is returned for unknown archives
+	ErrArchiveNotFound = errors.New("archive not found")
+)
+
+const (
+	// archiveStaleAfter is how long archiving may go without progress before
+	// another attempt takes it over
+	archiveStaleAfter = 5 * time.Minute
+	// archiveHeartbeatRows is how many messages are archived between progress updates
+	archiveHeartbeatRows = 10000
+)
+
+// NewArchiveService constructs an ArchiveService writing archives to store
+func NewArchiveService(repo repository.ArchiveRepository, store storage.Store) ArchiveService {
+	return &archiveService{repo: repo, store: store}
+}
+
+type archiveService struct {
+	repo  repository.ArchiveRepository
+	store storage.Store
+}
+
+// monthStart returns the first day of t's month, in UTC
+func monthStart(t time.Time) time.Time {
+	y, m, _ := t.UTC().Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (s *archiveService) Archive(ctx context.Context, companyId, month string) (*model.MessageArchive, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	start, err := time.Parse("2006-01", month)
+	if err != nil {
+		return nil, fmt.Errorf("%w: month must be formatted as YYYY-MM", ErrInvalidArchive)
+	}
+
+	partitions, err := s.repo.MessagePartitions(ctx, companyId)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range partitions {
+		if p.From.After(start) || !p.To.After(start) {
+			continue
+		}
+		if p.To.After(monthStart(time.Now())) {
+			return nil, fmt.Errorf("%w: partition %s still receives messages", ErrInvalidArchive, p.Name)
+		}
+		a, claimed, err := s.begin(ctx, companyId, p)
+		if err != nil {
+			return nil, err
+		}
+		if !claimed {
+			return a, ErrArchiveExists
+		}
+		// The request returns right away; archiving outlives it
+		go s.run(context.Background(), companyId, p, a)
+		return a, nil
+	}
+	return nil, ErrPartitionNotFound
+}
+
+func (s *archiveService) ArchiveOlderThan(ctx context.Context, companyId string, months int) (int, error) {
+	if months <= 0 {
+		return 0, nil
+	}
+	partitions, err := s.repo.MessagePartitions(ctx, companyId)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := monthStart(time.Now()).AddDate(0, -months, 0)
+	archived := 0
+	for _, p := range partitions {
+		if p.To.After(cutoff) {
+			continue
+		}
+		a, claimed, err := s.begin(ctx, companyId, p)
+		if err != nil {
+			return archived, err
+		}
+		if !claimed {
+			continue
+		}
+		if err := s.run(ctx, companyId, p, a); err != nil {
+			return archived, fmt.Errorf("failed to archive partition %s: %w", p.Name, err)
+		}
+		archived++
+	}
+	return archived, nil
+}
+
+func (s *archiveService) begin(ctx context.Context, companyId string, p model.MessagePartition) (*model.MessageArchive, bool, error) {
+	a := &model.MessageArchive{
+		Partition: p.Name,
+		From:      p.From,
+		To:        p.To,
+		Format:    archive.Format,
+		FileKey:   path.Join(companyId, "archive", "messages", p.Name+"."+archive.Format),
+	}
+	claimed, err := s.repo.Begin(ctx, companyId, a, time.Now().Add(-archiveStaleAfter))
+	return a, claimed, err
+}
+
+// run exports the partition, checks the stored file holds every row, indexes its
+// chats and drops the partition. The partition stays attached whenever a step
+// fails, so nothing is lost and archiving can be retried.
+func (s *archiveService) run(ctx context.Context, companyId string, p model.MessagePartition, a *model.MessageArchive) error {
+	fail := func(err error) error {
+		a.Status = model.ArchiveStatusFailed
+		a.Error = err.Error()
+		_ = s.repo.Update(context.WithoutCancel(ctx), companyId, a)
+		return err
+	}
+
+	var chats []model.MessageArchiveChat
+	index := func(m *model.Message) {
+		if !hasKey(m) {
+			return // never returned by message reads
+		}
+		n := len(chats)
+		if n == 0 || chats[n-1].ChatID != m.ChatID || chats[n-1].AgentID != m.AgentID {
+			chats = append(chats, model.MessageArchiveChat{ArchiveID: a.ID, AgentID: m.AgentID, ChatID: m.ChatID})
+			n++
+		}
+		chats[n-1].Rows++
+		if m.IsDeleted {
+			chats[n-1].DeletedRows++
+		}
+	}
+
+	// Rows are encoded into a pipe that the store consumes, so partitions of any size stream through
+	pr, pw := io.Pipe()
+	var written int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w := archive.NewWriter(pw)
+		err := s.repo.StreamPartition(ctx, companyId, p.Name, func(m *model.Message) error {
+			if err := w.Write(m); err != nil {
+				return err
+			}
+			index(m)
+			if w.Rows()%archiveHeartbeatRows == 0 {
+				a.Rows = w.Rows()
+				return s.repo.Update(ctx, companyId, a)
+			}
+			return nil
+		})
+		if err == nil {
+			err = w.Close()
+		}
+		written = w.Rows()
+		pw.CloseWithError(err)
+	}()
+	err := s.store.Put(ctx, a.FileKey, pr, archive.ContentType)
+	pr.CloseWithError(err)
+	<-done
+	if err != nil {
+		return fail(err)
+	}
+
+	// Read the stored file back: it must hold every row before the partition goes
+	stored, err := s.countArchived(ctx, a.FileKey)
+	if err != nil {
+		return fail(fmt.Errorf("failed to verify archive: %w", err))
+	}
+	if stored != written {
+		return fail(fmt.Errorf("archive holds %d messages, %d were written", stored, written))
+	}
+	a.Rows = written
+	if info, err := s.store.Stat(ctx, a.FileKey); err == nil {
+		a.FileSize = info.Size
+	}
+
+	if err := s.repo.SaveChats(ctx, companyId, a.ID, chats); err != nil {
+		return fail(fmt.Errorf("failed to index archive: %w", err))
+	}
+	dropped, err := s.repo.DropPartition(ctx, companyId, p.Name, written)
+	if err != nil {
+		return fail(fmt.Errorf("failed to drop partition: %w", err))
+	}
+	if !dropped {
+		return fail(errors.New("partition changed while it was archived"))
+	}
+
+	a.Status = model.ArchiveStatusArchived
+	a.Error = ""
+	now := time.Now()
+	a.ArchivedAt = &now
+	return s.repo.Update(context.WithoutCancel(ctx), companyId, a)
+}
+
+func (s *archiveService) countArchived(ctx context.Context, key string) (int64, error) {
+	body, _, err := s.store.Open(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	return archive.Read(body, func(*model.Message) (bool, error) { return true, nil })
+}
+
+func (s *archiveService) Get(ctx context.Context, companyId string, id int64) (*model.MessageArchive, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	a, err := s.repo.Get(ctx, companyId, id)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, ErrArchiveNotFound
+	}
+	return a, nil
+}
+
+func (s *archiveService) List(ctx context.Context, companyId string, limit, offset int) (*model.MessageArchivePage, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	if limit <= 0 {
+		limit = 20
+	} else if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.List(ctx, companyId, limit, offset)
+}
+
+// hasKey reports whether a message has a key; reads skip messages without one
+func hasKey(m *model.Message) bool {
+	return len(m.Key) > 0 && string(m.Key) != "null"
+}
+
+// matchesFilter applies the is_deleted, reactions and phone filters of message reads;
+// phones are compared normalized, like the stored messages are filtered
+func matchesFilter(companyId string, m *model.Message, filter map[string]interface{}) bool {
+	if deleted, ok := filter["is_deleted"].(bool); ok && m.IsDeleted != deleted {
+		return false
+	}
+	if reactions, ok := filter["reactions"].(bool); ok && !reactions {
+		if r := payload.Reaction(m.MessageObj); r != nil && r.TargetID != "" {
+			return false
+		}
+	}
+	region := phone.RegionFor(companyId)
+	for column, value := range map[string]string{"from_phone": m.FromPhone, "to_phone": m.ToPhone} {
+		if raw, ok := filter[column].(string); ok && raw != "" && phone.Normalize(value, region) != phone.Normalize(raw, region) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexedRows counts the messages of an index entry matching the is_deleted filter.
+// The index counts neither phones nor reactions: with a phone or reactions filter
+// ok is false and the archive has to be read.
+func indexedRows(c model.MessageArchiveChat, filter map[string]interface{}) (n int64, ok bool) {
+	for _, column := range []string{"from_phone", "to_phone"} {
+		if raw, _ := filter[column].(string); raw != "" {
+			return 0, false
+		}
+	}
+	if _, set := filter["reactions"]; set {
+		return 0, false
+	}
+	deleted, ok := filter["is_deleted"].(bool)
+	switch {
+	case !ok:
+		return c.Rows, true
+	case deleted:
+		return c.DeletedRows, true
+	default:
+		return c.Rows - c.DeletedRows, true
+	}
+}
+
+func (s *archiveService) CountChat(ctx context.Context, companyId, agentId, chatId string, filter map[string]interface{}) (int64, error) {
+	entries, err := s.repo.FindChats(ctx, companyId, agentId, []string{chatId})
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, e := range entries {
+		if n, ok := indexedRows(e, filter); ok {
+			total += n
+			continue
+		}
+		err := s.read(ctx, e.FileKey, func(m *model.Message) (bool, error) {
+			if m.ChatID > chatId || (m.ChatID == chatId && m.AgentID > agentId) {
+				return false, nil
+			}
+			if m.ChatID == chatId && m.AgentID == agentId && hasKey(m) && matchesFilter(companyId, m, filter) {
+				total++
+			}
+			return true, nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// FetchChat skips whole archives using the chat index and only opens those
+// holding the requested page. Archives are ordered by chat, so reading stops
+// once past the chat.
+func (s *archiveService) FetchChat(
+	ctx context.Context,
+	companyId, agentId, chatId string,
+	filter map[string]interface{},
+	desc bool,
+	limit, offset int,
+) ([]model.Message, error) {
+	entries, err := s.repo.FindChats(ctx, companyId, agentId, []string{chatId})
+	if err != nil {
+		return nil, err
+	}
+	if desc {
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].From.After(entries[j].From) })
+	}
+
+	items := make([]model.Message, 0, limit)
+	skip := int64(offset)
+	for _, e := range entries {
+		if len(items) >= limit {
+			break
+		}
+		if n, ok := indexedRows(e, filter); ok && skip >= n {
+			skip -= n
+			continue
+		}
+
+		var chat []model.Message
+		err := s.read(ctx, e.FileKey, func(m *model.Message) (bool, error) {
+			if m.ChatID > chatId || (m.ChatID == chatId && m.AgentID > agentId) {
+				return false, nil
+			}
+			if m.ChatID == chatId && m.AgentID == agentId && hasKey(m) && matchesFilter(companyId, m, filter) {
+				chat = append(chat, *m)
+			}
+			return true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(chat, func(i, j int) bool {
+			a, b := chat[i], chat[j]
+			if a.MessageTimestamp != b.MessageTimestamp {
+				return (a.MessageTimestamp < b.MessageTimestamp) != desc
+			}
+			return (a.ID < b.ID) != desc
+		})
+
+		if skip >= int64(len(chat)) {
+			skip -= int64(len(chat))
+			continue
+		}
+		chat = chat[skip:]
+		skip = 0
+		if room := limit - len(items); len(chat) > room {
+			chat = chat[:room]
+		}
+		items = append(items, chat...)
+	}
+	return items, nil
+}
+
+func (s *archiveService) read(ctx context.Context, key string, fn func(*model.Message) (bool, error)) error {
+	body, _, err := s.store.Open(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to open archive %s: %w", key, err)
+	}
+	defer body.Close()
+	if _, err := archive.Read(body, fn); err != nil {
+		return fmt.Errorf("failed to read archive %s: %w", key, err)
+	}
+	return nil
+}
+
+// chatArchives groups the index entries of chats by archive
+func (s *archiveService) chatArchives(ctx context.Context, companyId, agentId string, chatIds []string) ([]model.MessageArchiveChat, map[string]struct{}, error) {
+	entries, err := s.repo.FindChats(ctx, companyId, agentId, chatIds)
+	if err != nil {
+		return nil, nil, err
+	}
+	var files []model.MessageArchiveChat
+	seen := make(map[int64]struct{})
+	for _, e := range entries {
+		if _, ok := seen[e.ArchiveID]; !ok {
+			seen[e.ArchiveID] = struct{}{}
+			files = append(files, e)
+		}
+	}
+	wanted := make(map[string]struct{}, len(chatIds))
+	for _, id := range chatIds {
+		wanted[id] = struct{}{}
+	}
+	return files, wanted, nil
+}
+
+func (s *archiveService) StreamChats(ctx context.Context, companyId, agentId string, chatIds []string, fn func(*model.Message) error) error {
+	files, wanted, err := s.chatArchives(ctx, companyId, agentId, chatIds)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		err := s.read(ctx, f.FileKey, func(m *model.Message) (bool, error) {
+			if _, ok := wanted[m.ChatID]; ok && (agentId == "" || m.AgentID == agentId) {
+				return true, fn(m)
+			}
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RewriteChats replaces each archive with a copy holding the modified messages.
+// The copy must hold as many messages as the original before it replaces it.
+func (s *archiveService) RewriteChats(ctx context.Context, companyId, agentId string, chatIds []string, fn func(*model.Message) error) (int64, error) {
+	files, wanted, err := s.chatArchives(ctx, companyId, agentId, chatIds)
+	if err != nil {
+		return 0, err
+	}
+
+	var changed int64
+	for _, f := range files {
+		a, err := s.repo.Get(ctx, companyId, f.ArchiveID)
+		if err != nil {
+			return changed, err
+		}
+		if a == nil {
+			continue
+		}
+
+		tmpKey := a.FileKey + ".rewrite"
+		pr, pw := io.Pipe()
+		var n int64
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			w := archive.NewWriter(pw)
+			err := s.read(ctx, a.FileKey, func(m *model.Message) (bool, error) {
+				if _, ok := wanted[m.ChatID]; ok && (agentId == "" || m.AgentID == agentId) {
+					if err := fn(m); err != nil {
+						return false, err
+					}
+					n++
+				}
+				return true, w.Write(m)
+			})
+			if err == nil {
+				err = w.Close()
+			}
+			if err == nil && w.Rows() != a.Rows {
+				err = fmt.Errorf("rewritten archive holds %d messages instead of %d", w.Rows(), a.Rows)
+			}
+			pw.CloseWithError(err)
+		}()
+		err = s.store.Put(ctx, tmpKey, pr, archive.ContentType)
+		pr.CloseWithError(err)
+		<-done
+		if err != nil {
+			_ = s.store.Delete(ctx, tmpKey)
+			return changed, err
+		}
+
+		if err := s.replace(ctx, tmpKey, a.FileKey); err != nil {
+			return changed, err
+		}
+		changed += n
+		if info, err := s.store.Stat(ctx, a.FileKey); err == nil {
+			a.FileSize = info.Size
+		}
+		if err := s.repo.Update(ctx, companyId, a); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// replace moves the object at src to dst
+func (s *archiveService) replace(ctx context.Context, src, dst string) error {
+	body, info, err := s.store.Open(ctx, src)
+	if err != nil {
+		return err
+	}
+	err = s.store.Put(ctx, dst, body, info.ContentType)
+	body.Close()
+	if err != nil {
+		return err
+	}
+	return s.store.Delete(ctx, src)
+}
+
+func (s *archiveService) Expired(ctx context.Context, companyId string, before time.Time) ([]model.MessageArchive, error) {
+	archives, err := s.repo.ListArchived(ctx, companyId)
+	if err != nil {
+		return nil, err
+	}
+	var expired []model.MessageArchive
+	for _, a := range archives {
+		if !a.To.After(before) {
+			expired = append(expired, a)
+		}
+	}
+	return expired, nil
+}
+
+func (s *archiveService) Remove(ctx context.Context, companyId string, a *model.MessageArchive) error {
+	if err := s.store.Delete(ctx, a.FileKey); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, companyId, a.ID)
+}
@@ -0,0 +1,80 @@
+// internal/service/audit.go
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+)
+
+// AuditService records and lists mutating API calls
+type AuditService interface {
+	// Record persists a single audit entry for the tenant
+	Record(ctx context.Context, companyId string, entry *model.AuditLog) error
+	// FetchAuditLogs returns a paginated, newest-first page of audit entries
+	FetchAuditLogs(ctx context.Context, companyId string, filter map[string]interface{}, limit, offset int) (*model.AuditPage, error)
+}
+
+// NewAuditService constructs an AuditService backed by the given repository
+func NewAuditService(repo repository.AuditRepository) AuditService {
+	return &auditService{repo: repo}
+}
+
+type auditService struct {
+	repo repository.AuditRepository
+}
+
+func (s *auditService) Record(ctx context.Context, companyId string, entry *model.AuditLog) error {
+	if companyId == "" {
+		return errors.New("companyId is required")
+	}
+	if entry.Method == "" {
+		return errors.New("method is required")
+	}
+
+	// enforce tenant
+	entry.CompanyID = companyId
+	return s.repo.Create(ctx, companyId, entry)
+}
+
+func (s *auditService) FetchAuditLogs(
+	ctx context.Context,
+	companyId string,
+	filter map[string]interface{},
+	limit, offset int,
+) (*model.AuditPage, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+
+	// Apply default pagination
+	if limit <= 0 {
+		limit = 20
+	} else if limit > 100 {
+		limit = 100
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+
+	// Validate filter values
+	validatedFilter := make(map[string]interface{})
+	for key, value := range filter {
+		switch key {
+		case "entity_type", "entity_id", "actor", "method", "request_id":
+			if strVal, ok := value.(string); ok && strVal != "" {
+				validatedFilter[key] = strVal
+			}
+		case "from", "to":
+			if timeVal, ok := value.(time.Time); ok && !timeVal.IsZero() {
+				validatedFilter[key] = timeVal
+			}
+		}
+	}
+
+	return s.repo.FetchAuditLogs(ctx, companyId, validatedFilter, limit, offset)
+}
@@ -0,0 +1,48 @@
+// internal/service/cache.go
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
+)
+
+// resultCache keeps computed results per tenant for a fixed time in the shared cache
+// store (see package cache), encoded as JSON. Entries are tagged with the cache's
+// tag, so the store expires and evicts them like cached responses, and dropping a
+// tenant's whole cache drops them too.
+type resultCache struct {
+	tag string
+	ttl time.Duration
+}
+
+// newResultCache returns a cache keeping entries for ttl under tag; ttl <= 0 disables it.
+func newResultCache(tag string, ttl time.Duration) *resultCache {
+	return &resultCache{tag: tag, ttl: ttl}
+}
+
+// Get decodes the tenant's result under key into dest and reports a hit. On a miss
+// it returns the generation to pass to Set, read before the result is computed.
+func (c *resultCache) Get(ctx context.Context, companyId, key string, dest interface{}) (string, bool) {
+	if c.ttl <= 0 {
+		return "", false
+	}
+	if raw, ok := cache.Get(ctx, companyId, c.tag+":"+key); ok && json.Unmarshal(raw, dest) == nil {
+		return "", true
+	}
+	generation, _ := cache.Generation(ctx, companyId, c.tag)
+	return generation, false
+}
+
+// Set stores the tenant's result under key, unless the cache's tag was invalidated
+// since generation was read or generation is empty.
+func (c *resultCache) Set(ctx context.Context, companyId, key, generation string, value interface{}) {
+	if c.ttl <= 0 || generation == "" {
+		return
+	}
+	if raw, err := json.Marshal(value); err == nil {
+		cache.SetFor(ctx, companyId, c.tag+":"+key, raw, c.ttl, generation, c.tag)
+	}
+}
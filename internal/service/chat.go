@@ -53,7 +53,7 @@ func (s *chatService) FetchChats(
 	validatedFilter := make(map[string]interface{})
 	for key, value := range filter {
 		switch key {
-		case "agent_id", "assigned_to":
+		case "agent_id", "assigned_to", "phone_number":
 			if strVal, ok := value.(string); ok && strVal != "" {
 				validatedFilter[key] = strVal
 			}
@@ -95,7 +95,7 @@ func (s *chatService) FetchRangeChats(
 	validatedFilter := make(map[string]interface{})
 	for key, value := range filter {
 		switch key {
-		case "agent_id", "assigned_to":
+		case "agent_id", "assigned_to", "phone_number":
 			if strVal, ok := value.(string); ok && strVal != "" {
 				validatedFilter[key] = strVal
 			}
@@ -4,6 +4,8 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
@@ -13,10 +15,20 @@ type ContactService interface {
 	FetchContacts(ctx context.Context, companyId string, filter map[string]interface{}, sort, order string, limit, offset int) (*model.ContactPage, error)
 	GetContactByID(ctx context.Context, companyId, id string) (*model.Contact, error)
 	GetContactByPhoneAndAgent(ctx context.Context, companyId, phoneNumber, agentId string) (*model.Contact, error)
-	UpdateContact(ctx context.Context, companyId, id string, in model.ContactUpdateInput) (*model.Contact, error)
+	// UpdateContact applies a partial update; a non-empty ifMatch must match the
+	// contact's current ETag or ErrPreconditionFailed is returned
+	UpdateContact(ctx context.Context, companyId, id string, in model.ContactUpdateInput, ifMatch string) (*model.Contact, error)
 	SearchContacts(ctx context.Context, companyId, query, agentId string) (*model.ContactPage, error)
+	FetchContactHistory(ctx context.Context, companyId, id string, limit, offset int) (*model.ContactHistoryPage, error)
+	GetContactAsOf(ctx context.Context, companyId, id string, asOf time.Time) (*model.Contact, error)
+	FindDuplicateContacts(ctx context.Context, companyId, agentId string, limit, offset int) (*model.ContactDuplicatePage, error)
+	// MergeContacts returns ErrInvalidMerge for requests that cannot be merged
+	MergeContacts(ctx context.Context, companyId string, in model.ContactMergeInput) (*model.Contact, error)
 }
 
+// ErrInvalidMerge is returned for merge requests that cannot be applied
+var ErrInvalidMerge = repository.ErrInvalidMerge
+
 func NewContactService(repo repository.ContactRepository) ContactService {
 	return &contactService{repo: repo}
 }
@@ -90,7 +102,12 @@ func (s *contactService) GetContactByPhoneAndAgent(ctx context.Context, companyI
 	return s.repo.GetContactByPhoneAndAgent(ctx, companyId, phoneNumber, agentId)
 }
 
-func (s *contactService) UpdateContact(ctx context.Context, companyId, id string, in model.ContactUpdateInput) (*model.Contact, error) {
+func (s *contactService) UpdateContact(
+	ctx context.Context,
+	companyId, id string,
+	in model.ContactUpdateInput,
+	ifMatchTag string,
+) (*model.Contact, error) {
 	if companyId == "" || id == "" {
 		return nil, errors.New("companyId and id are required")
 	}
@@ -123,7 +140,7 @@ func (s *contactService) UpdateContact(ctx context.Context, companyId, id string
 		return nil, errors.New("no fields to update")
 	}
 
-	return s.repo.UpdateContact(ctx, companyId, id, updates)
+	return s.repo.UpdateContact(ctx, companyId, id, updates, ifMatch(ifMatchTag, ContactETag))
 }
 
 func (s *contactService) SearchContacts(ctx context.Context, companyId, query, agentId string) (*model.ContactPage, error) {
@@ -148,3 +165,90 @@ func (s *contactService) SearchContacts(ctx context.Context, companyId, query, a
 
 	return s.repo.SearchContacts(ctx, companyId, query, agentId, limit)
 }
+
+func (s *contactService) FetchContactHistory(ctx context.Context, companyId, id string, limit, offset int) (*model.ContactHistoryPage, error) {
+	if companyId == "" || id == "" {
+		return nil, errors.New("companyId and id are required")
+	}
+
+	// Apply default pagination
+	if limit <= 0 {
+		limit = 20
+	} else if limit > 100 {
+		limit = 100
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+
+	return s.repo.FetchContactHistory(ctx, companyId, id, limit, offset)
+}
+
+func (s *contactService) GetContactAsOf(ctx context.Context, companyId, id string, asOf time.Time) (*model.Contact, error) {
+	if companyId == "" || id == "" {
+		return nil, errors.New("companyId and id are required")
+	}
+
+	// Nothing to reconstruct for the present or the future
+	if asOf.IsZero() || !asOf.Before(time.Now()) {
+		return s.repo.GetContactByID(ctx, companyId, id)
+	}
+
+	return s.repo.GetContactAsOf(ctx, companyId, id, asOf)
+}
+
+// FindDuplicateContacts groups contacts whose phone numbers normalize to the same number.
+// Contacts inside a group are oldest first, so the first one is the natural survivor.
+func (s *contactService) FindDuplicateContacts(
+	ctx context.Context,
+	companyId, agentId string,
+	limit, offset int,
+) (*model.ContactDuplicatePage, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+
+	// Apply default pagination
+	if limit <= 0 {
+		limit = 20
+	} else if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	return s.repo.FindDuplicateContacts(ctx, companyId, agentId, limit, offset)
+}
+
+func (s *contactService) MergeContacts(ctx context.Context, companyId string, in model.ContactMergeInput) (*model.Contact, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	if in.SurvivorID == "" {
+		return nil, fmt.Errorf("%w: survivor_id is required", ErrInvalidMerge)
+	}
+	if len(in.DuplicateIDs) == 0 {
+		return nil, fmt.Errorf("%w: duplicate_ids is required", ErrInvalidMerge)
+	}
+	if len(in.DuplicateIDs) > 50 {
+		return nil, fmt.Errorf("%w: at most 50 duplicates can be merged at once", ErrInvalidMerge)
+	}
+
+	// Drop repeats and reject merging a contact into itself
+	seen := map[string]bool{in.SurvivorID: true}
+	duplicateIds := make([]string, 0, len(in.DuplicateIDs))
+	for _, id := range in.DuplicateIDs {
+		if id == in.SurvivorID {
+			return nil, fmt.Errorf("%w: survivor_id cannot be one of duplicate_ids", ErrInvalidMerge)
+		}
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		duplicateIds = append(duplicateIds, id)
+	}
+
+	return s.repo.MergeContacts(ctx, companyId, in.SurvivorID, duplicateIds, in.Fields)
+}
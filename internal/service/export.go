@@ -0,0 +1,460 @@
+// internal/service/export.go
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/storage"
+)
+
+// ExportService runs asynchronous exports on a pool of workers
+type ExportService interface {
+	// Create validates and queues an export
+	Create(ctx context.Context, companyId string, in model.ExportRequest) (*model.ExportJob, error)
+	// Get returns a job with its progress and, once completed, its download link
+	Get(ctx context.Context, companyId string, id int64) (*model.ExportJob, error)
+	// List returns the tenant's jobs, newest first
+	List(ctx context.Context, companyId string, limit, offset int) (*model.ExportJobPage, error)
+	// Open returns the file of a completed job
+	Open(ctx context.Context, companyId string, id int64) (io.ReadCloser, *model.ExportJob, error)
+	// Start runs the workers until ctx is done
+	Start(ctx context.Context)
+	// Resume queues the tenant's unfinished jobs, including those whose worker stopped
+	Resume(ctx context.Context, companyId string) (int, error)
+}
+
+var (
+	// ErrExportNotFound is returned for unknown export jobs
+	ErrExportNotFound = errors.New("export not found")
+	// ErrExportNotReady is returned when downloading a job that has not completed
+	ErrExportNotReady = errors.New("export is not completed")
+	// ErrInvalidExport is returned for invalid export requests
+	ErrInvalidExport = errors.New("invalid export")
+)
+
+const (
+	// exportBatchSize is how many rows are read and written between progress updates
+	exportBatchSize = 1000
+	// exportStaleAfter is how long a running job may go without progress before
+	// another worker takes it over
+	exportStaleAfter = 2 * time.Minute
+	// exportHeartbeatInterval is how often a worker marks its job alive, well within exportStaleAfter
+	exportHeartbeatInterval = exportStaleAfter / 4
+	// maxExportPeriod bounds message exports
+	maxExportPeriod = 366 * 24 * time.Hour
+	// exportQueueSize bounds queued jobs; jobs that do not fit wait for the next Resume
+	exportQueueSize = 100
+)
+
+type exportRef struct {
+	companyId string
+	id        int64
+}
+
+// NewExportService constructs an ExportService writing files to store with the given number of workers
+func NewExportService(repo repository.ExportRepository, store storage.Store, workers int) ExportService {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &exportService{
+		repo:    repo,
+		store:   store,
+		workers: workers,
+		queue:   make(chan exportRef, exportQueueSize),
+	}
+}
+
+type exportService struct {
+	repo    repository.ExportRepository
+	store   storage.Store
+	workers int
+	queue   chan exportRef
+	// queued holds the jobs waiting in or taken from the queue by this process
+	queued sync.Map
+}
+
+func (s *exportService) Create(ctx context.Context, companyId string, in model.ExportRequest) (*model.ExportJob, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+
+	job := &model.ExportJob{
+		Kind:    in.Kind,
+		Format:  in.Format,
+		AgentID: in.AgentID,
+		ChatID:  in.ChatID,
+		From:    in.From,
+		To:      in.To,
+		Status:  model.ExportJobPending,
+	}
+	if job.Format == "" {
+		job.Format = model.ExportFormatJSONL
+	}
+	if job.Format != model.ExportFormatJSONL && job.Format != model.ExportFormatCSV {
+		return nil, fmt.Errorf("%w: format must be %s or %s", ErrInvalidExport, model.ExportFormatJSONL, model.ExportFormatCSV)
+	}
+
+	switch job.Kind {
+	case model.ExportKindContacts:
+		if job.ChatID != "" || job.From != nil || job.To != nil {
+			return nil, fmt.Errorf("%w: contacts exports only accept agent_id", ErrInvalidExport)
+		}
+	case model.ExportKindMessages:
+		if job.From == nil || job.To == nil {
+			return nil, fmt.Errorf("%w: messages exports require from and to", ErrInvalidExport)
+		}
+		if !job.To.After(*job.From) {
+			return nil, fmt.Errorf("%w: to must be after from", ErrInvalidExport)
+		}
+		if job.To.Sub(*job.From) > maxExportPeriod {
+			return nil, fmt.Errorf("%w: period must not exceed 366 days", ErrInvalidExport)
+		}
+	default:
+		return nil, fmt.Errorf("%w: kind must be %s or %s", ErrInvalidExport, model.ExportKindContacts, model.ExportKindMessages)
+	}
+
+	if err := s.repo.Create(ctx, companyId, job); err != nil {
+		return nil, err
+	}
+	s.enqueue(companyId, job.ID)
+	return job, nil
+}
+
+func (s *exportService) Get(ctx context.Context, companyId string, id int64) (*model.ExportJob, error) {
+	job, err := s.repo.Get(ctx, companyId, id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrExportNotFound
+	}
+	presentExport(job)
+	return job, nil
+}
+
+func (s *exportService) List(ctx context.Context, companyId string, limit, offset int) (*model.ExportJobPage, error) {
+	if limit <= 0 {
+		limit = 20
+	} else if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	page, err := s.repo.List(ctx, companyId, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Items {
+		presentExport(&page.Items[i])
+	}
+	return page, nil
+}
+
+func (s *exportService) Open(ctx context.Context, companyId string, id int64) (io.ReadCloser, *model.ExportJob, error) {
+	job, err := s.Get(ctx, companyId, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.Status != model.ExportJobCompleted {
+		return nil, nil, ErrExportNotReady
+	}
+	body, _, err := s.store.Open(ctx, job.FileKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, job, nil
+}
+
+func (s *exportService) Start(ctx context.Context) {
+	for i := 0; i < s.workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case ref := <-s.queue:
+					s.run(ctx, ref)
+					s.queued.Delete(ref)
+				}
+			}
+		}()
+	}
+}
+
+func (s *exportService) Resume(ctx context.Context, companyId string) (int, error) {
+	jobs, err := s.repo.Unfinished(ctx, companyId)
+	if err != nil {
+		return 0, err
+	}
+	staleBefore := time.Now().Add(-exportStaleAfter)
+	queued := 0
+	for _, job := range jobs {
+		// Running jobs still making progress belong to a live worker
+		if job.Status == model.ExportJobRunning && job.UpdatedAt.After(staleBefore) {
+			continue
+		}
+		if s.enqueue(companyId, job.ID) {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// enqueue queues a job unless this process already holds it; a full queue leaves
+// the job pending for the next Resume.
+func (s *exportService) enqueue(companyId string, id int64) bool {
+	ref := exportRef{companyId: companyId, id: id}
+	if _, loaded := s.queued.LoadOrStore(ref, struct{}{}); loaded {
+		return false
+	}
+	select {
+	case s.queue <- ref:
+		return true
+	default:
+		s.queued.Delete(ref)
+		return false
+	}
+}
+
+// run claims a job and writes its file. A job interrupted by shutdown is left
+// running and restarted from scratch once it goes stale; its file is replaced.
+func (s *exportService) run(ctx context.Context, ref exportRef) {
+	claimed, err := s.repo.Claim(ctx, ref.companyId, ref.id, time.Now().Add(-exportStaleAfter))
+	if err != nil || !claimed {
+		return
+	}
+	stop := s.heartbeat(ctx, ref)
+	defer stop()
+	job, err := s.repo.Get(ctx, ref.companyId, ref.id)
+	if err != nil || job == nil {
+		return
+	}
+
+	fail := func(err error) {
+		job.Status = model.ExportJobFailed
+		job.Error = err.Error()
+		now := time.Now()
+		job.FinishedAt = &now
+		_ = s.repo.Update(context.WithoutCancel(ctx), ref.companyId, job)
+	}
+
+	total, err := s.repo.CountRows(ctx, ref.companyId, job)
+	if err != nil {
+		if ctx.Err() == nil {
+			fail(err)
+		}
+		return
+	}
+	job.Total = total
+	job.FileKey = path.Join(ref.companyId, "exports", fmt.Sprintf("%d-%s.%s", job.ID, job.Kind, job.Format))
+	if err := s.repo.Update(ctx, ref.companyId, job); err != nil {
+		return
+	}
+
+	// Rows are encoded into a pipe that the store consumes, so files of any size stream through
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.writeRows(ctx, ref.companyId, job, pw))
+	}()
+	err = s.store.Put(ctx, job.FileKey, pr, exportContentType(job.Format))
+	pr.CloseWithError(err)
+	if err != nil {
+		if ctx.Err() == nil {
+			fail(err)
+		}
+		return
+	}
+
+	info, err := s.store.Stat(ctx, job.FileKey)
+	if err != nil {
+		fail(err)
+		return
+	}
+	job.Status = model.ExportJobCompleted
+	job.FileSize = info.Size
+	now := time.Now()
+	job.FinishedAt = &now
+	_ = s.repo.Update(context.WithoutCancel(ctx), ref.companyId, job)
+}
+
+// heartbeat keeps a claimed job fresh until the returned stop is called, so a slow
+// count or upload never lets another worker take the job over.
+func (s *exportService) heartbeat(ctx context.Context, ref exportRef) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(exportHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = s.repo.Touch(ctx, ref.companyId, ref.id)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// writeRows encodes the job's rows to w, storing progress after each batch
+func (s *exportService) writeRows(ctx context.Context, companyId string, job *model.ExportJob, w io.Writer) error {
+	enc := newRowEncoder(job.Format, w)
+	progress := func(n int) error {
+		job.Processed += int64(n)
+		if err := enc.flush(); err != nil {
+			return err
+		}
+		return s.repo.Update(ctx, companyId, job)
+	}
+
+	switch job.Kind {
+	case model.ExportKindContacts:
+		err := s.repo.StreamContacts(ctx, companyId, job, exportBatchSize, func(batch []model.Contact) error {
+			for i := range batch {
+				if err := enc.encode(&batch[i], contactRecord(&batch[i])); err != nil {
+					return err
+				}
+			}
+			return progress(len(batch))
+		})
+		if err != nil {
+			return err
+		}
+	case model.ExportKindMessages:
+		err := s.repo.StreamMessages(ctx, companyId, job, exportBatchSize, func(batch []model.Message) error {
+			for i := range batch {
+				if err := enc.encode(&batch[i], messageRecord(&batch[i])); err != nil {
+					return err
+				}
+			}
+			return progress(len(batch))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return enc.flush()
+}
+
+// rowEncoder writes one JSON object per line, or CSV records under a header row
+type rowEncoder struct {
+	json      *json.Encoder
+	csv       *csv.Writer
+	header    []string
+	wroteHead bool
+}
+
+func newRowEncoder(format string, w io.Writer) *rowEncoder {
+	if format == model.ExportFormatCSV {
+		return &rowEncoder{csv: csv.NewWriter(w)}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &rowEncoder{json: enc}
+}
+
+// encode writes a row: value as JSON, or record (column → value pairs) as CSV
+func (e *rowEncoder) encode(value interface{}, record [][2]string) error {
+	if e.json != nil {
+		return e.json.Encode(value)
+	}
+	if !e.wroteHead {
+		header := make([]string, len(record))
+		for i, col := range record {
+			header[i] = col[0]
+		}
+		if err := e.csv.Write(header); err != nil {
+			return err
+		}
+		e.wroteHead = true
+	}
+	row := make([]string, len(record))
+	for i, col := range record {
+		row[i] = col[1]
+	}
+	return e.csv.Write(row)
+}
+
+func (e *rowEncoder) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+	return nil
+}
+
+func contactRecord(c *model.Contact) [][2]string {
+	return [][2]string{
+		{"id", c.ID},
+		{"phone_number", c.PhoneNumber},
+		{"agent_id", c.AgentID},
+		{"chat_id", c.ChatID},
+		{"custom_name", c.CustomName},
+		{"push_name", c.PushName},
+		{"tags", c.Tags},
+		{"assigned_to", c.AssignedTo},
+		{"origin", c.Origin},
+		{"status", c.Status},
+		{"notes", c.Notes},
+		{"created_at", c.CreatedAt.UTC().Format(time.RFC3339)},
+		{"updated_at", c.UpdatedAt.UTC().Format(time.RFC3339)},
+	}
+}
+
+func messageRecord(m *model.Message) [][2]string {
+	return [][2]string{
+		{"id", m.MessageID},
+		{"agent_id", m.AgentID},
+		{"chat_id", m.ChatID},
+		{"flow", m.Flow},
+		{"from_phone", m.FromPhone},
+		{"to_phone", m.ToPhone},
+		{"message_type", m.MessageType},
+		{"message_text", m.MessageText},
+		{"status", m.Status},
+		{"is_deleted", strconv.FormatBool(m.IsDeleted)},
+		{"message_timestamp", strconv.FormatInt(m.MessageTimestamp, 10)},
+		{"message_date", m.MessageDate.Format(time.DateOnly)},
+	}
+}
+
+func exportContentType(format string) string {
+	if format == model.ExportFormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// presentExport computes the progress and download link of a job
+func presentExport(job *model.ExportJob) {
+	switch {
+	case job.Status == model.ExportJobCompleted:
+		job.Progress = 100
+		job.DownloadURL = fmt.Sprintf("/api/v1/exports/%d/download", job.ID)
+	case job.Total > 0:
+		// Rows added while the export runs may push processed past total
+		percent := math.Min(float64(job.Processed)*100/float64(job.Total), 100)
+		job.Progress = math.Round(percent*100) / 100
+	}
+}
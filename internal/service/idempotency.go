@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+)
+
+// IdempotencyService lets clients retry mutating requests safely: the first request
+// holding an Idempotency-Key runs, retries get its stored response.
+type IdempotencyService interface {
+	// Begin claims key for a request. It returns the claim, to pass to Complete or
+	// Release, when the request should run, or the completed response to replay.
+	Begin(ctx context.Context, companyId, key, fingerprint string) (*model.IdempotencyKey, error)
+	// Complete stores the response of the request holding claim
+	Complete(ctx context.Context, companyId string, claim *model.IdempotencyKey, statusCode int, headers map[string]string, body []byte) error
+	// Release frees claim's key after a failed request, so it can be retried
+	Release(ctx context.Context, companyId string, claim *model.IdempotencyKey) error
+	// Cleanup removes the tenant's expired keys
+	Cleanup(ctx context.Context, companyId string) (int64, error)
+}
+
+// maxIdempotencyKeyLength bounds client-supplied keys
+const maxIdempotencyKeyLength = 255
+
+// Defaults applying when no lifetime or lock timeout is configured
+const (
+	defaultIdempotencyTTL         = 24 * time.Hour
+	defaultIdempotencyLockTimeout = time.Minute
+)
+
+var (
+	// ErrInvalidIdempotencyKey is returned for empty, too long or non-printable keys
+	ErrInvalidIdempotencyKey = errors.New("idempotency key must be 1-255 printable ASCII characters")
+	// ErrIdempotencyKeyReused is returned when a key is sent again with a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+	// ErrIdempotencyKeyInProgress is returned while the first request with the key is running
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+// NewIdempotencyService keeps keys for ttl after their first use (24h when ttl <= 0).
+// A request holds its key for at most lockTimeout (1m when <= 0); a retry arriving
+// later takes the key over, so a replica dying mid-request does not block it.
+func NewIdempotencyService(repo repository.IdempotencyRepository, ttl, lockTimeout time.Duration) IdempotencyService {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	if lockTimeout <= 0 {
+		lockTimeout = defaultIdempotencyLockTimeout
+	}
+	return &idempotencyService{repo: repo, ttl: ttl, lockTimeout: lockTimeout}
+}
+
+type idempotencyService struct {
+	repo        repository.IdempotencyRepository
+	ttl         time.Duration
+	lockTimeout time.Duration
+}
+
+func (s *idempotencyService) Begin(ctx context.Context, companyId, key, fingerprint string) (*model.IdempotencyKey, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	if !validIdempotencyKey(key) {
+		return nil, ErrInvalidIdempotencyKey
+	}
+
+	holder := make([]byte, 16)
+	if _, err := rand.Read(holder); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	lockedUntil := now.Add(s.lockTimeout)
+	claim := &model.IdempotencyKey{
+		Key:         key,
+		Fingerprint: fingerprint,
+		Holder:      hex.EncodeToString(holder),
+		LockedUntil: &lockedUntil,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+	existing, err := s.repo.Reserve(ctx, companyId, claim)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return claim, nil
+	}
+	if existing.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !existing.Completed {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	return existing, nil
+}
+
+func (s *idempotencyService) Complete(
+	ctx context.Context,
+	companyId string,
+	claim *model.IdempotencyKey,
+	statusCode int,
+	headers map[string]string,
+	body []byte,
+) error {
+	encoded, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+	completed := *claim
+	completed.Completed = true
+	completed.LockedUntil = nil
+	completed.StatusCode = statusCode
+	completed.Headers = encoded
+	completed.Body = body
+	return s.repo.Complete(ctx, companyId, &completed)
+}
+
+func (s *idempotencyService) Release(ctx context.Context, companyId string, claim *model.IdempotencyKey) error {
+	return s.repo.Release(ctx, companyId, claim)
+}
+
+func (s *idempotencyService) Cleanup(ctx context.Context, companyId string) (int64, error) {
+	if companyId == "" {
+		return 0, errors.New("companyId is required")
+	}
+	return s.repo.DeleteExpired(ctx, companyId, time.Now())
+}
+
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
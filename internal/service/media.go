@@ -0,0 +1,121 @@
+// internal/service/media.go
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/media"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/payload"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/storage"
+)
+
+// MediaService exposes message attachments through signed URLs
+type MediaService interface {
+	// Attach fills in the media metadata and a signed URL of every message with an attachment
+	Attach(companyId string, messages []model.Message)
+	// Open verifies a signed media URL and returns the attachment
+	Open(ctx context.Context, companyId, agentId, chatId, messageId string, expires int64, sig string) (*MediaObject, error)
+}
+
+// MediaObject is an attachment to serve: either a stored object (Body) or,
+// for media kept outside our storage, an external URL to redirect to.
+type MediaObject struct {
+	Body        io.ReadCloser
+	Size        int64
+	ContentType string
+	FileName    string
+	RedirectURL string
+}
+
+// ErrMediaNotFound is returned when a message has no retrievable attachment
+var ErrMediaNotFound = errors.New("media not found")
+
+// NewMediaService constructs a MediaService reading attachments from store
+func NewMediaService(repo repository.MessageRepository, store storage.Store, signer *media.Signer) MediaService {
+	return &mediaService{repo: repo, store: store, signer: signer}
+}
+
+type mediaService struct {
+	repo   repository.MessageRepository
+	store  storage.Store
+	signer *media.Signer
+}
+
+func (s *mediaService) Attach(companyId string, messages []model.Message) {
+	now := time.Now()
+	for i := range messages {
+		m := payload.Media(messages[i].MessageObj)
+		if m == nil {
+			continue
+		}
+		url, expiresAt := s.signer.URL(companyId, messages[i].AgentID, messages[i].ChatID, messages[i].MessageID, now)
+		m.URL = url
+		m.URLExpiresAt = &expiresAt
+		messages[i].Media = m
+	}
+}
+
+func (s *mediaService) Open(ctx context.Context, companyId, agentId, chatId, messageId string, expires int64, sig string) (*MediaObject, error) {
+	if err := s.signer.Verify(companyId, agentId, chatId, messageId, expires, sig, time.Now()); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.repo.GetByMessageID(ctx, companyId, agentId, chatId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, ErrMediaNotFound
+	}
+	meta := payload.Media(msg.MessageObj)
+	if meta == nil {
+		return nil, ErrMediaNotFound
+	}
+
+	body, info, err := s.store.Open(ctx, mediaKey(companyId, msg))
+	if errors.Is(err, storage.ErrNotFound) {
+		// Media that was never copied to our storage is served from where it lives
+		if isExternalURL(msg.MessageUrl) {
+			return &MediaObject{RedirectURL: msg.MessageUrl}, nil
+		}
+		return nil, ErrMediaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &MediaObject{
+		Body:        body,
+		Size:        info.Size,
+		ContentType: meta.Mimetype,
+		FileName:    meta.FileName,
+	}
+	if obj.ContentType == "" {
+		obj.ContentType = info.ContentType
+	}
+	return obj, nil
+}
+
+// mediaKey is where a message's attachment is stored: message_url when it holds
+// a storage path, otherwise <companyId>/media/<messageId>. The path is cleaned as
+// rooted, so ".." segments cannot leave the company's directory.
+func mediaKey(companyId string, msg *model.Message) string {
+	if msg.MessageUrl != "" && !isExternalURL(msg.MessageUrl) {
+		key := path.Join(companyId, path.Clean("/"+msg.MessageUrl))
+		if strings.HasPrefix(key, companyId+"/") {
+			return key
+		}
+	}
+	return path.Join(companyId, "media", msg.MessageID)
+}
+
+func isExternalURL(u string) bool {
+	return strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "http://")
+}
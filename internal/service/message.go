@@ -7,24 +7,76 @@ import (
 	"fmt"
 
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/payload"
 	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
 )
 
 // MessageService defines business operations for reading messages
 type MessageService interface {
 	// FetchMessagesByChatId returns paginated messages for a chat with sorting
-	FetchMessagesByChatId(ctx context.Context, companyId, agentId, chatId string, sort, order string, limit, offset int) (*repository.MessagePage, error)
+	FetchMessagesByChatId(ctx context.Context, companyId, agentId, chatId string, sort, order string, limit, offset int, opts MessageOptions) (*repository.MessagePage, error)
 	// FetchRangeMessagesByChatId returns messages in a specific range for infinite scroll with total count
-	FetchRangeMessagesByChatId(ctx context.Context, companyId, agentId, chatId string, sort, order string, start, end int) (*repository.MessagePage, error)
+	FetchRangeMessagesByChatId(ctx context.Context, companyId, agentId, chatId string, sort, order string, start, end int, opts MessageOptions) (*repository.MessagePage, error)
+	// FetchReplies returns the messages quoting messageId, oldest first
+	FetchReplies(ctx context.Context, companyId, agentId, chatId, messageId string, limit, offset int, opts MessageOptions) (*repository.MessagePage, error)
+	// GetEditHistory returns a message's original text and its recorded edits
+	GetEditHistory(ctx context.Context, companyId, agentId, chatId, messageId string) (*model.MessageEditHistory, error)
 }
 
-// NewMessageService constructs a MessageService backed by the given repository
-func NewMessageService(repo repository.MessageRepository) MessageService {
-	return &messageService{repo: repo}
+// MessageOptions controls which messages are fetched and how they are presented
+type MessageOptions struct {
+	// Format is raw (default) or normalized, which adds the typed payload reading
+	Format string
+	// Deleted is include (default), exclude or only
+	Deleted string
+	// Text selects message_text: original, current (edited) or empty for the stored value
+	Text string
+	// FromPhone and ToPhone keep the messages of a sender / recipient, in any phone format
+	FromPhone string
+	ToPhone   string
+}
+
+// Message response formats
+const (
+	MessageFormatRaw        = "raw"
+	MessageFormatNormalized = "normalized"
+)
+
+// Deleted message visibility
+const (
+	DeletedInclude = "include"
+	DeletedExclude = "exclude"
+	DeletedOnly    = "only"
+)
+
+// Message text versions
+const (
+	MessageTextOriginal = "original"
+	MessageTextCurrent  = "current"
+)
+
+var (
+	// ErrInvalidMessageFormat is returned for unknown format values
+	ErrInvalidMessageFormat = errors.New("format must be raw or normalized")
+	// ErrInvalidDeletedOption is returned for unknown deleted values
+	ErrInvalidDeletedOption = errors.New("deleted must be include, exclude or only")
+	// ErrInvalidTextOption is returned for unknown text values
+	ErrInvalidTextOption = errors.New("text must be original or current")
+	// ErrMessageNotFound is returned when the chat has no message with the requested ID
+	ErrMessageNotFound = errors.New("message not found")
+)
+
+// NewMessageService constructs a MessageService backed by the given repository.
+// Attachments are described and linked through mediaSvc; chats continue into
+// archived partitions through archives, which may be nil.
+func NewMessageService(repo repository.MessageRepository, mediaSvc MediaService, archives ArchiveService) MessageService {
+	return &messageService{repo: repo, media: mediaSvc, archives: archives}
 }
 
 type messageService struct {
-	repo repository.MessageRepository
+	repo     repository.MessageRepository
+	media    MediaService
+	archives ArchiveService
 }
 
 func (s *messageService) FetchMessagesByChatId(
@@ -32,11 +84,15 @@ func (s *messageService) FetchMessagesByChatId(
 	companyId, agentId, chatId string,
 	sort, order string,
 	limit, offset int,
+	opts MessageOptions,
 ) (*repository.MessagePage, error) {
 	// Validate required parameters
 	if companyId == "" || agentId == "" || chatId == "" {
 		return nil, errors.New("companyId, agentId, and chatId are required")
 	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
 
 	// Apply default pagination
 	if limit <= 0 {
@@ -58,7 +114,7 @@ func (s *messageService) FetchMessagesByChatId(
 	}
 
 	// Fetch messages from repository
-	page, err := s.repo.FetchMessagesByChatId(ctx, companyId, agentId, chatId, sort, order, limit, offset)
+	page, err := s.fetchPage(ctx, companyId, agentId, chatId, opts.filter(), sort, order, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch messages: %w", err)
 	}
@@ -67,6 +123,9 @@ func (s *messageService) FetchMessagesByChatId(
 	if page.Items == nil {
 		page.Items = make([]model.Message, 0)
 	}
+	if err := s.present(ctx, companyId, agentId, chatId, page.Items, opts); err != nil {
+		return nil, err
+	}
 
 	return page, nil
 }
@@ -76,11 +135,15 @@ func (s *messageService) FetchRangeMessagesByChatId(
 	companyId, agentId, chatId string,
 	sort, order string,
 	start, end int,
+	opts MessageOptions,
 ) (*repository.MessagePage, error) {
 	// Validate required parameters
 	if companyId == "" || agentId == "" || chatId == "" {
 		return nil, errors.New("companyId, agentId, and chatId are required")
 	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
 
 	// Validate range parameters
 	if start < 0 {
@@ -106,7 +169,7 @@ func (s *messageService) FetchRangeMessagesByChatId(
 	}
 
 	// Fetch messages from repository
-	page, err := s.repo.FetchRangeMessagesByChatId(ctx, companyId, agentId, chatId, sort, order, start, end)
+	page, err := s.fetchRange(ctx, companyId, agentId, chatId, opts.filter(), sort, order, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch range messages: %w", err)
 	}
@@ -115,6 +178,207 @@ func (s *messageService) FetchRangeMessagesByChatId(
 	if page.Items == nil {
 		page.Items = make([]model.Message, 0)
 	}
+	if err := s.present(ctx, companyId, agentId, chatId, page.Items, opts); err != nil {
+		return nil, err
+	}
 
 	return page, nil
 }
+
+// fetchPage reads a page of a chat, continuing into its archived messages.
+// Archived messages are older than every stored one, so sorted by message_timestamp
+// they come after the stored messages in descending order and before them in
+// ascending order. Other sorts would interleave both sources, so they only read
+// the stored messages.
+func (s *messageService) fetchPage(
+	ctx context.Context,
+	companyId, agentId, chatId string,
+	filter map[string]interface{},
+	sort, order string,
+	limit, offset int,
+) (*repository.MessagePage, error) {
+	sort, order = repository.ValidateMessageSort(sort, order)
+
+	var archived int64
+	if s.archives != nil && sort == "message_timestamp" {
+		var err error
+		if archived, err = s.archives.CountChat(ctx, companyId, agentId, chatId, filter); err != nil {
+			return nil, err
+		}
+	}
+	if archived == 0 {
+		return s.repo.FetchMessagesByChatId(ctx, companyId, agentId, chatId, filter, sort, order, limit, offset)
+	}
+
+	if order == "DESC" {
+		page, err := s.repo.FetchMessagesByChatId(ctx, companyId, agentId, chatId, filter, sort, order, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+		if rest := limit - len(page.Items); rest > 0 {
+			items, err := s.archives.FetchChat(ctx, companyId, agentId, chatId, filter, true, rest, max(0, offset-int(page.Total)))
+			if err != nil {
+				return nil, err
+			}
+			page.Items = append(page.Items, items...)
+		}
+		page.Total += archived
+		return page, nil
+	}
+
+	var items []model.Message
+	if int64(offset) < archived {
+		var err error
+		if items, err = s.archives.FetchChat(ctx, companyId, agentId, chatId, filter, false, limit, offset); err != nil {
+			return nil, err
+		}
+	}
+	// The stored messages are still queried when the page is full, for their total
+	rest := limit - len(items)
+	page, err := s.repo.FetchMessagesByChatId(ctx, companyId, agentId, chatId, filter, sort, order, max(rest, 1), max(0, offset-int(archived)))
+	if err != nil {
+		return nil, err
+	}
+	if rest == 0 {
+		page.Items = nil
+	}
+	page.Items = append(items, page.Items...)
+	page.Total += archived
+	return page, nil
+}
+
+// fetchRange reads messages [start, end] of a chat, continuing into its archived messages
+func (s *messageService) fetchRange(
+	ctx context.Context,
+	companyId, agentId, chatId string,
+	filter map[string]interface{},
+	sort, order string,
+	start, end int,
+) (*repository.MessagePage, error) {
+	if s.archives == nil {
+		return s.repo.FetchRangeMessagesByChatId(ctx, companyId, agentId, chatId, filter, sort, order, start, end)
+	}
+	return s.fetchPage(ctx, companyId, agentId, chatId, filter, sort, order, end-start+1, start)
+}
+
+func (o MessageOptions) validate() error {
+	switch o.Format {
+	case "", MessageFormatRaw, MessageFormatNormalized:
+	default:
+		return ErrInvalidMessageFormat
+	}
+	switch o.Deleted {
+	case "", DeletedInclude, DeletedExclude, DeletedOnly:
+	default:
+		return ErrInvalidDeletedOption
+	}
+	switch o.Text {
+	case "", MessageTextOriginal, MessageTextCurrent:
+	default:
+		return ErrInvalidTextOption
+	}
+	return nil
+}
+
+// filter translates the options into repository filters
+func (o MessageOptions) filter() map[string]interface{} {
+	filter := make(map[string]interface{})
+	switch o.Deleted {
+	case DeletedExclude:
+		filter["is_deleted"] = false
+	case DeletedOnly:
+		filter["is_deleted"] = true
+	}
+	if o.FromPhone != "" {
+		filter["from_phone"] = o.FromPhone
+	}
+	if o.ToPhone != "" {
+		filter["to_phone"] = o.ToPhone
+	}
+	// Normalized messages carry their reactions, which are not listed on their own
+	if o.Format == MessageFormatNormalized {
+		filter["reactions"] = false
+	}
+	return filter
+}
+
+// present derives the response-only fields of messages fetched from one chat
+func (s *messageService) present(ctx context.Context, companyId, agentId, chatId string, items []model.Message, opts MessageOptions) error {
+	s.media.Attach(companyId, items)
+	// Raw messages are returned as stored, without the extra reaction and quote lookups
+	if opts.Format == MessageFormatNormalized {
+		if err := s.attachReactions(ctx, companyId, agentId, chatId, items); err != nil {
+			return err
+		}
+		if err := s.attachQuoted(ctx, companyId, agentId, chatId, items); err != nil {
+			return err
+		}
+	}
+
+	for i := range items {
+		msg := &items[i]
+		switch opts.Text {
+		case MessageTextOriginal:
+			msg.MessageText = originalText(msg)
+		case MessageTextCurrent:
+			msg.MessageText = currentText(msg)
+		}
+		if opts.Format == MessageFormatNormalized {
+			msg.Normalized = payload.Normalize(msg)
+			if opts.Text == MessageTextOriginal {
+				msg.Normalized.Text = originalText(msg)
+			}
+		}
+	}
+	return nil
+}
+
+// originalText is the text a message was sent with, before any edit
+func originalText(msg *model.Message) string {
+	if text := payload.Text(msg.MessageObj); text != "" {
+		return text
+	}
+	return msg.MessageText
+}
+
+// currentText is the text of the latest edit, or the original text
+func currentText(msg *model.Message) string {
+	if text := payload.EditedText(msg.EditedMessageObj); text != "" {
+		return text
+	}
+	return originalText(msg)
+}
+
+func (s *messageService) GetEditHistory(ctx context.Context, companyId, agentId, chatId, messageId string) (*model.MessageEditHistory, error) {
+	msg, err := s.repo.GetByMessageID(ctx, companyId, agentId, chatId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, ErrMessageNotFound
+	}
+
+	edits, err := s.repo.FetchEdits(ctx, companyId, agentId, chatId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	// Edits made before the history was recorded only survive as the current version
+	if len(edits) == 0 && payload.EditedText(msg.EditedMessageObj) != "" {
+		edits = append(edits, model.MessageEdit{EditedMessageObj: msg.EditedMessageObj})
+	}
+	for i := range edits {
+		edits[i].Text = payload.EditedText(edits[i].EditedMessageObj)
+	}
+
+	return &model.MessageEditHistory{
+		MessageID:    msg.MessageID,
+		ChatID:       msg.ChatID,
+		AgentID:      msg.AgentID,
+		OriginalText: originalText(msg),
+		CurrentText:  currentText(msg),
+		Edited:       len(edits) > 0,
+		Deleted:      msg.IsDeleted,
+		MessageObj:   msg.MessageObj,
+		Edits:        edits,
+	}, nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+)
+
+// stubMessageRepo serves a chat's stored messages, held oldest first
+type stubMessageRepo struct {
+	repository.MessageRepository
+	stored []model.Message
+}
+
+func (r *stubMessageRepo) FetchMessagesByChatId(
+	_ context.Context,
+	_, _, _ string,
+	_ map[string]interface{},
+	_, order string,
+	limit, offset int,
+) (*repository.MessagePage, error) {
+	return &repository.MessagePage{
+		Items: slicePage(r.stored, order != "ASC" && order != "asc", limit, offset),
+		Total: int64(len(r.stored)),
+	}, nil
+}
+
+// stubArchives serves a chat's archived messages, held oldest first
+type stubArchives struct {
+	ArchiveService
+	archived []model.Message
+}
+
+func (a *stubArchives) CountChat(context.Context, string, string, string, map[string]interface{}) (int64, error) {
+	return int64(len(a.archived)), nil
+}
+
+func (a *stubArchives) FetchChat(
+	_ context.Context,
+	_, _, _ string,
+	_ map[string]interface{},
+	desc bool,
+	limit, offset int,
+) ([]model.Message, error) {
+	return slicePage(a.archived, desc, limit, offset), nil
+}
+
+// slicePage returns the page [offset, offset+limit) of oldest-first messages in the given order
+func slicePage(messages []model.Message, desc bool, limit, offset int) []model.Message {
+	ordered := make([]model.Message, len(messages))
+	copy(ordered, messages)
+	if desc {
+		for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		}
+	}
+	if offset >= len(ordered) {
+		return []model.Message{}
+	}
+	return ordered[offset:min(offset+limit, len(ordered))]
+}
+
+func timestamps(messages []model.Message) []int64 {
+	out := make([]int64, 0, len(messages))
+	for _, m := range messages {
+		out = append(out, m.MessageTimestamp)
+	}
+	return out
+}
+
+// TestFetchPageSplicesArchives pages through a chat whose older half is archived and
+// checks every page against the whole chat sorted by message_timestamp.
+func TestFetchPageSplicesArchives(t *testing.T) {
+	var archived, stored, all []model.Message
+	for ts := int64(1); ts <= 10; ts++ {
+		m := model.Message{ID: ts, MessageTimestamp: ts}
+		if ts <= 4 {
+			archived = append(archived, m)
+		} else {
+			stored = append(stored, m)
+		}
+		all = append(all, m)
+	}
+	svc := &messageService{
+		repo:     &stubMessageRepo{stored: stored},
+		archives: &stubArchives{archived: archived},
+	}
+
+	for _, order := range []string{"desc", "asc"} {
+		t.Run(order, func(t *testing.T) {
+			desc := order == "desc"
+			for limit := 1; limit <= 4; limit++ {
+				for offset := 0; offset <= len(all)+1; offset++ {
+					page, err := svc.fetchPage(context.Background(), "acme", "agent", "chat", nil,
+						"message_timestamp", order, limit, offset)
+					if err != nil {
+						t.Fatalf("limit %d offset %d: %v", limit, offset, err)
+					}
+					if page.Total != int64(len(all)) {
+						t.Errorf("limit %d offset %d: total = %d, want %d", limit, offset, page.Total, len(all))
+					}
+					got := timestamps(page.Items)
+					want := timestamps(slicePage(all, desc, limit, offset))
+					if !reflect.DeepEqual(got, want) {
+						t.Errorf("limit %d offset %d: timestamps = %v, want %v", limit, offset, got, want)
+					}
+				}
+			}
+		})
+	}
+}
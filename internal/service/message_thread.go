@@ -0,0 +1,179 @@
+// internal/service/message_thread.go
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/payload"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+)
+
+func (s *messageService) FetchReplies(
+	ctx context.Context,
+	companyId, agentId, chatId, messageId string,
+	limit, offset int,
+	opts MessageOptions,
+) (*repository.MessagePage, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 20
+	} else if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	target, err := s.repo.GetByMessageID(ctx, companyId, agentId, chatId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, ErrMessageNotFound
+	}
+
+	page, err := s.repo.FetchReplies(ctx, companyId, target.AgentID, target.ChatID, messageId, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch replies: %w", err)
+	}
+	if err := s.present(ctx, companyId, target.AgentID, target.ChatID, page.Items, opts); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// attachReactions aggregates, with one query, the reactions made to the given messages.
+// Each sender counts once per message with their latest emoji; withdrawn reactions are dropped.
+func (s *messageService) attachReactions(ctx context.Context, companyId, agentId, chatId string, items []model.Message) error {
+	ids := make([]string, 0, len(items))
+	for _, msg := range items {
+		if msg.MessageID != "" {
+			ids = append(ids, msg.MessageID)
+		}
+	}
+
+	reactions, err := s.repo.FetchReactions(ctx, companyId, agentId, chatId, ids)
+	if err != nil {
+		return err
+	}
+	if len(reactions) == 0 {
+		return nil
+	}
+
+	// target message → sender → emoji, applied oldest first so later reactions win
+	latest := make(map[string]map[string]string)
+	for _, msg := range reactions {
+		reaction := payload.Reaction(msg.MessageObj)
+		if reaction == nil || reaction.TargetID == "" {
+			continue
+		}
+		bySender, ok := latest[reaction.TargetID]
+		if !ok {
+			bySender = make(map[string]string)
+			latest[reaction.TargetID] = bySender
+		}
+		if reaction.Removed {
+			delete(bySender, msg.FromPhone)
+		} else {
+			bySender[msg.FromPhone] = reaction.Emoji
+		}
+	}
+
+	for i := range items {
+		items[i].Reactions = summarizeReactions(latest[items[i].MessageID])
+	}
+	return nil
+}
+
+// summarizeReactions groups reactions by emoji, most frequent first
+func summarizeReactions(bySender map[string]string) []model.MessageReactionSummary {
+	if len(bySender) == 0 {
+		return nil
+	}
+	byEmoji := make(map[string]*model.MessageReactionSummary)
+	for sender, emoji := range bySender {
+		summary, ok := byEmoji[emoji]
+		if !ok {
+			summary = &model.MessageReactionSummary{Emoji: emoji, Reactors: []string{}}
+			byEmoji[emoji] = summary
+		}
+		summary.Count++
+		summary.Reactors = append(summary.Reactors, sender)
+	}
+
+	out := make([]model.MessageReactionSummary, 0, len(byEmoji))
+	for _, summary := range byEmoji {
+		sort.Strings(summary.Reactors)
+		out = append(out, *summary)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Emoji < out[j].Emoji
+	})
+	return out
+}
+
+// attachQuoted sets the preview of the message each reply quotes. Quoted messages
+// outside the page are loaded with one query; missing ones fall back to the
+// copy WhatsApp embeds in the reply.
+func (s *messageService) attachQuoted(ctx context.Context, companyId, agentId, chatId string, items []model.Message) error {
+	refs := make(map[int]*model.MessageReference)
+	known := make(map[string]*model.Message, len(items))
+	for i := range items {
+		known[items[i].MessageID] = &items[i]
+	}
+
+	var missing []string
+	for i := range items {
+		ref := payload.ReplyTo(items[i].MessageObj)
+		if ref == nil {
+			continue
+		}
+		refs[i] = ref
+		if _, ok := known[ref.MessageID]; !ok {
+			missing = append(missing, ref.MessageID)
+			known[ref.MessageID] = nil
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	found, err := s.repo.FetchByMessageIDs(ctx, companyId, agentId, chatId, missing)
+	if err != nil {
+		return err
+	}
+	for i := range found {
+		known[found[i].MessageID] = &found[i]
+	}
+
+	for i, ref := range refs {
+		quoted := known[ref.MessageID]
+		if quoted == nil {
+			items[i].Quoted = &model.QuotedMessage{ID: ref.MessageID, Text: ref.Text}
+			continue
+		}
+		preview := &model.QuotedMessage{
+			ID:               quoted.MessageID,
+			Found:            true,
+			FromPhone:        quoted.FromPhone,
+			Flow:             quoted.Flow,
+			MessageType:      quoted.MessageType,
+			Text:             currentText(quoted),
+			IsDeleted:        quoted.IsDeleted,
+			MessageTimestamp: quoted.MessageTimestamp,
+		}
+		if m := payload.Media(quoted.MessageObj); m != nil {
+			preview.MediaType = m.Type
+		}
+		items[i].Quoted = preview
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/etag"
+)
+
+// ErrPreconditionFailed is returned when an If-Match tag no longer matches the
+// current version of the resource
+var ErrPreconditionFailed = errors.New("resource was modified since it was read")
+
+// ifMatch returns a repository check that rejects an update unless header matches
+// the entity tag of the current row, as computed by tagOf. An empty header
+// disables the check.
+func ifMatch[T any](header string, tagOf func(*T) string) func(*T) error {
+	if header == "" {
+		return nil
+	}
+	return func(current *T) error {
+		if !etag.Match(header, tagOf(current)) {
+			return ErrPreconditionFailed
+		}
+		return nil
+	}
+}
+
+// ContactETag returns the entity tag of a contact
+func ContactETag(c *model.Contact) string {
+	return etag.OfValue(c)
+}
+
+// AgentETag returns the entity tag of an agent, computed from its editable fields
+// and updated_at only, so heartbeats and the presentation of the agent (staleness,
+// hidden expired QR codes) leave it unchanged. The QR code stands in by its expiry,
+// which every new code moves.
+func AgentETag(a *model.Agent) string {
+	return etag.OfValue(struct {
+		AgentName   string     `json:"agent_name"`
+		HostName    string     `json:"host_name"`
+		PhoneNumber string     `json:"phone_number"`
+		Version     string     `json:"version"`
+		Status      string     `json:"status"`
+		QRExpiresAt *time.Time `json:"qr_expires_at"`
+		UpdatedAt   time.Time  `json:"updated_at"`
+	}{a.AgentName, a.HostName, a.PhoneNumber, a.Version, a.Status, a.QRExpiresAt, a.UpdatedAt})
+}
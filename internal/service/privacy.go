@@ -0,0 +1,337 @@
+// internal/service/privacy.go
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/payload"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/storage"
+	"gitlab.com/timkado/api/daisi-rest-postgres/pkg/phone"
+)
+
+// PrivacyService answers data subject requests: export or erase everything stored
+// about one phone number. Every request is recorded in the privacy log.
+type PrivacyService interface {
+	// Erase redacts the subject's messages and their media, and anonymizes its contacts and chats
+	Erase(ctx context.Context, companyId string, in model.PrivacyRequest) (*model.PrivacyLog, error)
+	// PrepareExport finds the subject and records the export. It runs before
+	// streaming starts, so an unknown number can still be reported as an error.
+	PrepareExport(ctx context.Context, companyId string, in model.PrivacyRequest) (*model.PrivacySubject, error)
+	// WriteExport streams the JSON bundle of a prepared subject to w
+	WriteExport(ctx context.Context, companyId string, subject *model.PrivacySubject, w io.Writer) error
+	// ListLog returns the privacy log, newest first
+	ListLog(ctx context.Context, companyId string, limit, offset int) (*model.PrivacyLogPage, error)
+}
+
+var (
+	// ErrInvalidPrivacyRequest is returned for requests without a valid phone number
+	ErrInvalidPrivacyRequest = errors.New("invalid privacy request")
+	// ErrPrivacySubjectNotFound is returned when nothing is stored about the phone number
+	ErrPrivacySubjectNotFound = errors.New("no data found for this phone number")
+)
+
+// privacyBatchSize is how many messages are read or redacted at a time
+const privacyBatchSize = 500
+
+// NewPrivacyService constructs a PrivacyService removing erased media from store.
+// Archived messages of the subject's chats are covered through archives, which may be nil.
+func NewPrivacyService(repo repository.PrivacyRepository, store storage.Store, archives ArchiveService, hashSecret string) PrivacyService {
+	return &privacyService{repo: repo, store: store, archives: archives, hashSecret: []byte(hashSecret)}
+}
+
+type privacyService struct {
+	repo     repository.PrivacyRepository
+	store    storage.Store
+	archives ArchiveService
+	// hashSecret keys the phone hashes of the privacy log
+	hashSecret []byte
+}
+
+// find collects the subject's contacts and chats and counts its messages
+func (s *privacyService) find(ctx context.Context, companyId string, in model.PrivacyRequest) (*model.PrivacySubject, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	in.PhoneNumber = strings.TrimSpace(in.PhoneNumber)
+	if phone.Normalize(in.PhoneNumber, phone.RegionFor(companyId)) == "" {
+		return nil, fmt.Errorf("%w: phone_number is required", ErrInvalidPrivacyRequest)
+	}
+
+	contacts, err := s.repo.FindContacts(ctx, companyId, in.PhoneNumber, in.AgentID)
+	if err != nil {
+		return nil, err
+	}
+	var chatIds []string
+	for _, c := range contacts {
+		if c.ChatID != "" {
+			chatIds = append(chatIds, c.ChatID)
+		}
+	}
+	chats, err := s.repo.FindChats(ctx, companyId, in.PhoneNumber, in.AgentID, chatIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range chats {
+		chatIds = append(chatIds, c.ChatID)
+	}
+
+	subject := &model.PrivacySubject{
+		PhoneNumber: in.PhoneNumber,
+		AgentID:     in.AgentID,
+		GeneratedAt: time.Now().UTC(),
+		Contacts:    contacts,
+		Chats:       chats,
+		Scope:       model.PrivacyScope{PhoneNumber: in.PhoneNumber, AgentID: in.AgentID, ChatIDs: uniqueStrings(chatIds)},
+	}
+	if subject.MessageCount, err = s.repo.CountMessages(ctx, companyId, subject.Scope); err != nil {
+		return nil, fmt.Errorf("failed to count messages: %w", err)
+	}
+	if len(contacts) == 0 && len(chats) == 0 && subject.MessageCount == 0 {
+		return nil, ErrPrivacySubjectNotFound
+	}
+	return subject, nil
+}
+
+// logEntry describes a request on subject for the privacy log
+func (s *privacyService) logEntry(companyId, action string, subject *model.PrivacySubject) *model.PrivacyLog {
+	ids := make([]string, 0, len(subject.Contacts))
+	for _, c := range subject.Contacts {
+		ids = append(ids, c.ID)
+	}
+	return &model.PrivacyLog{
+		Action:     action,
+		PhoneHash:  s.phoneHash(companyId, subject.PhoneNumber),
+		AgentID:    subject.AgentID,
+		ContactIDs: strings.Join(ids, ","),
+		Contacts:   int64(len(subject.Contacts)),
+		Chats:      int64(len(subject.Chats)),
+		Messages:   subject.MessageCount,
+	}
+}
+
+// phoneHash is the HMAC-SHA256 of the number's E.164 form, so the log can be searched
+// for a number without storing it. Phone numbers are few enough to be enumerated, so
+// a plain hash would be reversible; the key keeps it opaque to readers of the database.
+func (s *privacyService) phoneHash(companyId, raw string) string {
+	mac := hmac.New(sha256.New, s.hashSecret)
+	mac.Write([]byte(phone.Normalize(raw, phone.RegionFor(companyId))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *privacyService) Erase(ctx context.Context, companyId string, in model.PrivacyRequest) (*model.PrivacyLog, error) {
+	subject, err := s.find(ctx, companyId, in)
+	if err != nil {
+		return nil, err
+	}
+	entry := s.logEntry(companyId, model.PrivacyActionErase, subject)
+	entry.Messages = 0
+
+	// Media goes first: a failed deletion leaves the message intact, so retrying finds it again
+	for {
+		batch, err := s.repo.FetchUnredacted(ctx, companyId, subject.Scope, privacyBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			deleted, err := s.deleteMedia(ctx, companyId, &batch[i])
+			if err != nil {
+				return nil, err
+			}
+			if deleted {
+				entry.MediaFiles++
+			}
+		}
+		if err := s.repo.RedactMessages(ctx, companyId, subject.PhoneNumber, batch); err != nil {
+			return nil, err
+		}
+		entry.Messages += int64(len(batch))
+		if len(batch) < privacyBatchSize {
+			break
+		}
+	}
+
+	// Archives only hold messages by chat, so they are redacted for the subject's chats
+	if s.archives != nil && len(subject.Scope.ChatIDs) > 0 {
+		n, err := s.archives.RewriteChats(ctx, companyId, subject.AgentID, subject.Scope.ChatIDs, func(msg *model.Message) error {
+			deleted, err := s.deleteMedia(ctx, companyId, msg)
+			if err != nil {
+				return err
+			}
+			if deleted {
+				entry.MediaFiles++
+			}
+			redactMessage(companyId, msg, subject.PhoneNumber)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to redact archived messages: %w", err)
+		}
+		entry.Messages += n
+	}
+
+	if err := s.repo.AnonymizeChats(ctx, companyId, subject.Chats); err != nil {
+		return nil, fmt.Errorf("failed to anonymize chats: %w", err)
+	}
+	if err := s.repo.AnonymizeContacts(ctx, companyId, subject.Contacts); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateLog(ctx, companyId, entry); err != nil {
+		return nil, fmt.Errorf("failed to record privacy log: %w", err)
+	}
+	return entry, nil
+}
+
+// deleteMedia removes the stored attachment of msg. Returns whether a file was removed.
+func (s *privacyService) deleteMedia(ctx context.Context, companyId string, msg *model.Message) (bool, error) {
+	if payload.Media(msg.MessageObj) == nil && (msg.MessageUrl == "" || isExternalURL(msg.MessageUrl)) {
+		return false, nil
+	}
+	key := mediaKey(companyId, msg)
+	if _, err := s.store.Stat(ctx, key); errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err := s.store.Delete(ctx, key); err != nil {
+		return false, fmt.Errorf("failed to delete media of message %s: %w", msg.MessageID, err)
+	}
+	return true, nil
+}
+
+// redactMessage clears the content of an archived message like RedactMessages does for stored ones
+func redactMessage(companyId string, msg *model.Message, phoneNumber string) {
+	msg.MessageText = ""
+	msg.MessageUrl = ""
+	msg.MessageObj = []byte("{}")
+	msg.EditedMessageObj = nil
+	msg.Jid = ""
+	var key map[string]json.RawMessage
+	if len(msg.Key) > 0 && json.Unmarshal(msg.Key, &key) == nil && key != nil {
+		for _, field := range repository.KeyJIDFields {
+			delete(key, field)
+		}
+		msg.Key, _ = json.Marshal(key)
+	}
+
+	region := phone.RegionFor(companyId)
+	subject := phone.Normalize(phoneNumber, region)
+	if phone.Normalize(msg.FromPhone, region) == subject {
+		msg.FromPhone = ""
+	}
+	if phone.Normalize(msg.ToPhone, region) == subject {
+		msg.ToPhone = ""
+	}
+}
+
+func (s *privacyService) PrepareExport(ctx context.Context, companyId string, in model.PrivacyRequest) (*model.PrivacySubject, error) {
+	subject, err := s.find(ctx, companyId, in)
+	if err != nil {
+		return nil, err
+	}
+	var contactIds []string
+	for _, c := range subject.Contacts {
+		contactIds = append(contactIds, c.ID)
+	}
+	if subject.ContactHistory, err = s.repo.FetchContactHistory(ctx, companyId, contactIds); err != nil {
+		return nil, err
+	}
+	if subject.ContactHistory == nil {
+		subject.ContactHistory = make([]model.ContactHistory, 0)
+	}
+
+	entry := s.logEntry(companyId, model.PrivacyActionExport, subject)
+	if err := s.repo.CreateLog(ctx, companyId, entry); err != nil {
+		return nil, fmt.Errorf("failed to record privacy log: %w", err)
+	}
+	subject.LogID = entry.ID
+	return subject, nil
+}
+
+// WriteExport writes the subject as a JSON object whose "messages" array is
+// streamed in batches, so large histories never load at once.
+func (s *privacyService) WriteExport(ctx context.Context, companyId string, subject *model.PrivacySubject, w io.Writer) error {
+	header, err := json.Marshal(subject)
+	if err != nil {
+		return err
+	}
+	// Reopen the header object to append the messages array
+	if _, err := w.Write(header[:len(header)-1]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `,"messages":[`); err != nil {
+		return err
+	}
+
+	first := true
+	write := func(msg *model.Message) error {
+		msg.Media = payload.Media(msg.MessageObj)
+		raw, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err = w.Write(raw)
+		return err
+	}
+	err = s.repo.StreamMessages(ctx, companyId, subject.Scope, privacyBatchSize, func(batch []model.Message) error {
+		for i := range batch {
+			if err := write(&batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if s.archives != nil && len(subject.Scope.ChatIDs) > 0 {
+		if err := s.archives.StreamChats(ctx, companyId, subject.AgentID, subject.Scope.ChatIDs, write); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "]}")
+	return err
+}
+
+func (s *privacyService) ListLog(ctx context.Context, companyId string, limit, offset int) (*model.PrivacyLogPage, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	if limit <= 0 {
+		limit = 20
+	} else if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.ListLog(ctx, companyId, limit, offset)
+}
+
+// uniqueStrings removes duplicates, keeping the first occurrence
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	out := values[:0]
+	for _, v := range values {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		out = append(out, v)
+	}
+	return out
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/cache"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/ratelimit"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+)
+
+// RateLimitService enforces per-tenant request rates and monthly quotas, and
+// reports usage.
+type RateLimitService interface {
+	// Allow counts a request of an API key (tokenId) to path against the company's
+	// rate limit and, with enforceQuota, its monthly quota. When the limiter fails
+	// the returned decision allows the request and the error is reported too.
+	Allow(ctx context.Context, companyId, tokenId, path string, enforceQuota bool) (*model.RateLimitDecision, error)
+	// Usage returns the current month's usage, the limits in force and up to months
+	// months of history, newest first
+	Usage(ctx context.Context, companyId string, months int) (*model.UsageReport, error)
+	// Flush writes the usage counted by this replica to the database
+	Flush(ctx context.Context) error
+}
+
+// limitsTTL is how long a tenant's limits are reused before being read again
+const limitsTTL = time.Minute
+
+// usageRefresh is how long a month's stored total is reused; requests counted by
+// other replicas become visible after their flush and this delay, so the quota may
+// be overrun by what they serve in up to USAGE_FLUSH_INTERVAL + usageRefresh
+const usageRefresh = 30 * time.Second
+
+// maxUsageMonths bounds the history returned by Usage
+const maxUsageMonths = 36
+
+// NewRateLimitService counts requests in counters. defaults apply to tenants
+// without configured limits; defaults.Requests <= 0 disables the default rate limit.
+func NewRateLimitService(repo repository.RateLimitRepository, counters ratelimit.Store, defaults model.RateLimit) RateLimitService {
+	if defaults.WindowSeconds <= 0 {
+		defaults.WindowSeconds = 60
+	}
+	return &rateLimitService{
+		repo:     repo,
+		counters: counters,
+		defaults: defaults,
+		limits:   newResultCache(cache.TagRateLimits, limitsTTL),
+		pending:  make(map[usageKey]*usageDelta),
+		totals:   make(map[string]monthTotal),
+	}
+}
+
+type rateLimitService struct {
+	repo     repository.RateLimitRepository
+	counters ratelimit.Store
+	defaults model.RateLimit
+	limits   *resultCache
+
+	mu sync.Mutex
+	// pending holds the usage counted since the last flush
+	pending map[usageKey]*usageDelta
+	// totals holds each company's stored total of the current month
+	totals map[string]monthTotal
+}
+
+type usageKey struct {
+	companyId string
+	month     string
+}
+
+type usageDelta struct {
+	requests int64
+	rejected int64
+}
+
+type monthTotal struct {
+	month    string
+	requests int64
+	loadedAt time.Time
+}
+
+func (s *rateLimitService) Allow(
+	ctx context.Context,
+	companyId, tokenId, path string,
+	enforceQuota bool,
+) (*model.RateLimitDecision, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+
+	now := time.Now().UTC()
+	month := now.Format("2006-01")
+	limits, err := s.tenantLimits(ctx, companyId)
+	decision := &model.RateLimitDecision{Allowed: true}
+
+	if quota := s.quota(limits); enforceQuota && quota > 0 {
+		used, usageErr := s.monthRequests(ctx, companyId, month)
+		if usageErr != nil {
+			err = errors.Join(err, usageErr)
+		} else if used >= quota {
+			decision.Allowed = false
+			decision.QuotaExceeded = true
+			decision.QuotaResetAt = nextMonth(now)
+			s.record(companyId, month, false)
+			return decision, err
+		}
+	}
+
+	limit := s.match(limits, path)
+	if limit.Requests > 0 {
+		window := time.Duration(limit.WindowSeconds) * time.Second
+		w := ratelimit.WindowAt(now, window)
+		scope := limit.PathPrefix
+		if scope == "" {
+			scope = "*"
+		}
+
+		count, countErr := s.counters.Incr(ctx, ratelimit.Key(w, companyId, scope), window)
+		if countErr != nil {
+			s.record(companyId, month, true)
+			return decision, errors.Join(err, countErr)
+		}
+		decision.Window = window
+		decision.Reset = w.End.Sub(now)
+		decision.Limit = limit.Requests
+		decision.Remaining = max(limit.Requests-count, 0)
+		decision.Allowed = count <= limit.Requests
+
+		if limit.KeyRequests != nil && *limit.KeyRequests > 0 && tokenId != "" {
+			keyCount, countErr := s.counters.Incr(ctx, ratelimit.Key(w, companyId, "key", tokenId, scope), window)
+			if countErr != nil {
+				err = errors.Join(err, countErr)
+			} else {
+				if remaining := max(*limit.KeyRequests-keyCount, 0); remaining < decision.Remaining || keyCount > *limit.KeyRequests {
+					decision.Limit = *limit.KeyRequests
+					decision.Remaining = remaining
+				}
+				decision.Allowed = decision.Allowed && keyCount <= *limit.KeyRequests
+			}
+		}
+	}
+
+	s.record(companyId, month, decision.Allowed)
+	return decision, err
+}
+
+func (s *rateLimitService) Usage(ctx context.Context, companyId string, months int) (*model.UsageReport, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	if months <= 0 {
+		months = 12
+	} else if months > maxUsageMonths {
+		months = maxUsageMonths
+	}
+
+	limits, err := s.tenantLimits(ctx, companyId)
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.repo.ListUsage(ctx, companyId, months)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	report := &model.UsageReport{
+		Month:    now.Format("2006-01"),
+		ResetsAt: nextMonth(now),
+		Limits:   limits,
+		History:  history,
+	}
+	if report.History == nil {
+		report.History = []model.MonthlyUsage{}
+	}
+
+	// Add what this replica has not flushed yet
+	s.mu.Lock()
+	for i := range report.History {
+		if delta, ok := s.pending[usageKey{companyId, report.History[i].Month}]; ok {
+			report.History[i].Requests += delta.requests
+			report.History[i].Rejected += delta.rejected
+		}
+	}
+	if len(report.History) == 0 || report.History[0].Month != report.Month {
+		if delta, ok := s.pending[usageKey{companyId, report.Month}]; ok {
+			current := model.MonthlyUsage{Month: report.Month, Requests: delta.requests, Rejected: delta.rejected}
+			report.History = append([]model.MonthlyUsage{current}, report.History...)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(report.History) > 0 && report.History[0].Month == report.Month {
+		report.Requests = report.History[0].Requests
+		report.Rejected = report.History[0].Rejected
+	}
+	if len(report.History) > months {
+		report.History = report.History[:months]
+	}
+	if quota := s.quota(limits); quota > 0 {
+		remaining := max(quota-report.Requests, 0)
+		report.Quota = &quota
+		report.Remaining = &remaining
+	}
+	return report, nil
+}
+
+func (s *rateLimitService) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[usageKey]*usageDelta)
+	s.mu.Unlock()
+
+	var errs []error
+	for key, delta := range pending {
+		err := s.repo.AddUsage(ctx, key.companyId, key.month, delta.requests, delta.rejected)
+
+		s.mu.Lock()
+		if err != nil {
+			// Keep the counts for the next flush
+			errs = append(errs, err)
+			current := s.pendingDelta(key)
+			current.requests += delta.requests
+			current.rejected += delta.rejected
+		} else if total, ok := s.totals[key.companyId]; ok && total.month == key.month {
+			total.requests += delta.requests
+			s.totals[key.companyId] = total
+		}
+		s.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// tenantLimits returns the configured limits, or the defaults when there are none.
+// On failure the defaults are returned with the error.
+func (s *rateLimitService) tenantLimits(ctx context.Context, companyId string) ([]model.RateLimit, error) {
+	var cached []model.RateLimit
+	generation, ok := s.limits.Get(ctx, companyId, "limits", &cached)
+	if ok {
+		return cached, nil
+	}
+
+	limits, err := s.repo.ListLimits(ctx, companyId)
+	if err != nil {
+		return []model.RateLimit{s.defaults}, err
+	}
+	if len(limits) == 0 {
+		limits = []model.RateLimit{s.defaults}
+	}
+	s.limits.Set(ctx, companyId, "limits", generation, limits)
+	return limits, nil
+}
+
+// match returns the limit with the longest prefix of path; limits are sorted by
+// decreasing prefix length. Without a company default the server default applies.
+func (s *rateLimitService) match(limits []model.RateLimit, path string) model.RateLimit {
+	for _, limit := range limits {
+		if strings.HasPrefix(path, limit.PathPrefix) {
+			if limit.WindowSeconds <= 0 {
+				limit.WindowSeconds = s.defaults.WindowSeconds
+			}
+			return limit
+		}
+	}
+	return s.defaults
+}
+
+// quota returns the monthly quota of the company default, 0 when unlimited
+func (s *rateLimitService) quota(limits []model.RateLimit) int64 {
+	for _, limit := range limits {
+		if limit.PathPrefix == "" {
+			if limit.MonthlyQuota == nil {
+				return 0
+			}
+			return *limit.MonthlyQuota
+		}
+	}
+	if s.defaults.MonthlyQuota == nil {
+		return 0
+	}
+	return *s.defaults.MonthlyQuota
+}
+
+// monthRequests returns the company's requests of the month: the stored total
+// plus what this replica has not flushed yet.
+func (s *rateLimitService) monthRequests(ctx context.Context, companyId, month string) (int64, error) {
+	s.mu.Lock()
+	total, ok := s.totals[companyId]
+	s.mu.Unlock()
+
+	if !ok || total.month != month || time.Since(total.loadedAt) > usageRefresh {
+		usage, err := s.repo.ListUsage(ctx, companyId, 1)
+		if err != nil {
+			return 0, err
+		}
+		total = monthTotal{month: month, loadedAt: time.Now()}
+		if len(usage) > 0 && usage[0].Month == month {
+			total.requests = usage[0].Requests
+		}
+		s.mu.Lock()
+		s.totals[companyId] = total
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if delta, ok := s.pending[usageKey{companyId, month}]; ok {
+		total.requests += delta.requests
+	}
+	return total.requests, nil
+}
+
+// record counts a request as served or rejected
+func (s *rateLimitService) record(companyId, month string, allowed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delta := s.pendingDelta(usageKey{companyId, month})
+	if allowed {
+		delta.requests++
+	} else {
+		delta.rejected++
+	}
+}
+
+// pendingDelta returns the unflushed usage of key; the caller holds mu
+func (s *rateLimitService) pendingDelta(key usageKey) *usageDelta {
+	delta, ok := s.pending[key]
+	if !ok {
+		delta = &usageDelta{}
+		s.pending[key] = delta
+	}
+	return delta
+}
+
+// nextMonth returns the start of the month after t's, in UTC
+func nextMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,398 @@
+// internal/service/retention.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+)
+
+// RetentionService manages retention policies and removes the data they expire
+type RetentionService interface {
+	// GetPolicies returns the company default first, then agent policies
+	GetPolicies(ctx context.Context, companyId string) ([]model.RetentionPolicy, error)
+	// SetPolicy replaces the company default (agentId "") or an agent's policy
+	SetPolicy(ctx context.Context, companyId, agentId string, in model.RetentionPolicyInput) (*model.RetentionPolicy, error)
+	// DeletePolicy removes an agent's policy, which then inherits the company default
+	DeletePolicy(ctx context.Context, companyId, agentId string) error
+	// Report is a dry run: what Enforce would remove now
+	Report(ctx context.Context, companyId string) (*model.RetentionReport, error)
+	// Enforce removes expired partitions and rows. Returns nil when the tenant has no
+	// policy or another enforcement of the tenant is in progress.
+	Enforce(ctx context.Context, companyId string) (*model.RetentionRun, error)
+	// ListRuns returns past enforcements, newest first
+	ListRuns(ctx context.Context, companyId string, limit, offset int) (*model.RetentionRunPage, error)
+}
+
+var (
+	// ErrInvalidRetentionPolicy is returned for invalid retention policies
+	ErrInvalidRetentionPolicy = errors.New("invalid retention policy")
+	// ErrRetentionPolicyNotFound is returned when deleting an agent policy that does not exist
+	ErrRetentionPolicyNotFound = errors.New("retention policy not found")
+)
+
+const (
+	// retentionBatchSize bounds the rows removed per statement, keeping locks short
+	retentionBatchSize = 1000
+	// retentionStaleAfter is how long a run may go without progress before it is
+	// considered dead and another one may start
+	retentionStaleAfter = 5 * time.Minute
+	// maxRetentionDays bounds retention periods (100 years)
+	maxRetentionDays = 36500
+)
+
+// retentionTarget is one policy applied to messages or contacts
+type retentionTarget struct {
+	model.RetentionTarget
+	scope model.RetentionScope
+}
+
+// retentionPlan is what the tenant's policies expire at a given time
+type retentionPlan struct {
+	messages []retentionTarget
+	contacts []retentionTarget
+	// partitionsBefore is the date before which every message expired, whatever
+	// its agent; zero when some messages are kept forever
+	partitionsBefore time.Time
+}
+
+// NewRetentionService constructs a RetentionService. Expired message partitions are dropped;
+// message archives, when archives is not nil, expire like the partitions they replaced.
+func NewRetentionService(repo repository.RetentionRepository, archives ArchiveService) RetentionService {
+	return &retentionService{repo: repo, archives: archives}
+}
+
+type retentionService struct {
+	repo     repository.RetentionRepository
+	archives ArchiveService
+}
+
+func (s *retentionService) GetPolicies(ctx context.Context, companyId string) ([]model.RetentionPolicy, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	policies, err := s.repo.ListPolicies(ctx, companyId)
+	if err != nil {
+		return nil, err
+	}
+	if policies == nil {
+		policies = make([]model.RetentionPolicy, 0)
+	}
+	return policies, nil
+}
+
+func (s *retentionService) SetPolicy(ctx context.Context, companyId, agentId string, in model.RetentionPolicyInput) (*model.RetentionPolicy, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	for field, days := range map[string]*int{
+		"message_days":          in.MessageDays,
+		"inactive_contact_days": in.InactiveContactDays,
+	} {
+		if days != nil && (*days < 0 || *days > maxRetentionDays) {
+			return nil, fmt.Errorf("%w: %s must be between 0 and %d", ErrInvalidRetentionPolicy, field, maxRetentionDays)
+		}
+	}
+	if agentId != "" && in.MessageDays == nil && in.InactiveContactDays == nil {
+		return nil, fmt.Errorf("%w: set message_days or inactive_contact_days, or delete the policy to inherit the company default",
+			ErrInvalidRetentionPolicy)
+	}
+
+	policy := &model.RetentionPolicy{
+		AgentID:             agentId,
+		MessageDays:         in.MessageDays,
+		InactiveContactDays: in.InactiveContactDays,
+	}
+	if err := s.repo.SavePolicy(ctx, companyId, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (s *retentionService) DeletePolicy(ctx context.Context, companyId, agentId string) error {
+	if companyId == "" {
+		return errors.New("companyId is required")
+	}
+	if agentId == "" {
+		return errors.New("agentId is required")
+	}
+	deleted, err := s.repo.DeletePolicy(ctx, companyId, agentId)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrRetentionPolicyNotFound
+	}
+	return nil
+}
+
+// retentionCutoff returns the first day kept: messages dated before it expire.
+// Today always counts as kept, so days=30 keeps today and the 30 previous days.
+func retentionCutoff(now time.Time, days int) time.Time {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -days)
+}
+
+// planTargets resolves the company default and agent overrides into targets.
+// pick selects the field of a policy (messages or contacts).
+func planTargets(policies []model.RetentionPolicy, now time.Time, pick func(model.RetentionPolicy) *int) (targets []retentionTarget, allBefore time.Time) {
+	var fallback *int
+	var overridden []string
+	for _, p := range policies {
+		if p.AgentID == "" {
+			fallback = pick(p)
+		} else if pick(p) != nil {
+			overridden = append(overridden, p.AgentID)
+		}
+	}
+
+	// Everything expires before allBefore only when no agent keeps its data forever
+	keepsForever := fallback == nil || *fallback == 0
+	add := func(agentId string, days int, scope model.RetentionScope) {
+		scope.Before = retentionCutoff(now, days)
+		targets = append(targets, retentionTarget{
+			RetentionTarget: model.RetentionTarget{AgentID: agentId, Days: days, Before: scope.Before},
+			scope:           scope,
+		})
+		if allBefore.IsZero() || scope.Before.Before(allBefore) {
+			allBefore = scope.Before
+		}
+	}
+	if !keepsForever {
+		add("", *fallback, model.RetentionScope{ExcludeAgents: overridden})
+	}
+	for _, p := range policies {
+		days := pick(p)
+		if p.AgentID == "" || days == nil {
+			continue
+		}
+		if *days == 0 {
+			keepsForever = true
+			continue
+		}
+		add(p.AgentID, *days, model.RetentionScope{AgentID: p.AgentID})
+	}
+
+	if keepsForever {
+		allBefore = time.Time{}
+	}
+	return targets, allBefore
+}
+
+func (s *retentionService) plan(policies []model.RetentionPolicy, now time.Time) retentionPlan {
+	var plan retentionPlan
+	plan.messages, plan.partitionsBefore = planTargets(policies, now, func(p model.RetentionPolicy) *int { return p.MessageDays })
+	plan.contacts, _ = planTargets(policies, now, func(p model.RetentionPolicy) *int { return p.InactiveContactDays })
+	return plan
+}
+
+// expiredPartitions returns the messages partitions entirely before the plan's cutoff
+func (s *retentionService) expiredPartitions(ctx context.Context, companyId string, plan retentionPlan) ([]model.MessagePartition, error) {
+	if plan.partitionsBefore.IsZero() {
+		return nil, nil
+	}
+	partitions, err := s.repo.MessagePartitions(ctx, companyId)
+	if err != nil {
+		return nil, err
+	}
+	var expired []model.MessagePartition
+	for _, p := range partitions {
+		if !p.To.After(plan.partitionsBefore) {
+			expired = append(expired, p)
+		}
+	}
+	return expired, nil
+}
+
+// expiredArchives returns the message archives entirely before the plan's cutoff.
+// Archives hold every agent's messages, so they only expire with the partitions.
+func (s *retentionService) expiredArchives(ctx context.Context, companyId string, plan retentionPlan) ([]model.MessageArchive, error) {
+	if plan.partitionsBefore.IsZero() || s.archives == nil {
+		return nil, nil
+	}
+	return s.archives.Expired(ctx, companyId, plan.partitionsBefore)
+}
+
+func (s *retentionService) Report(ctx context.Context, companyId string) (*model.RetentionReport, error) {
+	policies, err := s.GetPolicies(ctx, companyId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	report := &model.RetentionReport{
+		GeneratedAt: now.UTC(),
+		Policies:    policies,
+		Partitions:  make([]model.RetentionPartition, 0),
+		Archives:    make([]model.MessageArchive, 0),
+		Messages:    make([]model.RetentionTarget, 0),
+		Contacts:    make([]model.RetentionTarget, 0),
+	}
+	plan := s.plan(policies, now)
+
+	partitions, err := s.expiredPartitions(ctx, companyId, plan)
+	if err != nil {
+		return nil, err
+	}
+	skip := make([]string, 0, len(partitions))
+	for _, p := range partitions {
+		rows, err := s.repo.CountPartition(ctx, companyId, p.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count partition %s: %w", p.Name, err)
+		}
+		report.Partitions = append(report.Partitions, model.RetentionPartition{
+			Name: p.Name, From: p.From, To: p.To, Rows: rows, Action: model.RetentionPartitionDrop,
+		})
+		report.TotalMessages += rows
+		skip = append(skip, p.Name)
+	}
+
+	archives, err := s.expiredArchives(ctx, companyId, plan)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range archives {
+		report.Archives = append(report.Archives, a)
+		report.TotalMessages += a.Rows
+	}
+
+	for _, t := range plan.messages {
+		t.scope.SkipPartitions = skip
+		rows, err := s.repo.CountExpiredMessages(ctx, companyId, t.scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count expired messages: %w", err)
+		}
+		t.Rows = rows
+		report.Messages = append(report.Messages, t.RetentionTarget)
+		report.TotalMessages += rows
+	}
+	for _, t := range plan.contacts {
+		rows, err := s.repo.CountInactiveContacts(ctx, companyId, t.scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count inactive contacts: %w", err)
+		}
+		t.Rows = rows
+		report.Contacts = append(report.Contacts, t.RetentionTarget)
+		report.TotalContacts += rows
+	}
+	return report, nil
+}
+
+// Enforce removes whole expired partitions and message archives first, then deletes the remaining expired
+// messages and inactive contacts in batches, storing progress after each batch.
+// A partition that cannot be removed (e.g. its lock is not granted in time) is left
+// to the batch deletes. An interrupted run is failed; the next one starts over.
+func (s *retentionService) Enforce(ctx context.Context, companyId string) (*model.RetentionRun, error) {
+	policies, err := s.GetPolicies(ctx, companyId)
+	if err != nil {
+		return nil, err
+	}
+	plan := s.plan(policies, time.Now())
+	if len(plan.messages) == 0 && len(plan.contacts) == 0 {
+		return nil, nil
+	}
+
+	run, err := s.repo.StartRun(ctx, companyId, time.Now().Add(-retentionStaleAfter))
+	if err != nil || run == nil {
+		return nil, err
+	}
+
+	var notes []string
+	finish := func(err error) (*model.RetentionRun, error) {
+		now := time.Now()
+		run.FinishedAt = &now
+		run.Status = model.RetentionRunCompleted
+		if err != nil {
+			run.Status = model.RetentionRunFailed
+			notes = append(notes, err.Error())
+		}
+		run.Error = strings.Join(notes, "; ")
+		if uerr := s.repo.UpdateRun(context.WithoutCancel(ctx), companyId, run); uerr != nil && err == nil {
+			err = uerr
+		}
+		return run, err
+	}
+
+	partitions, err := s.expiredPartitions(ctx, companyId, plan)
+	if err != nil {
+		return finish(err)
+	}
+	var removed []string
+	for _, p := range partitions {
+		if err := s.repo.RemovePartition(ctx, companyId, p.Name); err != nil {
+			if ctx.Err() != nil {
+				return finish(ctx.Err())
+			}
+			notes = append(notes, fmt.Sprintf("partition %s left to batch deletes: %v", p.Name, err))
+			continue
+		}
+		removed = append(removed, p.Name)
+		run.Partitions = strings.Join(removed, ",")
+		if err := s.repo.UpdateRun(ctx, companyId, run); err != nil {
+			return finish(err)
+		}
+	}
+
+	archives, err := s.expiredArchives(ctx, companyId, plan)
+	if err != nil {
+		return finish(err)
+	}
+	for i := range archives {
+		if err := s.archives.Remove(ctx, companyId, &archives[i]); err != nil {
+			return finish(fmt.Errorf("failed to remove archive %s: %w", archives[i].Partition, err))
+		}
+		run.DeletedArchives++
+		if err := s.repo.UpdateRun(ctx, companyId, run); err != nil {
+			return finish(err)
+		}
+	}
+
+	deleteAll := func(targets []retentionTarget, del func(context.Context, string, model.RetentionScope, int) (int64, error), counter *int64) error {
+		for _, t := range targets {
+			for {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				n, err := del(ctx, companyId, t.scope, retentionBatchSize)
+				if err != nil {
+					return err
+				}
+				*counter += n
+				if err := s.repo.UpdateRun(ctx, companyId, run); err != nil {
+					return err
+				}
+				if n < retentionBatchSize {
+					break
+				}
+			}
+		}
+		return nil
+	}
+	if err := deleteAll(plan.messages, s.repo.DeleteExpiredMessages, &run.DeletedMessages); err != nil {
+		return finish(fmt.Errorf("failed to delete expired messages: %w", err))
+	}
+	if err := deleteAll(plan.contacts, s.repo.DeleteInactiveContacts, &run.DeletedContacts); err != nil {
+		return finish(fmt.Errorf("failed to delete inactive contacts: %w", err))
+	}
+	return finish(nil)
+}
+
+func (s *retentionService) ListRuns(ctx context.Context, companyId string, limit, offset int) (*model.RetentionRunPage, error) {
+	if companyId == "" {
+		return nil, errors.New("companyId is required")
+	}
+	if limit <= 0 {
+		limit = 20
+	} else if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.ListRuns(ctx, companyId, limit, offset)
+}
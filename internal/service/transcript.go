@@ -0,0 +1,194 @@
+// internal/service/transcript.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/payload"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/repository"
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/transcript"
+)
+
+// TranscriptService renders complete chat transcripts
+type TranscriptService interface {
+	// Prepare resolves the chat, contact and agent names of a transcript. It runs
+	// before streaming starts, so a missing chat can still be reported as an error.
+	// A zero from or to leaves that side of the period open. Without agentId, a chat
+	// held by several agents is repository.ErrAmbiguousChat.
+	Prepare(ctx context.Context, companyId, chatId, agentId string, from, to time.Time, loc *time.Location) (*model.TranscriptHeader, error)
+	// Write streams every message of the prepared chat to w in format, archived ones first
+	Write(ctx context.Context, companyId string, header *model.TranscriptHeader, format string, w io.Writer) error
+}
+
+// ErrChatNotFound is returned when the chat does not exist
+var ErrChatNotFound = errors.New("chat not found")
+
+// transcriptBatchSize is how many messages are read from the database at a time
+const transcriptBatchSize = 500
+
+// NewTranscriptService constructs a TranscriptService; archives may be nil
+func NewTranscriptService(
+	chats repository.ChatRepository,
+	messages repository.MessageRepository,
+	agents repository.AgentRepository,
+	archives ArchiveService,
+) TranscriptService {
+	return &transcriptService{chats: chats, messages: messages, agents: agents, archives: archives}
+}
+
+type transcriptService struct {
+	chats    repository.ChatRepository
+	messages repository.MessageRepository
+	agents   repository.AgentRepository
+	archives ArchiveService
+}
+
+func (s *transcriptService) Prepare(
+	ctx context.Context,
+	companyId, chatId, agentId string,
+	from, to time.Time,
+	loc *time.Location,
+) (*model.TranscriptHeader, error) {
+	if !from.IsZero() && !to.IsZero() && !to.After(from) {
+		return nil, errors.New("to must be after from")
+	}
+
+	chat, err := s.chats.GetChat(ctx, companyId, chatId, agentId)
+	if err != nil {
+		return nil, err
+	}
+	if chat == nil {
+		return nil, ErrChatNotFound
+	}
+
+	header := &model.TranscriptHeader{
+		ChatID:       chat.ChatID,
+		AgentID:      chat.AgentID,
+		AgentName:    chat.AgentID,
+		ContactName:  chatDisplayName(chat),
+		ContactPhone: chat.PhoneNumber,
+		IsGroup:      chat.IsGroup,
+		GeneratedAt:  time.Now().UTC(),
+		Location:     loc,
+	}
+	if !from.IsZero() {
+		header.From = &from
+	}
+	if !to.IsZero() {
+		header.To = &to
+	}
+
+	agent, err := s.agents.GetByAgentID(ctx, companyId, chat.AgentID)
+	if err != nil {
+		return nil, err
+	}
+	if agent != nil && agent.AgentName != "" {
+		header.AgentName = agent.AgentName
+	}
+	return header, nil
+}
+
+func (s *transcriptService) Write(
+	ctx context.Context,
+	companyId string,
+	header *model.TranscriptHeader,
+	format string,
+	w io.Writer,
+) error {
+	tw, err := transcript.NewWriter(format, w)
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	var from, to time.Time
+	if header.From != nil {
+		from = *header.From
+	}
+	if header.To != nil {
+		to = *header.To
+	}
+
+	// Archived messages are older than every stored one, and archives hold each chat in order
+	if s.archives != nil {
+		err := s.archives.StreamChats(ctx, companyId, header.AgentID, []string{header.ChatID}, func(msg *model.Message) error {
+			if !hasKey(msg) || !inPeriod(msg, from, to) {
+				return nil
+			}
+			return tw.WriteEntry(transcriptEntry(header, msg))
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read archived messages: %w", err)
+		}
+	}
+
+	err = s.messages.StreamMessages(ctx, companyId, header.AgentID, header.ChatID, from, to, transcriptBatchSize,
+		func(batch []model.Message) error {
+			for i := range batch {
+				if err := tw.WriteEntry(transcriptEntry(header, &batch[i])); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// inPeriod reports whether a message was sent within [from, to); zero bounds are open
+func inPeriod(msg *model.Message, from, to time.Time) bool {
+	return (from.IsZero() || msg.MessageTimestamp >= from.Unix()) &&
+		(to.IsZero() || msg.MessageTimestamp < to.Unix())
+}
+
+// transcriptEntry describes a message for a transcript. Outbound messages are
+// attributed to the agent; inbound ones to the contact, or in groups to the sender.
+func transcriptEntry(header *model.TranscriptHeader, msg *model.Message) *model.TranscriptEntry {
+	n := payload.Normalize(msg)
+
+	entry := &model.TranscriptEntry{
+		MessageID: msg.MessageID,
+		Timestamp: time.Unix(msg.MessageTimestamp, 0).UTC(),
+		Flow:      msg.Flow,
+		Kind:      n.Kind,
+		Text:      n.Text,
+		Media:     n.Media,
+		Edited:    n.Edited,
+		Deleted:   n.Deleted,
+	}
+	if entry.Text == "" {
+		entry.Text = msg.MessageText
+	}
+	if n.Reaction != nil {
+		entry.Text = n.Reaction.Emoji
+	}
+
+	switch {
+	case msg.Flow == model.MessageFlowOutbound:
+		entry.Sender = header.AgentName
+	case header.IsGroup && msg.FromPhone != "":
+		entry.Sender = msg.FromPhone
+	default:
+		entry.Sender = header.ContactName
+	}
+	return entry
+}
+
+// chatDisplayName prefers the contact's custom name, then the group or push name, then the number
+func chatDisplayName(chat *model.Chat) string {
+	for _, name := range []string{chat.ContactCustomName, chat.GroupName, chat.PushName, chat.PhoneNumber} {
+		if name != "" {
+			return name
+		}
+	}
+	return chat.ChatID
+}
@@ -0,0 +1,33 @@
+// Package storage abstracts where binary objects (media, exports, archives) live.
+// Keys are slash-separated paths such as "<companyId>/media/<messageId>".
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when no object exists under a key.
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModifiedAt  time.Time
+}
+
+// Store is a blob store. Implementations must be safe for concurrent use.
+type Store interface {
+	// Put writes the object, replacing any previous content under key.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Open returns a reader for the object; the caller closes it.
+	Open(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	// Stat returns the object's metadata without reading it.
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Delete removes the object; deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
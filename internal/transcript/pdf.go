@@ -0,0 +1,255 @@
+package transcript
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+	"golang.org/x/text/unicode/norm"
+)
+
+// A4 page layout in points
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 50
+	pdfFontSize   = 10
+	pdfLeading    = 14
+	// pdfLineChars approximates how many Helvetica characters fit on a line
+	pdfLineChars = 95
+)
+
+// Fixed object numbers; pages and their content streams follow from 5 on
+const (
+	pdfCatalogObj  = 1
+	pdfPagesObj    = 2
+	pdfFontObj     = 3
+	pdfBoldFontObj = 4
+	pdfFirstObj    = 5
+)
+
+// pdfWriter streams a minimal PDF using the standard Helvetica fonts, which every
+// PDF reader provides, so no font is embedded. Each page is flushed once full, and
+// the page tree and cross-reference table are written on Close. Text is limited to
+// the WinAnsi character set (see pdfEscape).
+type pdfWriter struct {
+	w       *countingWriter
+	header  *model.TranscriptHeader
+	offsets map[int]int64
+	nextObj int
+	pages   []int
+	page    bytes.Buffer
+	lines   int
+	err     error
+}
+
+func newPDFWriter(w io.Writer) *pdfWriter {
+	return &pdfWriter{
+		w:       &countingWriter{w: w},
+		offsets: make(map[int]int64),
+		nextObj: pdfFirstObj,
+	}
+}
+
+// linesPerPage is how many lines fit between the top and bottom margins
+const linesPerPage = (pdfPageHeight - 2*pdfMargin) / pdfLeading
+
+func (p *pdfWriter) WriteHeader(h *model.TranscriptHeader) error {
+	p.header = h
+	p.raw("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	p.object(pdfCatalogObj, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pdfPagesObj))
+	p.object(pdfFontObj, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	p.object(pdfBoldFontObj, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	lines := headerLines(h)
+	p.line(lines[0], true)
+	for _, line := range lines[1:] {
+		p.line(line, false)
+	}
+	p.line("", false)
+	return p.err
+}
+
+func (p *pdfWriter) WriteEntry(e *model.TranscriptEntry) error {
+	for _, line := range wrap(fmt.Sprintf("%s  %s", formatTime(e.Timestamp, p.header.Location), e.Sender), pdfLineChars) {
+		p.line(line, true)
+	}
+	for _, paragraph := range strings.Split(entryBody(e), "\n") {
+		for _, line := range wrap(paragraph, pdfLineChars) {
+			p.line("    "+line, false)
+		}
+	}
+	return p.err
+}
+
+func (p *pdfWriter) Close() error {
+	if p.lines > 0 || len(p.pages) == 0 {
+		p.flushPage()
+	}
+
+	kids := make([]string, len(p.pages))
+	for i, obj := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", obj)
+	}
+	p.object(pdfPagesObj, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+
+	// Cross-reference table: one entry per object, in object number order
+	xref := p.w.n
+	p.raw(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", p.nextObj))
+	for obj := 1; obj < p.nextObj; obj++ {
+		p.raw(fmt.Sprintf("%010d 00000 n \n", p.offsets[obj]))
+	}
+	p.raw(fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", p.nextObj, pdfCatalogObj, xref))
+	return p.err
+}
+
+// line adds one line of text, starting a new page when the current one is full
+func (p *pdfWriter) line(text string, bold bool) {
+	if p.lines == linesPerPage {
+		p.flushPage()
+	}
+	if p.lines == 0 {
+		fmt.Fprintf(&p.page, "BT\n%d TL\n%d %d Td\n", pdfLeading, pdfMargin, pdfPageHeight-pdfMargin)
+	}
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.page, "/%s %d Tf (%s) Tj T*\n", font, pdfFontSize, pdfEscape(text))
+	p.lines++
+}
+
+// flushPage writes the buffered page and its content stream
+func (p *pdfWriter) flushPage() {
+	if p.lines > 0 {
+		p.page.WriteString("ET\n")
+	}
+	pageObj, contentObj := p.nextObj, p.nextObj+1
+	p.nextObj += 2
+
+	p.object(pageObj, fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> >> /Contents %d 0 R >>",
+		pdfPagesObj, pdfPageWidth, pdfPageHeight, pdfFontObj, pdfBoldFontObj, contentObj))
+	p.object(contentObj, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.page.Len(), p.page.String()))
+
+	p.pages = append(p.pages, pageObj)
+	p.page.Reset()
+	p.lines = 0
+}
+
+func (p *pdfWriter) object(num int, body string) {
+	p.offsets[num] = p.w.n
+	p.raw(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", num, body))
+}
+
+func (p *pdfWriter) raw(s string) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = io.WriteString(p.w, s)
+}
+
+// winAnsiSpecials maps the characters WinAnsiEncoding places in 0x80-0x9F
+var winAnsiSpecials = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91,
+	'’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98,
+	'™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// winAnsi returns the WinAnsiEncoding byte of r
+func winAnsi(r rune) (byte, bool) {
+	switch {
+	case r >= 0x20 && r < 0x7F, r >= 0xA0 && r <= 0xFF:
+		return byte(r), true
+	}
+	b, ok := winAnsiSpecials[r]
+	return b, ok
+}
+
+// pdfEscape encodes text as a WinAnsi PDF string literal body. Accented letters
+// missing from WinAnsi lose their accents; invisible joiners, variation selectors
+// and emoji modifiers are dropped, and other characters become "?".
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+			continue
+		case '\t':
+			b.WriteString("    ")
+			continue
+		}
+		if c, ok := winAnsi(r); ok {
+			writePDFByte(&b, c)
+			continue
+		}
+		if r < 0x20 || unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf, unicode.Sk) {
+			continue
+		}
+		if c, ok := winAnsiBase(r); ok {
+			writePDFByte(&b, c)
+			continue
+		}
+		b.WriteByte('?')
+	}
+	return b.String()
+}
+
+// winAnsiBase returns the WinAnsi byte of r's base letter (e.g. "ő" -> "o")
+func winAnsiBase(r rune) (byte, bool) {
+	decomposed := []rune(norm.NFD.String(string(r)))
+	if len(decomposed) < 2 {
+		return 0, false
+	}
+	for _, mark := range decomposed[1:] {
+		if !unicode.Is(unicode.Mn, mark) {
+			return 0, false
+		}
+	}
+	return winAnsi(decomposed[0])
+}
+
+func writePDFByte(b *strings.Builder, c byte) {
+	if c < 0x80 {
+		b.WriteByte(c)
+		return
+	}
+	fmt.Fprintf(b, "\\%03o", c)
+}
+
+// wrap splits text into lines of at most width characters, breaking at spaces when possible
+func wrap(text string, width int) []string {
+	var lines []string
+	for utf8.RuneCountInString(text) > width {
+		runes := []rune(text)
+		cut := width
+		for i := width; i > width/2; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		lines = append(lines, string(runes[:cut]))
+		text = strings.TrimLeft(string(runes[cut:]), " ")
+	}
+	return append(lines, text)
+}
+
+// countingWriter tracks the byte offset needed for the cross-reference table
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
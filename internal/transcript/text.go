@@ -0,0 +1,107 @@
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+)
+
+// textWriter renders one line per message: "[time] sender: body"
+type textWriter struct {
+	w      io.Writer
+	header *model.TranscriptHeader
+}
+
+func (t *textWriter) WriteHeader(h *model.TranscriptHeader) error {
+	t.header = h
+	lines := headerLines(h)
+	_, err := fmt.Fprintf(t.w, "%s\n%s\n\n", strings.Join(lines, "\n"), strings.Repeat("=", 60))
+	return err
+}
+
+func (t *textWriter) WriteEntry(e *model.TranscriptEntry) error {
+	body := strings.ReplaceAll(entryBody(e), "\n", "\n    ")
+	_, err := fmt.Fprintf(t.w, "[%s] %s: %s\n", formatTime(e.Timestamp, t.header.Location), e.Sender, body)
+	return err
+}
+
+func (t *textWriter) Close() error { return nil }
+
+// jsonlWriter renders the header and every message as one JSON object per line
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &jsonlWriter{enc: enc}
+}
+
+func (j *jsonlWriter) WriteHeader(h *model.TranscriptHeader) error {
+	return j.enc.Encode(struct {
+		Type string `json:"type"`
+		*model.TranscriptHeader
+	}{"header", h})
+}
+
+func (j *jsonlWriter) WriteEntry(e *model.TranscriptEntry) error {
+	return j.enc.Encode(struct {
+		Type string `json:"type"`
+		*model.TranscriptEntry
+	}{"message", e})
+}
+
+func (j *jsonlWriter) Close() error { return nil }
+
+// htmlWriter renders a standalone page with inbound and outbound messages aligned apart
+type htmlWriter struct {
+	w      io.Writer
+	header *model.TranscriptHeader
+}
+
+const htmlHead = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>%s</title>
+<style>
+body{font-family:sans-serif;max-width:800px;margin:2em auto;color:#222}
+header{border-bottom:1px solid #ccc;margin-bottom:1em}
+.msg{margin:.5em 0;padding:.5em .75em;border-radius:6px;background:#f1f1f1;max-width:75%%;white-space:pre-wrap}
+.outbound{margin-left:auto;background:#dcf8c6}
+.meta{font-size:.8em;color:#666}
+</style></head><body>
+`
+
+func (t *htmlWriter) WriteHeader(h *model.TranscriptHeader) error {
+	t.header = h
+	lines := headerLines(h)
+	if _, err := fmt.Fprintf(t.w, htmlHead, html.EscapeString(lines[0])); err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("<header><h1>" + html.EscapeString(lines[0]) + "</h1>\n")
+	for _, line := range lines[1:] {
+		b.WriteString("<p>" + html.EscapeString(line) + "</p>\n")
+	}
+	b.WriteString("</header>\n")
+	_, err := io.WriteString(t.w, b.String())
+	return err
+}
+
+func (t *htmlWriter) WriteEntry(e *model.TranscriptEntry) error {
+	_, err := fmt.Fprintf(t.w, "<div class=\"msg %s\"><div class=\"meta\">%s &middot; %s</div>%s</div>\n",
+		html.EscapeString(e.Flow),
+		html.EscapeString(e.Sender),
+		html.EscapeString(formatTime(e.Timestamp, t.header.Location)),
+		html.EscapeString(entryBody(e)),
+	)
+	return err
+}
+
+func (t *htmlWriter) Close() error {
+	_, err := io.WriteString(t.w, "</body></html>\n")
+	return err
+}
@@ -0,0 +1,135 @@
+// Package transcript renders chat transcripts as plain text, JSON lines, HTML or
+// PDF. Writers stream: entries are written as they arrive, so transcripts of any
+// length are produced in constant memory.
+package transcript
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gitlab.com/timkado/api/daisi-rest-postgres/internal/model"
+)
+
+// Supported formats
+const (
+	FormatText  = "txt"
+	FormatJSONL = "jsonl"
+	FormatHTML  = "html"
+	FormatPDF   = "pdf"
+)
+
+// Writer renders one transcript: WriteHeader once, WriteEntry per message, then Close.
+type Writer interface {
+	WriteHeader(h *model.TranscriptHeader) error
+	WriteEntry(e *model.TranscriptEntry) error
+	// Close writes the trailer; it does not close the underlying writer
+	Close() error
+}
+
+// NewWriter returns a writer rendering format to w.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatText:
+		return &textWriter{w: w}, nil
+	case FormatJSONL:
+		return newJSONLWriter(w), nil
+	case FormatHTML:
+		return &htmlWriter{w: w}, nil
+	case FormatPDF:
+		return newPDFWriter(w), nil
+	}
+	return nil, fmt.Errorf("unsupported transcript format %q (txt, jsonl, html, pdf)", format)
+}
+
+// ContentType returns the MIME type of a format.
+func ContentType(format string) string {
+	switch format {
+	case FormatJSONL:
+		return "application/x-ndjson"
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	case FormatPDF:
+		return "application/pdf"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// Valid reports whether format is supported.
+func Valid(format string) bool {
+	switch format {
+	case FormatText, FormatJSONL, FormatHTML, FormatPDF:
+		return true
+	}
+	return false
+}
+
+const timeLayout = "2006-01-02 15:04:05 MST"
+
+// headerLines is the header shared by the text, HTML and PDF renderings
+func headerLines(h *model.TranscriptHeader) []string {
+	contact := h.ContactName
+	if h.ContactPhone != "" && h.ContactPhone != contact {
+		contact = strings.TrimSpace(contact + " (" + h.ContactPhone + ")")
+	}
+	agent := h.AgentName
+	if h.AgentID != "" && h.AgentID != agent {
+		agent = strings.TrimSpace(agent + " (" + h.AgentID + ")")
+	}
+	label := "Contact"
+	if h.IsGroup {
+		label = "Group"
+	}
+
+	period := "all messages"
+	switch {
+	case h.From != nil && h.To != nil:
+		period = formatTime(*h.From, h.Location) + " to " + formatTime(*h.To, h.Location)
+	case h.From != nil:
+		period = "from " + formatTime(*h.From, h.Location)
+	case h.To != nil:
+		period = "until " + formatTime(*h.To, h.Location)
+	}
+
+	return []string{
+		"Chat transcript " + h.ChatID,
+		label + ": " + contact,
+		"Agent: " + agent,
+		"Period: " + period,
+		"Generated: " + formatTime(h.GeneratedAt, h.Location),
+	}
+}
+
+// entryBody is the readable content of a message: its text, prefixed with
+// the attachment or message kind when it is not plain text
+func entryBody(e *model.TranscriptEntry) string {
+	var parts []string
+	switch {
+	case e.Media != nil:
+		label := "[" + e.Media.Type
+		if e.Media.FileName != "" {
+			label += ": " + e.Media.FileName
+		}
+		parts = append(parts, label+"]")
+	case e.Kind != "" && e.Kind != model.MessageKindText:
+		parts = append(parts, "["+e.Kind+"]")
+	}
+	if e.Text != "" {
+		parts = append(parts, e.Text)
+	}
+	if e.Edited {
+		parts = append(parts, "(edited)")
+	}
+	if e.Deleted {
+		parts = append(parts, "(deleted)")
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatTime(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format(timeLayout)
+}
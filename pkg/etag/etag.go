@@ -0,0 +1,62 @@
+// Package etag computes entity tags and evaluates the If-Match and If-None-Match
+// preconditions of RFC 9110.
+package etag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// Of returns the strong entity tag of a representation, quoted ("\"3f2a...\"").
+func Of(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// OfValue returns the entity tag of v's JSON encoding, or "" when v cannot be encoded.
+func OfValue(v interface{}) string {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return Of(body)
+}
+
+// Match evaluates an If-Match header against the current tag with the strong
+// comparison: weak tags never match. "*" matches any current representation.
+func Match(header, current string) bool {
+	return matches(header, current, false)
+}
+
+// NoneMatch reports whether an If-None-Match header lists the current tag, with
+// the weak comparison. A true result means the client's copy is current.
+func NoneMatch(header, current string) bool {
+	return matches(header, current, true)
+}
+
+func matches(header, current string, weak bool) bool {
+	header = strings.TrimSpace(header)
+	if header == "" || current == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+	if weak {
+		current = strings.TrimPrefix(current, "W/")
+	} else if strings.HasPrefix(current, "W/") {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == current {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+// Package phone normalizes phone numbers so the same subscriber compares equal
+// regardless of how upstream formatted it (+62812..., 62812..., 0812..., WA JIDs).
+package phone
+
+import (
+	"strings"
+	"sync"
+)
+
+// DefaultRegion is used for tenants without a configured region.
+const DefaultRegion = "ID"
+
+// countryCodes maps ISO 3166 region codes to their calling codes.
+var countryCodes = map[string]string{
+	"AE": "971", "AU": "61", "BD": "880", "BN": "673", "CN": "86",
+	"DE": "49", "GB": "44", "HK": "852", "ID": "62", "IN": "91",
+	"JP": "81", "KH": "855", "KR": "82", "LA": "856", "MM": "95",
+	"MY": "60", "NL": "31", "PH": "63", "PK": "92", "SA": "966",
+	"SG": "65", "TH": "66", "TL": "670", "TW": "886", "US": "1",
+	"VN": "84",
+}
+
+var (
+	mu            sync.RWMutex
+	defaultRegion = DefaultRegion
+	tenantRegions = map[string]string{}
+)
+
+// Configure sets the default region and the per-tenant overrides (companyId → region).
+// Call once at startup before serving requests.
+func Configure(defaultRgn string, tenants map[string]string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if defaultRgn != "" {
+		defaultRegion = strings.ToUpper(defaultRgn)
+	}
+	tenantRegions = make(map[string]string, len(tenants))
+	for companyId, region := range tenants {
+		tenantRegions[companyId] = strings.ToUpper(region)
+	}
+}
+
+// RegionFor returns the region used to interpret national numbers of a tenant.
+func RegionFor(companyId string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if region, ok := tenantRegions[companyId]; ok {
+		return region
+	}
+	return defaultRegion
+}
+
+// CountryCode returns the calling code of a region, falling back to the default region.
+func CountryCode(region string) string {
+	if cc, ok := countryCodes[strings.ToUpper(region)]; ok {
+		return cc
+	}
+	return countryCodes[DefaultRegion]
+}
+
+// Normalize returns the number in E.164 form ("+6281234567890").
+// National numbers (leading trunk 0 or no prefix) are interpreted in region;
+// WhatsApp JIDs ("62812...@s.whatsapp.net", "62812...:3@s.whatsapp.net") are unwrapped.
+// Returns "" when the input contains no digits.
+func Normalize(raw, region string) string {
+	countryCode := CountryCode(region)
+
+	raw = strings.TrimSpace(unwrapJID(raw))
+	international := strings.HasPrefix(raw, "+")
+	digits := digitsOnly(raw)
+	if digits == "" {
+		return ""
+	}
+
+	switch {
+	case international:
+		return "+" + digits
+	case strings.HasPrefix(digits, "00"):
+		return "+" + digits[2:]
+	case strings.HasPrefix(digits, "0"):
+		return "+" + countryCode + strings.TrimLeft(digits, "0")
+	case strings.HasPrefix(digits, countryCode):
+		return "+" + digits
+	default:
+		return "+" + countryCode + digits
+	}
+}
+
+// Variants returns the formats upstream is known to store for a number:
+// E.164, E.164 without "+", and the national form with trunk 0 when the
+// number belongs to region. Used for exact lookups on unnormalized columns.
+func Variants(raw, region string) []string {
+	e164 := Normalize(raw, region)
+	if e164 == "" {
+		return nil
+	}
+
+	variants := []string{e164, strings.TrimPrefix(e164, "+")}
+	if national, ok := strings.CutPrefix(e164, "+"+CountryCode(region)); ok {
+		variants = append(variants, "0"+national)
+	}
+	if raw = strings.TrimSpace(raw); raw != "" && !contains(variants, raw) {
+		variants = append(variants, raw)
+	}
+	return variants
+}
+
+// Subscriber returns the national significant number (without country code or
+// trunk 0), which appears verbatim in every stored format. Useful as a search
+// pattern for partial matches.
+func Subscriber(raw, region string) string {
+	e164 := Normalize(raw, region)
+	if national, ok := strings.CutPrefix(e164, "+"+CountryCode(region)); ok {
+		return national
+	}
+	return strings.TrimPrefix(e164, "+")
+}
+
+// LooksLikeNumber reports whether a free-text query is probably a phone number:
+// only digits, spaces, dashes, dots, parentheses and a leading +, with at least 6 digits.
+func LooksLikeNumber(q string) bool {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return false
+	}
+	digits := 0
+	for i, r := range q {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return false
+		}
+	}
+	return digits >= 6
+}
+
+// SQLExpr returns a Postgres expression that normalizes column exactly like Normalize
+// for the given region. It only uses immutable functions, so it can back a
+// generated column.
+func SQLExpr(column, region string) string {
+	countryCode := CountryCode(region)
+	unwrapped := "btrim(split_part(split_part(" + column + ", '@', 1), ':', 1))"
+	digits := "regexp_replace(" + unwrapped + ", '[^0-9]', '', 'g')"
+
+	return "CASE" +
+		" WHEN " + digits + " = '' THEN NULL" +
+		" WHEN " + unwrapped + " LIKE '+%' THEN '+' || " + digits +
+		" WHEN " + digits + " LIKE '00%' THEN '+' || substr(" + digits + ", 3)" +
+		" WHEN " + digits + " LIKE '0%' THEN '+" + countryCode + "' || ltrim(" + digits + ", '0')" +
+		" WHEN " + digits + " LIKE '" + countryCode + "%' THEN '+' || " + digits +
+		" ELSE '+" + countryCode + "' || " + digits +
+		" END"
+}
+
+// unwrapJID strips the WhatsApp server and device parts of a JID.
+func unwrapJID(raw string) string {
+	if at := strings.IndexByte(raw, '@'); at >= 0 {
+		raw = raw[:at]
+	}
+	if colon := strings.IndexByte(raw, ':'); colon >= 0 {
+		raw = raw[:colon]
+	}
+	return raw
+}
+
+func digitsOnly(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package phone
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		region string
+		want   string
+	}{
+		{"local with trunk 0", "081234567890", "ID", "+6281234567890"},
+		{"local with separators", "0812-3456 7890", "ID", "+6281234567890"},
+		{"local without trunk 0", "81234567890", "ID", "+6281234567890"},
+		{"country code without plus", "6281234567890", "ID", "+6281234567890"},
+		{"plus prefixed", "+6281234567890", "ID", "+6281234567890"},
+		{"plus prefixed other country", "+6591234567", "ID", "+6591234567"},
+		{"plus prefixed with spaces", " +62 812 3456 7890 ", "ID", "+6281234567890"},
+		{"00 prefixed", "006281234567890", "ID", "+6281234567890"},
+		{"00 prefixed other country", "00601123456789", "ID", "+601123456789"},
+		{"whatsapp jid", "6281234567890@s.whatsapp.net", "ID", "+6281234567890"},
+		{"whatsapp jid with device", "6281234567890:3@s.whatsapp.net", "ID", "+6281234567890"},
+		{"local in other region", "0123456789", "MY", "+60123456789"},
+		{"unknown region uses default", "081234567890", "ZZ", "+6281234567890"},
+		{"empty", "", "ID", ""},
+		{"no digits", "not a number", "ID", ""},
+		{"only plus", "+", "ID", ""},
+		{"jid without number", "@s.whatsapp.net", "ID", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.raw, tt.region); got != tt.want {
+				t.Errorf("Normalize(%q, %q) = %q, want %q", tt.raw, tt.region, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVariants(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want []string
+	}{
+		{"local", "081234567890", []string{"+6281234567890", "6281234567890", "081234567890"}},
+		{"plus prefixed", "+6281234567890", []string{"+6281234567890", "6281234567890", "081234567890"}},
+		{"00 prefixed keeps raw", "006281234567890", []string{"+6281234567890", "6281234567890", "081234567890", "006281234567890"}},
+		{"other country", "+6591234567", []string{"+6591234567", "6591234567"}},
+		{"invalid", "abc", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Variants(tt.raw, "ID"); !slices.Equal(got, tt.want) {
+				t.Errorf("Variants(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriber(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"081234567890", "81234567890"},
+		{"+6281234567890", "81234567890"},
+		{"006281234567890", "81234567890"},
+		{"+6591234567", "6591234567"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Subscriber(tt.raw, "ID"); got != tt.want {
+			t.Errorf("Subscriber(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestLooksLikeNumber(t *testing.T) {
+	tests := []struct {
+		q    string
+		want bool
+	}{
+		{"0812 3456", true},
+		{"+62 (812) 345-678", true},
+		{"12345", false},
+		{"62+812345678", false},
+		{"john 0812345678", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := LooksLikeNumber(tt.q); got != tt.want {
+			t.Errorf("LooksLikeNumber(%q) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestRegionFor(t *testing.T) {
+	Configure("my", map[string]string{"acme": "sg"})
+	t.Cleanup(func() { Configure(DefaultRegion, nil) })
+
+	if got := RegionFor("acme"); got != "SG" {
+		t.Errorf("RegionFor(acme) = %q, want SG", got)
+	}
+	if got := RegionFor("other"); got != "MY" {
+		t.Errorf("RegionFor(other) = %q, want MY", got)
+	}
+}